@@ -31,25 +31,53 @@ type Canal struct {
 
 	cfg *Config
 
-	parser     *parser.Parser
-	master     *masterInfo
-	dumper     *dump.Dumper
-	dumped     bool
-	dumpDoneCh chan struct{}
-	syncer     *replication.BinlogSyncer
+	parser      *parser.Parser
+	master      *masterInfo
+	dumper      *dump.Dumper
+	snapshotter *snapshotDumper
+	dumped      bool
+	dumpDoneCh  chan struct{}
+	syncer      *replication.BinlogSyncer
+	posSaver    *positionSaver
+
+	// chunkedSnapshot is read while syncing the binlog
+	chunkedSnapshot *chunkedSnapshot
 
 	eventHandler EventHandler
+	// the transaction of the events passed to handleEvent
+	trx trxState
 
 	connLock sync.Mutex
 	conn     *client.Conn
+	// addr is the address of the primary, changed by the failover
+	addr string
+
+	// schemaHistory is nil unless SchemaHistory is enabled
+	schemaHistory *schemaHistory
 
 	tableLock          sync.RWMutex
 	tables             map[string]*schema.Table
 	errorTablesGetTime map[string]time.Time
+	// the tables built from the table map events, see UseTableMapMetadata
+	tableMapTables map[string]*tableMapTable
 
 	tableMatchCache   map[string]bool
 	includeTableRegex []*regexp.Regexp
 	excludeTableRegex []*regexp.Regexp
+	// backfillPos are the snapshot positions of the backfilled tables, their
+	// rows are skipped until then
+	backfillPos map[string]mysql.Position
+
+	// the table filter updates applied by the binlog sync
+	filterUpdateLock sync.Mutex
+	filterLock       sync.Mutex
+	filterUpdates    []*tableFilterUpdate
+	filterWaitCtx    context.Context
+	filterWake       context.CancelFunc
+	syncing          bool
+
+	// transformer is nil without Transforms
+	transformer *transformer
 
 	delay atomic.Uint32
 
@@ -61,6 +89,9 @@ type Canal struct {
 var (
 	UnknownTableRetryPeriod = time.Second * time.Duration(10)
 	ErrExcludedTable        = errors.New("excluded table meta")
+	// ErrNotGTIDSync is returned by WaitUntilGTID when canal syncs from a
+	// binlog position, its synced GTID set is unknown.
+	ErrNotGTIDSync = errors.New("canal doesn't sync with GTIDs")
 )
 
 func NewCanal(cfg *Config) (*Canal, error) {
@@ -73,6 +104,7 @@ func NewCanal(cfg *Config) (*Canal, error) {
 		cfg.Dialer = dialer.DialContext
 	}
 	c.cfg = cfg
+	c.addr = cfg.Addr
 
 	c.ctx, c.cancel = context.WithCancel(context.Background())
 
@@ -84,22 +116,43 @@ func NewCanal(cfg *Config) (*Canal, error) {
 		c.errorTablesGetTime = make(map[string]time.Time)
 	}
 	c.master = &masterInfo{logger: c.cfg.Logger}
+	if c.cfg.PositionStore != nil {
+		c.posSaver = &positionSaver{
+			store:     c.cfg.PositionStore,
+			batchSize: c.cfg.PositionSaveBatchSize,
+			interval:  c.cfg.PositionSaveInterval,
+			logger:    c.cfg.Logger,
+		}
+	}
 
 	var err error
 
-	if err = c.prepareDumper(); err != nil {
-		return nil, errors.Trace(err)
+	if c.cfg.SchemaHistory {
+		if c.schemaHistory, err = loadSchemaHistory(c.cfg.SchemaHistoryFile, c.cfg.Logger); err != nil {
+			return nil, errors.Trace(err)
+		}
 	}
 
-	if err = c.prepareSyncer(); err != nil {
-		return nil, errors.Trace(err)
+	// offline there is no server to dump or sync from
+	if c.cfg.BinlogDir == "" {
+		if err = c.prepareDumper(); err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		if err = c.prepareSyncer(); err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		if err := c.checkBinlogRowFormat(); err != nil {
+			return nil, errors.Trace(err)
+		}
 	}
 
-	if err := c.checkBinlogRowFormat(); err != nil {
+	if err := c.initTableFilter(); err != nil {
 		return nil, errors.Trace(err)
 	}
 
-	if err := c.initTableFilter(); err != nil {
+	if c.transformer, err = newTransformer(c.cfg.Transforms); err != nil {
 		return nil, errors.Trace(err)
 	}
 
@@ -107,35 +160,59 @@ func NewCanal(cfg *Config) (*Canal, error) {
 }
 
 func (c *Canal) initTableFilter() error {
-	if n := len(c.cfg.IncludeTableRegex); n > 0 {
-		c.includeTableRegex = make([]*regexp.Regexp, n)
-		for i, val := range c.cfg.IncludeTableRegex {
-			reg, err := regexp.Compile(val)
-			if err != nil {
-				return errors.Trace(err)
-			}
-			c.includeTableRegex[i] = reg
-		}
+	include, err := compileTableRegex(c.cfg.IncludeTableRegex)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	exclude, err := compileTableRegex(c.cfg.ExcludeTableRegex)
+	if err != nil {
+		return errors.Trace(err)
 	}
 
-	if n := len(c.cfg.ExcludeTableRegex); n > 0 {
-		c.excludeTableRegex = make([]*regexp.Regexp, n)
-		for i, val := range c.cfg.ExcludeTableRegex {
-			reg, err := regexp.Compile(val)
-			if err != nil {
-				return errors.Trace(err)
-			}
-			c.excludeTableRegex[i] = reg
+	c.setTableFilter(include, exclude)
+	return nil
+}
+
+func compileTableRegex(exprs []string) ([]*regexp.Regexp, error) {
+	if len(exprs) == 0 {
+		return nil, nil
+	}
+
+	regs := make([]*regexp.Regexp, len(exprs))
+	for i, val := range exprs {
+		reg, err := regexp.Compile(val)
+		if err != nil {
+			return nil, errors.Trace(err)
 		}
+		regs[i] = reg
 	}
+	return regs, nil
+}
+
+// setTableFilter replaces the table filter and clears its cache.
+func (c *Canal) setTableFilter(include []*regexp.Regexp, exclude []*regexp.Regexp) {
+	c.tableLock.Lock()
+	defer c.tableLock.Unlock()
 
+	c.includeTableRegex = include
+	c.excludeTableRegex = exclude
+	c.tableMatchCache = nil
 	if c.includeTableRegex != nil || c.excludeTableRegex != nil {
 		c.tableMatchCache = make(map[string]bool)
 	}
-	return nil
 }
 
 func (c *Canal) prepareDumper() error {
+	if c.cfg.Dump.ChunkSize > 0 {
+		if _, _, err := splitTableName(c.cfg.Dump.WatermarkTable); err != nil {
+			return errors.Annotate(err, "invalid watermark table")
+		}
+	}
+	if c.cfg.Dump.Native || c.cfg.Dump.ChunkSize > 0 {
+		c.snapshotter = newSnapshotDumper(&c.cfg.Dump)
+		return nil
+	}
+
 	var err error
 	dumpPath := c.cfg.Dump.ExecutionPath
 	if len(dumpPath) == 0 {
@@ -198,6 +275,8 @@ func (c *Canal) GetDelay() uint32 {
 
 // Run will first try to dump all data from MySQL master `mysqldump`,
 // then sync from the binlog position in the dump data.
+// If a PositionStore is configured and has a saved position, Run skips the
+// dump and resumes from that position instead.
 // It will run forever until meeting an error or Canal closed.
 func (c *Canal) Run() error {
 	return c.run()
@@ -233,11 +312,19 @@ func (c *Canal) run() error {
 
 	c.master.UpdateTimestamp(uint32(utils.Now().Unix()))
 
+	if err := c.loadPosition(); err != nil {
+		c.cfg.Logger.Error("canal load position err", slog.Any("error", err))
+		return errors.Trace(err)
+	}
+
 	if !c.dumped {
 		c.dumped = true
 
 		err := c.tryDump()
-		close(c.dumpDoneCh)
+		// the chunked snapshot is done later
+		if c.chunkedSnapshot == nil {
+			close(c.dumpDoneCh)
+		}
 
 		if err != nil {
 			c.cfg.Logger.Error("canal dump mysql err", slog.Any("error", err))
@@ -245,7 +332,11 @@ func (c *Canal) run() error {
 		}
 	}
 
-	if err := c.runSyncBinlog(); err != nil {
+	runSync := c.runSyncBinlog
+	if c.cfg.BinlogDir != "" {
+		runSync = c.runOfflineBinlog
+	}
+	if err := runSync(); err != nil {
 		if errors.Cause(err) != context.Canceled {
 			c.cfg.Logger.Error("canal start sync binlog err", slog.Any("error", err))
 			return errors.Trace(err)
@@ -261,7 +352,9 @@ func (c *Canal) Close() {
 	defer c.m.Unlock()
 
 	c.cancel()
-	c.syncer.Close()
+	if c.syncer != nil {
+		c.syncer.Close()
+	}
 	c.connLock.Lock()
 	if c.conn != nil {
 		c.conn.Close()
@@ -269,7 +362,9 @@ func (c *Canal) Close() {
 	}
 	c.connLock.Unlock()
 
-	_ = c.eventHandler.OnPosSynced(nil, c.master.Position(), c.master.GTIDSet(), true)
+	if err := c.syncPosition(nil, c.master.Position(), c.master.GTIDSet(), true); err != nil {
+		c.cfg.Logger.Error("canal sync position on close err", slog.Any("error", err))
+	}
 }
 
 func (c *Canal) WaitDumpDone() <-chan struct{} {
@@ -281,22 +376,36 @@ func (c *Canal) Ctx() context.Context {
 }
 
 func (c *Canal) checkTableMatch(key string) bool {
+	c.tableLock.RLock()
 	// no filter, return true
 	if c.tableMatchCache == nil {
+		c.tableLock.RUnlock()
 		return true
 	}
-
-	c.tableLock.RLock()
 	rst, ok := c.tableMatchCache[key]
 	c.tableLock.RUnlock()
 	if ok {
 		// cache hit
 		return rst
 	}
+
+	// the filter may have changed meanwhile
+	c.tableLock.Lock()
+	defer c.tableLock.Unlock()
+	if c.tableMatchCache == nil {
+		return true
+	}
+	matchFlag := matchTable(c.includeTableRegex, c.excludeTableRegex, key)
+	c.tableMatchCache[key] = matchFlag
+	return matchFlag
+}
+
+// matchTable reports whether the table is included and not excluded.
+func matchTable(include []*regexp.Regexp, exclude []*regexp.Regexp, key string) bool {
 	matchFlag := false
 	// check include
-	if c.includeTableRegex != nil {
-		for _, reg := range c.includeTableRegex {
+	if include != nil {
+		for _, reg := range include {
 			if reg.MatchString(key) {
 				matchFlag = true
 				break
@@ -307,21 +416,24 @@ func (c *Canal) checkTableMatch(key string) bool {
 	}
 
 	// check exclude
-	if matchFlag && c.excludeTableRegex != nil {
-		for _, reg := range c.excludeTableRegex {
+	if matchFlag && exclude != nil {
+		for _, reg := range exclude {
 			if reg.MatchString(key) {
 				matchFlag = false
 				break
 			}
 		}
 	}
-	c.tableLock.Lock()
-	c.tableMatchCache[key] = matchFlag
-	c.tableLock.Unlock()
 	return matchFlag
 }
 
 func (c *Canal) GetTable(db string, table string) (*schema.Table, error) {
+	return c.getTable(db, table, c.master.Position())
+}
+
+// getTable returns the table of a rows event at pos, the version of the
+// schema history at that position if it has one.
+func (c *Canal) getTable(db string, table string, pos mysql.Position) (*schema.Table, error) {
 	key := fmt.Sprintf("%s.%s", db, table)
 	// if table is excluded, return error and skip parsing event or dump
 	if !c.checkTableMatch(key) {
@@ -335,6 +447,22 @@ func (c *Canal) GetTable(db string, table string) (*schema.Table, error) {
 		return t, nil
 	}
 
+	if c.schemaHistory != nil {
+		t, err := c.schemaHistory.table(key, pos)
+		if err != nil {
+			return nil, err
+		}
+		if t != nil {
+			// not cached, the version depends on the position
+			return t, nil
+		}
+	}
+
+	if c.cfg.BinlogDir != "" {
+		// offline the tables can't be fetched
+		return nil, schema.ErrTableNotExist
+	}
+
 	if c.cfg.DiscardNoMetaRowEvent {
 		c.tableLock.RLock()
 		lastTime, ok := c.errorTablesGetTime[key]
@@ -390,6 +518,12 @@ func (c *Canal) GetTable(db string, table string) (*schema.Table, error) {
 	}
 	c.tableLock.Unlock()
 
+	if c.schemaHistory != nil {
+		if err := c.schemaHistory.seed(t, pos); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
 	return t, nil
 }
 
@@ -398,6 +532,7 @@ func (c *Canal) ClearTableCache(db []byte, table []byte) {
 	key := fmt.Sprintf("%s.%s", db, table)
 	c.tableLock.Lock()
 	delete(c.tables, key)
+	delete(c.tableMapTables, key)
 	if c.cfg.DiscardNoMetaRowEvent {
 		delete(c.errorTablesGetTime, key)
 	}
@@ -443,6 +578,15 @@ func (c *Canal) checkBinlogRowFormat() error {
 		return errors.Errorf("binlog must ROW format, but %s now", f)
 	}
 
+	if c.cfg.UseTableMapMetadata {
+		res, err = c.Execute(`SHOW GLOBAL VARIABLES LIKE 'binlog_row_metadata';`)
+		if err != nil {
+			return errors.Trace(err)
+		} else if f, _ := res.GetString(0, 1); !strings.EqualFold(f, "FULL") {
+			return errors.Errorf("binlog_row_metadata must be FULL to use table map metadata, but %q now", f)
+		}
+	}
+
 	return nil
 }
 
@@ -467,28 +611,20 @@ func (c *Canal) prepareSyncer() error {
 		Localhost:               c.cfg.Localhost,
 		EventCacheCount:         c.cfg.EventCacheCount,
 		FillZeroLogPos:          c.cfg.FillZeroLogPos,
+		Metrics:                 c.cfg.Metrics,
 
-		RowsEventDecodeFunc: func(event *replication.RowsEvent, data []byte) error {
-			pos, err := event.DecodeHeader(data)
-			if err != nil {
-				return err
-			}
-
-			key := fmt.Sprintf("%s.%s", string(event.Table.Schema), string(event.Table.Table))
-			if !c.checkTableMatch(key) {
-				return nil
-			}
-
-			return event.DecodeData(pos, data)
-		},
+		RowsEventDecodeFunc: c.decodeRowsEvent,
+	}
+	if c.failoverEnabled() && cfg.MaxReconnectAttempts <= 0 {
+		cfg.MaxReconnectAttempts = defaultFailoverReconnectAttempts
 	}
 
-	if strings.Contains(c.cfg.Addr, "/") {
-		cfg.Host = c.cfg.Addr
+	if strings.Contains(c.addr, "/") {
+		cfg.Host = c.addr
 	} else {
-		host, port, err := net.SplitHostPort(c.cfg.Addr)
+		host, port, err := net.SplitHostPort(c.addr)
 		if err != nil {
-			return errors.Errorf("invalid MySQL address format %s, must host:port", c.cfg.Addr)
+			return errors.Errorf("invalid MySQL address format %s, must host:port", c.addr)
 		}
 		portNumber, err := strconv.ParseUint(port, 10, 16)
 		if err != nil {
@@ -504,11 +640,39 @@ func (c *Canal) prepareSyncer() error {
 	return nil
 }
 
+// decodeRowsEvent decodes the rows of the tables matched by the table
+// filter only, and of the watermark table the chunked snapshot follows.
+func (c *Canal) decodeRowsEvent(event *replication.RowsEvent, data []byte) error {
+	pos, err := event.DecodeHeader(data)
+	if err != nil {
+		return err
+	}
+
+	db, table := string(event.Table.Schema), string(event.Table.Table)
+	if !c.checkTableMatch(db+"."+table) && !c.isWatermarkTable(db, table) {
+		return nil
+	}
+
+	return event.DecodeData(pos, data)
+}
+
+// connOptions returns the options of the connections to the server.
+func (c *Canal) connOptions() []client.Option {
+	var options []client.Option
+	if c.cfg.TLSConfig != nil {
+		options = append(options, func(conn *client.Conn) error {
+			conn.SetTLSConfig(c.cfg.TLSConfig)
+			return nil
+		})
+	}
+	return options
+}
+
 func (c *Canal) connect(options ...client.Option) (*client.Conn, error) {
 	ctx, cancel := context.WithTimeout(c.ctx, time.Second*10)
 	defer cancel()
 
-	return client.ConnectWithDialer(ctx, "", c.cfg.Addr,
+	return client.ConnectWithDialer(ctx, "", c.addr,
 		c.cfg.User, c.cfg.Password, "", c.cfg.Dialer, options...)
 }
 
@@ -516,13 +680,7 @@ func (c *Canal) connect(options ...client.Option) (*client.Conn, error) {
 func (c *Canal) Execute(cmd string, args ...any) (rr *mysql.Result, err error) {
 	c.connLock.Lock()
 	defer c.connLock.Unlock()
-	argF := make([]client.Option, 0)
-	if c.cfg.TLSConfig != nil {
-		argF = append(argF, func(conn *client.Conn) error {
-			conn.SetTLSConfig(c.cfg.TLSConfig)
-			return nil
-		})
-	}
+	argF := c.connOptions()
 
 	retryNum := 3
 	for range retryNum {
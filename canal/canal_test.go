@@ -187,6 +187,18 @@ func (s *canalTestSuite) TestAnalyzeAdvancesSyncedPos() {
 	require.Greater(s.T(), endingPos.Pos, startingPos.Pos)
 }
 
+func (s *canalTestSuite) TestCatchMasterGTID() {
+	<-s.c.WaitDumpDone()
+
+	s.execute("INSERT INTO test.canal_test (name) VALUES (?)", "gtid")
+	err := s.c.CatchMasterGTID(10 * time.Second)
+	require.NoError(s.T(), err)
+
+	gset, err := s.c.GetMasterGTIDSet()
+	require.NoError(s.T(), err)
+	require.True(s.T(), s.c.SyncedGTIDSet().Contain(gset))
+}
+
 func (s *canalTestSuite) TestCanalFilter() {
 	// included
 	sch, err := s.c.GetTable("test", "canal_test")
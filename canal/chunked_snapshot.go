@@ -0,0 +1,497 @@
+package canal
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"github.com/google/uuid"
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/client"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// snapshotProgress is saved in DumpConfig.ProgressFile after every window
+// of the chunked snapshot.
+type snapshotProgress struct {
+	Done   bool                              `toml:"done"`
+	Tables map[string]*tableSnapshotProgress `toml:"tables"`
+}
+
+type tableSnapshotProgress struct {
+	// the primary key of the last row read, as SQL literals
+	LastKey []string `toml:"last_key"`
+	Done    bool     `toml:"done"`
+}
+
+func loadSnapshotProgress(path string) (*snapshotProgress, error) {
+	p := &snapshotProgress{Tables: make(map[string]*tableSnapshotProgress)}
+	if path == "" {
+		return p, nil
+	}
+
+	if _, err := toml.DecodeFile(path, p); err != nil && !os.IsNotExist(err) {
+		return nil, errors.Trace(err)
+	}
+	if p.Tables == nil {
+		p.Tables = make(map[string]*tableSnapshotProgress)
+	}
+	return p, nil
+}
+
+func (p *snapshotProgress) save(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(p); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(writeFileAtomic(path, buf.Bytes()))
+}
+
+// snapshotChunk holds the rows of a chunk read in the current window.
+type snapshotChunk struct {
+	name  string
+	table *schema.Table
+	rows  [][]any
+	// the index of the rows by primary key, the rows changed in the window
+	// are removed
+	keys map[string]int
+
+	lastKey []string
+	last    bool
+}
+
+// chunkedSnapshot reads the tables in chunks of primary key ranges while the
+// binlog is synced, like the DBLog algorithm of Netflix, so no global read
+// lock is needed:
+//
+//  1. a low watermark is written to the watermark table
+//  2. the next chunk of several tables is read in parallel
+//  3. a high watermark is written
+//
+// The rows of the chunks which are changed by the binlog events between the
+// watermarks are dropped, since the events carry newer values. The remaining
+// rows are passed to OnRow as inserts after the transaction of the high
+// watermark in the binlog, so they are ordered with the binlog events. The
+// progress is saved after every window so a restarted snapshot reads the next
+// chunks.
+type chunkedSnapshot struct {
+	c    *Canal
+	pool *client.Pool
+
+	chunkSize int
+	workers   int
+
+	watermarkSchema string
+	watermarkTable  string
+
+	progress *snapshotProgress
+	tables   []snapshotTable
+
+	// the watermarks of the window being read, empty between the windows,
+	// the window is open once the low watermark is met in the binlog
+	low, high  string
+	windowOpen bool
+	chunks     map[string]*snapshotChunk
+
+	// highMet is set once the high watermark is met, the window is emitted
+	// after the transaction holding it
+	highMet bool
+}
+
+func splitTableName(name string) (string, string, error) {
+	seps := strings.Split(name, ".")
+	if len(seps) != 2 {
+		return "", "", errors.Errorf("table %s must be qualified with a database, like db.table", name)
+	}
+	return seps[0], seps[1], nil
+}
+
+// prepareChunkedSnapshot loads the progress of the chunked snapshot, and
+// starts syncing the binlog at the current position if none is set.
+func (c *Canal) prepareChunkedSnapshot() error {
+	progress, err := loadSnapshotProgress(c.cfg.Dump.ProgressFile)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if progress.Done {
+		c.cfg.Logger.Info("skip chunked snapshot, already done")
+		return nil
+	}
+
+	s := &chunkedSnapshot{
+		c:         c,
+		chunkSize: c.cfg.Dump.ChunkSize,
+		workers:   max(c.cfg.Dump.Workers, 1),
+		progress:  progress,
+	}
+	if s.watermarkSchema, s.watermarkTable, err = splitTableName(c.cfg.Dump.WatermarkTable); err != nil {
+		return errors.Trace(err)
+	}
+
+	if _, err = c.Execute(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id INT UNSIGNED NOT NULL PRIMARY KEY, watermark VARCHAR(64) NOT NULL)",
+		s.watermarkTableName())); err != nil {
+		return errors.Trace(err)
+	}
+
+	options := c.connOptions()
+	if c.cfg.Charset != "" {
+		options = append(options, func(conn *client.Conn) error {
+			return conn.SetCharset(c.cfg.Charset)
+		})
+	}
+	// the chunks are read from the primary the canal connects to, which
+	// differs from the configured one after a failover
+	c.connLock.Lock()
+	addr := c.addr
+	c.connLock.Unlock()
+	s.pool, err = client.NewPoolWithOptions(addr, c.cfg.User, c.cfg.Password, "",
+		client.WithPoolLimits(1, s.workers, s.workers),
+		client.WithLogger(c.cfg.Logger),
+		client.WithDialer(c.cfg.Dialer),
+		client.WithConnOptions(options...))
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	conn, err := s.pool.GetConn(c.ctx)
+	if err != nil {
+		s.close()
+		return errors.Trace(err)
+	}
+	tables, err := c.snapshotter.listTables(conn)
+	s.pool.PutConn(conn)
+	if err != nil {
+		s.close()
+		return errors.Trace(err)
+	}
+	for _, t := range tables {
+		if p := progress.Tables[t.db+"."+t.table]; p == nil || !p.Done {
+			s.tables = append(s.tables, t)
+		}
+	}
+
+	pos := c.master.Position()
+	gset := c.master.GTIDSet()
+	if len(pos.Name) == 0 && (gset == nil || gset.String() == "") {
+		if pos, err = c.GetMasterPos(); err != nil {
+			s.close()
+			return errors.Trace(err)
+		}
+		c.master.Update(pos)
+		if err = c.syncPosition(nil, pos, gset, true); err != nil {
+			s.close()
+			return errors.Trace(err)
+		}
+	}
+
+	c.cfg.Logger.Info("start chunked snapshot", slog.Int("tables", len(s.tables)), slog.Any("pos", pos))
+	c.chunkedSnapshot = s
+	return nil
+}
+
+func (s *chunkedSnapshot) close() {
+	s.pool.Close()
+}
+
+func (s *chunkedSnapshot) done() bool {
+	return len(s.tables) == 0
+}
+
+// readWindow writes the low watermark, reads the next chunks and writes the
+// high watermark.
+func (s *chunkedSnapshot) readWindow() error {
+	n := min(s.workers, len(s.tables))
+	tables := s.tables[:n]
+
+	s.low = uuid.NewString()
+	s.high = uuid.NewString()
+	s.windowOpen = false
+	s.chunks = make(map[string]*snapshotChunk, n)
+
+	if err := s.writeWatermark(s.low); err != nil {
+		return errors.Trace(err)
+	}
+
+	chunks := make([]*snapshotChunk, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i, t := range tables {
+		wg.Go(func() {
+			chunks[i], errs[i] = s.readChunk(t)
+		})
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return errors.Annotatef(err, "read chunk of %s.%s", tables[i].db, tables[i].table)
+		}
+		s.chunks[chunks[i].name] = chunks[i]
+	}
+
+	return errors.Trace(s.writeWatermark(s.high))
+}
+
+func (s *chunkedSnapshot) writeWatermark(watermark string) error {
+	_, err := s.c.Execute(fmt.Sprintf("REPLACE INTO %s (id, watermark) VALUES (%d, '%s')",
+		s.watermarkTableName(), s.c.cfg.ServerID, mysql.Escape(watermark)))
+	return errors.Trace(err)
+}
+
+// watermarkTableName returns the quoted name of the watermark table.
+func (s *chunkedSnapshot) watermarkTableName() string {
+	return quoteIdentifier(s.watermarkSchema) + "." + quoteIdentifier(s.watermarkTable)
+}
+
+func (s *chunkedSnapshot) readChunk(t snapshotTable) (*snapshotChunk, error) {
+	c := s.c
+	name := t.db + "." + t.table
+	chunk := &snapshotChunk{name: name, keys: make(map[string]int)}
+
+	tableInfo, err := c.GetTable(t.db, t.table)
+	if err != nil {
+		e := errors.Cause(err)
+		if e == ErrExcludedTable ||
+			e == schema.ErrTableNotExist ||
+			e == schema.ErrMissingTableMeta {
+			chunk.last = true
+			return chunk, nil
+		}
+		return nil, errors.Trace(err)
+	}
+	chunk.table = tableInfo
+
+	if len(tableInfo.PKColumns) == 0 {
+		c.cfg.Logger.Warn("skip table without primary key in chunked snapshot", slog.String("table", name))
+		chunk.last = true
+		return chunk, nil
+	}
+
+	var lastKey []string
+	if p := s.progress.Tables[name]; p != nil {
+		lastKey = p.LastKey
+	}
+	query := s.chunkQuery(tableInfo, lastKey)
+
+	conn, err := s.pool.GetConn(c.ctx)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer s.pool.PutConn(conn)
+
+	if _, err = conn.Execute("SET SESSION time_zone = '+00:00'"); err != nil {
+		return nil, errors.Trace(err)
+	}
+	rr, err := conn.Execute(query)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rr.Close()
+
+	if len(rr.Fields) != len(tableInfo.Columns) {
+		return nil, errors.Errorf("%s has %d columns in the snapshot but %d in the table schema", name, len(rr.Fields), len(tableInfo.Columns))
+	}
+
+	for i, row := range rr.Values {
+		vs := make([]any, len(row))
+		for j := range row {
+			if vs[j], err = c.snapshotValue(rr.Fields[j], &tableInfo.Columns[j], &row[j]); err != nil {
+				return nil, errors.Annotatef(err, "parse column %s of %s", tableInfo.Columns[j].Name, name)
+			}
+		}
+		chunk.keys[rowKey(tableInfo, vs)] = i
+		chunk.rows = append(chunk.rows, vs)
+	}
+
+	chunk.last = len(rr.Values) < s.chunkSize
+	chunk.lastKey = lastKey
+	if n := len(rr.Values); n > 0 {
+		chunk.lastKey = make([]string, len(tableInfo.PKColumns))
+		for i, idx := range tableInfo.PKColumns {
+			chunk.lastKey[i] = sqlLiteral(rr.Fields[idx], &rr.Values[n-1][idx])
+		}
+	}
+
+	return chunk, nil
+}
+
+// chunkQuery returns the query reading the rows after lastKey in primary
+// key order.
+func (s *chunkedSnapshot) chunkQuery(t *schema.Table, lastKey []string) string {
+	pks := make([]string, len(t.PKColumns))
+	for i, idx := range t.PKColumns {
+		pks[i] = quoteIdentifier(t.Columns[idx].Name)
+	}
+	pkList := strings.Join(pks, ", ")
+
+	var conds []string
+	if len(lastKey) > 0 {
+		conds = append(conds, fmt.Sprintf("(%s) > (%s)", pkList, strings.Join(lastKey, ", ")))
+	}
+	if where := s.c.snapshotter.where; where != "" {
+		conds = append(conds, "("+where+")")
+	}
+
+	// the columns are listed for the INVISIBLE ones, which SELECT * omits
+	query := fmt.Sprintf("SELECT %s FROM %s.%s", selectColumns(t), quoteIdentifier(t.Schema), quoteIdentifier(t.Name))
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	return query + fmt.Sprintf(" ORDER BY %s LIMIT %d", pkList, s.chunkSize)
+}
+
+// binaryCollationID is the collation of the binary strings.
+const binaryCollationID = 63
+
+// sqlLiteral returns the SQL literal of a value of the text protocol.
+func sqlLiteral(f *mysql.Field, v *mysql.FieldValue) string {
+	switch v.Type {
+	case mysql.FieldValueTypeNull:
+		return "NULL"
+	case mysql.FieldValueTypeString:
+	default:
+		return v.String()
+	}
+
+	switch {
+	case f.Type == mysql.MYSQL_TYPE_NEWDECIMAL || f.Type == mysql.MYSQL_TYPE_DECIMAL:
+		return string(v.AsString())
+	case f.Charset == binaryCollationID:
+		return "X'" + hex.EncodeToString(v.AsString()) + "'"
+	}
+	return "'" + mysql.Escape(string(v.AsString())) + "'"
+}
+
+// rowKey returns the primary key of the row as a string.
+func rowKey(t *schema.Table, row []any) string {
+	var b strings.Builder
+	for i, idx := range t.PKColumns {
+		if i > 0 {
+			b.WriteByte(0)
+		}
+		if idx >= len(row) {
+			continue
+		}
+		switch v := row[idx].(type) {
+		case []byte:
+			b.Write(v)
+		default:
+			fmt.Fprint(&b, v)
+		}
+	}
+	return b.String()
+}
+
+// observe tracks the watermarks in the binlog and drops the rows of the
+// chunks changed in the window. It returns true when the high watermark is
+// met, the chunks are emitted after its transaction.
+func (s *chunkedSnapshot) observe(ev *replication.BinlogEvent) bool {
+	switch e := ev.Event.(type) {
+	case *replication.RowsEvent:
+		return s.observeRows(e)
+	case *replication.TransactionPayloadEvent:
+		high := false
+		for _, subEvent := range e.Events {
+			if s.observe(subEvent) {
+				high = true
+			}
+		}
+		return high
+	}
+	return false
+}
+
+func (s *chunkedSnapshot) observeRows(e *replication.RowsEvent) bool {
+	if len(e.Rows) == 0 || s.low == "" {
+		return false
+	}
+
+	if s.c.isWatermarkTable(string(e.Table.Schema), string(e.Table.Table)) {
+		// the value after the change
+		row := e.Rows[len(e.Rows)-1]
+		if len(row) < 2 {
+			return false
+		}
+		watermark, _ := row[1].(string)
+		switch {
+		case !s.windowOpen && watermark == s.low:
+			s.windowOpen = true
+		case s.windowOpen && watermark == s.high:
+			s.windowOpen = false
+			s.highMet = true
+			return true
+		}
+		return false
+	}
+
+	if !s.windowOpen {
+		return false
+	}
+	chunk := s.chunks[string(e.Table.Schema)+"."+string(e.Table.Table)]
+	if chunk == nil || chunk.table == nil {
+		return false
+	}
+
+	for _, row := range e.Rows {
+		r := append([]any(nil), row...)
+		(&RowsEvent{Table: chunk.table, Rows: [][]any{r}}).handleUnsigned()
+		if i, ok := chunk.keys[rowKey(chunk.table, r)]; ok {
+			chunk.rows[i] = nil
+		}
+	}
+	return false
+}
+
+// emit passes the rows of the window to OnRow and saves the progress.
+func (s *chunkedSnapshot) emit() error {
+	for _, t := range s.tables[:len(s.chunks)] {
+		chunk := s.chunks[t.db+"."+t.table]
+		for _, row := range chunk.rows {
+			if row == nil {
+				continue
+			}
+			if err := s.c.onRow(newRowsEvent(chunk.table, InsertAction, [][]any{row}, nil, nil)); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		s.progress.Tables[chunk.name] = &tableSnapshotProgress{LastKey: chunk.lastKey, Done: chunk.last}
+	}
+
+	// the finished tables leave the window
+	tables := s.tables[:0]
+	for _, t := range s.tables {
+		if p := s.progress.Tables[t.db+"."+t.table]; p == nil || !p.Done {
+			tables = append(tables, t)
+		}
+	}
+	s.tables = tables
+	s.low, s.high = "", ""
+	s.highMet = false
+	s.chunks = nil
+
+	s.progress.Done = s.done()
+	if err := s.progress.save(s.c.cfg.Dump.ProgressFile); err != nil {
+		return errors.Trace(err)
+	}
+	if s.progress.Done {
+		s.c.cfg.Logger.Info("chunked snapshot done")
+	}
+	return nil
+}
+
+// isWatermarkTable reports whether the table is the watermark table of the
+// chunked snapshot, its rows are not passed to the event handler.
+func (c *Canal) isWatermarkTable(db string, table string) bool {
+	return c.cfg.Dump.ChunkSize > 0 && c.cfg.Dump.WatermarkTable == db+"."+table
+}
@@ -0,0 +1,205 @@
+package canal
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+	"github.com/stretchr/testify/require"
+)
+
+type chunkedSnapshotTestHandler struct {
+	DummyEventHandler
+
+	rows [][]any
+}
+
+func (h *chunkedSnapshotTestHandler) OnRow(e *RowsEvent) error {
+	h.rows = append(h.rows, e.Rows...)
+	return nil
+}
+
+func chunkedSnapshotTestEvent(db, table string, rows ...[]any) *replication.BinlogEvent {
+	return &replication.BinlogEvent{
+		Header: &replication.EventHeader{EventType: replication.UPDATE_ROWS_EVENTv2},
+		Event: &replication.RowsEvent{
+			Table: &replication.TableMapEvent{Schema: []byte(db), Table: []byte(table)},
+			Rows:  rows,
+		},
+	}
+}
+
+func TestChunkedSnapshotWindow(t *testing.T) {
+	h := &chunkedSnapshotTestHandler{}
+	cfg := NewDefaultConfig()
+	cfg.Dump.ChunkSize = 3
+	cfg.Dump.WatermarkTable = "canal.watermark"
+	cfg.Dump.ProgressFile = filepath.Join(t.TempDir(), "progress.toml")
+	c := &Canal{cfg: cfg, eventHandler: h, snapshotter: newSnapshotDumper(&cfg.Dump)}
+
+	table := &schema.Table{
+		Schema:    "test",
+		Name:      "t",
+		Columns:   []schema.TableColumn{{Name: "id", Type: schema.TYPE_NUMBER, IsUnsigned: true}, {Name: "name", Type: schema.TYPE_STRING}},
+		PKColumns: []int{0},
+	}
+	s := &chunkedSnapshot{
+		c:         c,
+		chunkSize: 3,
+		workers:   1,
+		progress:  &snapshotProgress{Tables: make(map[string]*tableSnapshotProgress)},
+		tables:    []snapshotTable{{db: "test", table: "t"}},
+		low:       "low",
+		high:      "high",
+		chunks: map[string]*snapshotChunk{
+			"test.t": {
+				name:    "test.t",
+				table:   table,
+				rows:    [][]any{{uint32(1), "a"}, {uint32(2), "b"}, {uint32(3), "c"}},
+				keys:    map[string]int{"1": 0, "2": 1, "3": 2},
+				lastKey: []string{"3"},
+			},
+		},
+	}
+
+	// changes before the low watermark are already in the chunk
+	require.False(t, s.observe(chunkedSnapshotTestEvent("test", "t", []any{int32(1), "a"}, []any{int32(1), "x"})))
+	require.False(t, s.observe(chunkedSnapshotTestEvent("canal", "watermark", []any{int32(1), "old"}, []any{int32(1), "low"})))
+	// the rows changed in the window are dropped from the chunk
+	require.False(t, s.observe(chunkedSnapshotTestEvent("test", "t", []any{int32(2), "b"}, []any{int32(2), "y"})))
+	require.False(t, s.observe(chunkedSnapshotTestEvent("test", "u", []any{int32(3), "c"})))
+	require.True(t, s.observe(chunkedSnapshotTestEvent("canal", "watermark", []any{int32(1), "low"}, []any{int32(1), "high"})))
+
+	require.NoError(t, s.emit())
+	require.Equal(t, [][]any{{uint32(1), "a"}, {uint32(3), "c"}}, h.rows)
+	require.False(t, s.done())
+	require.Empty(t, s.low)
+
+	progress, err := loadSnapshotProgress(cfg.Dump.ProgressFile)
+	require.NoError(t, err)
+	require.Equal(t, &snapshotProgress{Tables: map[string]*tableSnapshotProgress{"test.t": {LastKey: []string{"3"}}}}, progress)
+	require.Equal(t, "SELECT `id`, `name` FROM `test`.`t` WHERE (`id`) > (3) ORDER BY `id` LIMIT 3", s.chunkQuery(table, progress.Tables["test.t"].LastKey))
+	quoted := &schema.Table{Schema: "te`st", Name: "t`1", Columns: []schema.TableColumn{{Name: "i`d"}}, PKColumns: []int{0}}
+	require.Equal(t, "SELECT `i``d` FROM `te``st`.`t``1` ORDER BY `i``d` LIMIT 3", s.chunkQuery(quoted, nil))
+
+	// the last chunk finishes the snapshot
+	s.low, s.high = "low2", "high2"
+	s.chunks = map[string]*snapshotChunk{"test.t": {name: "test.t", table: table, keys: map[string]int{}, last: true}}
+	require.False(t, s.observe(chunkedSnapshotTestEvent("canal", "watermark", []any{int32(1), "low2"})))
+	require.True(t, s.observe(chunkedSnapshotTestEvent("canal", "watermark", []any{int32(1), "low2"}, []any{int32(1), "high2"})))
+	require.NoError(t, s.emit())
+	require.True(t, s.done())
+
+	progress, err = loadSnapshotProgress(cfg.Dump.ProgressFile)
+	require.NoError(t, err)
+	require.True(t, progress.Done)
+}
+
+// TestChunkedSnapshotAfterTransaction verifies the window is emitted after
+// the transaction holding the high watermark, not between its OnBegin and
+// OnCommit.
+func TestChunkedSnapshotAfterTransaction(t *testing.T) {
+	h := &transactionTestHandler{}
+	c := newTransactionTestCanal(h)
+	c.cfg.Dump.ChunkSize = 3
+	c.cfg.Dump.WatermarkTable = "canal.watermark"
+	c.cfg.Dump.ProgressFile = filepath.Join(t.TempDir(), "progress.toml")
+
+	table := &schema.Table{Schema: "test", Name: "t", Columns: []schema.TableColumn{{Name: "id"}}, PKColumns: []int{0}}
+	s := &chunkedSnapshot{
+		c:          c,
+		progress:   &snapshotProgress{Tables: make(map[string]*tableSnapshotProgress)},
+		tables:     []snapshotTable{{db: "test", table: "t"}},
+		low:        "low",
+		high:       "high",
+		windowOpen: true,
+		chunks: map[string]*snapshotChunk{
+			"test.t": {name: "test.t", table: table, rows: [][]any{{int32(1)}}, keys: map[string]int{"1": 0}, lastKey: []string{"1"}},
+		},
+	}
+	c.chunkedSnapshot = s
+
+	high := chunkedSnapshotTestEvent("canal", "watermark", []any{int32(1), "low"}, []any{int32(1), "high"})
+	high.Header.LogPos = 120
+	for _, ev := range []*replication.BinlogEvent{
+		transactionTestEvent(100, &replication.GTIDEvent{SID: transactionTestSID, GNO: 1}),
+		transactionTestEvent(110, &replication.QueryEvent{Query: []byte("BEGIN")}),
+		high,
+		transactionTestEvent(130, &replication.XIDEvent{}),
+	} {
+		s.observe(ev)
+		require.NoError(t, c.handleEvent(ev))
+		require.NoError(t, c.emitChunkedSnapshot(nil))
+	}
+
+	require.Equal(t, []string{
+		"begin 3e11fa47-71ca-11e1-9e33-c80aa9429562:1 1700000000",
+		"xid", "commit 130", "synced 130",
+		"row 1 ",
+	}, h.calls)
+	require.False(t, s.highMet)
+	require.Empty(t, s.low)
+}
+
+func TestSQLLiteral(t *testing.T) {
+	fields := []*mysql.Field{
+		{Type: mysql.MYSQL_TYPE_LONGLONG},
+		{Type: mysql.MYSQL_TYPE_NEWDECIMAL},
+		{Type: mysql.MYSQL_TYPE_VAR_STRING, Charset: 33},
+		{Type: mysql.MYSQL_TYPE_VAR_STRING, Charset: binaryCollationID},
+	}
+
+	var data mysql.RowData
+	for _, v := range []string{"-12", "12.3400", "it's", "\x00\xff"} {
+		data = append(data, mysql.PutLengthEncodedString([]byte(v))...)
+	}
+	row, err := data.ParseText(fields, nil)
+	require.NoError(t, err)
+
+	var literals []string
+	for i := range row {
+		literals = append(literals, sqlLiteral(fields[i], &row[i]))
+	}
+	require.Equal(t, []string{"-12", "12.3400", `'it\'s'`, "X'00ff'"}, literals)
+}
+
+func TestChunkedSnapshotDecodeWatermarkRows(t *testing.T) {
+	c := newTransactionTestCanal(&DummyEventHandler{})
+	c.cfg.IncludeTableRegex = []string{"test\\..*"}
+	c.cfg.Dump.ChunkSize = 3
+	c.cfg.Dump.WatermarkTable = "canal.watermark"
+	require.NoError(t, c.initTableFilter())
+
+	p := replication.NewBinlogParser()
+	p.SetRowsEventDecodeFunc(c.decodeRowsEvent)
+	parse := func(eventType replication.EventType, e replication.Event) replication.Event {
+		data, err := replication.EncodeEvent(&replication.EventHeader{EventType: eventType}, e, replication.BINLOG_CHECKSUM_ALG_OFF)
+		require.NoError(t, err)
+		be, err := p.Parse(data)
+		require.NoError(t, err)
+		return be.Event
+	}
+	parse(replication.FORMAT_DESCRIPTION_EVENT, replication.NewFormatDescriptionEvent("8.0.36", replication.BINLOG_CHECKSUM_ALG_OFF))
+
+	// the watermark table is decoded though the table filter rejects it
+	for i, name := range []string{"watermark", "other"} {
+		table := parse(replication.TABLE_MAP_EVENT, &replication.TableMapEvent{
+			TableID:     uint64(i + 1),
+			Schema:      []byte("canal"),
+			Table:       []byte(name),
+			ColumnCount: 2,
+			ColumnType:  []byte{mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_VARCHAR},
+			ColumnMeta:  []uint16{0, 64},
+			NullBitmap:  []byte{0},
+		}).(*replication.TableMapEvent)
+		rows := [][]any{{int32(1), "low"}}
+		e := parse(replication.WRITE_ROWS_EVENTv2, replication.NewRowsEvent(replication.WRITE_ROWS_EVENTv2, table, rows)).(*replication.RowsEvent)
+		if name == "watermark" {
+			require.Equal(t, rows, e.Rows)
+		} else {
+			require.Empty(t, e.Rows)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package canal
 
 import (
+	"context"
 	"crypto/tls"
 	"log/slog"
 	"math/rand"
@@ -48,6 +49,34 @@ type DumpConfig struct {
 
 	// Set extra options
 	ExtraOptions []string `toml:"extra_options"`
+
+	// Native takes the snapshot with SELECT in a consistent snapshot
+	// transaction instead of running mysqldump, the binlog position is read
+	// under FLUSH TABLES WITH READ LOCK unless SkipMasterData is set. The rows
+	// are passed to OnRow with the same types as the rows of the binlog.
+	// ExecutionPath, MaxAllowedPacketMB, Protocol and ExtraOptions are ignored.
+	Native bool `toml:"native"`
+
+	// ChunkSize enables the chunked snapshot when greater than 0. The tables
+	// are read in chunks of that many rows in primary key order while the
+	// binlog is synced, without global read lock: the rows of a chunk are
+	// passed to OnRow once the binlog reaches the end of the chunk read, minus
+	// the rows changed by the binlog events meanwhile. Tables without primary
+	// key are skipped. WaitDumpDone is closed once all the tables are read.
+	ChunkSize int `toml:"chunk_size"`
+
+	// Workers is the number of tables whose chunks are read in parallel by the
+	// chunked snapshot, the default is 1.
+	Workers int `toml:"workers"`
+
+	// WatermarkTable is the table the chunked snapshot writes its watermarks
+	// to, like `db.canal_watermark`. It is created if it doesn't exist.
+	WatermarkTable string `toml:"watermark_table"`
+
+	// ProgressFile saves the last chunk read of each table, so that a
+	// restarted chunked snapshot continues with the next chunks. Use it with
+	// a PositionStore to resume the binlog sync too.
+	ProgressFile string `toml:"progress_file"`
 }
 
 type Config struct {
@@ -91,6 +120,20 @@ type Config struct {
 	// whether disable re-sync for broken connection
 	DisableRetrySync bool `toml:"disable_retry_sync"`
 
+	// FailoverAddrs are the addresses of the servers which may become the
+	// primary. When the sync from Addr fails, the writable server with the
+	// highest executed GTID set is the new primary, and the sync continues
+	// from the synced GTID set; the server must have all the synced
+	// transactions. DiscoverCandidates returns the addresses instead if set.
+	// It requires syncing with GTIDs, and MaxReconnectAttempts is 3 if not
+	// set so that the sync from a dead primary fails.
+	FailoverAddrs      []string                                    `toml:"failover_addrs"`
+	DiscoverCandidates func(ctx context.Context) ([]string, error) `toml:"-"`
+
+	// FailoverTimeout is how long to look for a new primary, one minute if
+	// zero.
+	FailoverTimeout time.Duration `toml:"failover_timeout"`
+
 	// whether the function WaitUntilPos() can use FLUSH BINARY LOGS
 	// to ensure we advance past a position. This should not strictly be required,
 	// and requires additional privileges.
@@ -114,6 +157,63 @@ type Config struct {
 	// if you table contain large columns, you can decrease this value to avoid OOM.
 	EventCacheCount int
 
+	// ParallelWorkers enables applying transactions on that many goroutines
+	// when greater than 1. The events of a transaction are still passed to
+	// OnGTID, OnRowsQueryEvent, OnRow and OnXID in order on one goroutine, but
+	// transactions which don't depend on each other according to the logical
+	// clock of MySQL or the group commits of MariaDB are handled concurrently.
+	// OnPosSynced is called with the position up to which all transactions are
+	// handled. DDL and other events are handled once all transactions before
+	// them are done.
+	ParallelWorkers int `toml:"parallel_workers"`
+
+	// PositionStore saves the synced position and GTID set after the
+	// position is passed to OnPosSynced, and Run resumes from the saved
+	// position unless RunFrom or StartFromGTID is used.
+	PositionStore PositionStore `toml:"-"`
+
+	// PositionSaveBatchSize and PositionSaveInterval batch the saves to the
+	// PositionStore: the position is saved after that many transactions or
+	// once the interval has elapsed, whichever comes first, also when no
+	// other transaction comes. Positions at rotate and DDL events, after the
+	// dump and on Close are always saved.
+	// If both are zero every position is saved.
+	PositionSaveBatchSize int           `toml:"position_save_batch_size"`
+	PositionSaveInterval  time.Duration `toml:"position_save_interval"`
+
+	// SchemaHistory decodes the rows with the tables in effect at their
+	// binlog position instead of the current tables: a table is fetched from
+	// the server once, then the DDL of the binlog is applied to it.
+	// SchemaHistoryFile saves the history, so that the binlog before a DDL
+	// can be synced again after a restart.
+	SchemaHistory     bool   `toml:"schema_history"`
+	SchemaHistoryFile string `toml:"schema_history_file"`
+
+	// UseTableMapMetadata builds the tables of the rows events from the
+	// column metadata of their table map events instead of fetching them
+	// with SHOW COLUMNS, so the tables follow the DDL without extra
+	// privileges. It requires binlog_row_metadata=FULL (MySQL 8.0.1+,
+	// MariaDB 10.5+). Without PRIMARY KEY metadata the tables have no
+	// primary key; other indexes are not logged.
+	UseTableMapMetadata bool `toml:"use_table_map_metadata"`
+
+	// BinlogDir reads the binlog files of the directory, like the files
+	// saved by replication.BinlogSyncer.StartBackup, instead of syncing from
+	// the server. The files are read in order from the position passed to
+	// RunFrom, or from the first file, and Run returns at the end of the
+	// last file. The tables must come from the schema history, the table
+	// map metadata or SetTableCache, as no server is connected; the dump is
+	// skipped.
+	BinlogDir string `toml:"binlog_dir"`
+
+	// Transforms remove, hash or mask columns and filter the rows of the
+	// tables before they are passed to OnRow, see TransformConfig.
+	Transforms []TransformConfig `toml:"transform"`
+
+	// Metrics receives the metrics of the events, the lag, the reconnects and
+	// the time taken by the event handler, see MetricsCollector.
+	Metrics Metrics `toml:"-"`
+
 	// FillZeroLogPos enables dynamic LogPos calculation for MariaDB.
 	// When enabled, automatically adds BINLOG_SEND_ANNOTATE_ROWS_EVENT flag
 	// to ensure correct position calculation in MariaDB 11.4+.
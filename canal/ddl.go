@@ -0,0 +1,231 @@
+package canal
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// DDLType is the kind of a DDL statement.
+type DDLType string
+
+// The kinds of DDL statements.
+const (
+	DDLCreateDatabase DDLType = "create database"
+	DDLAlterDatabase  DDLType = "alter database"
+	DDLDropDatabase   DDLType = "drop database"
+	DDLCreateTable    DDLType = "create table"
+	DDLAlterTable     DDLType = "alter table"
+	DDLRenameTable    DDLType = "rename table"
+	DDLDropTable      DDLType = "drop table"
+	DDLTruncateTable  DDLType = "truncate table"
+	DDLCreateIndex    DDLType = "create index"
+	DDLDropIndex      DDLType = "drop index"
+	DDLCreateView     DDLType = "create view"
+	DDLDropView       DDLType = "drop view"
+	DDLCreateTrigger  DDLType = "create trigger"
+	DDLDropTrigger    DDLType = "drop trigger"
+)
+
+// DDLEvent is a DDL statement on one database or table. A statement on
+// several tables, like DROP TABLE a, b, is one event per table.
+type DDLEvent struct {
+	Type DDLType
+
+	// Schema is the database, Table is empty for the database statements
+	// and DROP TRIGGER.
+	Schema string
+	Table  string
+
+	// NewSchema and NewTable are the new names of a renamed table, by
+	// RENAME TABLE or ALTER TABLE ... RENAME.
+	NewSchema string
+	NewTable  string
+
+	// Name is the index of CREATE INDEX and DROP INDEX, or the trigger of
+	// CREATE TRIGGER and DROP TRIGGER.
+	Name string
+
+	// Stmt is the parsed statement, nil for the triggers which the parser
+	// doesn't support.
+	Stmt ast.StmtNode
+
+	Query   *replication.QueryEvent
+	Header  *replication.EventHeader
+	NextPos mysql.Position
+}
+
+// String implements fmt.Stringer interface.
+func (e *DDLEvent) String() string {
+	s := fmt.Sprintf("%s %s", e.Type, e.Schema)
+	if e.Table != "" {
+		s += "." + e.Table
+	}
+	if e.NewTable != "" {
+		s += fmt.Sprintf(" to %s.%s", e.NewSchema, e.NewTable)
+	}
+	if e.Name != "" {
+		s += " " + e.Name
+	}
+	return s
+}
+
+// DDLHandler is an optional interface of the EventHandler to get the DDL
+// statements with their kind and tables. OnDDLEvent is called after
+// OnTableChanged and OnDDL.
+type DDLHandler interface {
+	OnDDLEvent(e *DDLEvent) error
+}
+
+// UnparsedQueryHandler is an optional interface of the EventHandler to get
+// the query events which the parser can't parse, instead of skipping them.
+type UnparsedQueryHandler interface {
+	OnUnparsedQuery(header *replication.EventHeader, e *replication.QueryEvent, err error) error
+}
+
+// newDDLEvents returns the DDL events of a statement, the tables without
+// database are in db.
+func newDDLEvents(stmt ast.StmtNode, db string) []*DDLEvent {
+	table := func(tp DDLType, t *ast.TableName) *DDLEvent {
+		e := &DDLEvent{Type: tp, Schema: t.Schema.O, Table: t.Name.O, Stmt: stmt}
+		if e.Schema == "" {
+			e.Schema = db
+		}
+		return e
+	}
+	database := func(tp DDLType, name string) []*DDLEvent {
+		if name == "" {
+			name = db
+		}
+		return []*DDLEvent{{Type: tp, Schema: name, Stmt: stmt}}
+	}
+
+	switch st := stmt.(type) {
+	case *ast.CreateDatabaseStmt:
+		return database(DDLCreateDatabase, st.Name.O)
+	case *ast.AlterDatabaseStmt:
+		return database(DDLAlterDatabase, st.Name.O)
+	case *ast.DropDatabaseStmt:
+		return database(DDLDropDatabase, st.Name.O)
+	case *ast.CreateTableStmt:
+		return []*DDLEvent{table(DDLCreateTable, st.Table)}
+	case *ast.AlterTableStmt:
+		e := table(DDLAlterTable, st.Table)
+		for _, spec := range st.Specs {
+			if spec.Tp == ast.AlterTableRenameTable {
+				renamed := table(DDLAlterTable, spec.NewTable)
+				e.NewSchema, e.NewTable = renamed.Schema, renamed.Table
+			}
+		}
+		return []*DDLEvent{e}
+	case *ast.RenameTableStmt:
+		events := make([]*DDLEvent, 0, len(st.TableToTables))
+		for _, tt := range st.TableToTables {
+			e := table(DDLRenameTable, tt.OldTable)
+			renamed := table(DDLRenameTable, tt.NewTable)
+			e.NewSchema, e.NewTable = renamed.Schema, renamed.Table
+			events = append(events, e)
+		}
+		return events
+	case *ast.DropTableStmt:
+		tp := DDLDropTable
+		if st.IsView {
+			tp = DDLDropView
+		}
+		events := make([]*DDLEvent, 0, len(st.Tables))
+		for _, t := range st.Tables {
+			events = append(events, table(tp, t))
+		}
+		return events
+	case *ast.TruncateTableStmt:
+		return []*DDLEvent{table(DDLTruncateTable, st.Table)}
+	case *ast.CreateIndexStmt:
+		e := table(DDLCreateIndex, st.Table)
+		e.Name = st.IndexName
+		return []*DDLEvent{e}
+	case *ast.DropIndexStmt:
+		e := table(DDLDropIndex, st.Table)
+		e.Name = st.IndexName
+		return []*DDLEvent{e}
+	case *ast.CreateViewStmt:
+		return []*DDLEvent{table(DDLCreateView, st.ViewName)}
+	}
+	return nil
+}
+
+var (
+	identifierExp    = "(`(?:[^`]|``)+`|[\\w$]+)"
+	qualifiedNameExp = identifierExp + `(?:\s*\.\s*` + identifierExp + `)?`
+
+	createTriggerExp = regexp.MustCompile(`(?is)^\s*CREATE\s+(?:DEFINER\s*=\s*\S+\s+)?TRIGGER\s+(?:IF\s+NOT\s+EXISTS\s+)?` +
+		qualifiedNameExp + `\s+(?:BEFORE|AFTER)\s+\w+\s+ON\s+` + qualifiedNameExp)
+	dropTriggerExp = regexp.MustCompile(`(?is)^\s*DROP\s+TRIGGER\s+(?:IF\s+EXISTS\s+)?` + qualifiedNameExp)
+)
+
+func unquoteIdentifier(s string) string {
+	if strings.HasPrefix(s, "`") {
+		return strings.ReplaceAll(s[1:len(s)-1], "``", "`")
+	}
+	return s
+}
+
+// qualifiedName returns the database and the name of `db`.`name` or `name`.
+func qualifiedName(first, second, db string) (string, string) {
+	if second == "" {
+		return db, unquoteIdentifier(first)
+	}
+	return unquoteIdentifier(first), unquoteIdentifier(second)
+}
+
+// newUnparsedDDLEvents returns the DDL events of the statements which the
+// parser doesn't support, or nil.
+func newUnparsedDDLEvents(query string, db string) []*DDLEvent {
+	if m := createTriggerExp.FindStringSubmatch(query); m != nil {
+		triggerDB, trigger := qualifiedName(m[1], m[2], db)
+		tableDB, table := qualifiedName(m[3], m[4], triggerDB)
+		return []*DDLEvent{{Type: DDLCreateTrigger, Schema: tableDB, Table: table, Name: trigger}}
+	}
+	if m := dropTriggerExp.FindStringSubmatch(query); m != nil {
+		triggerDB, trigger := qualifiedName(m[1], m[2], db)
+		return []*DDLEvent{{Type: DDLDropTrigger, Schema: triggerDB, Name: trigger}}
+	}
+	return nil
+}
+
+// onDDLEvents passes the events to the DDLHandler.
+func (c *Canal) onDDLEvents(header *replication.EventHeader, pos mysql.Position, e *replication.QueryEvent, events []*DDLEvent) error {
+	h, ok := c.eventHandler.(DDLHandler)
+	if !ok {
+		return nil
+	}
+	for _, ev := range events {
+		ev.Query, ev.Header, ev.NextPos = e, header, pos
+		if err := h.OnDDLEvent(ev); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// handleUnparsedQuery handles a query event the parser can't parse, it
+// returns whether the query is a DDL statement.
+func (c *Canal) handleUnparsedQuery(header *replication.EventHeader, pos mysql.Position, e *replication.QueryEvent, parseErr error) (bool, error) {
+	if events := newUnparsedDDLEvents(string(e.Query), string(e.Schema)); len(events) > 0 {
+		return true, c.onDDLEvents(header, pos, e, events)
+	}
+
+	if h, ok := c.eventHandler.(UnparsedQueryHandler); ok {
+		return false, errors.Trace(h.OnUnparsedQuery(header, e, parseErr))
+	}
+	// The parser does not understand all syntax.
+	// For example, it won't parse [CREATE|DROP] TRIGGER statements.
+	c.cfg.Logger.Error("error parsing query, will skip this event", slog.String("query", string(e.Query)), slog.Any("error", parseErr))
+	return false, nil
+}
@@ -0,0 +1,121 @@
+package canal
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/pingcap/tidb/pkg/parser"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+	"github.com/stretchr/testify/require"
+)
+
+type ddlTestHandler struct {
+	DummyEventHandler
+
+	events   []*DDLEvent
+	unparsed []string
+}
+
+func (h *ddlTestHandler) OnDDLEvent(e *DDLEvent) error {
+	h.events = append(h.events, e)
+	return nil
+}
+
+func (h *ddlTestHandler) OnUnparsedQuery(_ *replication.EventHeader, e *replication.QueryEvent, err error) error {
+	h.unparsed = append(h.unparsed, string(e.Query))
+	return nil
+}
+
+func TestNewDDLEvents(t *testing.T) {
+	cases := []struct {
+		query    string
+		expected []string
+	}{
+		{"CREATE DATABASE d", []string{"create database d"}},
+		{"ALTER DATABASE CHARACTER SET utf8mb4", []string{"alter database test"}},
+		{"DROP DATABASE IF EXISTS d", []string{"drop database d"}},
+		{"CREATE TABLE d.t (id INT)", []string{"create table d.t"}},
+		{"CREATE TABLE t LIKE d.u", []string{"create table test.t"}},
+		{"ALTER TABLE t ADD COLUMN c INT", []string{"alter table test.t"}},
+		{"ALTER TABLE t ADD COLUMN c INT, RENAME TO d.u", []string{"alter table test.t to d.u"}},
+		{"RENAME TABLE t TO u, d.a TO e.b", []string{"rename table test.t to test.u", "rename table d.a to e.b"}},
+		{"DROP TABLE t, d.u", []string{"drop table test.t", "drop table d.u"}},
+		{"TRUNCATE TABLE t", []string{"truncate table test.t"}},
+		{"CREATE UNIQUE INDEX idx ON t (c)", []string{"create index test.t idx"}},
+		{"DROP INDEX idx ON d.t", []string{"drop index d.t idx"}},
+		{"CREATE OR REPLACE VIEW v AS SELECT 1", []string{"create view test.v"}},
+		{"DROP VIEW v, d.w", []string{"drop view test.v", "drop view d.w"}},
+		{"INSERT INTO t VALUES (1)", nil},
+	}
+
+	p := parser.New()
+	for _, tc := range cases {
+		stmt, err := p.ParseOneStmt(tc.query, "", "")
+		require.NoError(t, err, tc.query)
+
+		var events []string
+		for _, e := range newDDLEvents(stmt, "test") {
+			require.Equal(t, stmt, e.Stmt)
+			events = append(events, e.String())
+		}
+		require.Equal(t, tc.expected, events, tc.query)
+	}
+}
+
+func TestNewUnparsedDDLEvents(t *testing.T) {
+	cases := []struct {
+		query    string
+		expected []string
+	}{
+		{"CREATE TRIGGER tr BEFORE INSERT ON t FOR EACH ROW SET NEW.c = 1", []string{"create trigger test.t tr"}},
+		{"CREATE DEFINER=`root`@`%` TRIGGER `d`.`tr` AFTER UPDATE ON `u` FOR EACH ROW BEGIN END", []string{"create trigger d.u tr"}},
+		{"create trigger tr before delete on d.t for each row begin end", []string{"create trigger d.t tr"}},
+		{"DROP TRIGGER IF EXISTS `d`.`tr`", []string{"drop trigger d tr"}},
+		{"DROP TRIGGER tr", []string{"drop trigger test tr"}},
+		{"CREATE PROCEDURE p() BEGIN END", nil},
+	}
+
+	for _, tc := range cases {
+		var events []string
+		for _, e := range newUnparsedDDLEvents(tc.query, "test") {
+			require.Nil(t, e.Stmt)
+			events = append(events, e.String())
+		}
+		require.Equal(t, tc.expected, events, tc.query)
+	}
+}
+
+func TestCanalDDLEvents(t *testing.T) {
+	h := &ddlTestHandler{}
+	c := newTransactionTestCanal(h)
+
+	query := func(pos uint32, q string) {
+		require.NoError(t, c.handleEvent(transactionTestEvent(pos, &replication.QueryEvent{
+			Schema: []byte("test"),
+			Query:  []byte(q),
+		})))
+	}
+
+	query(100, "RENAME TABLE t TO u")
+	query(200, "CREATE DATABASE d")
+	query(300, "CREATE TRIGGER tr BEFORE INSERT ON t FOR EACH ROW SET NEW.c = 1")
+	query(400, "CREATE EVENT ev ON SCHEDULE EVERY 1 DAY DO SELECT 1")
+
+	var events []string
+	for _, e := range h.events {
+		events = append(events, fmt.Sprintf("%s %d", e, e.NextPos.Pos))
+	}
+	require.Equal(t, []string{
+		"rename table test.t to test.u 100",
+		"create database d 200",
+		"create trigger test.t tr 300",
+	}, events)
+	require.IsType(t, &ast.RenameTableStmt{}, h.events[0].Stmt)
+	require.Equal(t, "RENAME TABLE t TO u", string(h.events[0].Query.Query))
+	require.Equal(t, []string{"CREATE EVENT ev ON SCHEDULE EVERY 1 DAY DO SELECT 1"}, h.unparsed)
+
+	// the trigger is saved, the unparsed query is not
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000001", Pos: 300}, c.master.Position())
+}
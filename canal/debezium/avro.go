@@ -0,0 +1,113 @@
+package debezium
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// AvroSchema returns the Avro schema of a schema, like the one registered by
+// the Avro converter of Kafka Connect for the Debezium topics.
+func AvroSchema(s *Schema) ([]byte, error) {
+	if s.Type != "struct" {
+		return nil, errors.Errorf("Avro schema of a %s, a struct is expected", s.Type)
+	}
+	a := avroConverter{defined: make(map[string]bool)}
+	return json.Marshal(a.schema(s))
+}
+
+type avroConverter struct {
+	// the named records are defined once, and referred by their full name
+	defined map[string]bool
+}
+
+func (a *avroConverter) schema(s *Schema) any {
+	var avro map[string]any
+	switch s.Type {
+	case "struct":
+		name := avroFullName(s.Name)
+		if a.defined[name] {
+			return name
+		}
+		a.defined[name] = true
+
+		fields := make([]any, 0, len(s.Fields))
+		for _, f := range s.Fields {
+			field := map[string]any{"name": avroName(f.Field), "type": a.optional(f)}
+			if f.Optional {
+				field["default"] = nil
+			} else if f.Default != nil {
+				field["default"] = f.Default
+			}
+			fields = append(fields, field)
+		}
+		avro = map[string]any{"type": "record", "name": name, "fields": fields}
+	case "int8", "int16":
+		avro = map[string]any{"type": "int", "connect.type": s.Type}
+	case "int32":
+		avro = map[string]any{"type": "int"}
+	case "int64":
+		avro = map[string]any{"type": "long"}
+	case "float32":
+		avro = map[string]any{"type": "float"}
+	case "float64":
+		avro = map[string]any{"type": "double"}
+	default:
+		// boolean, string and bytes
+		avro = map[string]any{"type": s.Type}
+	}
+
+	if s.Type != "struct" && s.Name != "" {
+		avro["connect.name"] = s.Name
+		if s.Version > 0 {
+			avro["connect.version"] = s.Version
+		}
+		if len(s.Parameters) > 0 {
+			avro["connect.parameters"] = s.Parameters
+		}
+		if s.Name == decimalName {
+			avro["logicalType"] = "decimal"
+			avro["scale"], _ = strconv.Atoi(s.Parameters["scale"])
+			avro["precision"], _ = strconv.Atoi(s.Parameters["connect.decimal.precision"])
+		}
+	}
+	if len(avro) == 1 {
+		return avro["type"]
+	}
+	return avro
+}
+
+// optional returns the type of a field, a union with null if it's optional.
+func (a *avroConverter) optional(s *Schema) any {
+	tp := a.schema(s)
+	if s.Optional {
+		return []any{"null", tp}
+	}
+	return tp
+}
+
+// avroName replaces the characters not allowed in the Avro names with "_".
+func avroName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if c != '_' && !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') && !(i > 0 && '0' <= c && c <= '9') {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// avroFullName returns the Avro full name of a schema name, the unnamed
+// structs are ConnectDefault like Kafka Connect.
+func avroFullName(name string) string {
+	if name == "" {
+		return "ConnectDefault"
+	}
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = avroName(part)
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,56 @@
+package debezium
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAvroSchema(t *testing.T) {
+	s, err := NewSerializer(Config{ServerName: "db-1"})
+	require.NoError(t, err)
+
+	data, err := AvroSchema(s.EnvelopeSchema(testTable()))
+	require.NoError(t, err)
+
+	var avro struct {
+		Type   string
+		Name   string
+		Fields []struct {
+			Name    string
+			Type    json.RawMessage
+			Default any
+		}
+	}
+	require.NoError(t, json.Unmarshal(data, &avro))
+	require.Equal(t, "record", avro.Type)
+	require.Equal(t, "db_1.shop.orders.Envelope", avro.Name)
+	require.Equal(t, "before", avro.Fields[0].Name)
+	require.Equal(t, "after", avro.Fields[1].Name)
+	require.Equal(t, "op", avro.Fields[3].Name)
+
+	// the value record is defined in before and referred in after
+	require.Contains(t, string(avro.Fields[0].Type), `"name":"db_1.shop.orders.Value"`)
+	require.JSONEq(t, `["null","db_1.shop.orders.Value"]`, string(avro.Fields[1].Type))
+	require.JSONEq(t, `"string"`, string(avro.Fields[3].Type))
+
+	var before []json.RawMessage
+	require.NoError(t, json.Unmarshal(avro.Fields[0].Type, &before))
+	var value struct {
+		Fields []struct {
+			Name string
+			Type json.RawMessage
+		}
+	}
+	require.NoError(t, json.Unmarshal(before[1], &value))
+	require.JSONEq(t, `"long"`, string(value.Fields[0].Type))
+	require.JSONEq(t, `["null",{
+		"type":"bytes","logicalType":"decimal","precision":10,"scale":2,
+		"connect.name":"org.apache.kafka.connect.data.Decimal","connect.version":1,
+		"connect.parameters":{"scale":"2","connect.decimal.precision":"10"}
+	}]`, string(value.Fields[1].Type))
+
+	_, err = AvroSchema(&Schema{Type: "string"})
+	require.Error(t, err)
+}
@@ -0,0 +1,287 @@
+// Package debezium converts the rows events of canal to the change events of
+// the Debezium MySQL connector, so the tools reading Debezium topics can read
+// the changes replicated by canal.
+//
+// https://debezium.io/documentation/reference/stable/connectors/mysql.html#mysql-events
+package debezium
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/schema"
+	"github.com/go-mysql-org/go-mysql/utils"
+)
+
+// DecimalHandlingMode is how DECIMAL columns are converted, like the
+// decimal.handling.mode option of Debezium.
+type DecimalHandlingMode string
+
+const (
+	// DecimalPrecise converts decimals to the Decimal logical type of Kafka
+	// Connect, the unscaled value in big-endian two's complement bytes.
+	DecimalPrecise DecimalHandlingMode = "precise"
+	DecimalDouble  DecimalHandlingMode = "double"
+	DecimalString  DecimalHandlingMode = "string"
+)
+
+// BigintUnsignedHandlingMode is how BIGINT UNSIGNED columns are converted,
+// like the bigint.unsigned.handling.mode option of Debezium.
+type BigintUnsignedHandlingMode string
+
+const (
+	// BigintUnsignedLong converts them to int64, the values over
+	// math.MaxInt64 overflow.
+	BigintUnsignedLong BigintUnsignedHandlingMode = "long"
+	// BigintUnsignedPrecise converts them to decimals with scale 0.
+	BigintUnsignedPrecise BigintUnsignedHandlingMode = "precise"
+)
+
+// BinaryHandlingMode is how binary columns are converted, like the
+// binary.handling.mode option of Debezium.
+type BinaryHandlingMode string
+
+const (
+	// BinaryBytes keeps the bytes, they are base64 encoded in JSON.
+	BinaryBytes  BinaryHandlingMode = "bytes"
+	BinaryBase64 BinaryHandlingMode = "base64"
+	BinaryHex    BinaryHandlingMode = "hex"
+)
+
+// Config is the config of a Serializer. The modes default to precise, long
+// and bytes like Debezium.
+type Config struct {
+	// ServerName is the logical name of the server, the prefix of the topics
+	// and the schema names, like topic.prefix of Debezium.
+	ServerName string `toml:"server_name"`
+	// ServerID is reported for the rows of a dump, the binlog events report
+	// the server ID in their header.
+	ServerID uint32 `toml:"server_id"`
+	// Version is reported as the connector version in the source block.
+	Version string `toml:"version"`
+
+	DecimalHandlingMode        DecimalHandlingMode        `toml:"decimal_handling_mode"`
+	BigintUnsignedHandlingMode BigintUnsignedHandlingMode `toml:"bigint_unsigned_handling_mode"`
+	BinaryHandlingMode         BinaryHandlingMode         `toml:"binary_handling_mode"`
+
+	// TimestampStringLocation must be the TimestampStringLocation of the
+	// canal config. Without ParseTime the TIMESTAMP values are strings in this
+	// location, it's time.Local if nil.
+	TimestampStringLocation *time.Location `toml:"-"`
+
+	// IncludeSchema adds the schema block to the events, like the
+	// schemas.enable option of the Kafka Connect JSON converter.
+	IncludeSchema bool `toml:"include_schema"`
+}
+
+// Serializer converts rows events to Debezium change events.
+type Serializer struct {
+	cfg Config
+}
+
+// NewSerializer creates a Serializer.
+func NewSerializer(cfg Config) (*Serializer, error) {
+	switch cfg.DecimalHandlingMode {
+	case "":
+		cfg.DecimalHandlingMode = DecimalPrecise
+	case DecimalPrecise, DecimalDouble, DecimalString:
+	default:
+		return nil, errors.Errorf("unknown decimal handling mode %q", cfg.DecimalHandlingMode)
+	}
+	switch cfg.BigintUnsignedHandlingMode {
+	case "":
+		cfg.BigintUnsignedHandlingMode = BigintUnsignedLong
+	case BigintUnsignedLong, BigintUnsignedPrecise:
+	default:
+		return nil, errors.Errorf("unknown bigint unsigned handling mode %q", cfg.BigintUnsignedHandlingMode)
+	}
+	switch cfg.BinaryHandlingMode {
+	case "":
+		cfg.BinaryHandlingMode = BinaryBytes
+	case BinaryBytes, BinaryBase64, BinaryHex:
+	default:
+		return nil, errors.Errorf("unknown binary handling mode %q", cfg.BinaryHandlingMode)
+	}
+	if cfg.TimestampStringLocation == nil {
+		cfg.TimestampStringLocation = time.Local
+	}
+	return &Serializer{cfg: cfg}, nil
+}
+
+// The operations of the change events.
+const (
+	OpCreate = "c"
+	OpUpdate = "u"
+	OpDelete = "d"
+	OpRead   = "r"
+)
+
+// Envelope is a change event, its JSON encoding is the value of the Kafka
+// message written by Debezium.
+type Envelope struct {
+	Schema  *Schema `json:"schema,omitempty"`
+	Payload Payload `json:"payload"`
+}
+
+// Payload is the change of one row.
+type Payload struct {
+	Before *Row   `json:"before"`
+	After  *Row   `json:"after"`
+	Source Source `json:"source"`
+	Op     string `json:"op"`
+	TsMs   int64  `json:"ts_ms"`
+}
+
+// Source is the metadata of a change.
+type Source struct {
+	Version   string  `json:"version"`
+	Connector string  `json:"connector"`
+	Name      string  `json:"name"`
+	TsMs      int64   `json:"ts_ms"`
+	Snapshot  string  `json:"snapshot"`
+	DB        string  `json:"db"`
+	Sequence  *string `json:"sequence"`
+	Table     string  `json:"table"`
+	ServerID  uint32  `json:"server_id"`
+	GTID      *string `json:"gtid"`
+	File      string  `json:"file"`
+	Pos       uint32  `json:"pos"`
+	Row       int     `json:"row"`
+	Thread    *int64  `json:"thread"`
+	Query     *string `json:"query"`
+}
+
+// Row is a row or a struct value, it's encoded as a JSON object with the
+// fields in the order of the columns.
+type Row struct {
+	Fields []string
+	Values []any
+}
+
+// Get returns the value of the field.
+func (r *Row) Get(field string) (any, bool) {
+	for i, f := range r.Fields {
+		if f == field {
+			return r.Values[i], true
+		}
+	}
+	return nil, false
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (r *Row) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range r.Fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(field)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		value, err := json.Marshal(r.Values[i])
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Events converts the rows of the event to change events, one per row. pos
+// is the position of the event in the binlog, it's reported as the file and
+// the position in the source block. The rows of a dump, which have no
+// header, are read events of a snapshot.
+func (s *Serializer) Events(e *canal.RowsEvent, pos mysql.Position) ([]*Envelope, error) {
+	changes, err := e.RowChanges()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var envelopeSchema *Schema
+	if s.cfg.IncludeSchema {
+		envelopeSchema = s.EnvelopeSchema(e.Table)
+	}
+
+	now := utils.Now().UnixMilli()
+	source := Source{
+		Version:   s.cfg.Version,
+		Connector: "mysql",
+		Name:      s.cfg.ServerName,
+		TsMs:      now,
+		Snapshot:  "true",
+		DB:        e.Table.Schema,
+		Table:     e.Table.Name,
+		ServerID:  s.cfg.ServerID,
+		File:      pos.Name,
+		Pos:       pos.Pos,
+	}
+	if e.Header != nil {
+		source.Snapshot = "false"
+		source.ServerID = e.Header.ServerID
+		source.TsMs = int64(e.Header.Timestamp) * 1000
+	}
+	if !e.CommitTime.IsZero() {
+		source.TsMs = e.CommitTime.UnixMilli()
+	}
+	if e.GTID != "" {
+		gtid := e.GTID
+		source.GTID = &gtid
+	}
+
+	envelopes := make([]*Envelope, 0, len(changes))
+	for i, change := range changes {
+		payload := Payload{Source: source, TsMs: now}
+		payload.Source.Row = i
+		switch {
+		case e.Header == nil:
+			payload.Op = OpRead
+		case change.Action == canal.InsertAction:
+			payload.Op = OpCreate
+		case change.Action == canal.UpdateAction:
+			payload.Op = OpUpdate
+		case change.Action == canal.DeleteAction:
+			payload.Op = OpDelete
+		default:
+			return nil, errors.Errorf("unknown action %s of %s", change.Action, e.Table)
+		}
+
+		if change.Before != nil {
+			if payload.Before, err = s.row(e.Table, change.Before); err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+		if change.After != nil {
+			if payload.After, err = s.row(e.Table, change.After); err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+		envelopes = append(envelopes, &Envelope{Schema: envelopeSchema, Payload: payload})
+	}
+	return envelopes, nil
+}
+
+// row converts the values of a row image keyed by column name. The columns
+// not logged with binlog_row_image=MINIMAL are null.
+func (s *Serializer) row(t *schema.Table, image map[string]any) (*Row, error) {
+	r := &Row{Fields: make([]string, 0, len(t.Columns)), Values: make([]any, 0, len(t.Columns))}
+	for i := range t.Columns {
+		col := &t.Columns[i]
+		v, err := s.value(col, image[col.Name])
+		if err != nil {
+			return nil, errors.Annotatef(err, "column %s of %s", col.Name, t)
+		}
+		r.Fields = append(r.Fields, col.Name)
+		r.Values = append(r.Values, v)
+	}
+	return r, nil
+}
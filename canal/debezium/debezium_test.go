@@ -0,0 +1,169 @@
+package debezium
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+func testTable() *schema.Table {
+	t := &schema.Table{Schema: "shop", Name: "orders"}
+	t.AddColumn("id", "bigint unsigned", "", "")
+	t.AddColumn("amount", "decimal(10,2)", "", "")
+	t.AddColumn("created", "datetime(6)", "", "")
+	t.AddColumn("updated", "timestamp", "", "")
+	t.AddColumn("day", "date", "", "")
+	t.AddColumn("duration", "time(3)", "", "")
+	t.AddColumn("status", "enum('new','paid')", "", "")
+	t.AddColumn("tags", "set('a','b','c')", "", "")
+	t.AddColumn("flag", "bit(1)", "", "")
+	t.AddColumn("doc", "json", "", "")
+	t.AddColumn("data", "blob", "", "")
+	t.AddColumn("note", "varchar(20)", "utf8mb4_general_ci", "")
+	t.PKColumns = []int{0}
+	t.UnsignedColumns = []int{0}
+	return t
+}
+
+func TestEvents(t *testing.T) {
+	s, err := NewSerializer(Config{ServerName: "dbserver1", TimestampStringLocation: time.UTC})
+	require.NoError(t, err)
+
+	before := []any{
+		uint64(1), "12.50", "2024-01-02 03:04:05.123456", "2024-01-02 03:04:05", "2024-01-02", "-01:02:03.5",
+		int64(2), int64(5), int64(1), `{"a":1}`, []byte{1, 2}, "x",
+	}
+	after := []any{
+		uint64(1), "-0.01", "0000-00-00 00:00:00", nil, "1969-12-31", "00:00:00",
+		int64(1), int64(0), int64(0), []byte{}, []byte{}, []byte("y"),
+	}
+	e := &canal.RowsEvent{
+		Table:  testTable(),
+		Action: canal.UpdateAction,
+		Rows:   [][]any{before, after},
+		Header: &replication.EventHeader{Timestamp: 1700000000, ServerID: 7},
+		GTID:   "3e11fa47-71ca-11e1-9e33-c80aa9429562:23",
+	}
+	envelopes, err := s.Events(e, mysql.Position{Name: "mysql-bin.000003", Pos: 154})
+	require.NoError(t, err)
+	require.Len(t, envelopes, 1)
+
+	p := envelopes[0].Payload
+	require.Equal(t, OpUpdate, p.Op)
+	require.Nil(t, envelopes[0].Schema)
+	require.Equal(t, Source{
+		Connector: "mysql",
+		Name:      "dbserver1",
+		TsMs:      1700000000000,
+		Snapshot:  "false",
+		DB:        "shop",
+		Table:     "orders",
+		ServerID:  7,
+		GTID:      &e.GTID,
+		File:      "mysql-bin.000003",
+		Pos:       154,
+	}, p.Source)
+
+	require.Equal(t, []any{
+		int64(1), []byte{0x04, 0xe2}, int64(1704164645123456), "2024-01-02T03:04:05Z", int32(19724), int64(-3723500000),
+		"paid", "a,c", true, `{"a":1}`, []byte{1, 2}, "x",
+	}, p.Before.Values)
+	require.Equal(t, []any{
+		int64(1), []byte{0xff}, nil, nil, int32(-1), int64(0),
+		"new", "", false, nil, []byte{}, "y",
+	}, p.After.Values)
+
+	// the JSON keeps the order of the columns
+	data, err := json.Marshal(p.After)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"id":1,"amount":"/w==","created":null,"updated":null,"day":-1,"duration":0,"status":"new","tags":"","flag":false,"doc":null,"data":"","note":"y"}`, string(data))
+	require.Regexp(t, `^\{"id":1,"amount":"/w==","created":null,`, string(data))
+
+	// the rows of a dump are read
+	e = &canal.RowsEvent{Table: testTable(), Action: canal.InsertAction, Rows: [][]any{after}}
+	envelopes, err = s.Events(e, mysql.Position{})
+	require.NoError(t, err)
+	require.Equal(t, OpRead, envelopes[0].Payload.Op)
+	require.Equal(t, "true", envelopes[0].Payload.Source.Snapshot)
+	require.Nil(t, envelopes[0].Payload.Before)
+}
+
+func TestEventsDecoderOptions(t *testing.T) {
+	// UseDecimal and ParseTime
+	s, err := NewSerializer(Config{
+		DecimalHandlingMode:        DecimalString,
+		BigintUnsignedHandlingMode: BigintUnsignedPrecise,
+		BinaryHandlingMode:         BinaryHex,
+		IncludeSchema:              true,
+	})
+	require.NoError(t, err)
+
+	row := []any{
+		uint64(18446744073709551615), decimal.RequireFromString("12.5"), time.Date(2024, 1, 2, 3, 4, 5, 123456000, time.UTC),
+		time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("", 3600)), "2024-01-02", "00:00:01",
+		"paid", "a,b", int64(1), `{}`, []byte{0xab}, "x",
+	}
+	envelopes, err := s.Events(&canal.RowsEvent{
+		Table:  testTable(),
+		Action: canal.DeleteAction,
+		Rows:   [][]any{row},
+		Header: &replication.EventHeader{Timestamp: 1700000000},
+	}, mysql.Position{})
+	require.NoError(t, err)
+
+	p := envelopes[0].Payload
+	require.Equal(t, OpDelete, p.Op)
+	require.Nil(t, p.After)
+	require.Equal(t, []any{
+		[]byte{0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, "12.50", int64(1704164645123456),
+		"2024-01-02T02:04:05Z", int32(19724), int64(1000000),
+		"paid", "a,b", true, `{}`, "ab", "x",
+	}, p.Before.Values)
+
+	value := envelopes[0].Schema.Fields[0]
+	require.Equal(t, "before", value.Field)
+	require.Equal(t, ".shop.orders.Value", value.Name)
+	var types []string
+	for _, f := range value.Fields {
+		types = append(types, f.Type+" "+f.Name)
+	}
+	require.Equal(t, []string{
+		"bytes org.apache.kafka.connect.data.Decimal", "string ", "int64 io.debezium.time.MicroTimestamp",
+		"string io.debezium.time.ZonedTimestamp", "int32 io.debezium.time.Date", "int64 io.debezium.time.MicroTime",
+		"string io.debezium.data.Enum", "string io.debezium.data.EnumSet", "boolean ", "string io.debezium.data.Json",
+		"string ", "string ",
+	}, types)
+	require.False(t, value.Fields[0].Optional)
+	require.True(t, value.Fields[1].Optional)
+	require.Equal(t, map[string]string{"allowed": "new,paid"}, value.Fields[6].Parameters)
+
+	_, err = NewSerializer(Config{DecimalHandlingMode: "float"})
+	require.Error(t, err)
+}
+
+func TestDecimalBytes(t *testing.T) {
+	cases := []struct {
+		value    string
+		scale    int
+		expected []byte
+	}{
+		{"0", 0, []byte{0}},
+		{"127", 0, []byte{0x7f}},
+		{"128", 0, []byte{0x00, 0x80}},
+		{"-128", 0, []byte{0x80}},
+		{"-129", 0, []byte{0xff, 0x7f}},
+		{"-1", 0, []byte{0xff}},
+		{"1.5", 2, []byte{0x00, 0x96}},
+	}
+	for _, tc := range cases {
+		require.Equal(t, tc.expected, decimalBytes(decimal.RequireFromString(tc.value), tc.scale), tc.value)
+	}
+}
@@ -0,0 +1,346 @@
+package debezium
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// Schema is a Kafka Connect schema, the schema block of the JSON converter.
+type Schema struct {
+	Type       string            `json:"type"`
+	Fields     []*Schema         `json:"fields,omitempty"`
+	Optional   bool              `json:"optional"`
+	Default    any               `json:"default,omitempty"`
+	Name       string            `json:"name,omitempty"`
+	Version    int               `json:"version,omitempty"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+	Field      string            `json:"field,omitempty"`
+}
+
+// The names of the logical types.
+const (
+	decimalName        = "org.apache.kafka.connect.data.Decimal"
+	dateName           = "io.debezium.time.Date"
+	microTimeName      = "io.debezium.time.MicroTime"
+	timestampName      = "io.debezium.time.Timestamp"
+	microTimestampName = "io.debezium.time.MicroTimestamp"
+	zonedTimestampName = "io.debezium.time.ZonedTimestamp"
+	yearName           = "io.debezium.time.Year"
+	jsonName           = "io.debezium.data.Json"
+	enumName           = "io.debezium.data.Enum"
+	enumSetName        = "io.debezium.data.EnumSet"
+	bitsName           = "io.debezium.data.Bits"
+	geometryName       = "io.debezium.data.geometry.Geometry"
+	sourceName         = "io.debezium.connector.mysql.Source"
+)
+
+// EnvelopeSchema returns the schema of the change events of the table.
+func (s *Serializer) EnvelopeSchema(t *schema.Table) *Schema {
+	before := s.ValueSchema(t)
+	before.Field = "before"
+	after := s.ValueSchema(t)
+	after.Field = "after"
+
+	return &Schema{
+		Type: "struct",
+		Fields: []*Schema{
+			before,
+			after,
+			sourceSchema(),
+			{Type: "string", Field: "op"},
+			{Type: "int64", Optional: true, Field: "ts_ms"},
+		},
+		Name: s.topic(t) + ".Envelope",
+	}
+}
+
+// ValueSchema returns the schema of the rows of the table.
+func (s *Serializer) ValueSchema(t *schema.Table) *Schema {
+	fields := make([]*Schema, 0, len(t.Columns))
+	for i := range t.Columns {
+		field := s.columnSchema(&t.Columns[i])
+		field.Field = t.Columns[i].Name
+		field.Optional = !t.IsPrimaryKey(i)
+		fields = append(fields, field)
+	}
+	return &Schema{Type: "struct", Fields: fields, Optional: true, Name: s.topic(t) + ".Value"}
+}
+
+func (s *Serializer) topic(t *schema.Table) string {
+	return s.cfg.ServerName + "." + t.Schema + "." + t.Name
+}
+
+func sourceSchema() *Schema {
+	field := func(tp string, name string, optional bool) *Schema {
+		return &Schema{Type: tp, Optional: optional, Field: name}
+	}
+	snapshot := &Schema{
+		Type:       "string",
+		Optional:   true,
+		Default:    "false",
+		Name:       enumName,
+		Version:    1,
+		Parameters: map[string]string{"allowed": "true,last,false,incremental"},
+		Field:      "snapshot",
+	}
+	return &Schema{
+		Type: "struct",
+		Fields: []*Schema{
+			field("string", "version", false),
+			field("string", "connector", false),
+			field("string", "name", false),
+			field("int64", "ts_ms", false),
+			snapshot,
+			field("string", "db", false),
+			field("string", "sequence", true),
+			field("string", "table", true),
+			field("int64", "server_id", false),
+			field("string", "gtid", true),
+			field("string", "file", false),
+			field("int64", "pos", false),
+			field("int32", "row", false),
+			field("int64", "thread", true),
+			field("string", "query", true),
+		},
+		Name:  sourceName,
+		Field: "source",
+	}
+}
+
+// columnSchema returns the schema of the values of the column.
+func (s *Serializer) columnSchema(col *schema.TableColumn) *Schema {
+	switch columnKind(col) {
+	case kindInt16:
+		return &Schema{Type: "int16"}
+	case kindInt32:
+		return &Schema{Type: "int32"}
+	case kindInt64:
+		return &Schema{Type: "int64"}
+	case kindUint64:
+		if s.cfg.BigintUnsignedHandlingMode == BigintUnsignedPrecise {
+			return decimalSchema(20, 0)
+		}
+		return &Schema{Type: "int64"}
+	case kindYear:
+		return &Schema{Type: "int32", Name: yearName, Version: 1}
+	case kindFloat:
+		return &Schema{Type: "float64"}
+	case kindDecimal:
+		switch s.cfg.DecimalHandlingMode {
+		case DecimalDouble:
+			return &Schema{Type: "float64"}
+		case DecimalString:
+			return &Schema{Type: "string"}
+		}
+		precision, scale := decimalSize(col.RawType)
+		return decimalSchema(precision, scale)
+	case kindDate:
+		return &Schema{Type: "int32", Name: dateName, Version: 1}
+	case kindTime:
+		return &Schema{Type: "int64", Name: microTimeName, Version: 1}
+	case kindDatetime:
+		if fsp(col.RawType) <= 3 {
+			return &Schema{Type: "int64", Name: timestampName, Version: 1}
+		}
+		return &Schema{Type: "int64", Name: microTimestampName, Version: 1}
+	case kindTimestamp:
+		return &Schema{Type: "string", Name: zonedTimestampName, Version: 1}
+	case kindBool:
+		return &Schema{Type: "boolean"}
+	case kindBits:
+		return &Schema{
+			Type:       "bytes",
+			Name:       bitsName,
+			Version:    1,
+			Parameters: map[string]string{"length": strconv.Itoa(bitLength(col.RawType))},
+		}
+	case kindJSON:
+		return &Schema{Type: "string", Name: jsonName, Version: 1}
+	case kindEnum:
+		return &Schema{
+			Type:       "string",
+			Name:       enumName,
+			Version:    1,
+			Parameters: map[string]string{"allowed": strings.Join(col.EnumValues, ",")},
+		}
+	case kindSet:
+		return &Schema{
+			Type:       "string",
+			Name:       enumSetName,
+			Version:    1,
+			Parameters: map[string]string{"allowed": strings.Join(col.SetValues, ",")},
+		}
+	case kindBinary:
+		if s.cfg.BinaryHandlingMode == BinaryBytes {
+			return &Schema{Type: "bytes"}
+		}
+		return &Schema{Type: "string"}
+	case kindGeometry:
+		return &Schema{
+			Type: "struct",
+			Fields: []*Schema{
+				{Type: "bytes", Field: "wkb"},
+				{Type: "int32", Optional: true, Field: "srid"},
+			},
+			Name:    geometryName,
+			Version: 1,
+		}
+	}
+	return &Schema{Type: "string"}
+}
+
+func decimalSchema(precision, scale int) *Schema {
+	return &Schema{
+		Type:    "bytes",
+		Name:    decimalName,
+		Version: 1,
+		Parameters: map[string]string{
+			"scale":                     strconv.Itoa(scale),
+			"connect.decimal.precision": strconv.Itoa(precision),
+		},
+	}
+}
+
+// kind is the Debezium type of a column.
+type kind int
+
+const (
+	kindString kind = iota
+	kindInt16
+	kindInt32
+	kindInt64
+	kindUint64
+	kindYear
+	kindFloat
+	kindDecimal
+	kindDate
+	kindTime
+	kindDatetime
+	kindTimestamp
+	kindBool
+	kindBits
+	kindJSON
+	kindEnum
+	kindSet
+	kindBinary
+	kindGeometry
+)
+
+var geometryTypes = []string{
+	"geometry", "point", "linestring", "polygon",
+	"multipoint", "multilinestring", "multipolygon", "geomcollection", "geometrycollection",
+}
+
+func columnKind(col *schema.TableColumn) kind {
+	rawType := strings.ToLower(col.RawType)
+	switch col.Type {
+	case schema.TYPE_NUMBER:
+		switch {
+		case strings.HasPrefix(rawType, "year"):
+			return kindYear
+		case strings.HasPrefix(rawType, "tinyint"):
+			return kindInt16
+		case strings.HasPrefix(rawType, "smallint"):
+			if col.IsUnsigned {
+				return kindInt32
+			}
+			return kindInt16
+		case strings.HasPrefix(rawType, "bigint"):
+			if col.IsUnsigned {
+				return kindUint64
+			}
+			return kindInt64
+		}
+		if col.IsUnsigned {
+			return kindInt64
+		}
+		return kindInt32
+	case schema.TYPE_MEDIUM_INT:
+		return kindInt32
+	case schema.TYPE_FLOAT:
+		return kindFloat
+	case schema.TYPE_DECIMAL:
+		return kindDecimal
+	case schema.TYPE_DATE:
+		return kindDate
+	case schema.TYPE_TIME:
+		return kindTime
+	case schema.TYPE_DATETIME:
+		return kindDatetime
+	case schema.TYPE_TIMESTAMP:
+		return kindTimestamp
+	case schema.TYPE_BIT:
+		if bitLength(rawType) == 1 {
+			return kindBool
+		}
+		return kindBits
+	case schema.TYPE_JSON:
+		return kindJSON
+	case schema.TYPE_ENUM:
+		return kindEnum
+	case schema.TYPE_SET:
+		return kindSet
+	case schema.TYPE_BINARY:
+		return kindBinary
+	case schema.TYPE_POINT:
+		return kindGeometry
+	}
+	if strings.HasSuffix(rawType, "blob") {
+		return kindBinary
+	}
+	for _, tp := range geometryTypes {
+		if rawType == tp {
+			return kindGeometry
+		}
+	}
+	return kindString
+}
+
+// typeArgs returns the numbers in the parentheses of a column type.
+func typeArgs(rawType string) []int {
+	start := strings.IndexByte(rawType, '(')
+	end := strings.IndexByte(rawType, ')')
+	if start < 0 || end < start {
+		return nil
+	}
+	var args []int
+	for _, arg := range strings.Split(rawType[start+1:end], ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(arg))
+		if err != nil {
+			return nil
+		}
+		args = append(args, n)
+	}
+	return args
+}
+
+// decimalSize returns the precision and the scale of a decimal column, they
+// default to 10 and 0 like MySQL.
+func decimalSize(rawType string) (int, int) {
+	args := typeArgs(rawType)
+	switch len(args) {
+	case 1:
+		return args[0], 0
+	case 2:
+		return args[0], args[1]
+	}
+	return 10, 0
+}
+
+// fsp returns the fractional seconds precision of a temporal column.
+func fsp(rawType string) int {
+	if args := typeArgs(rawType); len(args) == 1 {
+		return args[0]
+	}
+	return 0
+}
+
+// bitLength returns the length of a bit column.
+func bitLength(rawType string) int {
+	if args := typeArgs(rawType); len(args) == 1 {
+		return args[0]
+	}
+	return 1
+}
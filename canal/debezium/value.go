@@ -0,0 +1,327 @@
+package debezium
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+const (
+	datetimeLayout = "2006-01-02 15:04:05"
+	dateLayout     = "2006-01-02"
+)
+
+// value converts a value decoded by the replication package, or read by the
+// dump, to the value of the column schema. The values depend on the UseDecimal,
+// ParseTime and TimestampStringLocation options of the decoder, all of them
+// are accepted.
+func (s *Serializer) value(col *schema.TableColumn, v any) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	switch columnKind(col) {
+	case kindInt16:
+		n, err := toInt64(v)
+		return int16(n), err
+	case kindInt32, kindYear:
+		n, err := toInt64(v)
+		return int32(n), err
+	case kindInt64:
+		return toInt64(v)
+	case kindUint64:
+		if s.cfg.BigintUnsignedHandlingMode == BigintUnsignedPrecise {
+			d, err := toDecimal(v)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			return decimalBytes(d, 0), nil
+		}
+		return toInt64(v)
+	case kindFloat:
+		return toFloat64(v)
+	case kindDecimal:
+		d, err := toDecimal(v)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		switch s.cfg.DecimalHandlingMode {
+		case DecimalDouble:
+			f, _ := d.Float64()
+			return f, nil
+		case DecimalString:
+			_, scale := decimalSize(col.RawType)
+			return d.StringFixed(int32(scale)), nil
+		}
+		_, scale := decimalSize(col.RawType)
+		return decimalBytes(d, scale), nil
+	case kindDate:
+		t, ok, err := toTime(v, dateLayout, time.UTC)
+		if !ok || err != nil {
+			return nil, err
+		}
+		return int32(t.Unix() / 86400), nil
+	case kindTime:
+		return toMicroTime(v)
+	case kindDatetime:
+		t, ok, err := toTime(v, datetimeLayout, time.UTC)
+		if !ok || err != nil {
+			return nil, err
+		}
+		if fsp(col.RawType) <= 3 {
+			return t.UnixMilli(), nil
+		}
+		return t.UnixMicro(), nil
+	case kindTimestamp:
+		t, ok, err := toTime(v, datetimeLayout, s.cfg.TimestampStringLocation)
+		if !ok || err != nil {
+			return nil, err
+		}
+		return t.UTC().Format(time.RFC3339Nano), nil
+	case kindBool:
+		n, err := toInt64(v)
+		return n != 0, err
+	case kindBits:
+		n, err := toInt64(v)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		b := binary.LittleEndian.AppendUint64(nil, uint64(n))
+		return b[:(bitLength(col.RawType)+7)/8], nil
+	case kindJSON:
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case []byte:
+			// an empty document is the JSON null literal
+			if len(v) == 0 {
+				return nil, nil
+			}
+			return string(v), nil
+		}
+	case kindEnum:
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case []byte:
+			return string(v), nil
+		}
+		n, err := toInt64(v)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		// 0 is the empty string of an invalid value
+		if n <= 0 || int(n) > len(col.EnumValues) {
+			return "", nil
+		}
+		return col.EnumValues[n-1], nil
+	case kindSet:
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case []byte:
+			return string(v), nil
+		}
+		n, err := toInt64(v)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		var values []string
+		for i, value := range col.SetValues {
+			if n&(1<<i) != 0 {
+				values = append(values, value)
+			}
+		}
+		return strings.Join(values, ","), nil
+	case kindBinary:
+		var b []byte
+		switch v := v.(type) {
+		case []byte:
+			b = v
+		case string:
+			b = []byte(v)
+		default:
+			return nil, errors.Errorf("unexpected %T value of a binary column", v)
+		}
+		switch s.cfg.BinaryHandlingMode {
+		case BinaryBase64:
+			return base64.StdEncoding.EncodeToString(b), nil
+		case BinaryHex:
+			return hex.EncodeToString(b), nil
+		}
+		return b, nil
+	case kindGeometry:
+		var b []byte
+		switch v := v.(type) {
+		case []byte:
+			b = v
+		case string:
+			b = []byte(v)
+		default:
+			return nil, errors.Errorf("unexpected %T value of a geometry column", v)
+		}
+		// MySQL stores the SRID before the WKB
+		if len(b) < 4 {
+			return nil, errors.Errorf("geometry value of %d bytes is too short", len(b))
+		}
+		return &Row{
+			Fields: []string{"wkb", "srid"},
+			Values: []any{b[4:], int32(binary.LittleEndian.Uint32(b))},
+		}, nil
+	case kindString:
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case []byte:
+			return string(v), nil
+		}
+	}
+	return nil, errors.Errorf("unexpected %T value of %s column", v, col.RawType)
+}
+
+func toInt64(v any) (int64, error) {
+	switch v := v.(type) {
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		return int64(v), nil
+	case uint:
+		return int64(v), nil
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			u, uerr := strconv.ParseUint(v, 10, 64)
+			if uerr != nil {
+				return 0, errors.Trace(err)
+			}
+			return int64(u), nil
+		}
+		return n, nil
+	}
+	return 0, errors.Errorf("unexpected %T value of an integer column", v)
+}
+
+func toFloat64(v any) (float64, error) {
+	switch v := v.(type) {
+	case float32:
+		// keep the shortest decimal form of the float32, not its float64 bits
+		return strconv.ParseFloat(strconv.FormatFloat(float64(v), 'g', -1, 32), 64)
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, errors.Errorf("unexpected %T value of a float column", v)
+}
+
+func toDecimal(v any) (decimal.Decimal, error) {
+	switch v := v.(type) {
+	case decimal.Decimal:
+		return v, nil
+	case string:
+		return decimal.NewFromString(v)
+	case uint64:
+		return decimal.NewFromBigInt(new(big.Int).SetUint64(v), 0), nil
+	}
+	n, err := toInt64(v)
+	if err != nil {
+		return decimal.Decimal{}, errors.Trace(err)
+	}
+	return decimal.NewFromInt(n), nil
+}
+
+// decimalBytes returns the unscaled value of the decimal in big-endian two's
+// complement, the encoding of the Decimal logical type.
+func decimalBytes(d decimal.Decimal, scale int) []byte {
+	x := d.Shift(int32(scale)).BigInt()
+	n := x.BitLen()
+	if x.Sign() < 0 {
+		n = new(big.Int).Not(x).BitLen()
+	}
+	// one more bit for the sign
+	size := n/8 + 1
+	if x.Sign() < 0 {
+		x = new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), uint(size*8)), x)
+	}
+	b := x.Bytes()
+	return append(make([]byte, size-len(b), size), b...)
+}
+
+// toTime returns the time of a temporal value, false for the zero dates.
+func toTime(v any, layout string, loc *time.Location) (time.Time, bool, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, true, nil
+	case string:
+		if strings.HasPrefix(v, "0000-00-00") {
+			return time.Time{}, false, nil
+		}
+		t, err := time.ParseInLocation(layout, v, loc)
+		if err != nil {
+			return time.Time{}, false, errors.Trace(err)
+		}
+		return t, true, nil
+	}
+	return time.Time{}, false, errors.Errorf("unexpected %T value of a temporal column", v)
+}
+
+// toMicroTime returns the microseconds of a TIME value like -838:59:59.000000.
+func toMicroTime(v any) (int64, error) {
+	s, ok := v.(string)
+	if !ok {
+		if d, ok := v.(time.Duration); ok {
+			return d.Microseconds(), nil
+		}
+		return 0, errors.Errorf("unexpected %T value of a time column", v)
+	}
+
+	sign := int64(1)
+	if strings.HasPrefix(s, "-") {
+		sign, s = -1, s[1:]
+	}
+	var micros int64
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		frac := (s[i+1:] + "000000")[:6]
+		n, err := strconv.ParseInt(frac, 10, 64)
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		micros, s = n, s[:i]
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, errors.Errorf("invalid time value %q", v)
+	}
+	var seconds int64
+	for _, part := range parts {
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		seconds = seconds*60 + n
+	}
+	return sign * (seconds*1000000 + micros), nil
+}
@@ -112,10 +112,15 @@ func (h *dumpParseHandler) Data(db string, table string, values []string) error
 	}
 
 	events := newRowsEvent(tableInfo, InsertAction, [][]any{vs}, nil, nil)
-	return h.c.eventHandler.OnRow(events)
+	return h.c.onRow(events)
 }
 
 func (c *Canal) AddDumpDatabases(dbs ...string) {
+	if c.snapshotter != nil {
+		c.snapshotter.addDatabases(dbs...)
+		return
+	}
+
 	if c.dumper == nil {
 		return
 	}
@@ -124,6 +129,11 @@ func (c *Canal) AddDumpDatabases(dbs ...string) {
 }
 
 func (c *Canal) AddDumpTables(db string, tables ...string) {
+	if c.snapshotter != nil {
+		c.snapshotter.addTables(db, tables...)
+		return
+	}
+
 	if c.dumper == nil {
 		return
 	}
@@ -132,6 +142,11 @@ func (c *Canal) AddDumpTables(db string, tables ...string) {
 }
 
 func (c *Canal) AddDumpIgnoreTables(db string, tables ...string) {
+	if c.snapshotter != nil {
+		c.snapshotter.addIgnoreTables(db, tables...)
+		return
+	}
+
 	if c.dumper == nil {
 		return
 	}
@@ -140,7 +155,7 @@ func (c *Canal) AddDumpIgnoreTables(db string, tables ...string) {
 }
 
 func (c *Canal) dump() error {
-	if c.dumper == nil {
+	if c.dumper == nil && c.snapshotter == nil {
 		return errors.New("mysqldump does not exist")
 	}
 
@@ -170,15 +185,22 @@ func (c *Canal) dump() error {
 	}
 
 	start := utils.Now()
-	c.cfg.Logger.Info("try dump MySQL and parse")
-	if err := c.dumper.DumpAndParse(h); err != nil {
-		return errors.Trace(err)
+	if c.snapshotter != nil {
+		c.cfg.Logger.Info("try dump MySQL with native snapshot")
+		if err := c.dumpSnapshot(h); err != nil {
+			return errors.Trace(err)
+		}
+	} else {
+		c.cfg.Logger.Info("try dump MySQL and parse")
+		if err := c.dumper.DumpAndParse(h); err != nil {
+			return errors.Trace(err)
+		}
 	}
 
 	pos := mysql.Position{Name: h.name, Pos: uint32(h.pos)}
 	c.master.Update(pos)
 	c.master.UpdateGTIDSet(h.gset)
-	if err := c.eventHandler.OnPosSynced(nil, pos, c.master.GTIDSet(), true); err != nil {
+	if err := c.syncPosition(nil, pos, c.master.GTIDSet(), true); err != nil {
 		return errors.Trace(err)
 	}
 	var startPos fmt.Stringer = pos
@@ -191,6 +213,16 @@ func (c *Canal) dump() error {
 }
 
 func (c *Canal) tryDump() error {
+	if c.cfg.BinlogDir != "" {
+		c.cfg.Logger.Info("skip dump, read binlog files offline")
+		return nil
+	}
+
+	if c.cfg.Dump.ChunkSize > 0 {
+		// the chunked snapshot resumes with the saved position
+		return c.prepareChunkedSnapshot()
+	}
+
 	pos := c.master.Position()
 	gset := c.master.GTIDSet()
 	if (len(pos.Name) > 0 && pos.Pos > 0) ||
@@ -200,7 +232,7 @@ func (c *Canal) tryDump() error {
 		return nil
 	}
 
-	if c.dumper == nil {
+	if c.dumper == nil && c.snapshotter == nil {
 		c.cfg.Logger.Info("skip dump, no mysqldump")
 		return nil
 	}
@@ -0,0 +1,206 @@
+package canal
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/client"
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+const (
+	defaultFailoverReconnectAttempts = 3
+	defaultFailoverTimeout           = time.Minute
+)
+
+var (
+	ErrNoPrimary = errors.New("no writable primary candidate")
+	// ErrFailoverMissingGTIDs is returned when the new primary doesn't have
+	// all the synced transactions, so the failover would lose them.
+	ErrFailoverMissingGTIDs = errors.New("primary candidate lacks synced transactions")
+	// ErrFailoverSplitBrain is returned when writable candidates executed
+	// different transactions, so none of them can be chosen.
+	ErrFailoverSplitBrain = errors.New("primary candidates diverged")
+)
+
+// syncerError is an error of the binlog syncer, as opposed to the errors of
+// the event handler, which may be followed by a failover. started is set
+// once the sync started.
+type syncerError struct {
+	err     error
+	started bool
+}
+
+func (e *syncerError) Error() string {
+	return e.err.Error()
+}
+
+type primaryCandidate struct {
+	addr     string
+	readOnly bool
+	gset     mysql.GTIDSet
+}
+
+func (c *Canal) failoverEnabled() bool {
+	return len(c.cfg.FailoverAddrs) > 0 || c.cfg.DiscoverCandidates != nil
+}
+
+// canFailover reports whether the sync can continue from another primary.
+func (c *Canal) canFailover() bool {
+	if !c.failoverEnabled() || c.ctx.Err() != nil {
+		return false
+	}
+	// the chunked snapshot reads its chunks from the primary
+	if c.chunkedSnapshot != nil && !c.chunkedSnapshot.done() {
+		return false
+	}
+	gset := c.master.GTIDSet()
+	return gset != nil && gset.String() != ""
+}
+
+// choosePrimary returns the writable candidate with the highest executed GTID
+// set among the ones containing the synced GTID set. The writable candidates
+// must not have diverged, which would be a split brain.
+func choosePrimary(candidates []*primaryCandidate, synced mysql.GTIDSet) (*primaryCandidate, error) {
+	var writable []*primaryCandidate
+	for _, candidate := range candidates {
+		if !candidate.readOnly {
+			writable = append(writable, candidate)
+		}
+	}
+	if len(writable) == 0 {
+		return nil, errors.Trace(ErrNoPrimary)
+	}
+
+	var primary *primaryCandidate
+	for _, candidate := range writable {
+		if candidate.gset.Contain(synced) && (primary == nil || candidate.gset.Contain(primary.gset)) {
+			primary = candidate
+		}
+	}
+	if primary == nil {
+		return nil, errors.Annotatef(ErrFailoverMissingGTIDs, "%s executed %s, synced %s", writable[0].addr, writable[0].gset, synced)
+	}
+	for _, candidate := range writable {
+		// the others are behind the primary unless they diverged
+		if !primary.gset.Contain(candidate.gset) {
+			return nil, errors.Annotatef(ErrFailoverSplitBrain, "%s executed %s, %s executed %s",
+				primary.addr, primary.gset, candidate.addr, candidate.gset)
+		}
+	}
+	return primary, nil
+}
+
+// probeCandidate reads whether the server is read only and its executed GTID
+// set.
+func (c *Canal) probeCandidate(ctx context.Context, addr string) (*primaryCandidate, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	conn, err := client.ConnectWithDialer(ctx, "", addr, c.cfg.User, c.cfg.Password, "", c.cfg.Dialer, c.connOptions()...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer conn.Close()
+
+	rr, err := conn.Execute("SELECT @@GLOBAL.read_only, " + gtidSetVariable(c.cfg.Flavor))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	readOnly, err := rr.GetInt(0, 0)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	gx, err := rr.GetString(0, 1)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	gset, err := mysql.ParseGTIDSet(c.cfg.Flavor, gx)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &primaryCandidate{addr: addr, readOnly: readOnly != 0, gset: gset}, nil
+}
+
+// findPrimary probes the candidates and returns the new primary.
+func (c *Canal) findPrimary(ctx context.Context) (*primaryCandidate, error) {
+	addrs := c.cfg.FailoverAddrs
+	if c.cfg.DiscoverCandidates != nil {
+		var err error
+		if addrs, err = c.cfg.DiscoverCandidates(ctx); err != nil {
+			return nil, errors.Annotate(err, "discover primary candidates")
+		}
+	}
+
+	candidates := make([]*primaryCandidate, 0, len(addrs))
+	for _, addr := range addrs {
+		candidate, err := c.probeCandidate(ctx, addr)
+		if err != nil {
+			c.cfg.Logger.Warn("probe primary candidate failed", slog.String("addr", addr), slog.Any("error", err))
+			continue
+		}
+		candidates = append(candidates, candidate)
+	}
+	return choosePrimary(candidates, c.master.GTIDSet())
+}
+
+// failover looks for a new primary until FailoverTimeout and syncs from it.
+func (c *Canal) failover(syncErr error) error {
+	timeout := c.cfg.FailoverTimeout
+	if timeout <= 0 {
+		timeout = defaultFailoverTimeout
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, timeout)
+	defer cancel()
+
+	c.cfg.Logger.Warn("binlog sync failed, looking for a new primary", slog.String("addr", c.addr), slog.Any("error", syncErr))
+	var primary *primaryCandidate
+	for {
+		var err error
+		primary, err = c.findPrimary(ctx)
+		if err == nil {
+			break
+		}
+		if errors.Cause(err) == ErrFailoverMissingGTIDs {
+			return errors.Trace(err)
+		}
+		c.cfg.Logger.Warn("no new primary found", slog.Any("error", err))
+
+		select {
+		case <-c.ctx.Done():
+			return c.ctx.Err()
+		case <-ctx.Done():
+			return errors.Annotatef(err, "no new primary found in %s after %v", timeout, syncErr)
+		case <-time.After(time.Second):
+		}
+	}
+
+	c.cfg.Logger.Info("fail over to new primary", slog.String("addr", primary.addr), slog.Any("gset", primary.gset))
+	c.connLock.Lock()
+	c.addr = primary.addr
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+	c.connLock.Unlock()
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+	c.syncer.Close()
+	return errors.Trace(c.prepareSyncer())
+}
+
+// gtidSetVariable returns the variable of the executed GTID set of the
+// flavor.
+func gtidSetVariable(flavor string) string {
+	if flavor == mysql.MariaDBFlavor {
+		return "@@GLOBAL.gtid_current_pos"
+	}
+	return "@@GLOBAL.GTID_EXECUTED"
+}
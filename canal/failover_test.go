@@ -0,0 +1,67 @@
+package canal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pingcap/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+func TestChoosePrimary(t *testing.T) {
+	gset := func(s string) mysql.GTIDSet {
+		set, err := mysql.ParseMysqlGTIDSet(s)
+		require.NoError(t, err)
+		return set
+	}
+	const sid = "3e11fa47-71ca-11e1-9e33-c80aa9429562:"
+
+	candidates := []*primaryCandidate{
+		{addr: "a:3306", gset: gset(sid + "1-90")},
+		// a read only replica with the most transactions
+		{addr: "b:3306", readOnly: true, gset: gset(sid + "1-120")},
+		{addr: "c:3306", gset: gset(sid + "1-100")},
+		{addr: "d:3306", gset: gset(sid + "1-95")},
+	}
+	primary, err := choosePrimary(candidates, gset(sid+"1-80"))
+	require.NoError(t, err)
+	require.Equal(t, "c:3306", primary.addr)
+
+	// the synced transactions 101-110 would be lost
+	_, err = choosePrimary(candidates, gset(sid+"1-110"))
+	require.Equal(t, ErrFailoverMissingGTIDs, errors.Cause(err))
+
+	_, err = choosePrimary(candidates[1:2], gset(sid+"1-80"))
+	require.Equal(t, ErrNoPrimary, errors.Cause(err))
+
+	// a writable candidate behind the synced set comes first
+	primary, err = choosePrimary([]*primaryCandidate{candidates[0], candidates[3]}, gset(sid+"1-92"))
+	require.NoError(t, err)
+	require.Equal(t, "d:3306", primary.addr)
+
+	// the candidates executed different transactions
+	const other = "5e11fa47-71ca-11e1-9e33-c80aa9429562:"
+	diverged := append(candidates, &primaryCandidate{addr: "e:3306", gset: gset(sid + "1-90," + other + "1")})
+	_, err = choosePrimary(diverged, gset(sid+"1-80"))
+	require.Equal(t, ErrFailoverSplitBrain, errors.Cause(err))
+}
+
+func TestCanFailover(t *testing.T) {
+	c := newTransactionTestCanal(&DummyEventHandler{})
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	require.False(t, c.canFailover())
+
+	c.cfg.FailoverAddrs = []string{"a:3306"}
+	// syncing from a binlog position
+	require.False(t, c.canFailover())
+
+	set, err := mysql.ParseMysqlGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-10")
+	require.NoError(t, err)
+	c.master.UpdateGTIDSet(set)
+	require.True(t, c.canFailover())
+
+	c.cancel()
+	require.False(t, c.canFailover())
+}
@@ -28,6 +28,20 @@ type EventHandler interface {
 	String() string
 }
 
+// TransactionHandler is an optional interface of the EventHandler to get the
+// boundaries of the transactions, for MySQL and MariaDB, with or without
+// binlog transaction compression.
+//
+// OnBegin is called before the events of a transaction, after OnGTID if there
+// is a GTID. OnCommit is called after the events of the transaction and OnXID,
+// before the position is synced. A DDL statement is a transaction by itself.
+// A transaction ending with ROLLBACK also calls OnCommit, since the
+// non-transactional changes logged in it are applied.
+type TransactionHandler interface {
+	OnBegin(header *replication.EventHeader, trx *Transaction) error
+	OnCommit(header *replication.EventHeader, nextPos mysql.Position) error
+}
+
 type DummyEventHandler struct{}
 
 func (h *DummyEventHandler) OnRotate(*replication.EventHeader, *replication.RotateEvent) error {
@@ -0,0 +1,208 @@
+package canal
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// Metrics receives the metrics of the canal, see Config.Metrics. The metrics
+// of the events come from the BinlogSyncer.
+type Metrics interface {
+	replication.Metrics
+
+	// ObserveHandler is called with the time the event handler took in a
+	// method, OnRow or OnPosSynced.
+	ObserveHandler(method string, d time.Duration)
+}
+
+type eventMetricKey struct {
+	eventType replication.EventType
+	table     string
+}
+
+type eventMetric struct {
+	events uint64
+	bytes  uint64
+}
+
+type handlerMetric struct {
+	count uint64
+	sum   time.Duration
+	max   time.Duration
+}
+
+// MetricsCollector is a Metrics which keeps the counters and gauges in
+// memory and writes them in the Prometheus text format, so that it can be
+// scraped as an http.Handler. The rates, like the events per second, are
+// computed by the queries over the counters. It can be the Metrics of a
+// replication.BinlogSyncer too.
+type MetricsCollector struct {
+	// Namespace prefixes the metric names, `canal` if empty.
+	Namespace string
+
+	mu              sync.Mutex
+	events          map[eventMetricKey]*eventMetric
+	handlers        map[string]*handlerMetric
+	lag             time.Duration
+	queueLength     int
+	queueCapacity   int
+	reconnects      uint64
+	reconnectErrors uint64
+}
+
+func NewMetricsCollector() *MetricsCollector {
+	return &MetricsCollector{
+		events:   make(map[eventMetricKey]*eventMetric),
+		handlers: make(map[string]*handlerMetric),
+	}
+}
+
+func (m *MetricsCollector) ObserveEvent(eventType replication.EventType, table string, size uint32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := eventMetricKey{eventType: eventType, table: table}
+	metric, ok := m.events[key]
+	if !ok {
+		metric = &eventMetric{}
+		m.events[key] = metric
+	}
+	metric.events++
+	metric.bytes += uint64(size)
+}
+
+func (m *MetricsCollector) ObserveLag(lag time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lag = lag
+}
+
+func (m *MetricsCollector) ObserveQueue(length int, capacity int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.queueLength = length
+	m.queueCapacity = capacity
+}
+
+func (m *MetricsCollector) ObserveReconnect(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.reconnects++
+	if err != nil {
+		m.reconnectErrors++
+	}
+}
+
+func (m *MetricsCollector) ObserveHandler(method string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	metric, ok := m.handlers[method]
+	if !ok {
+		metric = &handlerMetric{}
+		m.handlers[method] = metric
+	}
+	metric.count++
+	metric.sum += d
+	metric.max = max(metric.max, d)
+}
+
+// WritePrometheus writes the metrics in the Prometheus text exposition
+// format.
+func (m *MetricsCollector) WritePrometheus(w io.Writer) error {
+	ns := m.Namespace
+	if ns == "" {
+		ns = "canal"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	header := func(name string, kind string, help string) {
+		fmt.Fprintf(bw, "# HELP %s_%s %s\n# TYPE %s_%s %s\n", ns, name, help, ns, name, kind)
+	}
+
+	keys := make([]eventMetricKey, 0, len(m.events))
+	for key := range m.events {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b eventMetricKey) int {
+		return cmp.Or(cmp.Compare(a.eventType, b.eventType), cmp.Compare(a.table, b.table))
+	})
+	header("events_total", "counter", "Binlog events received.")
+	for _, key := range keys {
+		fmt.Fprintf(bw, "%s_events_total{type=%s,table=%s} %d\n", ns,
+			quoteLabel(key.eventType.String()), quoteLabel(key.table), m.events[key].events)
+	}
+	header("event_bytes_total", "counter", "Bytes of the binlog events received.")
+	for _, key := range keys {
+		fmt.Fprintf(bw, "%s_event_bytes_total{type=%s,table=%s} %d\n", ns,
+			quoteLabel(key.eventType.String()), quoteLabel(key.table), m.events[key].bytes)
+	}
+
+	header("lag_seconds", "gauge", "Time between the timestamp of the last event and its reception, zero at heartbeats.")
+	fmt.Fprintf(bw, "%s_lag_seconds %s\n", ns, formatSeconds(m.lag))
+	header("queue_length", "gauge", "Events waiting in the channel of the binlog streamer.")
+	fmt.Fprintf(bw, "%s_queue_length %d\n", ns, m.queueLength)
+	header("queue_capacity", "gauge", "Capacity of the channel of the binlog streamer.")
+	fmt.Fprintf(bw, "%s_queue_capacity %d\n", ns, m.queueCapacity)
+	header("reconnects_total", "counter", "Attempts to reconnect to the server.")
+	fmt.Fprintf(bw, "%s_reconnects_total %d\n", ns, m.reconnects)
+	header("reconnect_errors_total", "counter", "Failed attempts to reconnect to the server.")
+	fmt.Fprintf(bw, "%s_reconnect_errors_total %d\n", ns, m.reconnectErrors)
+
+	methods := make([]string, 0, len(m.handlers))
+	for method := range m.handlers {
+		methods = append(methods, method)
+	}
+	slices.Sort(methods)
+	header("handler_seconds", "summary", "Time taken by the event handler.")
+	for _, method := range methods {
+		metric := m.handlers[method]
+		fmt.Fprintf(bw, "%s_handler_seconds_sum{method=%s} %s\n", ns, quoteLabel(method), formatSeconds(metric.sum))
+		fmt.Fprintf(bw, "%s_handler_seconds_count{method=%s} %d\n", ns, quoteLabel(method), metric.count)
+	}
+	header("handler_max_seconds", "gauge", "Longest time taken by the event handler.")
+	for _, method := range methods {
+		fmt.Fprintf(bw, "%s_handler_max_seconds{method=%s} %s\n", ns, quoteLabel(method), formatSeconds(m.handlers[method].max))
+	}
+
+	return bw.Flush()
+}
+
+// ServeHTTP writes the metrics for a Prometheus scrape.
+func (m *MetricsCollector) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = m.WritePrometheus(w)
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(s string) string {
+	return `"` + labelReplacer.Replace(s) + `"`
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'g', -1, 64)
+}
+
+// observeHandler passes the time since start to the metrics.
+func (c *Canal) observeHandler(method string, start time.Time) {
+	if c.cfg.Metrics != nil {
+		c.cfg.Metrics.ObserveHandler(method, time.Since(start))
+	}
+}
@@ -0,0 +1,62 @@
+package canal
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+func TestMetricsCollector(t *testing.T) {
+	m := NewMetricsCollector()
+	m.ObserveEvent(replication.WRITE_ROWS_EVENTv2, "test.t", 100)
+	m.ObserveEvent(replication.WRITE_ROWS_EVENTv2, "test.t", 50)
+	m.ObserveEvent(replication.XID_EVENT, "", 31)
+	m.ObserveLag(1500 * time.Millisecond)
+	m.ObserveQueue(3, 10240)
+	m.ObserveReconnect(errors.New("connection refused"))
+	m.ObserveReconnect(nil)
+	m.ObserveHandler("OnRow", 2*time.Millisecond)
+	m.ObserveHandler("OnRow", 4*time.Millisecond)
+
+	var buf bytes.Buffer
+	require.NoError(t, m.WritePrometheus(&buf))
+	out := buf.String()
+	for _, line := range []string{
+		"# TYPE canal_events_total counter\n",
+		`canal_events_total{type="XIDEvent",table=""} 1` + "\n",
+		`canal_events_total{type="WriteRowsEventV2",table="test.t"} 2` + "\n",
+		`canal_event_bytes_total{type="WriteRowsEventV2",table="test.t"} 150` + "\n",
+		"canal_lag_seconds 1.5\n",
+		"canal_queue_length 3\n",
+		"canal_queue_capacity 10240\n",
+		"canal_reconnects_total 2\n",
+		"canal_reconnect_errors_total 1\n",
+		`canal_handler_seconds_sum{method="OnRow"} 0.006` + "\n",
+		`canal_handler_seconds_count{method="OnRow"} 2` + "\n",
+		`canal_handler_max_seconds{method="OnRow"} 0.004` + "\n",
+	} {
+		require.Contains(t, out, line)
+	}
+}
+
+func TestCanalMetrics(t *testing.T) {
+	c := newTransactionTestCanal(&DummyEventHandler{})
+	m := NewMetricsCollector()
+	c.cfg.Metrics = m
+
+	require.NoError(t, c.handleEvent(transactionTestRows(100, 1)))
+	require.NoError(t, c.handleEvent(transactionTestEvent(200, &replication.XIDEvent{})))
+	require.Equal(t, uint64(1), m.handlers["OnRow"].count)
+	require.Equal(t, uint64(1), m.handlers["OnPosSynced"].count)
+
+	// the delay is zero at heartbeats while the source is idle
+	c.updateReplicationDelay(transactionTestEvent(0, &replication.XIDEvent{}))
+	require.Positive(t, c.GetDelay())
+	c.updateReplicationDelay(&replication.BinlogEvent{Header: &replication.EventHeader{EventType: replication.HEARTBEAT_EVENT}, Event: &replication.HeartbeatEvent{}})
+	require.Zero(t, c.GetDelay())
+}
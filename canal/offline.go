@@ -0,0 +1,209 @@
+package canal
+
+import (
+	"cmp"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+var binlogFileExp = regexp.MustCompile(`^(.+)\.(\d+)$`)
+
+// binlogFiles returns the binlog files of the directory in order, from the
+// file from, or all the files with the first base name in order if from is
+// empty.
+func binlogFiles(dir string, from string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	type binlogFile struct {
+		name string
+		base string
+		seq  uint64
+	}
+	var files []binlogFile
+	for _, entry := range entries {
+		m := binlogFileExp.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || m == nil {
+			continue
+		}
+		seq, err := strconv.ParseUint(m[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		files = append(files, binlogFile{name: entry.Name(), base: m[1], seq: seq})
+	}
+	slices.SortFunc(files, func(a, b binlogFile) int {
+		return cmp.Or(cmp.Compare(a.base, b.base), cmp.Compare(a.seq, b.seq))
+	})
+
+	var base string
+	if m := binlogFileExp.FindStringSubmatch(from); m != nil {
+		base = m[1]
+	} else if len(files) > 0 {
+		base = files[0].base
+	}
+	var names []string
+	for _, f := range files {
+		if f.base == base && (len(names) > 0 || from == "" || f.name == from) {
+			names = append(names, f.name)
+		}
+	}
+	if from != "" && len(names) == 0 {
+		return nil, errors.Errorf("binlog file %s is not in %s", from, dir)
+	}
+	return names, nil
+}
+
+// gtidTracker adds the GTIDs of the binlog files to the GTID set, like
+// BinlogSyncer does for the events sent by the server.
+type gtidTracker struct {
+	set mysql.GTIDSet
+}
+
+func (t *gtidTracker) update(ev *replication.BinlogEvent) error {
+	switch e := ev.Event.(type) {
+	case *replication.PreviousGTIDsEvent:
+		// the GTID set before the first file
+		if t.set == nil {
+			set, err := mysql.ParseMysqlGTIDSet(e.GTIDSets)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			t.set = set
+		}
+	case *replication.MariadbGTIDListEvent:
+		if t.set == nil {
+			set := &mysql.MariadbGTIDSet{Sets: make(map[uint32]*mysql.MariadbGTID)}
+			for i := range e.GTIDs {
+				if err := set.AddSet(&e.GTIDs[i]); err != nil {
+					return errors.Trace(err)
+				}
+			}
+			t.set = set
+		}
+	case *replication.GTIDEvent:
+		return t.addGTID(e)
+	case *replication.GtidTaggedLogEvent:
+		return t.addGTID(&e.GTIDEvent)
+	case *replication.MariadbGTIDEvent:
+		if set, ok := t.set.(*mysql.MariadbGTIDSet); ok {
+			return errors.Trace(set.AddSet(&e.GTID))
+		}
+	case *replication.XIDEvent:
+		e.GSet = t.current()
+	case *replication.QueryEvent:
+		e.GSet = t.current()
+	case *replication.TransactionPayloadEvent:
+		for _, inner := range e.Events {
+			if err := t.update(inner); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+	return nil
+}
+
+func (t *gtidTracker) addGTID(e *replication.GTIDEvent) error {
+	set, ok := t.set.(*mysql.MysqlGTIDSet)
+	if !ok || isAnonymousGTID(e) {
+		return nil
+	}
+	u, err := uuid.FromBytes(e.SID)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// the tag is empty for untagged GTIDs
+	set.AddGTIDWithTag(u, e.Tag, e.GNO)
+	return nil
+}
+
+func (t *gtidTracker) current() mysql.GTIDSet {
+	if t.set == nil {
+		return nil
+	}
+	return t.set.Clone()
+}
+
+// runOfflineBinlog passes the events of the binlog files of BinlogDir to the
+// event handler, see BinlogDir.
+func (c *Canal) runOfflineBinlog() error {
+	files, err := binlogFiles(c.cfg.BinlogDir, c.master.Position().Name)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(files) == 0 {
+		return errors.Errorf("no binlog files in %s", c.cfg.BinlogDir)
+	}
+
+	var applier *parallelApplier
+	if c.cfg.ParallelWorkers > 1 {
+		applier = newParallelApplier(c, c.cfg.ParallelWorkers)
+		defer applier.close()
+	}
+	handle := func(ev *replication.BinlogEvent) error {
+		if applier != nil {
+			return applier.handleEvent(ev)
+		}
+		return c.handleEvent(ev)
+	}
+
+	p := replication.NewBinlogParser()
+	p.SetFlavor(c.cfg.Flavor)
+	p.SetUseDecimal(c.cfg.UseDecimal)
+	p.SetParseTime(c.cfg.ParseTime)
+	p.SetTimestampStringLocation(c.cfg.TimestampStringLocation)
+	p.SetRowsEventDecodeFunc(c.decodeRowsEvent)
+
+	gtids := &gtidTracker{set: c.master.GTIDSet()}
+	for _, name := range files {
+		pos := c.master.Position()
+		offset := int64(4)
+		if pos.Name == name {
+			offset = int64(pos.Pos)
+		} else {
+			// the first file, or the file before has no rotate event at its
+			// end, like the rotate event sent by the server
+			rotate := &replication.BinlogEvent{
+				Header: &replication.EventHeader{EventType: replication.ROTATE_EVENT},
+				Event:  &replication.RotateEvent{Position: 4, NextLogName: []byte(name)},
+			}
+			if err = handle(rotate); err != nil {
+				return errors.Trace(err)
+			}
+		}
+
+		c.cfg.Logger.Info("read binlog file", slog.String("file", name), slog.Int64("offset", offset))
+		err = p.ParseFile(filepath.Join(c.cfg.BinlogDir, name), offset, func(ev *replication.BinlogEvent) error {
+			if err := c.ctx.Err(); err != nil {
+				return err
+			}
+			if err := gtids.update(ev); err != nil {
+				return errors.Trace(err)
+			}
+			return handle(ev)
+		})
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	if applier != nil {
+		if err = applier.wait(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	c.cfg.Logger.Info("all binlog files are read", slog.Any("pos", c.master.Position()))
+	return errors.Trace(c.syncPosition(nil, c.master.Position(), c.master.GTIDSet(), true))
+}
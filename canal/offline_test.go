@@ -0,0 +1,164 @@
+package canal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/stretchr/testify/require"
+)
+
+type offlineTestHandler struct {
+	transactionTestHandler
+}
+
+func (h *offlineTestHandler) OnRotate(_ *replication.EventHeader, e *replication.RotateEvent) error {
+	h.calls = append(h.calls, fmt.Sprintf("rotate %s", e.NextLogName))
+	return nil
+}
+
+func writeOfflineTestBinlog(t *testing.T, dir string) {
+	gset, err := mysql.ParseMysqlGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-10")
+	require.NoError(t, err)
+	w, err := replication.NewBinlogWriter(replication.BinlogWriterConfig{
+		Dir:               dir,
+		ServerID:          1,
+		ChecksumAlgorithm: replication.BINLOG_CHECKSUM_ALG_CRC32,
+		MaxFileSize:       600,
+		GTIDSet:           gset,
+	})
+	require.NoError(t, err)
+
+	table := &replication.TableMapEvent{
+		TableID:     100,
+		Flags:       1,
+		Schema:      []byte("test"),
+		Table:       []byte("t"),
+		ColumnCount: 1,
+		ColumnType:  []byte{mysql.MYSQL_TYPE_LONG},
+		ColumnMeta:  []uint16{0},
+		NullBitmap:  []byte{0},
+		ColumnName:  [][]byte{[]byte("id")},
+	}
+	for gno := int64(11); gno <= 14; gno++ {
+		rows := replication.NewRowsEvent(replication.WRITE_ROWS_EVENTv2, table, [][]any{{int32(gno)}})
+		rows.Flags = replication.RowsEventStmtEndFlag
+		events := []*replication.BinlogEvent{
+			{Header: &replication.EventHeader{EventType: replication.GTID_EVENT}, Event: &replication.GTIDEvent{CommitFlag: 1, SID: transactionTestSID, GNO: gno}},
+			{Header: &replication.EventHeader{EventType: replication.QUERY_EVENT}, Event: &replication.QueryEvent{Schema: []byte("test"), Query: []byte("BEGIN")}},
+			{Header: &replication.EventHeader{EventType: replication.TABLE_MAP_EVENT}, Event: table},
+			{Header: &replication.EventHeader{EventType: replication.WRITE_ROWS_EVENTv2}, Event: rows},
+			{Header: &replication.EventHeader{EventType: replication.XID_EVENT}, Event: &replication.XIDEvent{XID: uint64(gno)}},
+		}
+		for _, e := range events {
+			e.Header.ServerID = 10
+			e.Header.Timestamp = 1700000000
+			require.NoError(t, w.WriteEvent(e))
+		}
+	}
+	require.NoError(t, w.Close())
+}
+
+func TestBinlogFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"mysql-bin.000010", "mysql-bin.000009", "mysql-bin.index", "relay.000001", "mysql-bin.000011"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+
+	files, err := binlogFiles(dir, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"mysql-bin.000009", "mysql-bin.000010", "mysql-bin.000011"}, files)
+
+	files, err = binlogFiles(dir, "mysql-bin.000010")
+	require.NoError(t, err)
+	require.Equal(t, []string{"mysql-bin.000010", "mysql-bin.000011"}, files)
+
+	_, err = binlogFiles(dir, "mysql-bin.000001")
+	require.Error(t, err)
+}
+
+func TestOfflineCanal(t *testing.T) {
+	dir := t.TempDir()
+	writeOfflineTestBinlog(t, dir)
+
+	newCanal := func() (*Canal, *offlineTestHandler) {
+		cfg := NewDefaultConfig()
+		cfg.BinlogDir = dir
+		cfg.UseTableMapMetadata = true
+		c, err := NewCanal(cfg)
+		require.NoError(t, err)
+		h := &offlineTestHandler{}
+		c.SetEventHandler(h)
+		return c, h
+	}
+
+	c, h := newCanal()
+	require.NoError(t, c.Run())
+	sid := "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	require.Equal(t, []string{
+		"rotate mysql-bin.000001",
+		"synced 4",
+		"begin " + sid + ":11 1700000000",
+		"row 11 " + sid + ":11",
+		"xid",
+		"commit 428",
+		"synced 428",
+		"begin " + sid + ":12 1700000000",
+		"row 12 " + sid + ":12",
+		"xid",
+		"commit 659",
+		"synced 659",
+		"rotate mysql-bin.000002",
+		"synced 4",
+		"begin " + sid + ":13 1700000000",
+		"row 13 " + sid + ":13",
+		"xid",
+		"commit 428",
+		"synced 428",
+		"begin " + sid + ":14 1700000000",
+		"row 14 " + sid + ":14",
+		"xid",
+		"commit 659",
+		"synced 659",
+		// the writer starts a new file after the rotate event
+		"rotate mysql-bin.000003",
+		"synced 4",
+		"synced 4",
+	}, h.calls)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000003", Pos: 4}, c.SyncedPosition())
+	require.Equal(t, sid+":1-14", c.SyncedGTIDSet().String())
+	c.Close()
+
+	// continue from a position
+	c, h = newCanal()
+	require.NoError(t, c.RunFrom(mysql.Position{Name: "mysql-bin.000002", Pos: 428}))
+	require.Equal(t, []string{
+		"begin " + sid + ":14 1700000000",
+		"row 14 " + sid + ":14",
+		"xid",
+		"commit 659",
+		"synced 659",
+		"rotate mysql-bin.000003",
+		"synced 4",
+		"synced 4",
+	}, h.calls)
+	c.Close()
+}
+
+func TestGTIDTrackerAnonymousGTID(t *testing.T) {
+	sid := "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	tracker := &gtidTracker{}
+	events := []replication.Event{
+		&replication.PreviousGTIDsEvent{GTIDSets: sid + ":1-10"},
+		// written with gtid_mode=OFF_PERMISSIVE: no GTID to add
+		&replication.GTIDEvent{SID: make([]byte, 16)},
+		&replication.GTIDEvent{SID: transactionTestSID, GNO: 11},
+	}
+	for _, e := range events {
+		require.NoError(t, tracker.update(&replication.BinlogEvent{Event: e}))
+	}
+	require.Equal(t, sid+":1-11", tracker.current().String())
+}
@@ -0,0 +1,385 @@
+package canal
+
+import (
+	"log/slog"
+	"math"
+	"sync"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/pingcap/errors"
+)
+
+// serialLastCommitted marks a transaction which has to wait for all the
+// transactions before it, like the ones without a logical clock.
+const serialLastCommitted int64 = math.MaxInt64
+
+// parallelTrx is a transaction buffered for a worker of the parallelApplier.
+type parallelTrx struct {
+	events []*replication.BinlogEvent
+
+	// the logical clock of the transaction, it can run once every
+	// transaction with a sequence number <= lastCommitted is done
+	lastCommitted  int64
+	sequenceNumber int64
+
+	done bool
+
+	info Transaction
+	// OnBegin is called and OnCommit is not yet
+	open bool
+
+	// the position and GTID set after the transaction
+	header *replication.EventHeader
+	pos    mysql.Position
+	gset   mysql.GTIDSet
+}
+
+// parallelApplier applies the transactions of the binlog on several workers,
+// scheduling them by the logical clock of the GTID events like the
+// LOGICAL_CLOCK parallel replication of MySQL, or by the group commit ids of
+// MariaDB. Events outside of transactions, like DDL and rotate events, are
+// handled by the caller after waiting for all the transactions in flight.
+//
+// Positions are synced with the watermark, the end of the last transaction
+// which has been handled together with all the transactions before it.
+type parallelApplier struct {
+	c *Canal
+
+	workers int
+	trxCh   chan *parallelTrx
+	wg      sync.WaitGroup
+
+	// trx is the transaction being read
+	trx *parallelTrx
+
+	// MariaDB group commits are translated to a logical clock
+	mariadbSequence      int64
+	mariadbCommitID      uint64
+	mariadbLastCommitted int64
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// pending holds the dispatched transactions in binlog order until they
+	// and all the transactions before them are done
+	pending []*parallelTrx
+	err     error
+}
+
+func newParallelApplier(c *Canal, workers int) *parallelApplier {
+	a := &parallelApplier{
+		c:       c,
+		workers: workers,
+		trxCh:   make(chan *parallelTrx),
+	}
+	a.cond = sync.NewCond(&a.mu)
+
+	a.wg.Add(workers)
+	for range workers {
+		go a.runWorker()
+	}
+
+	return a
+}
+
+// close waits for the workers to finish the dispatched transactions.
+func (a *parallelApplier) close() {
+	close(a.trxCh)
+	a.wg.Wait()
+}
+
+func (a *parallelApplier) handleEvent(ev *replication.BinlogEvent) error {
+	if err := a.error(); err != nil {
+		return err
+	}
+
+	switch e := ev.Event.(type) {
+	case *replication.GTIDEvent:
+		a.startTrx(ev, e)
+		return nil
+	case *replication.GtidTaggedLogEvent:
+		a.startTrx(ev, &e.GTIDEvent)
+		return nil
+	case *replication.MariadbGTIDEvent:
+		a.startMariadbTrx(ev, e)
+		return nil
+	case *replication.QueryEvent:
+		if a.trx == nil && !replication.IsBeginQuery(e.Query) {
+			break
+		}
+		switch {
+		case replication.IsBeginQuery(e.Query):
+			if a.trx == nil {
+				// no GTID event, the transaction can't run in parallel
+				a.trx = &parallelTrx{
+					lastCommitted: serialLastCommitted,
+					info:          Transaction{CommitTime: eventTime(ev.Header)},
+				}
+			}
+			a.trx.events = append(a.trx.events, ev)
+			return nil
+		case replication.IsEndQuery(e.Query):
+			a.trx.events = append(a.trx.events, ev)
+			a.trx.gset = e.GSet
+			return a.dispatch(ev)
+		}
+		// DDL and statements are handled sequentially
+	case *replication.XIDEvent:
+		if a.trx == nil {
+			break
+		}
+		a.trx.events = append(a.trx.events, ev)
+		a.trx.gset = e.GSet
+		return a.dispatch(ev)
+	case *replication.TransactionPayloadEvent:
+		if a.trx == nil {
+			break
+		}
+		a.trx.events = append(a.trx.events, ev)
+		for _, subEvent := range e.Events {
+			if xid, ok := subEvent.Event.(*replication.XIDEvent); ok {
+				a.trx.gset = xid.GSet
+			}
+		}
+		return a.dispatch(ev)
+	case *replication.RotateEvent:
+		// handled after the transactions in flight
+	default:
+		if a.trx != nil {
+			a.trx.events = append(a.trx.events, ev)
+			return nil
+		}
+	}
+
+	return a.handleSequentially(ev)
+}
+
+func (a *parallelApplier) startTrx(ev *replication.BinlogEvent, e *replication.GTIDEvent) {
+	// an unfinished transaction is sent again after a reconnection
+	a.trx = &parallelTrx{
+		events:         []*replication.BinlogEvent{ev},
+		lastCommitted:  e.LastCommitted,
+		sequenceNumber: e.SequenceNumber,
+		info:           newTransaction(ev.Header, e),
+	}
+	if e.LastCommitted == 0 && e.SequenceNumber == 0 {
+		// written by a server without logical clock
+		a.trx.lastCommitted = serialLastCommitted
+	}
+}
+
+func (a *parallelApplier) startMariadbTrx(ev *replication.BinlogEvent, e *replication.MariadbGTIDEvent) {
+	a.mariadbSequence++
+
+	// the transactions of a group commit can run in parallel, each group
+	// waits for all the transactions before it
+	groupCommit := e.Flags&replication.BINLOG_MARIADB_FL_GROUP_COMMIT_ID != 0
+	if !groupCommit || e.CommitID != a.mariadbCommitID {
+		a.mariadbLastCommitted = a.mariadbSequence - 1
+	}
+	a.mariadbCommitID = 0
+	if groupCommit {
+		a.mariadbCommitID = e.CommitID
+	}
+
+	a.trx = &parallelTrx{
+		events:         []*replication.BinlogEvent{ev},
+		lastCommitted:  a.mariadbLastCommitted,
+		sequenceNumber: a.mariadbSequence,
+		info:           newTransaction(ev.Header, e),
+	}
+}
+
+// handleSequentially waits for the transactions in flight, then handles the
+// event and the events of an unfinished transaction before it like without
+// parallel workers.
+func (a *parallelApplier) handleSequentially(ev *replication.BinlogEvent) error {
+	if err := a.wait(); err != nil {
+		return err
+	}
+
+	if a.trx != nil {
+		for _, e := range a.trx.events {
+			if err := a.c.handleEvent(e); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		a.trx = nil
+	}
+
+	return a.c.handleEvent(ev)
+}
+
+// wait waits until all the dispatched transactions are done.
+func (a *parallelApplier) wait() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for a.err == nil && len(a.pending) > 0 {
+		a.cond.Wait()
+	}
+	return a.err
+}
+
+func (a *parallelApplier) error() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.err
+}
+
+// dispatch passes the finished transaction to a worker once the transactions
+// it depends on are done.
+func (a *parallelApplier) dispatch(last *replication.BinlogEvent) error {
+	trx := a.trx
+	a.trx = nil
+
+	trx.header = last.Header
+	trx.pos = mysql.Position{Name: a.c.master.Position().Name, Pos: last.Header.LogPos}
+
+	a.mu.Lock()
+	for a.err == nil && a.blocked(trx) {
+		a.cond.Wait()
+	}
+	err := a.err
+	if err == nil {
+		a.pending = append(a.pending, trx)
+	}
+	a.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	a.trxCh <- trx
+	return nil
+}
+
+// blocked reports whether the transaction has to wait, it must be called with mu held.
+func (a *parallelApplier) blocked(trx *parallelTrx) bool {
+	// at most one transaction per worker is in flight
+	if len(a.pending) >= a.workers {
+		return true
+	}
+
+	for _, p := range a.pending {
+		if !p.done && (trx.lastCommitted == serialLastCommitted || p.sequenceNumber <= trx.lastCommitted) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *parallelApplier) runWorker() {
+	defer a.wg.Done()
+
+	for trx := range a.trxCh {
+		var err error
+		for _, ev := range trx.events {
+			if err = a.applyEvent(ev, trx); err != nil {
+				break
+			}
+		}
+		a.finish(trx, err)
+	}
+}
+
+// applyEvent calls the event handler for an event of a transaction.
+func (a *parallelApplier) applyEvent(ev *replication.BinlogEvent, trx *parallelTrx) error {
+	h := a.c.eventHandler
+	name := trx.pos.Name
+
+	switch e := ev.Event.(type) {
+	case *replication.RowsEvent:
+		if err := a.c.handleRowsEvent(ev, trx.info, mysql.Position{Name: name, Pos: ev.Header.LogPos}); err != nil {
+			a.c.cfg.Logger.Error("handle rows event", slog.String("file", name), slog.Uint64("position", uint64(ev.Header.LogPos)), slog.Any("error", err))
+			return errors.Trace(err)
+		}
+	case *replication.TransactionPayloadEvent:
+		for _, subEvent := range e.Events {
+			if err := a.applyEvent(subEvent, trx); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	case *replication.XIDEvent:
+		pos := mysql.Position{Name: name, Pos: ev.Header.LogPos}
+		if err := h.OnXID(ev.Header, pos); err != nil {
+			return errors.Trace(err)
+		}
+		return a.commit(ev.Header, pos, trx)
+	case *replication.QueryEvent:
+		switch {
+		case replication.IsBeginQuery(e.Query):
+			return a.begin(ev.Header, trx)
+		case replication.IsEndQuery(e.Query):
+			return a.commit(ev.Header, mysql.Position{Name: name, Pos: ev.Header.LogPos}, trx)
+		}
+	case *replication.MariadbGTIDEvent:
+		if err := h.OnGTID(ev.Header, e); err != nil {
+			return errors.Trace(err)
+		}
+		return a.begin(ev.Header, trx)
+	case *replication.GTIDEvent:
+		if err := h.OnGTID(ev.Header, e); err != nil {
+			return errors.Trace(err)
+		}
+		return a.begin(ev.Header, trx)
+	case *replication.GtidTaggedLogEvent:
+		return a.begin(ev.Header, trx)
+	case *replication.RowsQueryEvent:
+		return errors.Trace(h.OnRowsQueryEvent(e))
+	}
+	return nil
+}
+
+func (a *parallelApplier) begin(header *replication.EventHeader, trx *parallelTrx) error {
+	if trx.open {
+		return nil
+	}
+	trx.open = true
+	info := trx.info
+	return a.c.onBegin(header, &info)
+}
+
+func (a *parallelApplier) commit(header *replication.EventHeader, pos mysql.Position, trx *parallelTrx) error {
+	if !trx.open {
+		return nil
+	}
+	trx.open = false
+	return a.c.onCommit(header, pos)
+}
+
+// finish marks the transaction as done and syncs the position when the
+// watermark moves.
+func (a *parallelApplier) finish(trx *parallelTrx, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	defer a.cond.Broadcast()
+
+	if err != nil {
+		if a.err == nil {
+			a.err = err
+		}
+		return
+	}
+
+	trx.done = true
+
+	var watermark *parallelTrx
+	for len(a.pending) > 0 && a.pending[0].done {
+		watermark = a.pending[0]
+		a.pending = a.pending[1:]
+	}
+	if watermark == nil || a.err != nil {
+		return
+	}
+
+	// positions are synced in order while holding the lock
+	a.c.master.Update(watermark.pos)
+	a.c.master.UpdateTimestamp(watermark.header.Timestamp)
+	if watermark.gset != nil {
+		a.c.master.UpdateGTIDSet(watermark.gset)
+	}
+	if err = a.c.syncPosition(watermark.header, watermark.pos, a.c.master.GTIDSet(), false); err != nil {
+		a.err = errors.Trace(err)
+	}
+}
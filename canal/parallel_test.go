@@ -0,0 +1,137 @@
+package canal
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+	"github.com/pingcap/tidb/pkg/parser"
+	"github.com/stretchr/testify/require"
+)
+
+type parallelTestHandler struct {
+	DummyEventHandler
+
+	// the first transaction waits until the second one started
+	secondStarted chan struct{}
+
+	mu     sync.Mutex
+	rows   []any
+	synced []uint32
+	ddl    int
+}
+
+func (h *parallelTestHandler) OnRow(e *RowsEvent) error {
+	switch e.Rows[0][0] {
+	case int32(1):
+		select {
+		case <-h.secondStarted:
+		case <-time.After(5 * time.Second):
+			return mysql.ErrBadConn
+		}
+	case int32(2):
+		close(h.secondStarted)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.rows = append(h.rows, e.Rows[0][0])
+	return nil
+}
+
+func (h *parallelTestHandler) OnDDL(*replication.EventHeader, mysql.Position, *replication.QueryEvent) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ddl++
+	return nil
+}
+
+func (h *parallelTestHandler) OnPosSynced(_ *replication.EventHeader, pos mysql.Position, _ mysql.GTIDSet, _ bool) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.synced = append(h.synced, pos.Pos)
+	return nil
+}
+
+func parallelTestTransaction(id int32, lastCommitted, sequenceNumber int64, endPos uint32) []*replication.BinlogEvent {
+	table := &replication.TableMapEvent{Schema: []byte("test"), Table: []byte("t")}
+	return []*replication.BinlogEvent{
+		{
+			Header: &replication.EventHeader{EventType: replication.GTID_EVENT, LogPos: endPos - 30},
+			Event:  &replication.GTIDEvent{LastCommitted: lastCommitted, SequenceNumber: sequenceNumber},
+		},
+		{
+			Header: &replication.EventHeader{EventType: replication.QUERY_EVENT, LogPos: endPos - 20},
+			Event:  &replication.QueryEvent{Query: []byte("BEGIN")},
+		},
+		{
+			Header: &replication.EventHeader{EventType: replication.WRITE_ROWS_EVENTv2, LogPos: endPos - 10},
+			Event:  &replication.RowsEvent{Table: table, Rows: [][]any{{id}}},
+		},
+		{
+			Header: &replication.EventHeader{EventType: replication.XID_EVENT, LogPos: endPos},
+			Event:  &replication.XIDEvent{XID: uint64(id)},
+		},
+	}
+}
+
+func TestParallelApplier(t *testing.T) {
+	h := &parallelTestHandler{secondStarted: make(chan struct{})}
+
+	cfg := NewDefaultConfig()
+	c := &Canal{
+		cfg:          cfg,
+		parser:       parser.New(),
+		master:       &masterInfo{logger: cfg.Logger},
+		eventHandler: h,
+		tables:       make(map[string]*schema.Table),
+	}
+	c.master.Update(mysql.Position{Name: "mysql-bin.000001", Pos: 4})
+	c.SetTableCache([]byte("test"), []byte("t"), &schema.Table{Schema: "test", Name: "t", Columns: []schema.TableColumn{{Name: "id"}}})
+
+	var events []*replication.BinlogEvent
+	// the first two transactions run in parallel, the third one waits for both
+	events = append(events, parallelTestTransaction(1, 0, 1, 100)...)
+	events = append(events, parallelTestTransaction(2, 0, 2, 200)...)
+	events = append(events, parallelTestTransaction(3, 2, 3, 300)...)
+	// a DDL waits for all the transactions
+	events = append(events, &replication.BinlogEvent{
+		Header: &replication.EventHeader{EventType: replication.QUERY_EVENT, LogPos: 400},
+		Event:  &replication.QueryEvent{Schema: []byte("test"), Query: []byte("ALTER TABLE t ADD COLUMN c INT")},
+	})
+
+	a := newParallelApplier(c, 4)
+	for _, ev := range events {
+		require.NoError(t, a.handleEvent(ev))
+	}
+	a.close()
+
+	require.Equal(t, []any{int32(2), int32(1), int32(3)}, h.rows)
+	// the position of the second transaction is only synced after the first one
+	require.Equal(t, []uint32{200, 300, 400}, h.synced)
+	require.Equal(t, 1, h.ddl)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000001", Pos: 400}, c.SyncedPosition())
+}
+
+func TestParallelApplierMariadbGroupCommit(t *testing.T) {
+	a := &parallelApplier{}
+
+	lastCommitted := func(commitID uint64) int64 {
+		e := &replication.MariadbGTIDEvent{CommitID: commitID}
+		if commitID != 0 {
+			e.Flags = replication.BINLOG_MARIADB_FL_GROUP_COMMIT_ID
+		}
+		a.startMariadbTrx(&replication.BinlogEvent{Event: e}, e)
+		return a.trx.lastCommitted
+	}
+
+	require.Equal(t, int64(0), lastCommitted(10))
+	require.Equal(t, int64(0), lastCommitted(10))
+	require.Equal(t, int64(2), lastCommitted(11))
+	require.Equal(t, int64(3), lastCommitted(0))
+	require.Equal(t, int64(4), lastCommitted(12))
+	require.Equal(t, int64(4), lastCommitted(12))
+}
@@ -0,0 +1,297 @@
+package canal
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// PositionStore persists the binlog position and the GTID set canal has
+// synced, so that Run can resume from them after a restart.
+type PositionStore interface {
+	// Load returns the saved position and GTID set. An empty position and a
+	// nil GTID set are returned when nothing has been saved yet.
+	Load() (mysql.Position, mysql.GTIDSet, error)
+	// Save persists the position and the GTID set, the set may be nil.
+	Save(pos mysql.Position, set mysql.GTIDSet) error
+}
+
+type storedPosition struct {
+	Name    string `toml:"bin_name"`
+	Pos     uint32 `toml:"bin_pos"`
+	GTIDSet string `toml:"gtid_set"`
+}
+
+func newStoredPosition(pos mysql.Position, set mysql.GTIDSet) storedPosition {
+	p := storedPosition{Name: pos.Name, Pos: pos.Pos}
+	if set != nil {
+		p.GTIDSet = set.String()
+	}
+	return p
+}
+
+func (p storedPosition) decode(flavor string) (mysql.Position, mysql.GTIDSet, error) {
+	pos := mysql.Position{Name: p.Name, Pos: p.Pos}
+	if p.GTIDSet == "" {
+		return pos, nil, nil
+	}
+
+	set, err := mysql.ParseGTIDSet(flavor, p.GTIDSet)
+	if err != nil {
+		return pos, nil, errors.Trace(err)
+	}
+	return pos, set, nil
+}
+
+// FilePositionStore saves the position in a TOML file. The file is replaced
+// atomically by renaming a temporary file written in the same directory.
+type FilePositionStore struct {
+	path   string
+	flavor string
+}
+
+// NewFilePositionStore creates a store saving to path, the flavor is used to
+// parse the GTID set.
+func NewFilePositionStore(path string, flavor string) *FilePositionStore {
+	return &FilePositionStore{path: path, flavor: flavor}
+}
+
+func (s *FilePositionStore) Load() (mysql.Position, mysql.GTIDSet, error) {
+	var p storedPosition
+	if _, err := toml.DecodeFile(s.path, &p); err != nil {
+		if os.IsNotExist(err) {
+			return mysql.Position{}, nil, nil
+		}
+		return mysql.Position{}, nil, errors.Trace(err)
+	}
+
+	return p.decode(s.flavor)
+}
+
+func (s *FilePositionStore) Save(pos mysql.Position, set mysql.GTIDSet) error {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(newStoredPosition(pos, set)); err != nil {
+		return errors.Trace(err)
+	}
+
+	return errors.Trace(writeFileAtomic(s.path, buf.Bytes()))
+}
+
+// writeFileAtomic replaces the file at path by renaming a temporary file
+// written in the same directory.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer func() {
+		// no-op once renamed
+		_ = os.Remove(f.Name())
+	}()
+
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	return errors.Trace(os.Rename(f.Name(), path))
+}
+
+// MySQLPositionStore saves the position in a row of a MySQL table, keyed by
+// the name of the store so that several canals can share the table.
+type MySQLPositionStore struct {
+	conn mysql.Executer
+	// the quoted name of the table
+	table  string
+	name   string
+	flavor string
+}
+
+// NewMySQLPositionStore creates a store saving to the row name of table,
+// the table is created if it doesn't exist. The table name may be qualified
+// with a database, like `db.canal_position`.
+func NewMySQLPositionStore(conn mysql.Executer, table string, name string, flavor string) (*MySQLPositionStore, error) {
+	s := &MySQLPositionStore{conn: conn, table: quoteTableName(table), name: name, flavor: flavor}
+
+	_, err := conn.Execute(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		name VARCHAR(255) NOT NULL PRIMARY KEY,
+		bin_name VARCHAR(255) NOT NULL,
+		bin_pos BIGINT UNSIGNED NOT NULL,
+		gtid_set TEXT NOT NULL,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+	)`, s.table))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return s, nil
+}
+
+func (s *MySQLPositionStore) Load() (mysql.Position, mysql.GTIDSet, error) {
+	r, err := s.conn.Execute(fmt.Sprintf("SELECT bin_name, bin_pos, gtid_set FROM %s WHERE name = ?", s.table), s.name)
+	if err != nil {
+		return mysql.Position{}, nil, errors.Trace(err)
+	}
+	defer r.Close()
+
+	if r.RowNumber() == 0 {
+		return mysql.Position{}, nil, nil
+	}
+
+	var p storedPosition
+	if p.Name, err = r.GetString(0, 0); err != nil {
+		return mysql.Position{}, nil, errors.Trace(err)
+	}
+	pos, err := r.GetUint(0, 1)
+	if err != nil {
+		return mysql.Position{}, nil, errors.Trace(err)
+	}
+	p.Pos = uint32(pos)
+	if p.GTIDSet, err = r.GetString(0, 2); err != nil {
+		return mysql.Position{}, nil, errors.Trace(err)
+	}
+
+	return p.decode(s.flavor)
+}
+
+func (s *MySQLPositionStore) Save(pos mysql.Position, set mysql.GTIDSet) error {
+	p := newStoredPosition(pos, set)
+	r, err := s.conn.Execute(fmt.Sprintf(`INSERT INTO %s (name, bin_name, bin_pos, gtid_set) VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE bin_name = VALUES(bin_name), bin_pos = VALUES(bin_pos), gtid_set = VALUES(gtid_set)`, s.table),
+		s.name, p.Name, p.Pos, p.GTIDSet)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	r.Close()
+	return nil
+}
+
+// positionSaver batches the saves to the PositionStore of the config.
+type positionSaver struct {
+	store     PositionStore
+	batchSize int
+	interval  time.Duration
+	logger    *slog.Logger
+
+	mu       sync.Mutex
+	unsaved  int
+	lastSave time.Time
+	// the last position not saved yet, saved by the timer once the interval
+	// elapsed if no other position comes
+	pending    *mysql.Position
+	pendingSet mysql.GTIDSet
+	timer      *time.Timer
+}
+
+// save saves the position when force is true, or when the batch size or the
+// interval is reached. Without batch size and interval every position is saved.
+func (s *positionSaver) save(pos mysql.Position, set mysql.GTIDSet, force bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.unsaved++
+	if !force && (s.batchSize > 0 || s.interval > 0) {
+		batchFull := s.batchSize > 0 && s.unsaved >= s.batchSize
+		intervalElapsed := s.interval > 0 && time.Since(s.lastSave) >= s.interval
+		if !batchFull && !intervalElapsed {
+			s.pending, s.pendingSet = &pos, set
+			if s.interval > 0 && s.timer == nil {
+				s.timer = time.AfterFunc(s.interval-time.Since(s.lastSave), s.flush)
+			}
+			return nil
+		}
+	}
+
+	return errors.Trace(s.saveLocked(pos, set))
+}
+
+// flush saves the pending position, it is called by the timer.
+func (s *positionSaver) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.timer = nil
+	if s.pending == nil {
+		return
+	}
+	if err := s.saveLocked(*s.pending, s.pendingSet); err != nil {
+		s.logger.Error("save pending position", slog.Any("pos", *s.pending), slog.Any("error", err))
+	}
+}
+
+// saveLocked saves the position, it must be called with mu held.
+func (s *positionSaver) saveLocked(pos mysql.Position, set mysql.GTIDSet) error {
+	if err := s.store.Save(pos, set); err != nil {
+		return errors.Trace(err)
+	}
+	s.logger.Debug("save position", slog.Any("pos", pos), slog.Any("gset", set))
+
+	s.unsaved = 0
+	s.lastSave = time.Now()
+	s.pending, s.pendingSet = nil, nil
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	return nil
+}
+
+// syncPosition passes the synced position to OnPosSynced of the event
+// handler, then saves it in the PositionStore if one is configured.
+func (c *Canal) syncPosition(header *replication.EventHeader, pos mysql.Position, set mysql.GTIDSet, force bool) error {
+	start := time.Now()
+	err := c.eventHandler.OnPosSynced(header, pos, set, force)
+	c.observeHandler("OnPosSynced", start)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if c.posSaver == nil {
+		return nil
+	}
+	return errors.Trace(c.posSaver.save(pos, set, force))
+}
+
+// loadPosition sets the master position to the one saved in the
+// PositionStore, unless a position or a GTID set has already been set.
+func (c *Canal) loadPosition() error {
+	if c.posSaver == nil {
+		return nil
+	}
+
+	pos := c.master.Position()
+	gset := c.master.GTIDSet()
+	if (len(pos.Name) > 0 && pos.Pos > 0) || (gset != nil && gset.String() != "") {
+		return nil
+	}
+
+	pos, gset, err := c.posSaver.store.Load()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(pos.Name) == 0 && gset == nil {
+		return nil
+	}
+
+	c.cfg.Logger.Info("load saved position", slog.Any("pos", pos), slog.Any("gset", gset))
+	c.master.Update(pos)
+	if gset != nil {
+		c.master.UpdateGTIDSet(gset)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package canal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilePositionStore(t *testing.T) {
+	s := NewFilePositionStore(filepath.Join(t.TempDir(), "position.toml"), mysql.MySQLFlavor)
+
+	pos, gset, err := s.Load()
+	require.NoError(t, err)
+	require.Equal(t, mysql.Position{}, pos)
+	require.Nil(t, gset)
+
+	require.NoError(t, s.Save(mysql.Position{Name: "mysql-bin.000001", Pos: 4}, nil))
+	pos, gset, err = s.Load()
+	require.NoError(t, err)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000001", Pos: 4}, pos)
+	require.Nil(t, gset)
+
+	set, err := mysql.ParseMysqlGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-15")
+	require.NoError(t, err)
+	require.NoError(t, s.Save(mysql.Position{Name: "mysql-bin.000002", Pos: 1024}, set))
+	pos, gset, err = s.Load()
+	require.NoError(t, err)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000002", Pos: 1024}, pos)
+	require.Equal(t, set.String(), gset.String())
+
+	// no temporary files are left behind
+	files, err := filepath.Glob(filepath.Join(filepath.Dir(s.path), "*"))
+	require.NoError(t, err)
+	require.Equal(t, []string{s.path}, files)
+}
+
+type testExecuter struct {
+	queries []string
+}
+
+func (e *testExecuter) Execute(query string, _ ...any) (*mysql.Result, error) {
+	e.queries = append(e.queries, query)
+	return mysql.NewResult(mysql.NewResultset(3)), nil
+}
+
+func TestMySQLPositionStoreQuoting(t *testing.T) {
+	e := &testExecuter{}
+	s, err := NewMySQLPositionStore(e, "my db.canal`position", "c1", mysql.MySQLFlavor)
+	require.NoError(t, err)
+	_, _, err = s.Load()
+	require.NoError(t, err)
+	require.NoError(t, s.Save(mysql.Position{Name: "mysql-bin.000001", Pos: 4}, nil))
+
+	require.Len(t, e.queries, 3)
+	for _, query := range e.queries {
+		require.Contains(t, query, " `my db`.`canal``position` ")
+	}
+}
+
+type testPositionStore struct {
+	saved []mysql.Position
+}
+
+func (s *testPositionStore) Load() (mysql.Position, mysql.GTIDSet, error) {
+	if len(s.saved) == 0 {
+		return mysql.Position{}, nil, nil
+	}
+	return s.saved[len(s.saved)-1], nil, nil
+}
+
+func (s *testPositionStore) Save(pos mysql.Position, _ mysql.GTIDSet) error {
+	s.saved = append(s.saved, pos)
+	return nil
+}
+
+func TestPositionSaverBatch(t *testing.T) {
+	store := &testPositionStore{}
+	cfg := NewDefaultConfig()
+	s := &positionSaver{store: store, batchSize: 3, interval: time.Hour, logger: cfg.Logger, lastSave: time.Now()}
+
+	for i := uint32(1); i <= 7; i++ {
+		require.NoError(t, s.save(mysql.Position{Name: "mysql-bin.000001", Pos: i}, nil, i == 5))
+	}
+
+	// saved when the batch is full, and when forced
+	require.Equal(t, []mysql.Position{
+		{Name: "mysql-bin.000001", Pos: 3},
+		{Name: "mysql-bin.000001", Pos: 5},
+	}, store.saved)
+}
+
+func TestPositionSaverIdle(t *testing.T) {
+	store := &testPositionStore{}
+	cfg := NewDefaultConfig()
+	s := &positionSaver{store: store, interval: 50 * time.Millisecond, logger: cfg.Logger, lastSave: time.Now()}
+
+	require.NoError(t, s.save(mysql.Position{Name: "mysql-bin.000001", Pos: 1}, nil, false))
+	require.NoError(t, s.save(mysql.Position{Name: "mysql-bin.000001", Pos: 2}, nil, false))
+
+	// the last position is saved once the interval elapsed without new events
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(store.saved) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	s.mu.Lock()
+	require.Equal(t, []mysql.Position{{Name: "mysql-bin.000001", Pos: 2}}, store.saved)
+	require.Nil(t, s.timer)
+	s.mu.Unlock()
+}
+
+func TestCanalLoadPosition(t *testing.T) {
+	store := &testPositionStore{saved: []mysql.Position{{Name: "mysql-bin.000003", Pos: 120}}}
+	cfg := NewDefaultConfig()
+	c := &Canal{
+		cfg:      cfg,
+		master:   &masterInfo{logger: cfg.Logger},
+		posSaver: &positionSaver{store: store, logger: cfg.Logger},
+	}
+
+	require.NoError(t, c.loadPosition())
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000003", Pos: 120}, c.master.Position())
+
+	// a position set by RunFrom wins
+	c.master.Update(mysql.Position{Name: "mysql-bin.000001", Pos: 4})
+	require.NoError(t, c.loadPosition())
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000001", Pos: 4}, c.master.Position())
+}
@@ -0,0 +1,156 @@
+package canal
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// RowChange is the change of one row, with the values keyed by column name.
+type RowChange struct {
+	Table  *schema.Table
+	Action string
+
+	// PKValues are the primary key values of the row after an insert or
+	// update, and before a delete. It's nil if the table has no primary key.
+	PKValues []any
+
+	// Before is the row before an update or delete, nil for an insert.
+	Before map[string]any
+	// After is the row after an insert or update, nil for a delete.
+	After map[string]any
+
+	// ChangedColumns are the columns whose value is changed by an update, in
+	// the order of the table. For inserts and deletes all the columns are
+	// listed. Columns not logged with binlog_row_image=MINIMAL are skipped.
+	ChangedColumns []string
+
+	// GTID and CommitTime are copied from the RowsEvent.
+	GTID       string
+	CommitTime time.Time
+
+	Header *replication.EventHeader
+}
+
+// IsChanged reports whether the column is changed.
+func (c *RowChange) IsChanged(column string) bool {
+	return slices.Contains(c.ChangedColumns, column)
+}
+
+// String implements fmt.Stringer interface.
+func (c *RowChange) String() string {
+	return fmt.Sprintf("%s %s %v before %v after %v", c.Action, c.Table, c.PKValues, c.Before, c.After)
+}
+
+// RowChanges returns the changes of the rows of the event, an update is one
+// change with its before and after rows.
+func (r *RowsEvent) RowChanges() ([]*RowChange, error) {
+	step := 1
+	if r.Action == UpdateAction {
+		step = 2
+		if len(r.Rows)%2 != 0 {
+			return nil, errors.Errorf("update event of %s has %d rows, an even number is expected", r.Table, len(r.Rows))
+		}
+	}
+
+	changes := make([]*RowChange, 0, len(r.Rows)/step)
+	for i := 0; i < len(r.Rows); i += step {
+		change := &RowChange{
+			Table:      r.Table,
+			Action:     r.Action,
+			GTID:       r.GTID,
+			CommitTime: r.CommitTime,
+			Header:     r.Header,
+		}
+
+		row, err := r.rowImage(i)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		switch r.Action {
+		case InsertAction:
+			change.After = row
+		case DeleteAction:
+			change.Before = row
+		default:
+			change.Before = row
+			if change.After, err = r.rowImage(i + 1); err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+
+		image := r.Rows[i+step-1]
+		if len(r.Table.PKColumns) > 0 {
+			change.PKValues = make([]any, len(r.Table.PKColumns))
+			for j, idx := range r.Table.PKColumns {
+				change.PKValues[j] = image[idx]
+			}
+		}
+
+		for _, column := range r.Table.Columns {
+			if r.Action == UpdateAction {
+				before, ok1 := change.Before[column.Name]
+				after, ok2 := change.After[column.Name]
+				if !ok1 || !ok2 || valueEqual(before, after) {
+					continue
+				}
+			} else if _, ok := row[column.Name]; !ok {
+				continue
+			}
+			change.ChangedColumns = append(change.ChangedColumns, column.Name)
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+// rowImage returns the values of the i-th row keyed by column name, without
+// the columns skipped in the binlog.
+func (r *RowsEvent) rowImage(i int) (map[string]any, error) {
+	row := r.Rows[i]
+	if len(row) != len(r.Table.Columns) {
+		return nil, errors.Errorf("table %s has %d columns, but row data %v len is %d", r.Table,
+			len(r.Table.Columns), row, len(row))
+	}
+
+	var skipped []int
+	if i < len(r.skippedColumns) {
+		skipped = r.skippedColumns[i]
+	}
+
+	image := make(map[string]any, len(row)-len(skipped))
+	for j, column := range r.Table.Columns {
+		if !slices.Contains(skipped, j) {
+			image[column.Name] = row[j]
+		}
+	}
+	return image, nil
+}
+
+func valueEqual(a, b any) bool {
+	switch va := a.(type) {
+	case []byte:
+		vb, ok := b.([]byte)
+		return ok && bytes.Equal(va, vb)
+	case time.Time:
+		vb, ok := b.(time.Time)
+		return ok && va.Equal(vb)
+	case decimal.Decimal:
+		vb, ok := b.(decimal.Decimal)
+		return ok && va.Equal(vb)
+	case *replication.JsonDiff:
+		// a partial JSON update always changes the value
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
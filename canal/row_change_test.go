@@ -0,0 +1,59 @@
+package canal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRowChanges(t *testing.T) {
+	table := &schema.Table{
+		Schema:    "test",
+		Name:      "t",
+		Columns:   []schema.TableColumn{{Name: "id"}, {Name: "name"}, {Name: "data"}},
+		PKColumns: []int{0},
+	}
+	commitTime := time.Unix(1700000000, 0)
+
+	e := newRowsEvent(table, UpdateAction, [][]any{
+		{int32(1), "a", []byte("x")}, {int32(1), "b", []byte("x")},
+		{int32(2), "c", nil}, {int32(3), "c", []byte("y")},
+	}, nil, nil)
+	e.GTID = "3e11fa47-71ca-11e1-9e33-c80aa9429562:5"
+	e.CommitTime = commitTime
+
+	changes, err := e.RowChanges()
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+
+	require.Equal(t, []any{int32(1)}, changes[0].PKValues)
+	require.Equal(t, map[string]any{"id": int32(1), "name": "a", "data": []byte("x")}, changes[0].Before)
+	require.Equal(t, map[string]any{"id": int32(1), "name": "b", "data": []byte("x")}, changes[0].After)
+	require.Equal(t, []string{"name"}, changes[0].ChangedColumns)
+	require.True(t, changes[0].IsChanged("name"))
+	require.False(t, changes[0].IsChanged("data"))
+	require.Equal(t, e.GTID, changes[0].GTID)
+	require.Equal(t, commitTime, changes[0].CommitTime)
+
+	// the primary key after the update
+	require.Equal(t, []any{int32(3)}, changes[1].PKValues)
+	require.Equal(t, []string{"id", "data"}, changes[1].ChangedColumns)
+
+	// the columns not logged with binlog_row_image=MINIMAL are skipped
+	e = newRowsEvent(table, DeleteAction, [][]any{{int32(4), nil, nil}}, nil,
+		&replication.RowsEvent{SkippedColumns: [][]int{{1, 2}}})
+	changes, err = e.RowChanges()
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	require.Nil(t, changes[0].After)
+	require.Equal(t, map[string]any{"id": int32(4)}, changes[0].Before)
+	require.Equal(t, []any{int32(4)}, changes[0].PKValues)
+	require.Equal(t, []string{"id"}, changes[0].ChangedColumns)
+
+	e = newRowsEvent(table, InsertAction, [][]any{{int32(5), "e"}}, nil, nil)
+	_, err = e.RowChanges()
+	require.Error(t, err)
+}
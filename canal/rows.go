@@ -2,6 +2,7 @@ package canal
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/go-mysql-org/go-mysql/replication"
 	"github.com/go-mysql-org/go-mysql/schema"
@@ -27,6 +28,16 @@ type RowsEvent struct {
 	// Header can be used to inspect the event
 	Header *replication.EventHeader
 	Flags  uint16
+
+	// GTID is the GTID of the transaction, empty without GTID or for the
+	// rows of a dump.
+	GTID string
+	// CommitTime is the commit time of the transaction if the binlog has it,
+	// see RowChange.
+	CommitTime time.Time
+
+	// the columns not logged with binlog_row_image=MINIMAL, for each row
+	skippedColumns [][]int
 }
 
 func newRowsEvent(table *schema.Table, action string, rows [][]any, header *replication.EventHeader, ev *replication.RowsEvent) *RowsEvent {
@@ -38,6 +49,7 @@ func newRowsEvent(table *schema.Table, action string, rows [][]any, header *repl
 	e.Header = header
 	if ev != nil {
 		e.Flags = ev.Flags
+		e.skippedColumns = ev.SkippedColumns
 	}
 
 	e.handleUnsigned()
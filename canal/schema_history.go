@@ -0,0 +1,609 @@
+package canal
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// tableVersion is the definition of a table from a binlog position on. A
+// version without table is either dropped, or unknown when the DDL could not
+// be applied, then the table is fetched from the server again.
+type tableVersion struct {
+	Key     string        `toml:"key"`
+	BinName string        `toml:"bin_name"`
+	BinPos  uint32        `toml:"bin_pos"`
+	Dropped bool          `toml:"dropped"`
+	Table   *schema.Table `toml:"table"`
+}
+
+func (v *tableVersion) position() mysql.Position {
+	return mysql.Position{Name: v.BinName, Pos: v.BinPos}
+}
+
+type storedSchemaHistory struct {
+	Versions []*tableVersion `toml:"version"`
+}
+
+// schemaHistory keeps the versions of the tables, starting with the
+// definition fetched from the server and followed by the DDL of the binlog,
+// so that the rows are decoded with the table in effect at their position.
+type schemaHistory struct {
+	path   string
+	logger *slog.Logger
+
+	mu sync.RWMutex
+	// the versions of each table by db.table, sorted by position
+	tables map[string][]*tableVersion
+}
+
+func loadSchemaHistory(path string, logger *slog.Logger) (*schemaHistory, error) {
+	h := &schemaHistory{
+		path:   path,
+		logger: logger,
+		tables: make(map[string][]*tableVersion),
+	}
+	if path == "" {
+		return h, nil
+	}
+
+	var stored storedSchemaHistory
+	if _, err := toml.DecodeFile(path, &stored); err != nil {
+		if os.IsNotExist(err) {
+			return h, nil
+		}
+		return nil, errors.Trace(err)
+	}
+	for _, v := range stored.Versions {
+		h.tables[v.Key] = append(h.tables[v.Key], v)
+	}
+	return h, nil
+}
+
+// save must be called with mu held.
+func (h *schemaHistory) save() error {
+	if h.path == "" {
+		return nil
+	}
+
+	var stored storedSchemaHistory
+	keys := make([]string, 0, len(h.tables))
+	for key := range h.tables {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		stored.Versions = append(stored.Versions, h.tables[key]...)
+	}
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(stored); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(writeFileAtomic(h.path, buf.Bytes()))
+}
+
+// table returns the table in effect at the position, or the first version
+// if the history starts after it. It returns nil if the table is unknown.
+func (h *schemaHistory) table(key string, pos mysql.Position) (*schema.Table, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	versions := h.tables[key]
+	if len(versions) == 0 {
+		return nil, nil
+	}
+	v := versions[0]
+	for _, next := range versions[1:] {
+		if next.position().Compare(pos) > 0 {
+			break
+		}
+		v = next
+	}
+	if v.Dropped {
+		return nil, schema.ErrTableNotExist
+	}
+	return v.Table, nil
+}
+
+// seed adds the table fetched from the server at the position.
+func (h *schemaHistory) seed(t *schema.Table, pos mysql.Position) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.insert(&tableVersion{Key: t.String(), BinName: pos.Name, BinPos: pos.Pos, Table: t})
+	return h.save()
+}
+
+// insert adds the version in position order, replacing the one at the same
+// position. It must be called with mu held.
+func (h *schemaHistory) insert(v *tableVersion) {
+	versions := h.tables[v.Key]
+	i, found := slices.BinarySearchFunc(versions, v.position(), func(e *tableVersion, pos mysql.Position) int {
+		return e.position().Compare(pos)
+	})
+	if found {
+		versions[i] = v
+	} else {
+		versions = slices.Insert(versions, i, v)
+	}
+	h.tables[v.Key] = versions
+}
+
+// schemaChange collects the versions of the tables changed by the statements
+// of a query event.
+type schemaChange struct {
+	h   *schemaHistory
+	db  string
+	pos mysql.Position
+
+	versions map[string]*tableVersion
+}
+
+func (s *schemaChange) key(t *ast.TableName) string {
+	db := t.Schema.O
+	if db == "" {
+		db = s.db
+	}
+	return fmt.Sprintf("%s.%s", db, t.Name.O)
+}
+
+// current returns the version of the table before the statement, or nil if
+// the table is not in the history, or the history already starts after the
+// statement.
+func (s *schemaChange) current(key string) *tableVersion {
+	if v, ok := s.versions[key]; ok {
+		return v
+	}
+	versions := s.h.tables[key]
+	if len(versions) == 0 || versions[0].position().Compare(s.pos) >= 0 {
+		return nil
+	}
+	var v *tableVersion
+	for _, e := range versions {
+		if e.position().Compare(s.pos) >= 0 {
+			break
+		}
+		v = e
+	}
+	return v
+}
+
+func (s *schemaChange) set(key string, t *schema.Table, dropped bool) {
+	s.versions[key] = &tableVersion{Key: key, BinName: s.pos.Name, BinPos: s.pos.Pos, Dropped: dropped, Table: t}
+}
+
+func (s *schemaChange) rename(oldKey, newKey string, t *schema.Table) {
+	if t != nil {
+		t.Schema, t.Name, _ = strings.Cut(newKey, ".")
+	}
+	s.set(oldKey, nil, true)
+	s.set(newKey, t, false)
+}
+
+// apply replays the DDL of a query event on the tables at the position. The
+// tables which the DDL can't be applied to become unknown.
+func (h *schemaHistory) apply(stmts []ast.StmtNode, db string, pos mysql.Position) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := &schemaChange{h: h, db: db, pos: pos, versions: make(map[string]*tableVersion)}
+	for _, stmt := range stmts {
+		s.apply(stmt)
+	}
+	if len(s.versions) == 0 {
+		return nil
+	}
+
+	for key, v := range s.versions {
+		versions := h.tables[key]
+		// the versions after are written again by the events after
+		i := slices.IndexFunc(versions, func(e *tableVersion) bool {
+			return e.position().Compare(pos) >= 0
+		})
+		if i >= 0 {
+			versions = versions[:i]
+		}
+		h.tables[key] = append(versions, v)
+	}
+	return h.save()
+}
+
+func (s *schemaChange) apply(stmt ast.StmtNode) {
+	switch st := stmt.(type) {
+	case *ast.CreateTableStmt:
+		key := s.key(st.Table)
+		cur := s.current(key)
+		if st.IfNotExists && cur != nil && cur.Table != nil {
+			return
+		}
+		switch {
+		case st.ReferTable != nil:
+			var t *schema.Table
+			if ref := s.current(s.key(st.ReferTable)); ref != nil && ref.Table != nil {
+				t = cloneTable(ref.Table)
+				t.Schema, t.Name, _ = strings.Cut(key, ".")
+			}
+			s.set(key, t, false)
+		case st.Select != nil:
+			// the columns come from the query
+			s.set(key, nil, false)
+		default:
+			t, err := newTableFromCreate(key, st)
+			if err != nil {
+				s.h.logger.Warn("can't replay create table, the table will be fetched again", slog.String("table", key), slog.Any("error", err))
+			}
+			s.set(key, t, false)
+		}
+	case *ast.DropTableStmt:
+		if st.IsView {
+			return
+		}
+		for _, table := range st.Tables {
+			key := s.key(table)
+			if s.current(key) != nil {
+				s.set(key, nil, true)
+			}
+		}
+	case *ast.DropDatabaseStmt:
+		prefix := st.Name.O + "."
+		for key := range s.h.tables {
+			if strings.HasPrefix(key, prefix) && s.current(key) != nil {
+				s.set(key, nil, true)
+			}
+		}
+	case *ast.RenameTableStmt:
+		for _, tt := range st.TableToTables {
+			oldKey, newKey := s.key(tt.OldTable), s.key(tt.NewTable)
+			cur := s.current(oldKey)
+			if cur == nil {
+				if s.current(newKey) != nil {
+					s.set(newKey, nil, false)
+				}
+				continue
+			}
+			var t *schema.Table
+			if cur.Table != nil {
+				t = cloneTable(cur.Table)
+			}
+			s.rename(oldKey, newKey, t)
+		}
+	case *ast.AlterTableStmt:
+		key := s.key(st.Table)
+		t := s.table(key)
+		if t == nil {
+			return
+		}
+		newKey := key
+		for _, spec := range st.Specs {
+			if spec.Tp == ast.AlterTableRenameTable {
+				newKey = s.key(spec.NewTable)
+				continue
+			}
+			if err := alterTable(t, spec); err != nil {
+				s.h.logger.Warn("can't replay alter table, the table will be fetched again", slog.String("table", key), slog.Any("error", err))
+				t = nil
+				break
+			}
+		}
+		if newKey != key {
+			s.rename(key, newKey, t)
+		} else {
+			s.set(key, t, false)
+		}
+	case *ast.CreateIndexStmt:
+		key := s.key(st.Table)
+		if t := s.table(key); t != nil {
+			addIndex(t, st.IndexName, indexColumns(st.IndexPartSpecifications), st.KeyType == ast.IndexKeyTypeUnique)
+			s.set(key, t, false)
+		}
+	case *ast.DropIndexStmt:
+		key := s.key(st.Table)
+		if t := s.table(key); t != nil {
+			dropIndex(t, st.IndexName)
+			s.set(key, t, false)
+		}
+	}
+}
+
+// table returns a copy of the known table to change, or nil.
+func (s *schemaChange) table(key string) *schema.Table {
+	cur := s.current(key)
+	if cur == nil || cur.Table == nil {
+		return nil
+	}
+	return cloneTable(cur.Table)
+}
+
+func cloneTable(t *schema.Table) *schema.Table {
+	c := *t
+	c.Columns = slices.Clone(t.Columns)
+	c.Indexes = make([]*schema.Index, len(t.Indexes))
+	for i, index := range t.Indexes {
+		idx := *index
+		idx.Columns = slices.Clone(index.Columns)
+		idx.Cardinality = slices.Clone(index.Cardinality)
+		c.Indexes[i] = &idx
+	}
+	c.PKColumns = slices.Clone(t.PKColumns)
+	c.UnsignedColumns = slices.Clone(t.UnsignedColumns)
+	return &c
+}
+
+func newTableFromCreate(key string, st *ast.CreateTableStmt) (*schema.Table, error) {
+	t := &schema.Table{
+		Columns: make([]schema.TableColumn, 0, len(st.Cols)),
+		Indexes: make([]*schema.Index, 0, len(st.Constraints)),
+	}
+	t.Schema, t.Name, _ = strings.Cut(key, ".")
+
+	for _, def := range st.Cols {
+		if err := addColumn(t, def, nil); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	for _, c := range st.Constraints {
+		addConstraint(t, c)
+	}
+	resetColumnIndexes(t)
+	return t, nil
+}
+
+// addColumn adds the column at the position, or at the end if it's nil.
+func addColumn(t *schema.Table, def *ast.ColumnDef, position *ast.ColumnPosition) error {
+	name := def.Name.Name.O
+	if findColumn(t, name) >= 0 {
+		return errors.Errorf("column %s already exists", name)
+	}
+
+	collation := def.Tp.GetCollate()
+	var primary, unique, defaultExpr, onUpdate bool
+	var extra string
+	for _, opt := range def.Options {
+		switch opt.Tp {
+		case ast.ColumnOptionPrimaryKey:
+			primary = true
+		case ast.ColumnOptionUniqKey:
+			unique = true
+		case ast.ColumnOptionAutoIncrement:
+			extra = "auto_increment"
+		case ast.ColumnOptionGenerated:
+			extra = "VIRTUAL GENERATED"
+			if opt.Stored {
+				extra = "STORED GENERATED"
+			}
+		case ast.ColumnOptionCollate:
+			collation = opt.StrValue
+		case ast.ColumnOptionDefaultValue:
+			_, defaultExpr = opt.Expr.(*ast.FuncCallExpr)
+		case ast.ColumnOptionOnUpdate:
+			onUpdate = true
+		}
+	}
+	if extra == "" {
+		var extras []string
+		if defaultExpr {
+			extras = append(extras, "DEFAULT_GENERATED")
+		}
+		if onUpdate {
+			extras = append(extras, "on update CURRENT_TIMESTAMP")
+		}
+		extra = strings.Join(extras, " ")
+	}
+
+	n := len(t.Columns)
+	t.AddColumn(name, def.Tp.InfoSchemaStr(), collation, extra)
+	col := t.Columns[n]
+	t.Columns = t.Columns[:n]
+
+	i := n
+	if position != nil {
+		switch position.Tp {
+		case ast.ColumnPositionFirst:
+			i = 0
+		case ast.ColumnPositionAfter:
+			after := findColumn(t, position.RelativeColumn.Name.O)
+			if after < 0 {
+				return errors.Errorf("column %s not found", position.RelativeColumn.Name.O)
+			}
+			i = after + 1
+		}
+	}
+	t.Columns = slices.Insert(t.Columns, i, col)
+
+	if primary {
+		addIndex(t, "PRIMARY", []string{name}, true)
+	} else if unique {
+		addIndex(t, name, []string{name}, true)
+	}
+	return nil
+}
+
+func findColumn(t *schema.Table, name string) int {
+	return slices.IndexFunc(t.Columns, func(col schema.TableColumn) bool {
+		return strings.EqualFold(col.Name, name)
+	})
+}
+
+func indexColumns(parts []*ast.IndexPartSpecification) []string {
+	columns := make([]string, 0, len(parts))
+	for _, part := range parts {
+		// functional key parts have no column
+		if part.Column != nil {
+			columns = append(columns, part.Column.Name.O)
+		}
+	}
+	return columns
+}
+
+func addConstraint(t *schema.Table, c *ast.Constraint) {
+	switch c.Tp {
+	case ast.ConstraintPrimaryKey:
+		addIndex(t, "PRIMARY", indexColumns(c.Keys), true)
+	case ast.ConstraintKey, ast.ConstraintIndex, ast.ConstraintFulltext:
+		addIndex(t, c.Name, indexColumns(c.Keys), false)
+	case ast.ConstraintUniq, ast.ConstraintUniqKey, ast.ConstraintUniqIndex:
+		addIndex(t, c.Name, indexColumns(c.Keys), true)
+	}
+}
+
+// addIndex adds the index like SHOW INDEX lists it, the primary key first and
+// an index without name named after its first column.
+func addIndex(t *schema.Table, name string, columns []string, unique bool) {
+	if len(columns) == 0 {
+		return
+	}
+	if name == "" {
+		name = columns[0]
+		for i := 2; findIndex(t, name) >= 0; i++ {
+			name = fmt.Sprintf("%s_%d", columns[0], i)
+		}
+	}
+
+	index := schema.NewIndex(name)
+	for _, column := range columns {
+		index.AddColumn(column, 0)
+	}
+	if !unique {
+		index.NoneUnique = 1
+	}
+	if name == "PRIMARY" {
+		dropIndex(t, name)
+		t.Indexes = slices.Insert(t.Indexes, 0, index)
+	} else {
+		t.Indexes = append(t.Indexes, index)
+	}
+}
+
+func findIndex(t *schema.Table, name string) int {
+	return slices.IndexFunc(t.Indexes, func(index *schema.Index) bool {
+		return strings.EqualFold(index.Name, name)
+	})
+}
+
+func dropIndex(t *schema.Table, name string) {
+	if i := findIndex(t, name); i >= 0 {
+		t.Indexes = slices.Delete(t.Indexes, i, i+1)
+	}
+}
+
+// renameIndexColumn renames the column in the indexes, or removes it if the
+// new name is empty. The indexes left without columns are dropped.
+func renameIndexColumn(t *schema.Table, oldName, newName string) {
+	t.Indexes = slices.DeleteFunc(t.Indexes, func(index *schema.Index) bool {
+		if i := index.FindColumn(oldName); i >= 0 {
+			if newName != "" {
+				index.Columns[i] = newName
+			} else {
+				index.Columns = slices.Delete(index.Columns, i, i+1)
+				index.Cardinality = slices.Delete(index.Cardinality, i, i+1)
+			}
+		}
+		return len(index.Columns) == 0
+	})
+}
+
+func alterTable(t *schema.Table, spec *ast.AlterTableSpec) error {
+	switch spec.Tp {
+	case ast.AlterTableAddColumns:
+		for _, def := range spec.NewColumns {
+			if spec.IfNotExists && findColumn(t, def.Name.Name.O) >= 0 {
+				continue
+			}
+			if err := addColumn(t, def, spec.Position); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		for _, c := range spec.NewConstraints {
+			addConstraint(t, c)
+		}
+	case ast.AlterTableAddConstraint:
+		addConstraint(t, spec.Constraint)
+	case ast.AlterTableDropColumn:
+		i := findColumn(t, spec.OldColumnName.Name.O)
+		if i < 0 {
+			if spec.IfExists {
+				return nil
+			}
+			return errors.Errorf("column %s not found", spec.OldColumnName.Name.O)
+		}
+		renameIndexColumn(t, t.Columns[i].Name, "")
+		t.Columns = slices.Delete(t.Columns, i, i+1)
+	case ast.AlterTableModifyColumn, ast.AlterTableChangeColumn:
+		oldName := spec.NewColumns[0].Name.Name.O
+		if spec.OldColumnName != nil {
+			oldName = spec.OldColumnName.Name.O
+		}
+		i := findColumn(t, oldName)
+		if i < 0 {
+			return errors.Errorf("column %s not found", oldName)
+		}
+		oldName = t.Columns[i].Name
+		t.Columns = slices.Delete(t.Columns, i, i+1)
+
+		position := spec.Position
+		if position == nil || position.Tp == ast.ColumnPositionNone {
+			// keep the column in place
+			if i == 0 {
+				position = &ast.ColumnPosition{Tp: ast.ColumnPositionFirst}
+			} else {
+				position = &ast.ColumnPosition{
+					Tp:             ast.ColumnPositionAfter,
+					RelativeColumn: &ast.ColumnName{Name: ast.NewCIStr(t.Columns[i-1].Name)},
+				}
+			}
+		}
+		if err := addColumn(t, spec.NewColumns[0], position); err != nil {
+			return errors.Trace(err)
+		}
+		renameIndexColumn(t, oldName, spec.NewColumns[0].Name.Name.O)
+	case ast.AlterTableRenameColumn:
+		i := findColumn(t, spec.OldColumnName.Name.O)
+		if i < 0 {
+			return errors.Errorf("column %s not found", spec.OldColumnName.Name.O)
+		}
+		renameIndexColumn(t, t.Columns[i].Name, spec.NewColumnName.Name.O)
+		t.Columns[i].Name = spec.NewColumnName.Name.O
+	case ast.AlterTableDropPrimaryKey:
+		dropIndex(t, "PRIMARY")
+	case ast.AlterTableDropIndex:
+		dropIndex(t, spec.Name)
+	case ast.AlterTableRenameIndex:
+		if i := findIndex(t, spec.FromKey.O); i >= 0 {
+			t.Indexes[i].Name = spec.ToKey.O
+		}
+	}
+
+	resetColumnIndexes(t)
+	return nil
+}
+
+// resetColumnIndexes sets the unsigned and primary key columns after the
+// columns or indexes are changed.
+func resetColumnIndexes(t *schema.Table) {
+	t.UnsignedColumns = nil
+	for i, col := range t.Columns {
+		if col.IsUnsigned {
+			t.UnsignedColumns = append(t.UnsignedColumns, i)
+		}
+	}
+
+	t.PKColumns = nil
+	if len(t.Indexes) > 0 && t.Indexes[0].Name == "PRIMARY" {
+		t.PKColumns = make([]int, len(t.Indexes[0].Columns))
+		for i, name := range t.Indexes[0].Columns {
+			t.PKColumns[i] = findColumn(t, name)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package canal
+
+import (
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+	"github.com/pingcap/tidb/pkg/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func schemaHistoryColumns(t *schema.Table) []string {
+	var columns []string
+	for _, col := range t.Columns {
+		columns = append(columns, col.Name)
+	}
+	return columns
+}
+
+func TestSchemaHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.toml")
+	h, err := loadSchemaHistory(path, slog.Default())
+	require.NoError(t, err)
+
+	p := parser.New()
+	apply := func(pos uint32, query string) {
+		stmts, _, err := p.Parse(query, "", "")
+		require.NoError(t, err)
+		require.NoError(t, h.apply(stmts, "test", mysql.Position{Name: "mysql-bin.000001", Pos: pos}))
+	}
+	table := func(key string, pos uint32) *schema.Table {
+		ta, err := h.table(key, mysql.Position{Name: "mysql-bin.000001", Pos: pos})
+		require.NoError(t, err)
+		require.NotNil(t, ta)
+		return ta
+	}
+
+	apply(100, "CREATE TABLE t (id INT UNSIGNED NOT NULL AUTO_INCREMENT, name VARCHAR(20), e ENUM('a','b'), PRIMARY KEY (id), KEY (name))")
+	apply(200, "ALTER TABLE t ADD COLUMN c INT FIRST, DROP COLUMN e, CHANGE name title VARCHAR(30) COLLATE utf8mb4_bin")
+	apply(300, "RENAME TABLE t TO u")
+	apply(400, "ALTER TABLE u ADD COLUMN d DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP AFTER id, DROP PRIMARY KEY, ADD PRIMARY KEY (c, id)")
+	// unknown tables are left to be fetched from the server
+	apply(500, "ALTER TABLE v ADD COLUMN x INT")
+
+	ta := table("test.t", 150)
+	require.Equal(t, []string{"id", "name", "e"}, schemaHistoryColumns(ta))
+	require.Equal(t, "int(11) unsigned", ta.Columns[0].RawType)
+	require.True(t, ta.Columns[0].IsAuto)
+	require.Equal(t, []int{0}, ta.UnsignedColumns)
+	require.Equal(t, []string{"a", "b"}, ta.Columns[2].EnumValues)
+	require.Equal(t, []int{0}, ta.PKColumns)
+	require.Equal(t, []string{"PRIMARY", "name"}, []string{ta.Indexes[0].Name, ta.Indexes[1].Name})
+
+	ta = table("test.t", 200)
+	require.Equal(t, []string{"c", "id", "title"}, schemaHistoryColumns(ta))
+	require.Equal(t, "utf8mb4_bin", ta.Columns[2].Collation)
+	require.Equal(t, []int{1}, ta.PKColumns)
+	require.Equal(t, []int{1}, ta.UnsignedColumns)
+	require.Equal(t, []string{"title"}, ta.Indexes[1].Columns)
+
+	_, err = h.table("test.t", mysql.Position{Name: "mysql-bin.000001", Pos: 300})
+	require.ErrorIs(t, err, schema.ErrTableNotExist)
+
+	ta = table("test.u", 400)
+	require.Equal(t, "u", ta.Name)
+	require.Equal(t, []string{"c", "id", "d", "title"}, schemaHistoryColumns(ta))
+	require.True(t, ta.Columns[2].IsDefaultExpr)
+	require.True(t, ta.Columns[2].IsAutoUpdating)
+	require.Equal(t, []int{0, 1}, ta.PKColumns)
+
+	ta, err = h.table("test.v", mysql.Position{Name: "mysql-bin.000002", Pos: 4})
+	require.NoError(t, err)
+	require.Nil(t, ta)
+
+	// the saved history decodes the binlog before the DDL after a restart
+	h, err = loadSchemaHistory(path, slog.Default())
+	require.NoError(t, err)
+	require.Equal(t, []string{"id", "name", "e"}, schemaHistoryColumns(table("test.t", 150)))
+	require.Equal(t, []string{"c", "id", "d", "title"}, schemaHistoryColumns(table("test.u", 600)))
+
+	// replaying the DDL again rewrites the versions after it
+	apply(200, "ALTER TABLE t ADD COLUMN c2 INT")
+	require.Equal(t, []string{"id", "name", "e", "c2"}, schemaHistoryColumns(table("test.t", 250)))
+	_, err = h.table("test.u", mysql.Position{Name: "mysql-bin.000001", Pos: 400})
+	require.NoError(t, err)
+}
+
+func TestCanalSchemaHistory(t *testing.T) {
+	h, err := loadSchemaHistory("", slog.Default())
+	require.NoError(t, err)
+	c := newTransactionTestCanal(&DummyEventHandler{})
+	c.tableMatchCache = make(map[string]bool)
+	c.schemaHistory = h
+	c.ClearTableCache([]byte("test"), []byte("t"))
+
+	old := &schema.Table{Schema: "test", Name: "t", Columns: []schema.TableColumn{{Name: "id"}}}
+	require.NoError(t, h.seed(old, mysql.Position{Name: "mysql-bin.000001", Pos: 4}))
+
+	ta, err := c.GetTable("test", "t")
+	require.NoError(t, err)
+	require.Equal(t, old, ta)
+
+	require.NoError(t, c.handleEvent(transactionTestEvent(100, &replication.QueryEvent{
+		Schema: []byte("test"),
+		Query:  []byte("ALTER TABLE t ADD COLUMN name VARCHAR(10)"),
+	})))
+	ta, err = c.GetTable("test", "t")
+	require.NoError(t, err)
+	require.Equal(t, []string{"id", "name"}, schemaHistoryColumns(ta))
+
+	// rows before the DDL are decoded with the table before it
+	c.master.Update(mysql.Position{Name: "mysql-bin.000001", Pos: 50})
+	ta, err = c.GetTable("test", "t")
+	require.NoError(t, err)
+	require.Equal(t, old, ta)
+
+	// the rows are decoded with the table at their position, not the synced
+	// one, which is behind them with ParallelWorkers
+	rh := &transformTestHandler{}
+	c.eventHandler = rh
+	require.NoError(t, c.handleEvent(transactionTestRows(150, 1)))
+	require.Len(t, rh.events, 1)
+	require.Equal(t, []string{"id", "name"}, schemaHistoryColumns(rh.events[0].Table))
+}
@@ -0,0 +1,438 @@
+package canal
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/client"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/schema"
+	"github.com/pingcap/errors"
+	"github.com/shopspring/decimal"
+)
+
+// systemDatabases are skipped when the snapshot covers all the databases,
+// like mysqldump --all-databases does for the data of most of them.
+var systemDatabases = map[string]bool{
+	"mysql":              true,
+	"information_schema": true,
+	"performance_schema": true,
+	"sys":                true,
+}
+
+// snapshotDumper takes a consistent snapshot of the tables with
+// START TRANSACTION WITH CONSISTENT SNAPSHOT and streams their rows with
+// SELECT, without the mysqldump binary.
+type snapshotDumper struct {
+	databases    []string
+	tableDB      string
+	tables       []string
+	ignoreTables map[string]map[string]bool
+	where        string
+	// skip FLUSH TABLES WITH READ LOCK, the position is read by the caller
+	skipMasterData bool
+}
+
+func newSnapshotDumper(cfg *DumpConfig) *snapshotDumper {
+	d := &snapshotDumper{
+		tableDB:        cfg.TableDB,
+		tables:         append([]string(nil), cfg.Tables...),
+		databases:      append([]string(nil), cfg.Databases...),
+		ignoreTables:   make(map[string]map[string]bool),
+		where:          cfg.Where,
+		skipMasterData: cfg.SkipMasterData,
+	}
+
+	for _, ignoreTable := range cfg.IgnoreTables {
+		if seps := strings.Split(ignoreTable, ","); len(seps) == 2 {
+			d.addIgnoreTables(seps[0], seps[1])
+		}
+	}
+
+	return d
+}
+
+func (d *snapshotDumper) addDatabases(dbs ...string) {
+	d.databases = append(d.databases, dbs...)
+}
+
+func (d *snapshotDumper) addTables(db string, tables ...string) {
+	if d.tableDB != db {
+		d.tableDB = db
+		d.tables = d.tables[0:0]
+	}
+
+	d.tables = append(d.tables, tables...)
+}
+
+func (d *snapshotDumper) addIgnoreTables(db string, tables ...string) {
+	if d.ignoreTables[db] == nil {
+		d.ignoreTables[db] = make(map[string]bool)
+	}
+	for _, table := range tables {
+		d.ignoreTables[db][table] = true
+	}
+}
+
+// dumpSnapshot reads the binlog position of a consistent snapshot into h,
+// then passes the rows of the tables to OnRow.
+func (c *Canal) dumpSnapshot(h *dumpParseHandler) error {
+	d := c.snapshotter
+
+	conn, err := c.snapshotConn()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer conn.Close()
+
+	if err = c.startSnapshot(conn, h, !d.skipMasterData); err != nil {
+		return errors.Trace(err)
+	}
+	// the snapshot is read only
+	defer func() {
+		_, _ = conn.Execute("ROLLBACK")
+	}()
+
+	tables, err := d.listTables(conn)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	for _, t := range tables {
+		if err = c.dumpSnapshotTable(conn, t.db, t.table, d.where); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	return nil
+}
+
+// snapshotConn connects to the server for a snapshot.
+func (c *Canal) snapshotConn() (*client.Conn, error) {
+	conn, err := c.connect(c.connOptions()...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if c.cfg.Charset != "" {
+		if err = conn.SetCharset(c.cfg.Charset); err != nil {
+			conn.Close()
+			return nil, errors.Trace(err)
+		}
+	}
+
+	// TIMESTAMP values are read in UTC and converted like the ones of the binlog
+	for _, query := range []string{
+		"SET SESSION time_zone = '+00:00'",
+		"SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+	} {
+		if _, err = conn.Execute(query); err != nil {
+			conn.Close()
+			return nil, errors.Trace(err)
+		}
+	}
+	return conn, nil
+}
+
+// startSnapshot starts the consistent snapshot and, with masterData, reads
+// its binlog position while holding a global read lock.
+func (c *Canal) startSnapshot(conn *client.Conn, h *dumpParseHandler, masterData bool) error {
+	if !masterData {
+		_, err := conn.Execute("START TRANSACTION WITH CONSISTENT SNAPSHOT")
+		return errors.Trace(err)
+	}
+
+	if _, err := conn.Execute("FLUSH TABLES WITH READ LOCK"); err != nil {
+		return errors.Trace(err)
+	}
+	defer func() {
+		_, _ = conn.Execute("UNLOCK TABLES")
+	}()
+
+	if _, err := conn.Execute("START TRANSACTION WITH CONSISTENT SNAPSHOT"); err != nil {
+		return errors.Trace(err)
+	}
+
+	rr, err := conn.Execute(getShowBinaryLogQuery(c.cfg.Flavor, conn.GetServerVersion()))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if rr.RowNumber() == 0 {
+		return errors.New("binary log is not enabled")
+	}
+	if h.name, err = rr.GetString(0, 0); err != nil {
+		return errors.Trace(err)
+	}
+	if h.pos, err = rr.GetUint(0, 1); err != nil {
+		return errors.Trace(err)
+	}
+
+	// like mysqldump, only the GTID set of MySQL is read
+	if c.cfg.Flavor == mysql.MariaDBFlavor {
+		return nil
+	}
+	if rr, err = conn.Execute("SELECT @@GLOBAL.GTID_EXECUTED"); err != nil {
+		return errors.Trace(err)
+	}
+	gtids, err := rr.GetString(0, 0)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// empty without GTIDs, like the missing GTID_PURGED of mysqldump
+	if gtids != "" {
+		if h.gset, err = mysql.ParseGTIDSet(mysql.MySQLFlavor, gtids); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	return nil
+}
+
+type snapshotTable struct {
+	db    string
+	table string
+}
+
+func (d *snapshotDumper) listTables(conn *client.Conn) ([]snapshotTable, error) {
+	if len(d.tables) > 0 {
+		tables := make([]snapshotTable, 0, len(d.tables))
+		for _, table := range d.tables {
+			if !d.ignoreTables[d.tableDB][table] {
+				tables = append(tables, snapshotTable{db: d.tableDB, table: table})
+			}
+		}
+		return tables, nil
+	}
+
+	dbs := d.databases
+	if len(dbs) == 0 {
+		rr, err := conn.Execute("SHOW DATABASES")
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		for i := range rr.RowNumber() {
+			db, err := rr.GetString(i, 0)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			if !systemDatabases[strings.ToLower(db)] {
+				dbs = append(dbs, db)
+			}
+		}
+	}
+
+	var tables []snapshotTable
+	for _, db := range dbs {
+		rr, err := conn.Execute(fmt.Sprintf("SHOW FULL TABLES FROM %s WHERE Table_type = 'BASE TABLE'", quoteIdentifier(db)))
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		for i := range rr.RowNumber() {
+			table, err := rr.GetString(i, 0)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			if !d.ignoreTables[db][table] {
+				tables = append(tables, snapshotTable{db: db, table: table})
+			}
+		}
+	}
+	return tables, nil
+}
+
+func (c *Canal) dumpSnapshotTable(conn *client.Conn, db string, table string, where string) error {
+	tableInfo, err := c.GetTable(db, table)
+	if err != nil {
+		e := errors.Cause(err)
+		if e == ErrExcludedTable ||
+			e == schema.ErrTableNotExist ||
+			e == schema.ErrMissingTableMeta {
+			return nil
+		}
+		c.cfg.Logger.Error("error getting table information", slog.String("database", db), slog.String("table", table), slog.Any("error", err))
+		return errors.Trace(err)
+	}
+
+	// the columns are listed for the INVISIBLE ones, which SELECT * omits
+	query := fmt.Sprintf("SELECT %s FROM %s.%s", selectColumns(tableInfo), quoteIdentifier(db), quoteIdentifier(table))
+	if where != "" {
+		query += " WHERE " + where
+	}
+
+	c.cfg.Logger.Info("dump table", slog.String("database", db), slog.String("table", table))
+
+	var result mysql.Result
+	return conn.ExecuteSelectStreaming(query, &result, func(row []mysql.FieldValue) error {
+		if err := c.ctx.Err(); err != nil {
+			return err
+		}
+
+		if len(row) != len(tableInfo.Columns) {
+			return errors.Errorf("%s.%s has %d columns in the snapshot but %d in the table schema", db, table, len(row), len(tableInfo.Columns))
+		}
+
+		vs := make([]any, len(row))
+		for i := range row {
+			v, err := c.snapshotValue(result.Fields[i], &tableInfo.Columns[i], &row[i])
+			if err != nil {
+				return errors.Annotatef(err, "parse column %s of %s.%s", tableInfo.Columns[i].Name, db, table)
+			}
+			vs[i] = v
+		}
+
+		return c.onRow(newRowsEvent(tableInfo, InsertAction, [][]any{vs}, nil, nil))
+	}, nil)
+}
+
+// quoteIdentifier quotes a schema, table or column name for a query.
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// quoteTableName quotes each part of a table name qualified or not with a
+// database, like db.table.
+func quoteTableName(name string) string {
+	parts := strings.Split(name, ".")
+	for i := range parts {
+		parts[i] = quoteIdentifier(parts[i])
+	}
+	return strings.Join(parts, ".")
+}
+
+// selectColumns returns the select list of all the columns of the table, in
+// their order.
+func selectColumns(t *schema.Table) string {
+	cols := make([]string, len(t.Columns))
+	for i := range t.Columns {
+		cols[i] = quoteIdentifier(t.Columns[i].Name)
+	}
+	return strings.Join(cols, ", ")
+}
+
+const snapshotTimeFormat = "2006-01-02 15:04:05"
+
+// snapshotValue converts a value read from the snapshot to the type the
+// binlog row events decode the column to.
+func (c *Canal) snapshotValue(f *mysql.Field, col *schema.TableColumn, v *mysql.FieldValue) (any, error) {
+	switch v.Type {
+	case mysql.FieldValueTypeNull:
+		return nil, nil
+	case mysql.FieldValueTypeUnsigned:
+		n := v.AsUint64()
+		switch f.Type {
+		case mysql.MYSQL_TYPE_TINY:
+			return uint8(n), nil
+		case mysql.MYSQL_TYPE_SHORT:
+			return uint16(n), nil
+		case mysql.MYSQL_TYPE_INT24, mysql.MYSQL_TYPE_LONG:
+			return uint32(n), nil
+		case mysql.MYSQL_TYPE_YEAR:
+			return int(n), nil
+		}
+		return n, nil
+	case mysql.FieldValueTypeSigned:
+		n := v.AsInt64()
+		switch f.Type {
+		case mysql.MYSQL_TYPE_TINY:
+			return int8(n), nil
+		case mysql.MYSQL_TYPE_SHORT:
+			return int16(n), nil
+		case mysql.MYSQL_TYPE_INT24, mysql.MYSQL_TYPE_LONG:
+			return int32(n), nil
+		case mysql.MYSQL_TYPE_YEAR:
+			return int(n), nil
+		}
+		return n, nil
+	case mysql.FieldValueTypeFloat:
+		if f.Type == mysql.MYSQL_TYPE_FLOAT {
+			return float32(v.AsFloat64()), nil
+		}
+		return v.AsFloat64(), nil
+	}
+
+	// the string is reused for the next row
+	b := append([]byte(nil), v.AsString()...)
+	s := string(b)
+
+	switch col.Type {
+	case schema.TYPE_ENUM:
+		for i, value := range col.EnumValues {
+			if value == s {
+				return int64(i + 1), nil
+			}
+		}
+		// the empty string of invalid values
+		return int64(0), nil
+	case schema.TYPE_SET:
+		var bits int64
+		if s == "" {
+			return bits, nil
+		}
+		for _, name := range strings.Split(s, ",") {
+			for i, value := range col.SetValues {
+				if value == name {
+					bits |= 1 << uint(i)
+				}
+			}
+		}
+		return bits, nil
+	}
+
+	switch f.Type {
+	case mysql.MYSQL_TYPE_BIT:
+		var bits int64
+		for _, x := range b {
+			bits = bits<<8 | int64(x)
+		}
+		return bits, nil
+	case mysql.MYSQL_TYPE_NEWDECIMAL, mysql.MYSQL_TYPE_DECIMAL:
+		if c.cfg.UseDecimal {
+			return decimal.NewFromString(s)
+		}
+		return strconv.ParseFloat(s, 64)
+	case mysql.MYSQL_TYPE_DATETIME:
+		if !c.cfg.ParseTime || strings.HasPrefix(s, "0000-00-00") {
+			return s, nil
+		}
+		return time.ParseInLocation(snapshotTimeLayout(s), s, time.UTC)
+	case mysql.MYSQL_TYPE_TIMESTAMP:
+		if strings.HasPrefix(s, "0000-00-00") {
+			return s, nil
+		}
+		layout := snapshotTimeLayout(s)
+		t, err := time.ParseInLocation(layout, s, time.UTC)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		t = t.In(time.Local)
+		if c.cfg.ParseTime {
+			return t, nil
+		}
+		if c.cfg.TimestampStringLocation != nil {
+			t = t.In(c.cfg.TimestampStringLocation)
+		}
+		return t.Format(layout), nil
+	case mysql.MYSQL_TYPE_JSON,
+		mysql.MYSQL_TYPE_VARCHAR,
+		mysql.MYSQL_TYPE_VAR_STRING,
+		mysql.MYSQL_TYPE_STRING,
+		mysql.MYSQL_TYPE_DATE,
+		mysql.MYSQL_TYPE_TIME:
+		return s, nil
+	}
+
+	// BLOB, TEXT, GEOMETRY and VECTOR
+	return b, nil
+}
+
+// snapshotTimeLayout returns the layout of a DATETIME or TIMESTAMP value
+// with the fractional digits of the column.
+func snapshotTimeLayout(s string) string {
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		return snapshotTimeFormat + "." + strings.Repeat("0", len(s)-i-1)
+	}
+	return snapshotTimeFormat
+}
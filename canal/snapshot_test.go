@@ -0,0 +1,91 @@
+package canal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/schema"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotValue(t *testing.T) {
+	fields := []*mysql.Field{
+		{Type: mysql.MYSQL_TYPE_TINY},
+		{Type: mysql.MYSQL_TYPE_LONG, Flag: mysql.UNSIGNED_FLAG},
+		{Type: mysql.MYSQL_TYPE_LONGLONG},
+		{Type: mysql.MYSQL_TYPE_YEAR, Flag: mysql.UNSIGNED_FLAG},
+		{Type: mysql.MYSQL_TYPE_FLOAT},
+		{Type: mysql.MYSQL_TYPE_NEWDECIMAL},
+		{Type: mysql.MYSQL_TYPE_STRING, Flag: mysql.ENUM_FLAG},
+		{Type: mysql.MYSQL_TYPE_STRING, Flag: mysql.SET_FLAG},
+		{Type: mysql.MYSQL_TYPE_BIT},
+		{Type: mysql.MYSQL_TYPE_VAR_STRING},
+		{Type: mysql.MYSQL_TYPE_BLOB},
+		{Type: mysql.MYSQL_TYPE_DATETIME},
+		{Type: mysql.MYSQL_TYPE_TIMESTAMP},
+		{Type: mysql.MYSQL_TYPE_JSON},
+		{Type: mysql.MYSQL_TYPE_LONG},
+	}
+	columns := []schema.TableColumn{
+		{Type: schema.TYPE_NUMBER},
+		{Type: schema.TYPE_NUMBER, IsUnsigned: true},
+		{Type: schema.TYPE_NUMBER},
+		{Type: schema.TYPE_NUMBER},
+		{Type: schema.TYPE_FLOAT},
+		{Type: schema.TYPE_DECIMAL},
+		{Type: schema.TYPE_ENUM, EnumValues: []string{"a", "b", "c"}},
+		{Type: schema.TYPE_SET, SetValues: []string{"a", "b", "c"}},
+		{Type: schema.TYPE_BIT},
+		{Type: schema.TYPE_STRING},
+		{Type: schema.TYPE_STRING},
+		{Type: schema.TYPE_DATETIME},
+		{Type: schema.TYPE_TIMESTAMP},
+		{Type: schema.TYPE_JSON},
+		{Type: schema.TYPE_NUMBER},
+	}
+	values := []string{
+		"-1", "4294967295", "-5", "2024", "1.5", "12.34", "b", "a,c", "\x01\x02",
+		"text", "blob", "2024-01-02 03:04:05.123", "2024-01-02 03:04:05", `{"a": 1}`,
+	}
+
+	var data mysql.RowData
+	for _, v := range values {
+		data = append(data, mysql.PutLengthEncodedString([]byte(v))...)
+	}
+	// NULL
+	data = append(data, 0xfb)
+
+	row, err := data.ParseText(fields, nil)
+	require.NoError(t, err)
+
+	loc := time.FixedZone("UTC+1", 3600)
+	c := &Canal{cfg: &Config{TimestampStringLocation: loc}}
+	convert := func() []any {
+		vs := make([]any, len(row))
+		for i := range row {
+			vs[i], err = c.snapshotValue(fields[i], &columns[i], &row[i])
+			require.NoError(t, err)
+		}
+		return vs
+	}
+
+	require.Equal(t, []any{
+		int8(-1), uint32(4294967295), int64(-5), 2024, float32(1.5), 12.34, int64(2), int64(5), int64(0x0102),
+		"text", []byte("blob"), "2024-01-02 03:04:05.123", "2024-01-02 04:04:05", `{"a": 1}`, nil,
+	}, convert())
+
+	c.cfg.UseDecimal = true
+	c.cfg.ParseTime = true
+	vs := convert()
+	require.Equal(t, decimal.RequireFromString("12.34"), vs[5])
+	require.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 123000000, time.UTC), vs[11])
+	require.True(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).Equal(vs[12].(time.Time)))
+}
+
+func TestSnapshotSelectColumns(t *testing.T) {
+	table := &schema.Table{Columns: []schema.TableColumn{{Name: "id"}, {Name: "hidden", IsInvisible: true}, {Name: "a`b"}}}
+	require.Equal(t, "`id`, `hidden`, `a``b`", selectColumns(table))
+	require.Equal(t, "`x``y`", quoteIdentifier("x`y"))
+}
@@ -34,17 +34,75 @@ func (c *Canal) startSyncer() (*replication.BinlogStreamer, error) {
 }
 
 func (c *Canal) runSyncBinlog() error {
+	defer func() {
+		if c.chunkedSnapshot != nil {
+			c.chunkedSnapshot.close()
+		}
+	}()
+
+	// the failovers to primaries the sync can't start from
+	attempts := 0
+	for {
+		err := c.syncBinlog()
+		e, ok := err.(*syncerError)
+		if !ok {
+			return err
+		}
+		if e.started {
+			attempts = 0
+		}
+		attempts++
+		if !c.canFailover() || attempts > defaultFailoverReconnectAttempts {
+			return e.err
+		}
+		if err = c.failover(e.err); err != nil {
+			return err
+		}
+	}
+}
+
+// syncBinlog syncs the binlog from the primary, the errors of the syncer are
+// syncerErrors.
+func (c *Canal) syncBinlog() error {
 	s, err := c.startSyncer()
 	if err != nil {
-		return err
+		return &syncerError{err: err}
+	}
+
+	var applier *parallelApplier
+	if c.cfg.ParallelWorkers > 1 {
+		applier = newParallelApplier(c, c.cfg.ParallelWorkers)
+		defer applier.close()
 	}
 
+	c.setSyncing(true)
+	defer c.setSyncing(false)
+
 	for {
-		ev, err := s.GetEvent(c.ctx)
-		if err != nil {
+		if err := c.applyTableFilterUpdates(applier); err != nil {
 			return errors.Trace(err)
 		}
 
+		snapshot := c.chunkedSnapshot
+		if snapshot != nil && snapshot.low == "" {
+			if err := snapshot.readWindow(); err != nil {
+				return errors.Trace(err)
+			}
+		}
+
+		waitCtx := c.filterWaitContext()
+		ev, err := s.GetEvent(waitCtx)
+		if err != nil {
+			if c.ctx.Err() != nil {
+				return errors.Trace(err)
+			}
+			if waitCtx.Err() != nil {
+				// a table filter update is queued
+				continue
+			}
+			return &syncerError{err: errors.Trace(err), started: true}
+		}
+
 		// Update the delay between the Canal and the Master before the handler hooks are called
 		c.updateReplicationDelay(ev)
 
@@ -67,16 +125,56 @@ func (c *Canal) runSyncBinlog() error {
 			}
 		}
 
-		err = c.handleEvent(ev)
+		if snapshot != nil {
+			snapshot.observe(ev)
+		}
+
+		if applier != nil {
+			err = applier.handleEvent(ev)
+		} else {
+			err = c.handleEvent(ev)
+		}
 		if err != nil {
 			return err
 		}
+
+		if snapshot != nil {
+			if err = c.emitChunkedSnapshot(applier); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+}
+
+// emitChunkedSnapshot passes the rows of the chunked snapshot window to the
+// event handler once the transaction holding the high watermark is handled,
+// so they are not passed within a transaction.
+func (c *Canal) emitChunkedSnapshot(applier *parallelApplier) error {
+	snapshot := c.chunkedSnapshot
+	if !snapshot.highMet || c.inTransaction(applier) {
+		return nil
+	}
+	if applier != nil {
+		if err := applier.wait(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	if err := snapshot.emit(); err != nil {
+		return errors.Trace(err)
 	}
+	if snapshot.done() {
+		snapshot.close()
+		c.chunkedSnapshot = nil
+		close(c.dumpDoneCh)
+	}
+	return nil
 }
 
 func (c *Canal) handleEvent(ev *replication.BinlogEvent) error {
 	savePos := false
 	force := false
+	trxEnd := false
 	pos := c.master.Position()
 	var err error
 
@@ -101,7 +199,7 @@ func (c *Canal) handleEvent(ev *replication.BinlogEvent) error {
 		}
 	case *replication.RowsEvent:
 		// we only focus row based event
-		if err := c.handleRowsEvent(ev); err != nil {
+		if err := c.handleRowsEvent(ev, c.trx.Transaction, pos); err != nil {
 			c.cfg.Logger.Error("handle rows event", slog.String("file", pos.Name), slog.Uint64("position", uint64(curPos)), slog.Any("error", err))
 			return errors.Trace(err)
 		}
@@ -119,6 +217,7 @@ func (c *Canal) handleEvent(ev *replication.BinlogEvent) error {
 		return nil
 	case *replication.XIDEvent:
 		savePos = true
+		trxEnd = true
 		// try to save the position later
 		if err := c.eventHandler.OnXID(ev.Header, pos); err != nil {
 			return errors.Trace(err)
@@ -127,24 +226,49 @@ func (c *Canal) handleEvent(ev *replication.BinlogEvent) error {
 			c.master.UpdateGTIDSet(e.GSet)
 		}
 	case *replication.MariadbGTIDEvent:
+		c.gtidTrx(ev, newTransaction(ev.Header, e))
 		if err := c.eventHandler.OnGTID(ev.Header, e); err != nil {
 			return errors.Trace(err)
 		}
+		if err := c.beginTrx(ev.Header); err != nil {
+			return errors.Trace(err)
+		}
 	case *replication.GTIDEvent:
+		c.gtidTrx(ev, newTransaction(ev.Header, e))
 		if err := c.eventHandler.OnGTID(ev.Header, e); err != nil {
 			return errors.Trace(err)
 		}
+		if err := c.beginTrx(ev.Header); err != nil {
+			return errors.Trace(err)
+		}
+	case *replication.GtidTaggedLogEvent:
+		c.gtidTrx(ev, newTransaction(ev.Header, &e.GTIDEvent))
+		if err := c.beginTrx(ev.Header); err != nil {
+			return errors.Trace(err)
+		}
 	case *replication.RowsQueryEvent:
 		if err := c.eventHandler.OnRowsQueryEvent(e); err != nil {
 			return errors.Trace(err)
 		}
 	case *replication.QueryEvent:
+		if trxEnd, err = c.queryTrx(ev); err != nil {
+			return errors.Trace(err)
+		}
 		stmts, _, err := c.parser.Parse(string(e.Query), "", "")
 		if err != nil {
-			// The parser does not understand all syntax.
-			// For example, it won't parse [CREATE|DROP] TRIGGER statements.
-			c.cfg.Logger.Error("error parsing query, will skip this event", slog.String("query", string(e.Query)), slog.Any("error", err))
-			return nil
+			ddl, err := c.handleUnparsedQuery(ev.Header, pos, e, err)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if !ddl {
+				break
+			}
+			savePos, force = true, true
+		}
+		if c.schemaHistory != nil {
+			if err = c.schemaHistory.apply(stmts, string(e.Schema), pos); err != nil {
+				return errors.Trace(err)
+			}
 		}
 		for _, stmt := range stmts {
 			switch stmt.(type) {
@@ -169,6 +293,12 @@ func (c *Canal) handleEvent(ev *replication.BinlogEvent) error {
 					return errors.Trace(err)
 				}
 			}
+			if events := newDDLEvents(stmt, string(e.Schema)); len(events) > 0 {
+				force = true
+				if err = c.onDDLEvents(ev.Header, pos, e, events); err != nil {
+					return errors.Trace(err)
+				}
+			}
 		}
 		if savePos && e.GSet != nil {
 			c.master.UpdateGTIDSet(e.GSet)
@@ -177,11 +307,17 @@ func (c *Canal) handleEvent(ev *replication.BinlogEvent) error {
 		return nil
 	}
 
+	if trxEnd {
+		if err := c.commitTrx(ev.Header, pos); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
 	if savePos {
 		c.master.Update(pos)
 		c.master.UpdateTimestamp(ev.Header.Timestamp)
 
-		if err := c.eventHandler.OnPosSynced(ev.Header, pos, c.master.GTIDSet(), force); err != nil {
+		if err := c.syncPosition(ev.Header, pos, c.master.GTIDSet(), force); err != nil {
 			return errors.Trace(err)
 		}
 	}
@@ -256,6 +392,16 @@ func (c *Canal) updateTable(header *replication.EventHeader, db, table string) (
 }
 
 func (c *Canal) updateReplicationDelay(ev *replication.BinlogEvent) {
+	if _, ok := ev.Event.(*replication.HeartbeatEvent); ok {
+		// the heartbeats are sent once all the events are sent
+		c.delay.Store(0)
+		return
+	}
+	if ev.Header.Timestamp == 0 {
+		// fake events have no timestamp
+		return
+	}
+
 	var newDelay uint32
 	now := uint32(utils.Now().Unix())
 	if now >= ev.Header.Timestamp {
@@ -264,14 +410,27 @@ func (c *Canal) updateReplicationDelay(ev *replication.BinlogEvent) {
 	c.delay.Store(newDelay)
 }
 
-func (c *Canal) handleRowsEvent(e *replication.BinlogEvent) error {
+// handleRowsEvent passes the rows of the event at pos to the event handler.
+func (c *Canal) handleRowsEvent(e *replication.BinlogEvent, trx Transaction, pos mysql.Position) error {
 	ev := e.Event.(*replication.RowsEvent)
 
 	// Caveat: table may be altered at runtime.
 	schemaName := string(ev.Table.Schema)
 	tableName := string(ev.Table.Table)
+	if c.isWatermarkTable(schemaName, tableName) {
+		return nil
+	}
+	if c.backfilled(schemaName+"."+tableName, e.Header) {
+		return nil
+	}
 
-	t, err := c.GetTable(schemaName, tableName)
+	var t *schema.Table
+	var err error
+	if c.cfg.UseTableMapMetadata {
+		t, err = c.tableFromTableMap(ev.Table)
+	} else {
+		t, err = c.getTable(schemaName, tableName, pos)
+	}
 	if err != nil {
 		cause := errors.Cause(err)
 		// ignore errors below
@@ -284,6 +443,11 @@ func (c *Canal) handleRowsEvent(e *replication.BinlogEvent) error {
 		}
 		return err
 	}
+	if ev.Rows == nil {
+		// the table was included after the rows were read, so they are not
+		// decoded
+		return nil
+	}
 	var action string
 	switch e.Header.EventType {
 	case replication.WRITE_ROWS_EVENTv1, replication.WRITE_ROWS_EVENTv2, replication.MARIADB_WRITE_ROWS_COMPRESSED_EVENT_V1:
@@ -296,7 +460,9 @@ func (c *Canal) handleRowsEvent(e *replication.BinlogEvent) error {
 		return errors.Errorf("%s not supported now", e.Header.EventType)
 	}
 	events := newRowsEvent(t, action, ev.Rows, e.Header, ev)
-	return c.eventHandler.OnRow(events)
+	events.GTID = trx.GTID
+	events.CommitTime = trx.CommitTime
+	return c.onRow(events)
 }
 
 func (c *Canal) FlushBinlog() error {
@@ -337,6 +503,42 @@ func (c *Canal) WaitUntilPosContext(ctx context.Context, pos mysql.Position, tim
 	}
 }
 
+// WaitUntilGTID waits until the synced GTID set contains gset, see
+// WaitUntilGTIDContext.
+func (c *Canal) WaitUntilGTID(gset mysql.GTIDSet, timeout time.Duration) error {
+	return c.WaitUntilGTIDContext(context.Background(), gset, timeout)
+}
+
+// WaitUntilGTIDContext waits until the synced GTID set contains gset, like
+// WaitUntilPosContext for GTIDs without FLUSH BINARY LOGS. It returns
+// ErrNotGTIDSync when canal syncs from a binlog position.
+func (c *Canal) WaitUntilGTIDContext(ctx context.Context, gset mysql.GTIDSet, timeout time.Duration) error {
+	if synced := c.master.GTIDSet(); synced == nil || synced.String() == "" {
+		return errors.Trace(ErrNotGTIDSync)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		synced := c.master.GTIDSet()
+		if synced != nil && synced.Contain(gset) {
+			return nil
+		}
+		c.cfg.Logger.Debug("master GTID set is behind, wait to catch up", slog.Any("synced", synced), slog.Any("target", gset))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return errors.Errorf("wait GTID set %v too long > %s", gset, timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
 // getShowBinaryLogQuery returns the correct SQL statement to query binlog status
 // for the given database flavor and server version.
 //
@@ -376,14 +578,7 @@ func (c *Canal) GetMasterPos() (mysql.Position, error) {
 }
 
 func (c *Canal) GetMasterGTIDSet() (mysql.GTIDSet, error) {
-	query := ""
-	switch c.cfg.Flavor {
-	case mysql.MariaDBFlavor:
-		query = "SELECT @@GLOBAL.gtid_current_pos"
-	default:
-		query = "SELECT @@GLOBAL.GTID_EXECUTED"
-	}
-	rr, err := c.Execute(query)
+	rr, err := c.Execute("SELECT " + gtidSetVariable(c.cfg.Flavor))
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -398,6 +593,23 @@ func (c *Canal) GetMasterGTIDSet() (mysql.GTIDSet, error) {
 	return gset, nil
 }
 
+// CatchMasterGTID waits until the executed GTID set of the master is
+// synced, see CatchMasterGTIDContext.
+func (c *Canal) CatchMasterGTID(timeout time.Duration) error {
+	return c.CatchMasterGTIDContext(context.Background(), timeout)
+}
+
+// CatchMasterGTIDContext waits until the executed GTID set of the master,
+// read when it is called, is synced.
+func (c *Canal) CatchMasterGTIDContext(ctx context.Context, timeout time.Duration) error {
+	gset, err := c.GetMasterGTIDSet()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	return c.WaitUntilGTIDContext(ctx, gset, timeout)
+}
+
 func (c *Canal) CatchMasterPos(timeout time.Duration) error {
 	return c.CatchMasterPosContext(context.Background(), timeout)
 }
@@ -1,9 +1,13 @@
 package canal
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
 )
 
 func TestGetShowBinaryLogQuery(t *testing.T) {
@@ -29,3 +33,28 @@ func TestGetShowBinaryLogQuery(t *testing.T) {
 		})
 	}
 }
+
+func TestWaitUntilGTID(t *testing.T) {
+	c := newTransactionTestCanal(&DummyEventHandler{})
+	target, err := mysql.ParseMysqlGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-10")
+	require.NoError(t, err)
+
+	// synced from a binlog position, it doesn't wait for the timeout
+	require.ErrorIs(t, c.WaitUntilGTID(target, time.Hour), ErrNotGTIDSync)
+
+	synced, err := mysql.ParseMysqlGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5")
+	require.NoError(t, err)
+	c.master.UpdateGTIDSet(synced)
+	require.Error(t, c.WaitUntilGTID(target, 10*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, c.WaitUntilGTIDContext(ctx, target, time.Second), context.Canceled)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		synced, _ := mysql.ParseMysqlGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-12")
+		c.master.UpdateGTIDSet(synced)
+	}()
+	require.NoError(t, c.WaitUntilGTID(target, 5*time.Second))
+}
@@ -0,0 +1,252 @@
+package canal
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"slices"
+
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// tableFilterUpdate is a table filter to apply between the transactions of
+// the binlog sync.
+type tableFilterUpdate struct {
+	include  []*regexp.Regexp
+	exclude  []*regexp.Regexp
+	backfill bool
+	done     chan error
+}
+
+// UpdateTableFilter replaces IncludeTableRegex and ExcludeTableRegex while
+// the canal runs. While the binlog is synced, the filter is applied after
+// the transaction being handled and UpdateTableFilter waits for it; the rows
+// of the tables newly included are passed from the events read after that.
+//
+// With backfill, the tables newly included are read with a native snapshot,
+// like Dump.Native, and their rows are passed to OnRow as InsertAction before
+// their binlog rows, which are passed from the binlog position of the
+// snapshot. The binlog sync waits for the backfill, which needs the
+// privileges of FLUSH TABLES WITH READ LOCK. If it fails the filter is not
+// changed, but some rows may have been passed already. Backfill is ignored
+// when the binlog is not synced.
+func (c *Canal) UpdateTableFilter(include []string, exclude []string, backfill bool) error {
+	c.filterUpdateLock.Lock()
+	defer c.filterUpdateLock.Unlock()
+
+	return c.updateTableFilter(include, exclude, backfill)
+}
+
+// AddTable includes the table db.table in the table filter, see
+// UpdateTableFilter.
+func (c *Canal) AddTable(db string, table string, backfill bool) error {
+	c.filterUpdateLock.Lock()
+	defer c.filterUpdateLock.Unlock()
+
+	key := db + "." + table
+	expr := tableExpr(key)
+	include, exclude := c.tableFilter()
+	exclude = slices.DeleteFunc(exclude, func(e *regexp.Regexp) bool {
+		return e.String() == expr
+	})
+	if include != nil && !matchTable(include, nil, key) {
+		include = append(include, regexp.MustCompile(expr))
+	}
+	if !matchTable(include, exclude, key) {
+		return errors.Errorf("table %s is excluded by ExcludeTableRegex", key)
+	}
+	return c.updateTableFilter(regexStrings(include), regexStrings(exclude), backfill)
+}
+
+// RemoveTable excludes the table db.table from the table filter, see
+// UpdateTableFilter.
+func (c *Canal) RemoveTable(db string, table string) error {
+	c.filterUpdateLock.Lock()
+	defer c.filterUpdateLock.Unlock()
+
+	key := db + "." + table
+	include, exclude := c.tableFilter()
+	if !matchTable(include, exclude, key) {
+		return nil
+	}
+	exclude = append(exclude, regexp.MustCompile(tableExpr(key)))
+	return c.updateTableFilter(regexStrings(include), regexStrings(exclude), false)
+}
+
+func (c *Canal) updateTableFilter(include []string, exclude []string, backfill bool) error {
+	u := &tableFilterUpdate{backfill: backfill, done: make(chan error, 1)}
+	var err error
+	if u.include, err = compileTableRegex(include); err != nil {
+		return errors.Trace(err)
+	}
+	if u.exclude, err = compileTableRegex(exclude); err != nil {
+		return errors.Trace(err)
+	}
+
+	c.filterLock.Lock()
+	if !c.syncing {
+		c.filterLock.Unlock()
+		c.setTableFilter(u.include, u.exclude)
+		return nil
+	}
+	c.filterUpdates = append(c.filterUpdates, u)
+	if c.filterWake != nil {
+		// wake the sync up if it waits for events
+		c.filterWake()
+	}
+	c.filterLock.Unlock()
+
+	select {
+	case err = <-u.done:
+		return errors.Trace(err)
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	}
+}
+
+func (c *Canal) tableFilter() ([]*regexp.Regexp, []*regexp.Regexp) {
+	c.tableLock.RLock()
+	defer c.tableLock.RUnlock()
+
+	return slices.Clone(c.includeTableRegex), slices.Clone(c.excludeTableRegex)
+}
+
+func tableExpr(key string) string {
+	return "^" + regexp.QuoteMeta(key) + "$"
+}
+
+func regexStrings(regs []*regexp.Regexp) []string {
+	if regs == nil {
+		return nil
+	}
+	exprs := make([]string, len(regs))
+	for i, reg := range regs {
+		exprs[i] = reg.String()
+	}
+	return exprs
+}
+
+// setSyncing marks whether the binlog sync applies the table filter updates.
+func (c *Canal) setSyncing(syncing bool) {
+	c.filterLock.Lock()
+	defer c.filterLock.Unlock()
+
+	c.syncing = syncing
+}
+
+// filterWaitContext returns the context to wait for the events with, which
+// is canceled when a table filter update is queued.
+func (c *Canal) filterWaitContext() context.Context {
+	c.filterLock.Lock()
+	defer c.filterLock.Unlock()
+
+	if c.filterWaitCtx == nil || c.filterWaitCtx.Err() != nil {
+		c.filterWaitCtx, c.filterWake = context.WithCancel(c.ctx)
+	}
+	return c.filterWaitCtx
+}
+
+// applyTableFilterUpdates applies the queued table filter updates unless a
+// transaction is being handled.
+func (c *Canal) applyTableFilterUpdates(applier *parallelApplier) error {
+	c.filterLock.Lock()
+	updates := c.filterUpdates
+	if len(updates) == 0 || c.inTransaction(applier) {
+		c.filterLock.Unlock()
+		return nil
+	}
+	c.filterUpdates = nil
+	c.filterLock.Unlock()
+
+	if applier != nil {
+		if err := applier.wait(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	for _, u := range updates {
+		u.done <- c.applyTableFilterUpdate(u)
+	}
+	return nil
+}
+
+func (c *Canal) applyTableFilterUpdate(u *tableFilterUpdate) error {
+	include, exclude := c.tableFilter()
+	c.setTableFilter(u.include, u.exclude)
+	c.cfg.Logger.Info("update table filter", slog.Any("include", regexStrings(u.include)), slog.Any("exclude", regexStrings(u.exclude)))
+	if !u.backfill {
+		return nil
+	}
+
+	if err := c.backfill(include, exclude); err != nil {
+		c.setTableFilter(include, exclude)
+		return errors.Annotate(err, "backfill")
+	}
+	return nil
+}
+
+// backfill passes the rows of the tables included by the filter but not by
+// the previous one to OnRow, and skips their binlog rows until the position
+// of the snapshot.
+func (c *Canal) backfill(include []*regexp.Regexp, exclude []*regexp.Regexp) error {
+	conn, err := c.snapshotConn()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer conn.Close()
+
+	h := &dumpParseHandler{c: c}
+	if err = c.startSnapshot(conn, h, true); err != nil {
+		return errors.Trace(err)
+	}
+	defer func() {
+		_, _ = conn.Execute("ROLLBACK")
+	}()
+
+	tables, err := (&snapshotDumper{}).listTables(conn)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	pos := mysql.Position{Name: h.name, Pos: uint32(h.pos)}
+	for _, t := range tables {
+		key := t.db + "." + t.table
+		if matchTable(include, exclude, key) || !c.checkTableMatch(key) || c.isWatermarkTable(t.db, t.table) {
+			continue
+		}
+
+		c.cfg.Logger.Info("backfill table", slog.String("table", key), slog.Any("pos", pos))
+		c.tableLock.Lock()
+		if c.backfillPos == nil {
+			c.backfillPos = make(map[string]mysql.Position)
+		}
+		c.backfillPos[key] = pos
+		c.tableLock.Unlock()
+
+		if err = c.dumpSnapshotTable(conn, t.db, t.table, ""); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// backfilled reports whether the rows event of the table is before the
+// position of its backfill.
+func (c *Canal) backfilled(key string, header *replication.EventHeader) bool {
+	c.tableLock.RLock()
+	pos, ok := c.backfillPos[key]
+	c.tableLock.RUnlock()
+	if !ok {
+		return false
+	}
+
+	cur := mysql.Position{Name: c.master.Position().Name, Pos: header.LogPos}
+	if cur.Compare(pos) <= 0 {
+		return true
+	}
+	c.tableLock.Lock()
+	delete(c.backfillPos, key)
+	c.tableLock.Unlock()
+	return false
+}
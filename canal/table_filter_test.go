@@ -0,0 +1,92 @@
+package canal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+func TestCanalAddRemoveTable(t *testing.T) {
+	c := newTransactionTestCanal(&DummyEventHandler{})
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	defer c.cancel()
+	c.cfg.IncludeTableRegex = []string{"test\\..*"}
+	c.cfg.ExcludeTableRegex = []string{"test\\.tmp_.*"}
+	require.NoError(t, c.initTableFilter())
+
+	require.True(t, c.checkTableMatch("test.t"))
+	require.False(t, c.checkTableMatch("shop.users"))
+
+	require.NoError(t, c.AddTable("shop", "users", false))
+	require.True(t, c.checkTableMatch("shop.users"))
+	require.False(t, c.checkTableMatch("shop.orders"))
+
+	require.NoError(t, c.RemoveTable("test", "t"))
+	require.False(t, c.checkTableMatch("test.t"))
+	require.True(t, c.checkTableMatch("test.u"))
+
+	// the exact exclude of RemoveTable is removed, not the regexps
+	require.NoError(t, c.AddTable("test", "t", false))
+	require.True(t, c.checkTableMatch("test.t"))
+	require.Error(t, c.AddTable("test", "tmp_1", false))
+
+	include, exclude := c.tableFilter()
+	require.Equal(t, []string{"test\\..*", "^shop\\.users$"}, regexStrings(include))
+	require.Equal(t, []string{"test\\.tmp_.*"}, regexStrings(exclude))
+
+	require.Error(t, c.UpdateTableFilter([]string{"("}, nil, false))
+	require.NoError(t, c.UpdateTableFilter(nil, nil, false))
+	require.True(t, c.checkTableMatch("test.tmp_1"))
+}
+
+func TestCanalTableFilterUpdateAfterTransaction(t *testing.T) {
+	h := &transformTestHandler{}
+	c := newTransactionTestCanal(h)
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	defer c.cancel()
+	c.cfg.IncludeTableRegex = []string{"other\\..*"}
+	require.NoError(t, c.initTableFilter())
+	c.setSyncing(true)
+
+	waitCtx := c.filterWaitContext()
+	done := make(chan error, 1)
+	go func() {
+		done <- c.AddTable("test", "t", false)
+	}()
+	// the update wakes the sync up
+	<-waitCtx.Done()
+
+	// the update waits for the end of the transaction
+	require.NoError(t, c.handleEvent(transactionTestEvent(100, &replication.QueryEvent{Query: []byte("BEGIN")})))
+	require.NoError(t, c.applyTableFilterUpdates(nil))
+	require.False(t, c.checkTableMatch("test.t"))
+	require.NoError(t, c.handleEvent(transactionTestEvent(200, &replication.XIDEvent{})))
+	require.NoError(t, c.applyTableFilterUpdates(nil))
+	require.NoError(t, <-done)
+	require.True(t, c.checkTableMatch("test.t"))
+
+	// the rows read before the table was included are not decoded
+	undecoded := transactionTestRows(300, 1)
+	undecoded.Event.(*replication.RowsEvent).Rows = nil
+	require.NoError(t, c.handleEvent(undecoded))
+	require.NoError(t, c.handleEvent(transactionTestRows(400, 2)))
+	require.Len(t, h.events, 1)
+	require.Equal(t, int32(2), h.events[0].Rows[0][0])
+}
+
+func TestCanalBackfilledRows(t *testing.T) {
+	h := &transformTestHandler{}
+	c := newTransactionTestCanal(h)
+	c.backfillPos = map[string]mysql.Position{"test.t": {Name: "mysql-bin.000001", Pos: 300}}
+
+	for i, pos := range []uint32{200, 300, 400, 500} {
+		require.NoError(t, c.handleEvent(transactionTestRows(pos, int32(i))))
+	}
+	require.Len(t, h.events, 2)
+	require.Equal(t, int32(2), h.events[0].Rows[0][0])
+	require.Empty(t, c.backfillPos)
+}
@@ -0,0 +1,219 @@
+package canal
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/pkg/parser/charset"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// tableFromTableMap returns the table of a rows event built from the
+// optional metadata of its table map event, see UseTableMapMetadata.
+func (c *Canal) tableFromTableMap(tm *replication.TableMapEvent) (*schema.Table, error) {
+	key := fmt.Sprintf("%s.%s", tm.Schema, tm.Table)
+	if !c.checkTableMatch(key) {
+		return nil, ErrExcludedTable
+	}
+
+	c.tableLock.RLock()
+	cached, ok := c.tableMapTables[key]
+	c.tableLock.RUnlock()
+	if ok && cached.matches(tm) {
+		return cached.table, nil
+	}
+
+	t, err := newTableFromTableMap(tm)
+	if err != nil {
+		return nil, err
+	}
+	c.tableLock.Lock()
+	if c.tableMapTables == nil {
+		c.tableMapTables = make(map[string]*tableMapTable)
+	}
+	c.tableMapTables[key] = &tableMapTable{tm: tm, table: t}
+	c.tableLock.Unlock()
+	return t, nil
+}
+
+// tableMapTable is the table built from a table map event, reused for the
+// next table map events of the table until its definition changes.
+type tableMapTable struct {
+	tm    *replication.TableMapEvent
+	table *schema.Table
+}
+
+// matches reports whether the table map event is the one of the table, or
+// logs the same definition. The server uses a new table ID once the
+// definition of a table changed, the columns are compared in case the IDs
+// are reused after a restart.
+func (t *tableMapTable) matches(tm *replication.TableMapEvent) bool {
+	if t.tm == tm {
+		return true
+	}
+	return t.tm.TableID == tm.TableID &&
+		bytes.Equal(t.tm.ColumnType, tm.ColumnType) &&
+		slices.Equal(t.tm.ColumnMeta, tm.ColumnMeta) &&
+		slices.EqualFunc(t.tm.ColumnName, tm.ColumnName, bytes.Equal)
+}
+
+// newTableFromTableMap builds the table from the column names, signedness,
+// collations, enum and set values, primary key and visibility logged with
+// binlog_row_metadata=FULL.
+func newTableFromTableMap(tm *replication.TableMapEvent) (*schema.Table, error) {
+	names := tm.ColumnNameString()
+	if len(names) != int(tm.ColumnCount) {
+		return nil, errors.Errorf("table map event of %s.%s has no column names, binlog_row_metadata=FULL is required", tm.Schema, tm.Table)
+	}
+
+	unsigned := tm.UnsignedMap()
+	collations := tm.CollationMap()
+	enumSetCollations := tm.EnumSetCollationMap()
+	enumValues := tm.EnumStrValueMap()
+	setValues := tm.SetStrValueMap()
+	geometryTypes := tm.GeometryTypeMap()
+	visibility := tm.VisibilityMap()
+
+	t := &schema.Table{
+		Schema:  string(tm.Schema),
+		Name:    string(tm.Table),
+		Columns: make([]schema.TableColumn, 0, len(names)),
+		Indexes: make([]*schema.Index, 0, 1),
+	}
+	for i, name := range names {
+		collationID, ok := collations[i]
+		if !ok {
+			collationID = enumSetCollations[i]
+		}
+		var collation string
+		maxLen := uint16(1)
+		if co, err := charset.GetCollationByID(int(collationID)); err == nil && collationID != 0 {
+			collation = co.Name
+			if cs, err := charset.GetCharsetInfo(co.CharsetName); err == nil {
+				maxLen = uint16(cs.Maxlen)
+			}
+		}
+
+		columnType := tableMapColumnType(tm.ColumnType[i], tm.ColumnMeta[i], collation, maxLen)
+		switch {
+		case tm.IsEnumColumn(i):
+			columnType = "enum('" + strings.Join(enumValues[i], "','") + "')"
+		case tm.IsSetColumn(i):
+			columnType = "set('" + strings.Join(setValues[i], "','") + "')"
+		case tm.IsGeometryColumn(i) && geometryTypes[i] == 1:
+			columnType = "point"
+		}
+		if unsigned[i] {
+			columnType += " unsigned"
+		}
+
+		var extra string
+		if visible, ok := visibility[i]; ok && !visible {
+			extra = "INVISIBLE"
+		}
+
+		t.AddColumn(name, columnType, collation, extra)
+		// the values may contain commas
+		if values, ok := enumValues[i]; ok {
+			t.Columns[i].EnumValues = values
+		}
+		if values, ok := setValues[i]; ok {
+			t.Columns[i].SetValues = values
+		}
+	}
+
+	if len(tm.PrimaryKey) > 0 {
+		index := t.AddIndex("PRIMARY")
+		t.PKColumns = make([]int, len(tm.PrimaryKey))
+		for i, column := range tm.PrimaryKey {
+			if column >= tm.ColumnCount {
+				return nil, errors.Errorf("primary key column %d of %s.%s is out of range", column, tm.Schema, tm.Table)
+			}
+			index.AddColumn(names[column], 0)
+			t.PKColumns[i] = int(column)
+		}
+	}
+
+	return t, nil
+}
+
+// tableMapColumnType returns the column type like SHOW COLUMNS from the type
+// and the metadata of the table map event. The length of character columns
+// is logged in bytes, maxLen is the bytes per character of their charset.
+func tableMapColumnType(tp byte, meta uint16, collation string, maxLen uint16) string {
+	binary := collation == "binary"
+	if tp == mysql.MYSQL_TYPE_STRING {
+		var length int
+		tp, length = replication.StringColumnType(meta)
+		meta = uint16(length)
+	}
+
+	switch tp {
+	case mysql.MYSQL_TYPE_TINY:
+		return "tinyint"
+	case mysql.MYSQL_TYPE_SHORT:
+		return "smallint"
+	case mysql.MYSQL_TYPE_INT24:
+		return "mediumint"
+	case mysql.MYSQL_TYPE_LONG:
+		return "int"
+	case mysql.MYSQL_TYPE_LONGLONG:
+		return "bigint"
+	case mysql.MYSQL_TYPE_YEAR:
+		return "year"
+	case mysql.MYSQL_TYPE_FLOAT:
+		return "float"
+	case mysql.MYSQL_TYPE_DOUBLE:
+		return "double"
+	case mysql.MYSQL_TYPE_NEWDECIMAL:
+		return fmt.Sprintf("decimal(%d,%d)", meta>>8, meta&0xff)
+	case mysql.MYSQL_TYPE_DECIMAL:
+		return "decimal"
+	case mysql.MYSQL_TYPE_BIT:
+		return fmt.Sprintf("bit(%d)", (meta>>8)*8+(meta&0xff))
+	case mysql.MYSQL_TYPE_TIMESTAMP, mysql.MYSQL_TYPE_TIMESTAMP2:
+		return withFsp("timestamp", meta)
+	case mysql.MYSQL_TYPE_DATETIME, mysql.MYSQL_TYPE_DATETIME2:
+		return withFsp("datetime", meta)
+	case mysql.MYSQL_TYPE_TIME, mysql.MYSQL_TYPE_TIME2:
+		return withFsp("time", meta)
+	case mysql.MYSQL_TYPE_DATE, mysql.MYSQL_TYPE_NEWDATE:
+		return "date"
+	case mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_VAR_STRING:
+		if binary {
+			return fmt.Sprintf("varbinary(%d)", meta)
+		}
+		return fmt.Sprintf("varchar(%d)", meta/maxLen)
+	case mysql.MYSQL_TYPE_STRING:
+		if binary {
+			return fmt.Sprintf("binary(%d)", meta)
+		}
+		return fmt.Sprintf("char(%d)", meta/maxLen)
+	case mysql.MYSQL_TYPE_BLOB:
+		prefix := [...]string{"tiny", "", "medium", "long"}[min(max(meta, 1), 4)-1]
+		if binary || collation == "" {
+			return prefix + "blob"
+		}
+		return prefix + "text"
+	case mysql.MYSQL_TYPE_JSON:
+		return "json"
+	case mysql.MYSQL_TYPE_GEOMETRY:
+		return "geometry"
+	case mysql.MYSQL_TYPE_VECTOR:
+		return "vector"
+	}
+	return fmt.Sprintf("unknown(%d)", tp)
+}
+
+func withFsp(columnType string, fsp uint16) string {
+	if fsp == 0 {
+		return columnType
+	}
+	return fmt.Sprintf("%s(%d)", columnType, fsp)
+}
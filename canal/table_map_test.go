@@ -0,0 +1,94 @@
+package canal
+
+import (
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTableFromTableMap(t *testing.T) {
+	tm := &replication.TableMapEvent{
+		Schema:      []byte("test"),
+		Table:       []byte("t"),
+		ColumnCount: 7,
+		ColumnType: []byte{
+			mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_STRING,
+			mysql.MYSQL_TYPE_NEWDECIMAL, mysql.MYSQL_TYPE_DATETIME2, mysql.MYSQL_TYPE_LONG,
+		},
+		ColumnMeta: []uint16{0, 40, 4, uint16(mysql.MYSQL_TYPE_ENUM)<<8 | 1, 10<<8 | 2, 3, 0},
+		ColumnName: [][]byte{
+			[]byte("id"), []byte("name"), []byte("data"), []byte("e"), []byte("amount"), []byte("created"), []byte("hidden"),
+		},
+		SignednessBitmap:      []byte{0x80},
+		DefaultCharset:        []uint64{255, 1, 63},
+		EnumSetDefaultCharset: []uint64{255},
+		EnumStrValue:          [][][]byte{{[]byte("a"), []byte("b,c")}},
+		PrimaryKey:            []uint64{0},
+		VisibilityBitmap:      []byte{0xfc},
+	}
+
+	ta, err := newTableFromTableMap(tm)
+	require.NoError(t, err)
+	require.Equal(t, "test.t", ta.String())
+
+	var types []string
+	for _, col := range ta.Columns {
+		types = append(types, col.RawType)
+	}
+	require.Equal(t, []string{
+		"int unsigned", "varchar(10)", "varbinary(4)", "enum('a','b,c')", "decimal(10,2)", "datetime(3)", "int",
+	}, types)
+
+	require.True(t, ta.Columns[0].IsUnsigned)
+	require.Equal(t, []int{0}, ta.UnsignedColumns)
+	require.Equal(t, "utf8mb4_0900_ai_ci", ta.Columns[1].Collation)
+	require.Equal(t, schema.TYPE_BINARY, ta.Columns[2].Type)
+	require.Equal(t, schema.TYPE_ENUM, ta.Columns[3].Type)
+	require.Equal(t, []string{"a", "b,c"}, ta.Columns[3].EnumValues)
+	require.Equal(t, schema.TYPE_DECIMAL, ta.Columns[4].Type)
+	require.Equal(t, schema.TYPE_DATETIME, ta.Columns[5].Type)
+	require.True(t, ta.Columns[6].IsInvisible)
+	require.False(t, ta.Columns[0].IsInvisible)
+	require.Equal(t, []int{0}, ta.PKColumns)
+	require.Equal(t, "PRIMARY", ta.Indexes[0].Name)
+
+	// without binlog_row_metadata=FULL
+	_, err = newTableFromTableMap(&replication.TableMapEvent{
+		Schema:      []byte("test"),
+		Table:       []byte("t"),
+		ColumnCount: 1,
+		ColumnType:  []byte{mysql.MYSQL_TYPE_LONG},
+		ColumnMeta:  []uint16{0},
+	})
+	require.Error(t, err)
+}
+
+func TestTableFromTableMapCache(t *testing.T) {
+	c := newTransactionTestCanal(&DummyEventHandler{})
+	c.tableMatchCache = make(map[string]bool)
+	tableMap := func(tableID uint64, columns ...string) *replication.TableMapEvent {
+		tm := &replication.TableMapEvent{TableID: tableID, Schema: []byte("test"), Table: []byte("t"), ColumnCount: uint64(len(columns))}
+		for _, name := range columns {
+			tm.ColumnType = append(tm.ColumnType, mysql.MYSQL_TYPE_LONG)
+			tm.ColumnMeta = append(tm.ColumnMeta, 0)
+			tm.ColumnName = append(tm.ColumnName, []byte(name))
+		}
+		return tm
+	}
+
+	ta, err := c.tableFromTableMap(tableMap(100, "id"))
+	require.NoError(t, err)
+	// the table map events of the next transactions
+	ta2, err := c.tableFromTableMap(tableMap(100, "id"))
+	require.NoError(t, err)
+	require.Same(t, ta, ta2)
+
+	// the table is altered
+	ta2, err = c.tableFromTableMap(tableMap(101, "id", "name"))
+	require.NoError(t, err)
+	require.NotSame(t, ta, ta2)
+	require.Equal(t, []string{"id", "name"}, schemaHistoryColumns(ta2))
+}
@@ -0,0 +1,124 @@
+package canal
+
+import (
+	"time"
+
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// Transaction is the metadata of a binlog transaction.
+type Transaction struct {
+	// GTID is empty when GTID mode is off.
+	GTID string
+	// CommitTime is the original commit time of MySQL 8.0, otherwise the
+	// time of the first event of the transaction.
+	CommitTime time.Time
+}
+
+// newTransaction returns the transaction started by a GTID event. The commit
+// time is the original commit time of MySQL 8.0, or the time of the GTID
+// event which MariaDB writes at commit.
+func newTransaction(header *replication.EventHeader, e mysql.BinlogGTIDEvent) Transaction {
+	var trx Transaction
+	if !isAnonymousGTID(e) {
+		if gset, err := e.GTIDNext(); err == nil {
+			trx.GTID = gset.String()
+		}
+	}
+	if ge, ok := e.(*replication.GTIDEvent); ok {
+		trx.CommitTime = ge.OriginalCommitTime()
+	}
+	if trx.CommitTime.IsZero() {
+		trx.CommitTime = eventTime(header)
+	}
+	return trx
+}
+
+// isAnonymousGTID reports whether e is the ANONYMOUS_GTID_EVENT of a
+// transaction written with gtid_mode=OFF, which has no GTID: it is decoded
+// like a GTID event with a zero SID and GNO.
+func isAnonymousGTID(e mysql.BinlogGTIDEvent) bool {
+	ge, ok := e.(*replication.GTIDEvent)
+	return ok && ge.GNO == 0
+}
+
+func eventTime(header *replication.EventHeader) time.Time {
+	if header == nil || header.Timestamp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(header.Timestamp), 0)
+}
+
+// trxState tracks the transaction of the events passed to handleEvent.
+type trxState struct {
+	Transaction
+
+	// OnBegin is called and OnCommit is not yet
+	open bool
+	// the boundaries of the transaction, from its GTID and query events
+	tracker replication.TransactionTracker
+}
+
+// gtidTrx tracks the transaction started by the GTID event ev.
+func (c *Canal) gtidTrx(ev *replication.BinlogEvent, trx Transaction) {
+	c.trx.Transaction = trx
+	c.trx.open = false
+	c.trx.tracker.Update(ev)
+}
+
+// inTransaction reports whether the events of a transaction are being
+// handled, by c or by the parallel applier.
+func (c *Canal) inTransaction(applier *parallelApplier) bool {
+	return c.trx.open || (applier != nil && applier.trx != nil)
+}
+
+// beginTrx starts the transaction of c.trx.
+func (c *Canal) beginTrx(header *replication.EventHeader) error {
+	c.trx.open = true
+	trx := c.trx.Transaction
+	return c.onBegin(header, &trx)
+}
+
+// commitTrx ends the open transaction.
+func (c *Canal) commitTrx(header *replication.EventHeader, pos mysql.Position) error {
+	c.trx.tracker.Reset()
+	if !c.trx.open {
+		return nil
+	}
+	c.trx.open = false
+	return c.onCommit(header, pos)
+}
+
+// queryTrx tracks the transaction of the query event ev, it returns whether
+// the query ends the transaction. A statement outside of BEGIN and COMMIT,
+// like DDL, is a transaction by itself.
+func (c *Canal) queryTrx(ev *replication.BinlogEvent) (bool, error) {
+	begin, end := c.trx.tracker.Update(ev)
+	if begin {
+		// no GTID event
+		c.trx.Transaction = Transaction{CommitTime: eventTime(ev.Header)}
+		if err := c.beginTrx(ev.Header); err != nil {
+			return false, err
+		}
+	}
+	return end && c.trx.open, nil
+}
+
+func (c *Canal) onBegin(header *replication.EventHeader, trx *Transaction) error {
+	h, ok := c.eventHandler.(TransactionHandler)
+	if !ok {
+		return nil
+	}
+	return errors.Trace(h.OnBegin(header, trx))
+}
+
+func (c *Canal) onCommit(header *replication.EventHeader, pos mysql.Position) error {
+	h, ok := c.eventHandler.(TransactionHandler)
+	if !ok {
+		return nil
+	}
+	return errors.Trace(h.OnCommit(header, pos))
+}
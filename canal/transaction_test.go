@@ -0,0 +1,187 @@
+package canal
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+	"github.com/pingcap/tidb/pkg/parser"
+	"github.com/stretchr/testify/require"
+)
+
+var transactionTestSID = []byte{0x3e, 0x11, 0xfa, 0x47, 0x71, 0xca, 0x11, 0xe1, 0x9e, 0x33, 0xc8, 0x0a, 0xa9, 0x42, 0x95, 0x62}
+
+type transactionTestHandler struct {
+	DummyEventHandler
+
+	calls []string
+}
+
+func (h *transactionTestHandler) OnBegin(_ *replication.EventHeader, trx *Transaction) error {
+	h.calls = append(h.calls, fmt.Sprintf("begin %s %d", trx.GTID, trx.CommitTime.Unix()))
+	return nil
+}
+
+func (h *transactionTestHandler) OnCommit(_ *replication.EventHeader, pos mysql.Position) error {
+	h.calls = append(h.calls, fmt.Sprintf("commit %d", pos.Pos))
+	return nil
+}
+
+func (h *transactionTestHandler) OnRow(e *RowsEvent) error {
+	h.calls = append(h.calls, fmt.Sprintf("row %v %s", e.Rows[0][0], e.GTID))
+	return nil
+}
+
+func (h *transactionTestHandler) OnXID(*replication.EventHeader, mysql.Position) error {
+	h.calls = append(h.calls, "xid")
+	return nil
+}
+
+func (h *transactionTestHandler) OnDDL(*replication.EventHeader, mysql.Position, *replication.QueryEvent) error {
+	h.calls = append(h.calls, "ddl")
+	return nil
+}
+
+func (h *transactionTestHandler) OnPosSynced(_ *replication.EventHeader, pos mysql.Position, _ mysql.GTIDSet, _ bool) error {
+	h.calls = append(h.calls, fmt.Sprintf("synced %d", pos.Pos))
+	return nil
+}
+
+func newTransactionTestCanal(h EventHandler) *Canal {
+	cfg := NewDefaultConfig()
+	c := &Canal{
+		cfg:          cfg,
+		parser:       parser.New(),
+		master:       &masterInfo{logger: cfg.Logger},
+		eventHandler: h,
+		tables:       make(map[string]*schema.Table),
+	}
+	c.master.Update(mysql.Position{Name: "mysql-bin.000001", Pos: 4})
+	c.SetTableCache([]byte("test"), []byte("t"), &schema.Table{Schema: "test", Name: "t", Columns: []schema.TableColumn{{Name: "id"}}})
+	return c
+}
+
+func transactionTestEvent(pos uint32, e replication.Event) *replication.BinlogEvent {
+	return &replication.BinlogEvent{Header: &replication.EventHeader{LogPos: pos, Timestamp: 1700000000}, Event: e}
+}
+
+func transactionTestRows(pos uint32, id int32) *replication.BinlogEvent {
+	table := &replication.TableMapEvent{Schema: []byte("test"), Table: []byte("t")}
+	ev := transactionTestEvent(pos, &replication.RowsEvent{Table: table, Rows: [][]any{{id}}})
+	ev.Header.EventType = replication.WRITE_ROWS_EVENTv2
+	return ev
+}
+
+func TestNewTransaction(t *testing.T) {
+	header := &replication.EventHeader{Timestamp: 1700000000}
+
+	trx := newTransaction(header, &replication.GTIDEvent{SID: transactionTestSID, GNO: 7, OriginalCommitTimestamp: 1700000001000000})
+	require.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:7", trx.GTID)
+	require.True(t, trx.CommitTime.Equal(time.Unix(1700000001, 0)))
+
+	// without original commit timestamp, like MariaDB
+	trx = newTransaction(header, &replication.GTIDEvent{SID: transactionTestSID, GNO: 8})
+	require.True(t, trx.CommitTime.Equal(time.Unix(1700000000, 0)))
+
+	// an ANONYMOUS_GTID_EVENT with gtid_mode=OFF has no GTID
+	trx = newTransaction(header, &replication.GTIDEvent{SID: make([]byte, 16), OriginalCommitTimestamp: 1700000001000000})
+	require.Empty(t, trx.GTID)
+	require.True(t, trx.CommitTime.Equal(time.Unix(1700000001, 0)))
+}
+
+func TestTransactionAnonymousGTIDRows(t *testing.T) {
+	h := &transformTestHandler{}
+	c := newTransactionTestCanal(h)
+
+	anonymous := transactionTestEvent(100, &replication.GTIDEvent{SID: make([]byte, 16)})
+	anonymous.Header.EventType = replication.ANONYMOUS_GTID_EVENT
+	for _, ev := range []*replication.BinlogEvent{
+		anonymous,
+		transactionTestEvent(110, &replication.QueryEvent{Query: []byte("BEGIN")}),
+		transactionTestRows(120, 1),
+		transactionTestEvent(130, &replication.XIDEvent{}),
+	} {
+		require.NoError(t, c.handleEvent(ev))
+	}
+	require.Len(t, h.events, 1)
+	require.Empty(t, h.events[0].GTID)
+}
+
+func TestTransactionHandler(t *testing.T) {
+	h := &transactionTestHandler{}
+	c := newTransactionTestCanal(h)
+
+	events := []*replication.BinlogEvent{
+		// a MySQL transaction
+		transactionTestEvent(100, &replication.GTIDEvent{SID: transactionTestSID, GNO: 1, OriginalCommitTimestamp: 1700000001000000}),
+		transactionTestEvent(110, &replication.QueryEvent{Query: []byte("BEGIN")}),
+		transactionTestRows(120, 1),
+		transactionTestEvent(130, &replication.XIDEvent{}),
+		// a compressed transaction
+		transactionTestEvent(200, &replication.GTIDEvent{SID: transactionTestSID, GNO: 2}),
+		transactionTestEvent(230, &replication.TransactionPayloadEvent{Events: []*replication.BinlogEvent{
+			transactionTestEvent(0, &replication.QueryEvent{Query: []byte("BEGIN")}),
+			transactionTestRows(0, 2),
+			transactionTestEvent(230, &replication.XIDEvent{}),
+		}}),
+		// a MariaDB transaction ending with COMMIT
+		transactionTestEvent(400, &replication.MariadbGTIDEvent{GTID: mysql.MariadbGTID{DomainID: 0, ServerID: 1, SequenceNumber: 3}}),
+		transactionTestRows(410, 3),
+		transactionTestEvent(420, &replication.QueryEvent{Query: []byte("COMMIT")}),
+		// DDL without GTID
+		transactionTestEvent(450, &replication.QueryEvent{Schema: []byte("test"), Query: []byte("ALTER TABLE t ADD COLUMN c INT")}),
+		// a MariaDB standalone DDL
+		transactionTestEvent(500, &replication.MariadbGTIDEvent{
+			GTID:  mysql.MariadbGTID{DomainID: 0, ServerID: 1, SequenceNumber: 4},
+			Flags: replication.BINLOG_MARIADB_FL_STANDALONE,
+		}),
+		transactionTestEvent(510, &replication.QueryEvent{Schema: []byte("test"), Query: []byte("DROP TABLE t")}),
+	}
+	for _, ev := range events {
+		require.NoError(t, c.handleEvent(ev))
+	}
+
+	require.Equal(t, []string{
+		"begin 3e11fa47-71ca-11e1-9e33-c80aa9429562:1 1700000001",
+		"row 1 3e11fa47-71ca-11e1-9e33-c80aa9429562:1",
+		"xid", "commit 130", "synced 130",
+		"begin 3e11fa47-71ca-11e1-9e33-c80aa9429562:2 1700000000",
+		"row 2 3e11fa47-71ca-11e1-9e33-c80aa9429562:2",
+		"xid", "commit 230", "synced 230",
+		"begin 0-1-3 1700000000", "row 3 0-1-3", "commit 420", "synced 420",
+		"begin  1700000000", "ddl", "commit 450", "synced 450",
+		"begin 0-1-4 1700000000", "ddl", "commit 510", "synced 510",
+	}, h.calls)
+}
+
+func TestParallelTransactionHandler(t *testing.T) {
+	h := &transactionTestHandler{}
+	c := newTransactionTestCanal(h)
+
+	events := []*replication.BinlogEvent{
+		transactionTestEvent(100, &replication.GTIDEvent{SID: transactionTestSID, GNO: 1, SequenceNumber: 1}),
+		transactionTestEvent(110, &replication.QueryEvent{Query: []byte("BEGIN")}),
+		transactionTestRows(120, 1),
+		transactionTestEvent(130, &replication.XIDEvent{}),
+		// no GTID
+		transactionTestEvent(210, &replication.QueryEvent{Query: []byte("BEGIN")}),
+		transactionTestRows(220, 2),
+		transactionTestEvent(230, &replication.QueryEvent{Query: []byte("ROLLBACK")}),
+	}
+
+	a := newParallelApplier(c, 1)
+	for _, ev := range events {
+		require.NoError(t, a.handleEvent(ev))
+	}
+	a.close()
+
+	require.Equal(t, []string{
+		"begin 3e11fa47-71ca-11e1-9e33-c80aa9429562:1 1700000000",
+		"row 1 3e11fa47-71ca-11e1-9e33-c80aa9429562:1",
+		"xid", "commit 130", "synced 130",
+		"begin  1700000000", "row 2 ", "commit 230", "synced 230",
+	}, h.calls)
+}
@@ -0,0 +1,424 @@
+package canal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// TransformConfig changes the rows of the matching tables before they are
+// passed to OnRow, like:
+//
+//	[[transform]]
+//	table = "shop\\.users"
+//	exclude_columns = ["password"]
+//	hash_columns = ["email"]
+//	hash_salt = "secret"
+//	mask_columns = ["phone"]
+//	mask_keep = 4
+//
+//	[[transform.filter]]
+//	column = "tenant_id"
+//	op = "in"
+//	values = ["1", "2"]
+//
+// The first transform whose Table matches is used. The changed columns are
+// strings in the table of the RowsEvent.
+type TransformConfig struct {
+	// Table is a regexp of the tables with their database name, like
+	// IncludeTableRegex.
+	Table string `toml:"table"`
+
+	// IncludeColumns are the columns kept, all of them if empty.
+	// ExcludeColumns are the columns removed.
+	IncludeColumns []string `toml:"include_columns"`
+	ExcludeColumns []string `toml:"exclude_columns"`
+
+	// HashColumns are replaced by the hex SHA-256 of HashSalt and their value.
+	HashColumns []string `toml:"hash_columns"`
+	HashSalt    string   `toml:"hash_salt"`
+
+	// MaskColumns are replaced by '*' except their last MaskKeep characters.
+	MaskColumns []string `toml:"mask_columns"`
+	MaskKeep    int      `toml:"mask_keep"`
+
+	// Filters keep the rows matching all of them, an update is kept if the
+	// row matches before or after it.
+	Filters []RowFilterConfig `toml:"filter"`
+}
+
+// The operators of the row filters.
+const (
+	FilterIn        = "in"
+	FilterNotIn     = "not_in"
+	FilterNull      = "null"
+	FilterNotNull   = "not_null"
+	FilterRegexp    = "regexp"
+	FilterNotRegexp = "not_regexp"
+)
+
+// RowFilterConfig matches the rows whose column value, as a string, is in
+// Values for in and not_in, or matches the regexp of Values for regexp and
+// not_regexp. The values of enums and sets are their names.
+type RowFilterConfig struct {
+	Column string   `toml:"column"`
+	Op     string   `toml:"op"`
+	Values []string `toml:"values"`
+}
+
+type rowFilter struct {
+	RowFilterConfig
+
+	regexps []*regexp.Regexp
+}
+
+func (f *rowFilter) match(col *schema.TableColumn, v any) bool {
+	switch f.Op {
+	case FilterNull:
+		return v == nil
+	case FilterNotNull:
+		return v != nil
+	}
+	if v == nil {
+		return false
+	}
+
+	s := transformString(col, v)
+	switch f.Op {
+	case FilterIn:
+		return slices.Contains(f.Values, s)
+	case FilterNotIn:
+		return !slices.Contains(f.Values, s)
+	case FilterRegexp, FilterNotRegexp:
+		matched := slices.ContainsFunc(f.regexps, func(r *regexp.Regexp) bool {
+			return r.MatchString(s)
+		})
+		return matched == (f.Op == FilterRegexp)
+	}
+	return false
+}
+
+type transform struct {
+	cfg     TransformConfig
+	table   *regexp.Regexp
+	filters []*rowFilter
+}
+
+const (
+	columnKeep = iota
+	columnHash
+	columnMask
+)
+
+// transformedTable is the table of the transformed rows of a table.
+type transformedTable struct {
+	transform *transform
+	source    *schema.Table
+	table     *schema.Table
+
+	// columns are the indexes of the columns in the source table, ops how
+	// their values are changed.
+	columns []int
+	ops     []int
+	// filters are the filters with the indexes of their columns.
+	filters       []*rowFilter
+	filterColumns []int
+}
+
+// transformer applies the first matching transform to the rows events.
+type transformer struct {
+	transforms []*transform
+
+	mu     sync.RWMutex
+	tables map[string]*transformedTable
+}
+
+func newTransformer(configs []TransformConfig) (*transformer, error) {
+	if len(configs) == 0 {
+		return nil, nil
+	}
+
+	t := &transformer{tables: make(map[string]*transformedTable)}
+	for _, cfg := range configs {
+		reg, err := regexp.Compile(cfg.Table)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		tr := &transform{cfg: cfg, table: reg}
+		for _, filter := range cfg.Filters {
+			f := &rowFilter{RowFilterConfig: filter}
+			switch filter.Op {
+			case FilterIn, FilterNotIn, FilterNull, FilterNotNull:
+			case FilterRegexp, FilterNotRegexp:
+				for _, value := range filter.Values {
+					r, err := regexp.Compile(value)
+					if err != nil {
+						return nil, errors.Trace(err)
+					}
+					f.regexps = append(f.regexps, r)
+				}
+			default:
+				return nil, errors.Errorf("unknown filter op %q of column %s", filter.Op, filter.Column)
+			}
+			tr.filters = append(tr.filters, f)
+		}
+		t.transforms = append(t.transforms, tr)
+	}
+	return t, nil
+}
+
+// table returns the transformed table of a table, nil if no transform
+// matches it.
+func (t *transformer) table(source *schema.Table) (*transformedTable, error) {
+	key := source.String()
+
+	// the cached tables, the versions of the schema history and the tables
+	// of the table map events are only replaced when the table changes
+	t.mu.RLock()
+	tt, ok := t.tables[key]
+	t.mu.RUnlock()
+	if ok && (tt == nil || tt.source == source) {
+		return tt, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tt = nil
+	for _, tr := range t.transforms {
+		if tr.table.MatchString(key) {
+			var err error
+			if tt, err = tr.apply(source); err != nil {
+				return nil, errors.Trace(err)
+			}
+			break
+		}
+	}
+	// the tables changed by DDL are new tables, and replace their entry
+	t.tables[key] = tt
+	return tt, nil
+}
+
+func (tr *transform) apply(source *schema.Table) (*transformedTable, error) {
+	tt := &transformedTable{
+		transform: tr,
+		source:    source,
+		table:     &schema.Table{Schema: source.Schema, Name: source.Name},
+	}
+
+	for _, f := range tr.filters {
+		i := source.FindColumn(f.Column)
+		if i < 0 {
+			return nil, errors.Errorf("filter column %s is not in %s", f.Column, source)
+		}
+		tt.filters = append(tt.filters, f)
+		tt.filterColumns = append(tt.filterColumns, i)
+	}
+
+	// the new index of the columns of the source table, -1 if removed
+	index := make([]int, len(source.Columns))
+	for i, col := range source.Columns {
+		index[i] = -1
+		if len(tr.cfg.IncludeColumns) > 0 && !slices.Contains(tr.cfg.IncludeColumns, col.Name) {
+			continue
+		}
+		if slices.Contains(tr.cfg.ExcludeColumns, col.Name) {
+			continue
+		}
+
+		op := columnKeep
+		switch {
+		case slices.Contains(tr.cfg.HashColumns, col.Name):
+			op = columnHash
+			col.RawType = "char(64)"
+		case slices.Contains(tr.cfg.MaskColumns, col.Name):
+			op = columnMask
+			if col.Type != schema.TYPE_STRING || strings.HasSuffix(col.RawType, "blob") {
+				col.RawType = "text"
+			}
+		}
+		if op != columnKeep {
+			col.Type = schema.TYPE_STRING
+			col.IsUnsigned = false
+			col.EnumValues, col.SetValues = nil, nil
+		}
+
+		index[i] = len(tt.columns)
+		tt.columns = append(tt.columns, i)
+		tt.ops = append(tt.ops, op)
+		tt.table.Columns = append(tt.table.Columns, col)
+		if col.IsUnsigned {
+			tt.table.UnsignedColumns = append(tt.table.UnsignedColumns, index[i])
+		}
+	}
+
+	for _, i := range source.PKColumns {
+		if index[i] < 0 {
+			// a part of the primary key is not a primary key
+			tt.table.PKColumns = nil
+			break
+		}
+		tt.table.PKColumns = append(tt.table.PKColumns, index[i])
+	}
+	for _, idx := range source.Indexes {
+		if !slices.ContainsFunc(idx.Columns, func(column string) bool {
+			return tt.table.FindColumn(column) < 0
+		}) {
+			tt.table.Indexes = append(tt.table.Indexes, idx)
+		}
+	}
+	return tt, nil
+}
+
+// match reports whether the row of the source table matches the filters.
+func (tt *transformedTable) match(row []any) bool {
+	for i, f := range tt.filters {
+		column := tt.filterColumns[i]
+		var v any
+		if column < len(row) {
+			v = row[column]
+		}
+		if !f.match(&tt.source.Columns[column], v) {
+			return false
+		}
+	}
+	return true
+}
+
+// row returns the transformed row of a row of the source table.
+func (tt *transformedTable) row(row []any) []any {
+	cfg := &tt.transform.cfg
+	out := make([]any, len(tt.columns))
+	for i, column := range tt.columns {
+		if column >= len(row) {
+			continue
+		}
+		v := row[column]
+		if v == nil {
+			continue
+		}
+		switch tt.ops[i] {
+		case columnHash:
+			sum := sha256.Sum256([]byte(cfg.HashSalt + transformString(&tt.source.Columns[column], v)))
+			v = hex.EncodeToString(sum[:])
+		case columnMask:
+			v = mask(transformString(&tt.source.Columns[column], v), cfg.MaskKeep)
+		}
+		out[i] = v
+	}
+	return out
+}
+
+// skipped returns the indexes of the skipped columns of a row in the
+// transformed table.
+func (tt *transformedTable) skipped(columns []int) []int {
+	var skipped []int
+	for i, column := range tt.columns {
+		if slices.Contains(columns, column) {
+			skipped = append(skipped, i)
+		}
+	}
+	return skipped
+}
+
+// transform returns the event with the transformed rows, nil if all of them
+// are filtered out.
+func (t *transformer) transform(e *RowsEvent) (*RowsEvent, error) {
+	tt, err := t.table(e.Table)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if tt == nil {
+		return e, nil
+	}
+
+	step := 1
+	if e.Action == UpdateAction {
+		step = 2
+	}
+	out := *e
+	out.Table = tt.table
+	out.Rows = make([][]any, 0, len(e.Rows))
+	out.skippedColumns = nil
+	for i := 0; i+step <= len(e.Rows); i += step {
+		if !slices.ContainsFunc(e.Rows[i:i+step], tt.match) {
+			continue
+		}
+		for j := i; j < i+step; j++ {
+			out.Rows = append(out.Rows, tt.row(e.Rows[j]))
+			if len(e.skippedColumns) > 0 {
+				var skipped []int
+				if j < len(e.skippedColumns) {
+					skipped = tt.skipped(e.skippedColumns[j])
+				}
+				out.skippedColumns = append(out.skippedColumns, skipped)
+			}
+		}
+	}
+	if len(out.Rows) == 0 {
+		return nil, nil
+	}
+	return &out, nil
+}
+
+// transformString returns the value as a string, the names of the values of
+// enums and sets.
+func transformString(col *schema.TableColumn, v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05.999999")
+	case int64:
+		switch col.Type {
+		case schema.TYPE_ENUM:
+			if v > 0 && int(v) <= len(col.EnumValues) {
+				return col.EnumValues[v-1]
+			}
+			return ""
+		case schema.TYPE_SET:
+			var values []string
+			for i, value := range col.SetValues {
+				if v&(1<<i) != 0 {
+					values = append(values, value)
+				}
+			}
+			return strings.Join(values, ",")
+		}
+	}
+	return fmt.Sprint(v)
+}
+
+// mask replaces the characters of s with '*' except the last keep ones.
+func mask(s string, keep int) string {
+	r := []rune(s)
+	for i := 0; i < len(r)-keep; i++ {
+		r[i] = '*'
+	}
+	return string(r)
+}
+
+// onRow passes the rows to OnRow after the transforms.
+func (c *Canal) onRow(e *RowsEvent) error {
+	if c.transformer != nil {
+		var err error
+		if e, err = c.transformer.transform(e); err != nil || e == nil {
+			return errors.Trace(err)
+		}
+	}
+	start := time.Now()
+	err := c.eventHandler.OnRow(e)
+	c.observeHandler("OnRow", start)
+	return err
+}
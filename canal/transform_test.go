@@ -0,0 +1,147 @@
+package canal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+	"github.com/stretchr/testify/require"
+)
+
+type transformTestHandler struct {
+	DummyEventHandler
+
+	events []*RowsEvent
+}
+
+func (h *transformTestHandler) OnRow(e *RowsEvent) error {
+	h.events = append(h.events, e)
+	return nil
+}
+
+func transformTestTable() *schema.Table {
+	t := &schema.Table{Schema: "shop", Name: "users"}
+	t.AddColumn("id", "int unsigned", "", "")
+	t.AddColumn("tenant_id", "int", "", "")
+	t.AddColumn("email", "varchar(100)", "", "")
+	t.AddColumn("phone", "varchar(20)", "", "")
+	t.AddColumn("password", "varchar(64)", "", "")
+	t.AddColumn("plan", "enum('free','pro')", "", "")
+	t.PKColumns = []int{0}
+	t.UnsignedColumns = []int{0}
+	t.Indexes = []*schema.Index{{Name: "PRIMARY", Columns: []string{"id"}}, {Name: "pw", Columns: []string{"password"}}}
+	return t
+}
+
+func TestTransform(t *testing.T) {
+	cfg, err := NewConfig(`
+[[transform]]
+table = "shop\\.users"
+exclude_columns = ["password"]
+hash_columns = ["email"]
+hash_salt = "salt"
+mask_columns = ["phone"]
+mask_keep = 2
+
+[[transform.filter]]
+column = "tenant_id"
+op = "in"
+values = ["1", "2"]
+
+[[transform.filter]]
+column = "plan"
+op = "not_regexp"
+values = ["^free$"]
+`)
+	require.NoError(t, err)
+	tr, err := newTransformer(cfg.Transforms)
+	require.NoError(t, err)
+
+	table := transformTestTable()
+	e := newRowsEvent(table, UpdateAction, [][]any{
+		// moved to tenant 1
+		{int32(1), int32(3), "a@example.com", "12345", "x", int64(2)},
+		{int32(1), int32(1), "a@example.com", "12345", "x", int64(2)},
+		// other tenant
+		{int32(2), int32(3), "b@example.com", "678", "y", int64(2)},
+		{int32(2), int32(3), "c@example.com", "678", "y", int64(2)},
+		// free plan
+		{int32(3), int32(2), nil, nil, "z", int64(1)},
+		{int32(3), int32(2), nil, nil, "z", int64(1)},
+	}, &replication.EventHeader{}, &replication.RowsEvent{SkippedColumns: [][]int{{4}, {3, 4}, nil, nil, nil, nil}})
+
+	out, err := tr.transform(e)
+	require.NoError(t, err)
+	sum := sha256.Sum256([]byte("salta@example.com"))
+	require.Equal(t, [][]any{
+		{uint32(1), int32(3), hex.EncodeToString(sum[:]), "***45", int64(2)},
+		{uint32(1), int32(1), hex.EncodeToString(sum[:]), "***45", int64(2)},
+	}, out.Rows)
+	require.Equal(t, [][]int{nil, {3}}, out.skippedColumns)
+
+	ta := out.Table
+	require.Equal(t, []string{"id", "tenant_id", "email", "phone", "plan"}, schemaHistoryColumns(ta))
+	require.Equal(t, "char(64)", ta.Columns[2].RawType)
+	require.Equal(t, schema.TYPE_STRING, ta.Columns[2].Type)
+	require.Equal(t, []int{0}, ta.PKColumns)
+	require.Equal(t, []int{0}, ta.UnsignedColumns)
+	require.Len(t, ta.Indexes, 1)
+	// the source table is unchanged
+	require.Len(t, table.Columns, 6)
+
+	// the transformed table is reused until the table changes
+	out2, err := tr.transform(newRowsEvent(table, InsertAction, [][]any{{int32(4), int32(2), nil, nil, nil, int64(2)}}, nil, nil))
+	require.NoError(t, err)
+	require.Same(t, ta, out2.Table)
+	altered := transformTestTable()
+	altered.AddColumn("age", "int", "", "")
+	out2, err = tr.transform(newRowsEvent(altered, InsertAction, [][]any{{int32(4), int32(2), nil, nil, nil, int64(2), int32(30)}}, nil, nil))
+	require.NoError(t, err)
+	require.NotSame(t, ta, out2.Table)
+	require.Equal(t, []string{"id", "tenant_id", "email", "phone", "plan", "age"}, schemaHistoryColumns(out2.Table))
+
+	// all the rows are filtered out
+	out, err = tr.transform(newRowsEvent(table, DeleteAction, [][]any{{int32(4), int32(5), nil, nil, nil, int64(2)}}, nil, nil))
+	require.NoError(t, err)
+	require.Nil(t, out)
+
+	// other tables are not changed
+	other := &schema.Table{Schema: "shop", Name: "orders", Columns: []schema.TableColumn{{Name: "id"}}}
+	e = newRowsEvent(other, InsertAction, [][]any{{1}}, nil, nil)
+	out, err = tr.transform(e)
+	require.NoError(t, err)
+	require.Same(t, e, out)
+
+	_, err = newTransformer([]TransformConfig{{Table: "shop\\..*", Filters: []RowFilterConfig{{Column: "id", Op: "like"}}}})
+	require.Error(t, err)
+}
+
+func TestTransformIncludeColumns(t *testing.T) {
+	tr, err := newTransformer([]TransformConfig{{Table: "^shop\\.", IncludeColumns: []string{"tenant_id", "email"}}})
+	require.NoError(t, err)
+
+	out, err := tr.transform(newRowsEvent(transformTestTable(), InsertAction, [][]any{{int32(1), int32(3), "a@example.com", "1", "x", int64(1)}}, nil, nil))
+	require.NoError(t, err)
+	require.Equal(t, [][]any{{int32(3), "a@example.com"}}, out.Rows)
+	// without the primary key
+	require.Nil(t, out.Table.PKColumns)
+	require.Empty(t, out.Table.Indexes)
+}
+
+func TestCanalTransform(t *testing.T) {
+	h := &transformTestHandler{}
+	c := newTransactionTestCanal(h)
+	c.transformer, _ = newTransformer([]TransformConfig{{
+		Table:   "test\\.t",
+		Filters: []RowFilterConfig{{Column: "id", Op: FilterNotIn, Values: []string{"2"}}},
+	}})
+
+	for i, id := range []int32{1, 2, 3} {
+		require.NoError(t, c.handleEvent(transactionTestRows(uint32(100*(i+1)), id)))
+	}
+	require.Len(t, h.events, 2)
+	require.Equal(t, int32(1), h.events[0].Rows[0][0])
+	require.Equal(t, int32(3), h.events[1].Rows[0][0])
+}
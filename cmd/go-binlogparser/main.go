@@ -2,7 +2,9 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"slices"
 
 	"github.com/go-mysql-org/go-mysql/replication"
 )
@@ -11,6 +13,7 @@ var (
 	name   = flag.String("name", "", "binlog file name")
 	offset = flag.Int64("offset", 0, "parse start offset")
 	verify = flag.Bool("verify", false, "verify checksum")
+	sql    = flag.String("sql", "", "print the rows events as SQL: redo or flashback")
 )
 
 func main() {
@@ -24,9 +27,46 @@ func main() {
 		return nil
 	}
 
+	var stmts []string
+	switch *sql {
+	case "":
+	case "redo", "flashback":
+		p.SetParseTime(true)
+		p.SetUseDecimal(true)
+		r := &replication.SQLRenderer{Flashback: *sql == "flashback"}
+		fmt.Println("SET time_zone='+00:00';")
+		f = func(e *replication.BinlogEvent) error {
+			rows, ok := e.Event.(*replication.RowsEvent)
+			if !ok {
+				return nil
+			}
+			rowStmts, err := r.Render(rows)
+			if err != nil {
+				return err
+			}
+			if !r.Flashback {
+				for _, stmt := range rowStmts {
+					fmt.Println(stmt)
+				}
+				return nil
+			}
+			stmts = append(stmts, rowStmts...)
+			return nil
+		}
+	default:
+		println("invalid sql mode " + *sql)
+		os.Exit(1)
+	}
+
 	err := p.ParseFile(*name, *offset, f)
 	if err != nil {
 		println(err.Error())
 		os.Exit(1)
 	}
+
+	// undo the last rows first
+	slices.Reverse(stmts)
+	for _, stmt := range stmts {
+		fmt.Println(stmt)
+	}
 }
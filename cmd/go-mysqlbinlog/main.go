@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"time"
 
 	"github.com/pingcap/errors"
 
@@ -28,6 +29,14 @@ var (
 	pos  = flag.Int("pos", 4, "Binlog position")
 	gtid = flag.String("gtid", "", "Binlog GTID set that this slave has executed")
 
+	startDatetime = flag.String("start_datetime", "", "Start at the first transaction committed from this time, like 2006-01-02 15:04:05, instead of file, pos or gtid")
+
+	stopFile     = flag.String("stop_file", "", "Binlog filename to stop at, with stop_pos")
+	stopPos      = flag.Int("stop_pos", 4, "Binlog position to stop at")
+	stopGTID     = flag.String("stop_gtid", "", "Binlog GTID set to stop at once executed")
+	stopDatetime = flag.String("stop_datetime", "", "Stop before the transactions from this time, like 2006-01-02 15:04:05")
+	nonBlock     = flag.Bool("non_block", false, "Stop at the end of the binlog")
+
 	semiSync   = flag.Bool("semisync", false, "Support semi sync")
 	backupPath = flag.String("backup_path", "", "backup path to store binlog files")
 
@@ -72,9 +81,62 @@ func main() {
 		return
 	}
 
+	var stop replication.StopCondition
+	stop.Position = mysql.Position{Name: *stopFile, Pos: uint32(*stopPos)}
+	stop.NonBlock = *nonBlock
+	if len(*stopGTID) > 0 {
+		stop.GTIDSet, err = mysql.ParseGTIDSet(*flavor, *stopGTID)
+		if err != nil {
+			fmt.Printf("Failed to parse stop gtid %s with flavor %s, error: %v\n",
+				*stopGTID, *flavor, errors.ErrorStack(err))
+			return
+		}
+	}
+	if len(*stopDatetime) > 0 {
+		stop.Datetime, err = time.ParseInLocation(time.DateTime, *stopDatetime, time.Local)
+		if err != nil {
+			fmt.Printf("Failed to parse stop datetime %s, error: %v\n", *stopDatetime, err)
+			return
+		}
+	}
+
 	b := replication.NewBinlogSyncer(cfg)
 
 	pos := mysql.Position{Name: *file, Pos: uint32(*pos)}
+	var gset mysql.GTIDSet
+	if len(*gtid) > 0 {
+		gset, err = mysql.ParseGTIDSet(*flavor, *gtid)
+		if err != nil {
+			fmt.Printf("Failed to parse gtid %s with flavor %s, error: %v\n",
+				*gtid, *flavor, errors.ErrorStack(err))
+			return
+		}
+	}
+	if len(*startDatetime) > 0 {
+		// the start is found from the time, not given
+		startSet := false
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "file", "pos", "gtid":
+				startSet = true
+			}
+		})
+		if startSet {
+			fmt.Printf("start_datetime can not be used with file, pos or gtid\n")
+			return
+		}
+
+		start, err := time.ParseInLocation(time.DateTime, *startDatetime, time.Local)
+		if err != nil {
+			fmt.Printf("Failed to parse start datetime %s, error: %v\n", *startDatetime, err)
+			return
+		}
+		pos, gset, err = b.FindStartByTime(context.Background(), start)
+		if err != nil {
+			fmt.Printf("Find start by time error: %v\n", errors.ErrorStack(err))
+			return
+		}
+	}
 	if len(*backupPath) > 0 {
 		// Backup will always use RawMode.
 		err := b.StartBackup(*backupPath, pos, 0)
@@ -87,19 +149,15 @@ func main() {
 			s   *replication.BinlogStreamer
 			err error
 		)
-		if len(*gtid) > 0 {
-			gset, err := mysql.ParseGTIDSet(*flavor, *gtid)
-			if err != nil {
-				fmt.Printf("Failed to parse gtid %s with flavor %s, error: %v\n",
-					*gtid, *flavor, errors.ErrorStack(err))
-			}
-			s, err = b.StartSyncGTID(gset)
+		// the GTID set found by start_datetime is nil without GTIDs
+		if gset != nil {
+			s, err = b.StartSyncGTIDWithStop(gset, stop)
 			if err != nil {
 				fmt.Printf("Start sync by GTID error: %v\n", errors.ErrorStack(err))
 				return
 			}
 		} else {
-			s, err = b.StartSync(pos)
+			s, err = b.StartSyncWithStop(pos, stop)
 			if err != nil {
 				fmt.Printf("Start sync error: %v\n", errors.ErrorStack(err))
 				return
@@ -108,6 +166,9 @@ func main() {
 
 		for {
 			e, err := s.GetEvent(context.Background())
+			if err == replication.ErrStopConditionReached {
+				return
+			}
 			if err != nil {
 				// Try to output all left events
 				events := s.DumpEvents()
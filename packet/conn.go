@@ -112,6 +112,14 @@ func (c *Conn) EnableReadBuffering(bufferSize int) {
 	c.reader = c.br
 }
 
+// Reader returns the reader of the packets, buffered once read buffering is
+// enabled. It is for a connection read by a single goroutine without
+// ReadPacket, like the replies of a replica during a binlog dump, and not
+// with compression.
+func (c *Conn) Reader() io.Reader {
+	return c.reader
+}
+
 // connWriter adapts the deadline-setting write path to io.Writer so a
 // bufio.Writer can sit on top of it.
 type connWriter struct{ c *Conn }
@@ -2,6 +2,7 @@ package replication
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/pingcap/errors"
@@ -17,6 +18,14 @@ type BinlogStreamer struct {
 	ch  chan *BinlogEvent
 	ech chan error
 	err error
+
+	// stopped is set once the stop condition is reached, to return the
+	// events left before ErrStopConditionReached.
+	stopped bool
+
+	// done is closed by Close, when the consumer of the events is gone.
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 // GetEvent gets the binlog event one by one, it will block until Syncer receives any events from MySQL
@@ -25,37 +34,47 @@ func (s *BinlogStreamer) GetEvent(ctx context.Context) (*BinlogEvent, error) {
 	if s.err != nil {
 		return nil, ErrNeedSyncAgain
 	}
+	if s.stopped {
+		return s.nextStoppedEvent()
+	}
 
 	select {
 	case c := <-s.ch:
 		return c, nil
 	case s.err = <-s.ech:
+		if s.err == ErrStopConditionReached {
+			s.err = nil
+			s.stopped = true
+			return s.nextStoppedEvent()
+		}
 		return nil, s.err
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	}
 }
 
-// GetEventWithStartTime gets the binlog event with starttime, if current binlog event timestamp smaller than specify starttime
-// return nil event
-func (s *BinlogStreamer) GetEventWithStartTime(ctx context.Context, startTime time.Time) (*BinlogEvent, error) {
-	if s.err != nil {
-		return nil, ErrNeedSyncAgain
-	}
-	startUnix := startTime.Unix()
+// nextStoppedEvent returns the events sent before the stop condition was
+// reached, then ErrStopConditionReached.
+func (s *BinlogStreamer) nextStoppedEvent() (*BinlogEvent, error) {
 	select {
 	case c := <-s.ch:
-		if int64(c.Header.Timestamp) >= startUnix {
-			return c, nil
-		}
-		return nil, nil
-	case s.err = <-s.ech:
+		return c, nil
+	default:
+		s.err = ErrStopConditionReached
 		return nil, s.err
-	case <-ctx.Done():
-		return nil, ctx.Err()
 	}
 }
 
+// GetEventWithStartTime gets the binlog event with starttime, if current binlog event timestamp smaller than specify starttime
+// return nil event
+func (s *BinlogStreamer) GetEventWithStartTime(ctx context.Context, startTime time.Time) (*BinlogEvent, error) {
+	c, err := s.GetEvent(ctx)
+	if err != nil || int64(c.Header.Timestamp) >= startTime.Unix() {
+		return c, err
+	}
+	return nil, nil
+}
+
 // DumpEvents dumps all left events
 func (s *BinlogStreamer) DumpEvents() []*BinlogEvent {
 	count := len(s.ch)
@@ -94,10 +113,25 @@ func NewBinlogStreamerWithChanSize(chanSize int) *BinlogStreamer {
 
 	s.ch = make(chan *BinlogEvent, chanSize)
 	s.ech = make(chan error, 4)
+	s.done = make(chan struct{})
 
 	return s
 }
 
+// Close tells the producer of the events, like a replication handler, that
+// the consumer is gone. The events added afterwards are dropped.
+func (s *BinlogStreamer) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+// Done returns a channel closed by Close, for the producer of the events to
+// stop waiting for new ones.
+func (s *BinlogStreamer) Done() <-chan struct{} {
+	return s.done
+}
+
 // AddEventToStreamer adds a binlog event to the streamer. You can use it when you want to add an event to the streamer manually.
 // can be used in replication handlers
 func (s *BinlogStreamer) AddEventToStreamer(ev *BinlogEvent) error {
@@ -106,6 +140,8 @@ func (s *BinlogStreamer) AddEventToStreamer(ev *BinlogEvent) error {
 		return nil
 	case err := <-s.ech:
 		return err
+	case <-s.done:
+		return ErrSyncClosed
 	}
 }
 
@@ -151,6 +151,8 @@ type BinlogSyncerConfig struct {
 	// Set Dialer
 	Dialer client.Dialer `json:"-"`
 
+	// RowsEventDecodeFunc replaces the decoding of the rows events.
+	// (*RowsEvent).DecodeLazily decodes their rows on access, see RowIterator.
 	RowsEventDecodeFunc func(*RowsEvent, []byte) error `json:"-"`
 
 	TableMapOptionalMetaDecodeFunc func([]byte) error `json:"-"`
@@ -169,10 +171,19 @@ type BinlogSyncerConfig struct {
 	// Default 0,  this will be set to GOMAXPROCS.
 	PayloadDecoderConcurrency int
 
+	// LazyPayloadDecode defers the decompression and the decoding of the
+	// events of a TransactionPayloadEvent to its DecodeEvents method, for the
+	// consumers which skip or relay most of the transactions.
+	LazyPayloadDecode bool
+
 	// SynchronousEventHandler is used for synchronous event handling.
 	// This should not be used together with StartBackupWithHandler.
 	// If this is not nil, GetEvent does not need to be called.
 	SynchronousEventHandler EventHandler `json:"-"`
+
+	// Metrics receives the metrics of the events, the lag and the reconnects
+	// if set.
+	Metrics Metrics `json:"-"`
 }
 
 // EventHandler defines the interface for processing binlog events.
@@ -201,6 +212,9 @@ type BinlogSyncer struct {
 
 	running bool
 
+	// stop is the stop condition of the sync if any.
+	stop *syncStop
+
 	ctx    context.Context
 	cancel context.CancelFunc
 
@@ -245,6 +259,7 @@ func NewBinlogSyncer(cfg BinlogSyncerConfig) *BinlogSyncer {
 	b.parser.SetRenderJSONAsMySQLText(b.cfg.RenderJSONAsMySQLText)
 	b.parser.SetVerifyChecksum(b.cfg.VerifyChecksum)
 	b.parser.SetPayloadDecoderConcurrency(cfg.PayloadDecoderConcurrency)
+	b.parser.SetLazyPayloadDecode(cfg.LazyPayloadDecode)
 	b.parser.SetRowsEventDecodeFunc(b.cfg.RowsEventDecodeFunc)
 	b.parser.SetTableMapOptionalMetaDecodeFunc(b.cfg.TableMapOptionalMetaDecodeFunc)
 	b.running = false
@@ -496,6 +511,10 @@ func (b *BinlogSyncer) checkFlavor() {
 
 // StartSync starts syncing from the `pos` position.
 func (b *BinlogSyncer) StartSync(pos mysql.Position) (*BinlogStreamer, error) {
+	return b.startSync(pos, nil)
+}
+
+func (b *BinlogSyncer) startSync(pos mysql.Position, stop *syncStop) (*BinlogStreamer, error) {
 	b.cfg.Logger.Info("begin to sync binlog from position", slog.Any("position", pos))
 
 	b.m.Lock()
@@ -504,6 +523,7 @@ func (b *BinlogSyncer) StartSync(pos mysql.Position) (*BinlogStreamer, error) {
 	if b.running {
 		return nil, errors.Trace(errSyncRunning)
 	}
+	b.stop = stop
 
 	if err := b.prepareSyncPos(pos); err != nil {
 		return nil, errors.Trace(err)
@@ -516,6 +536,10 @@ func (b *BinlogSyncer) StartSync(pos mysql.Position) (*BinlogStreamer, error) {
 
 // StartSyncGTID starts syncing from the `gset` GTIDSet.
 func (b *BinlogSyncer) StartSyncGTID(gset mysql.GTIDSet) (*BinlogStreamer, error) {
+	return b.startSyncGTID(gset, nil)
+}
+
+func (b *BinlogSyncer) startSyncGTID(gset mysql.GTIDSet, stop *syncStop) (*BinlogStreamer, error) {
 	b.cfg.Logger.Info("begin to sync binlog from GTID set", slog.Any("GTID set", gset))
 
 	b.prevMySQLGTIDEvent = nil
@@ -527,6 +551,7 @@ func (b *BinlogSyncer) StartSyncGTID(gset mysql.GTIDSet) (*BinlogStreamer, error
 	if b.running {
 		return nil, errors.Trace(errSyncRunning)
 	}
+	b.stop = stop
 
 	// establishing network connection here and will start getting binlog events from "gset + 1", thus until first
 	// MariadbGTIDEvent/GTIDEvent event is received - we effectively do not have a "current GTID"
@@ -566,7 +591,7 @@ func (b *BinlogSyncer) writeBinlogDumpCommand(p mysql.Position) error {
 	binary.LittleEndian.PutUint32(data[pos:], p.Pos)
 	pos += 4
 
-	dumpCommandFlag := b.cfg.DumpCommandFlag
+	dumpCommandFlag := b.dumpCommandFlag()
 	if b.cfg.FillZeroLogPos && b.cfg.Flavor == mysql.MariaDBFlavor {
 		// Add BINLOG_SEND_ANNOTATE_ROWS_EVENT flag when FillZeroLogPos is enabled.
 		// This ensures the server sends ANNOTATE_ROWS_EVENT events which are needed
@@ -595,7 +620,7 @@ func (b *BinlogSyncer) writeBinlogDumpMysqlGTIDCommand(gset mysql.GTIDSet) error
 	data[pos] = mysql.COM_BINLOG_DUMP_GTID
 	pos++
 
-	binary.LittleEndian.PutUint16(data[pos:], 0)
+	binary.LittleEndian.PutUint16(data[pos:], b.dumpCommandFlag())
 	pos += 2
 
 	binary.LittleEndian.PutUint32(data[pos:], b.cfg.ServerID)
@@ -727,6 +752,9 @@ func (b *BinlogSyncer) retrySync() error {
 
 	b.parser.Reset()
 	b.prevMySQLGTIDEvent = nil
+	if b.stop != nil {
+		b.stop.reset()
+	}
 
 	if b.prevGset != nil {
 		extra := []any{slog.String("GTID Set", b.prevGset.String())}
@@ -830,7 +858,11 @@ func (b *BinlogSyncer) onStream(s *BinlogStreamer) {
 					return
 				case <-time.After(time.Second):
 					b.retryCount++
-					if err = b.retrySync(); err != nil {
+					err = b.retrySync()
+					if b.cfg.Metrics != nil {
+						b.cfg.Metrics.ObserveReconnect(err)
+					}
+					if err != nil {
 						if b.cfg.MaxReconnectAttempts > 0 && b.retryCount >= b.cfg.MaxReconnectAttempts {
 							b.cfg.Logger.Error(
 								"retry sync err, exceeded max retries",
@@ -872,12 +904,24 @@ func (b *BinlogSyncer) onStream(s *BinlogStreamer) {
 				return
 			}
 
+			if b.stop != nil && b.stop.before(e) {
+				b.cfg.Logger.Info("stop condition reached", slog.Any("position", b.nextPos))
+				s.closeWithError(ErrStopConditionReached)
+				return
+			}
+
 			// Handle the event and send ACK if necessary
 			err = b.handleEventAndACK(s, e, needACK)
 			if err != nil {
 				s.closeWithError(err)
 				return
 			}
+
+			if b.stop != nil && b.stop.after(e, b.nextPos, b.syncedGTIDSet()) {
+				b.cfg.Logger.Info("stop condition reached", slog.Any("position", b.nextPos))
+				s.closeWithError(ErrStopConditionReached)
+				return
+			}
 		case mysql.ERR_HEADER:
 			err = b.c.HandleErrorPacket(data)
 			s.closeWithError(err)
@@ -887,6 +931,10 @@ func (b *BinlogSyncer) onStream(s *BinlogStreamer) {
 			// when COM_BINLOG_DUMP command use BINLOG_DUMP_NON_BLOCK flag,
 			// if there is no more event to send an EOF_Packet instead of blocking the connection
 			b.cfg.Logger.Info("receive EOF packet, no more binlog event now.")
+			if b.stop != nil && b.stop.cond.NonBlock {
+				s.closeWithError(ErrStopConditionReached)
+				return
+			}
 			continue
 		default:
 			b.cfg.Logger.Error("invalid stream header", slog.Int("header", int(data[0])))
@@ -1018,17 +1066,14 @@ func (b *BinlogSyncer) handleEventAndACK(s *BinlogStreamer, e *BinlogEvent, need
 		// same as their uncompressed counterparts above; GTID event precedes
 		// payload uncompressed, so currGset already covers this transaction
 		if !b.cfg.DiscardGTIDSet {
-			for _, inner := range event.Events {
-				switch innerEvent := inner.Event.(type) {
-				case *XIDEvent:
-					innerEvent.GSet = b.getCurrentGtidSet()
-				case *QueryEvent:
-					innerEvent.GSet = b.getCurrentGtidSet()
-				}
-			}
+			event.setGSet(b.getCurrentGtidSet())
 		}
 	}
 
+	if b.cfg.Metrics != nil {
+		observeEvent(b.cfg.Metrics, e)
+	}
+
 	// Use SynchronousEventHandler if it's set
 	if b.cfg.SynchronousEventHandler != nil {
 		err := b.cfg.SynchronousEventHandler.HandleEvent(e)
@@ -1042,6 +1087,9 @@ func (b *BinlogSyncer) handleEventAndACK(s *BinlogStreamer, e *BinlogEvent, need
 		case <-b.ctx.Done():
 			return errors.New("sync is being closed")
 		}
+		if b.cfg.Metrics != nil {
+			b.cfg.Metrics.ObserveQueue(len(s.ch), cap(s.ch))
+		}
 	}
 
 	if needACK {
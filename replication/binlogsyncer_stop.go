@@ -0,0 +1,102 @@
+package replication
+
+import (
+	"time"
+
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// ErrStopConditionReached is returned by BinlogStreamer.GetEvent, after the
+// events before the stop, when the StopCondition of the sync is reached.
+var ErrStopConditionReached = errors.New("stop condition reached")
+
+// StopCondition stops a sync at a transaction boundary, see
+// StartSyncWithStop. The sync stops at the first condition reached among the
+// ones set.
+type StopCondition struct {
+	// Position stops the sync after the transaction which ends at or after
+	// this position, or at the first boundary past it.
+	Position mysql.Position
+
+	// GTIDSet stops the sync after the transaction with which the synced
+	// GTID set contains it. It needs a sync from a GTID set.
+	GTIDSet mysql.GTIDSet
+
+	// Datetime stops the sync before the first transaction with a timestamp
+	// equal to or later than it.
+	Datetime time.Time
+
+	// NonBlock stops the sync at the end of the binlog instead of waiting for
+	// new events, with BINLOG_DUMP_NON_BLOCK.
+	NonBlock bool
+}
+
+// syncStop checks the StopCondition of a sync against its events.
+type syncStop struct {
+	cond StopCondition
+
+	trx TransactionTracker
+}
+
+// StartSyncWithStop starts syncing from the `pos` position like StartSync,
+// and closes the streamer with ErrStopConditionReached when stop is reached.
+func (b *BinlogSyncer) StartSyncWithStop(pos mysql.Position, stop StopCondition) (*BinlogStreamer, error) {
+	if stop.GTIDSet != nil {
+		return nil, errors.New("the stop GTID set needs a sync from a GTID set")
+	}
+	return b.startSync(pos, &syncStop{cond: stop})
+}
+
+// StartSyncGTIDWithStop starts syncing from the `gset` GTIDSet like
+// StartSyncGTID, and closes the streamer with ErrStopConditionReached when
+// stop is reached.
+func (b *BinlogSyncer) StartSyncGTIDWithStop(gset mysql.GTIDSet, stop StopCondition) (*BinlogStreamer, error) {
+	return b.startSyncGTID(gset, &syncStop{cond: stop})
+}
+
+// dumpCommandFlag returns the flag of the binlog dump commands.
+func (b *BinlogSyncer) dumpCommandFlag() uint16 {
+	flag := b.cfg.DumpCommandFlag
+	if b.stop != nil && b.stop.cond.NonBlock {
+		flag |= BINLOG_DUMP_NON_BLOCK
+	}
+	return flag
+}
+
+// syncedGTIDSet returns the GTID set synced, nil for a sync from a position.
+func (b *BinlogSyncer) syncedGTIDSet() mysql.GTIDSet {
+	if b.currGset != nil {
+		return b.currGset
+	}
+	return b.prevGset
+}
+
+// reset forgets the transaction read when the sync restarts.
+func (st *syncStop) reset() {
+	st.trx.Reset()
+}
+
+// before reports whether the sync stops before e, the first event of a
+// transaction after the stop datetime.
+func (st *syncStop) before(e *BinlogEvent) bool {
+	if st.cond.Datetime.IsZero() || st.trx.InTransaction() || e.Header.Timestamp == 0 || !transactionEvent(e) {
+		return false
+	}
+	return !time.Unix(int64(e.Header.Timestamp), 0).Before(st.cond.Datetime)
+}
+
+// after reports whether the sync stops after e, with the position and the
+// GTID set synced after it.
+func (st *syncStop) after(e *BinlogEvent, pos mysql.Position, gset mysql.GTIDSet) bool {
+	st.trx.Update(e)
+	if st.trx.InTransaction() {
+		return false
+	}
+
+	if st.cond.Position.Name != "" && pos.Compare(st.cond.Position) >= 0 {
+		return true
+	}
+	return st.cond.GTIDSet != nil && gset != nil && gset.Contain(st.cond.GTIDSet)
+}
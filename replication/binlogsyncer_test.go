@@ -2,8 +2,10 @@ package replication
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net"
@@ -13,6 +15,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 
 	"github.com/go-mysql-org/go-mysql/client"
@@ -180,6 +183,51 @@ func TestHandleEventAndACKRotateLogDedup(t *testing.T) {
 	require.Equal(t, 2, strings.Count(buf.String(), "rotate to next binlog"))
 }
 
+type testMetrics struct {
+	events []string
+	lags   []time.Duration
+	queue  []int
+}
+
+func (m *testMetrics) ObserveEvent(eventType EventType, table string, size uint32) {
+	m.events = append(m.events, fmt.Sprintf("%s %s %d", eventType, table, size))
+}
+
+func (m *testMetrics) ObserveLag(lag time.Duration) {
+	m.lags = append(m.lags, lag)
+}
+
+func (m *testMetrics) ObserveQueue(length int, capacity int) {
+	m.queue = append(m.queue, length, capacity)
+}
+
+func (m *testMetrics) ObserveReconnect(error) {}
+
+// TestHandleEventAndACKMetrics verifies the metrics of the events, with a
+// zero lag at heartbeats.
+func TestHandleEventAndACKMetrics(t *testing.T) {
+	m := &testMetrics{}
+	b := NewBinlogSyncer(BinlogSyncerConfig{ServerID: 1, EventCacheCount: 8, Metrics: m})
+	defer b.Close()
+
+	ts := uint32(time.Now().Add(-time.Minute).Unix())
+	table := &TableMapEvent{Schema: []byte("test"), Table: []byte("t")}
+	s := NewBinlogStreamerWithChanSize(8)
+	for _, ev := range []*BinlogEvent{
+		{Header: &EventHeader{EventType: TABLE_MAP_EVENT, Timestamp: ts, EventSize: 40}, Event: table},
+		{Header: &EventHeader{EventType: WRITE_ROWS_EVENTv2, Timestamp: ts, EventSize: 60}, Event: &RowsEvent{Table: table}},
+		{Header: &EventHeader{EventType: HEARTBEAT_EVENT, EventSize: 39}, Event: &HeartbeatEvent{}},
+	} {
+		require.NoError(t, b.handleEventAndACK(s, ev, false))
+	}
+
+	require.Equal(t, []string{"TableMapEvent test.t 40", "WriteRowsEventV2 test.t 60", "HeartbeatEvent  39"}, m.events)
+	require.Len(t, m.lags, 3)
+	require.GreaterOrEqual(t, m.lags[0], time.Minute)
+	require.Zero(t, m.lags[2])
+	require.Equal(t, []int{1, 8, 2, 8, 3, 8}, m.queue)
+}
+
 func TestBinlogSyncerConfigLogsAsJSON(t *testing.T) {
 	var buf bytes.Buffer
 
@@ -204,3 +252,163 @@ func TestBinlogSyncerConfigLogsAsJSON(t *testing.T) {
 	require.Contains(t, buf.String(), `"ServerID":100`)
 	require.Contains(t, buf.String(), `"Port":3306`)
 }
+
+func stopTestEvents(ts uint32, pos uint32) []*BinlogEvent {
+	return []*BinlogEvent{
+		{Header: &EventHeader{EventType: GTID_EVENT, Timestamp: ts, LogPos: pos}, Event: &GTIDEvent{}},
+		{Header: &EventHeader{EventType: QUERY_EVENT, Timestamp: ts, LogPos: pos + 10}, Event: &QueryEvent{Query: []byte("BEGIN")}},
+		{Header: &EventHeader{EventType: WRITE_ROWS_EVENTv2, Timestamp: ts, LogPos: pos + 20}, Event: &RowsEvent{}},
+		{Header: &EventHeader{EventType: XID_EVENT, Timestamp: ts, LogPos: pos + 30}, Event: &XIDEvent{}},
+	}
+}
+
+// TestSyncStop verifies the stop conditions are checked at the transaction
+// boundaries.
+func TestSyncStop(t *testing.T) {
+	// the events after which the sync stops
+	run := func(st *syncStop, gset mysql.GTIDSet, events []*BinlogEvent) []int {
+		var stops []int
+		for i, e := range events {
+			if st.before(e) {
+				stops = append(stops, -i)
+			}
+			pos := mysql.Position{Name: "mysql-bin.000001", Pos: e.Header.LogPos}
+			if st.after(e, pos, gset) {
+				stops = append(stops, i)
+			}
+		}
+		return stops
+	}
+
+	events := append(stopTestEvents(100, 100), stopTestEvents(200, 200)...)
+	// the transaction with the position is read to its end
+	st := &syncStop{cond: StopCondition{Position: mysql.Position{Name: "mysql-bin.000001", Pos: 215}}}
+	require.Equal(t, []int{7}, run(st, nil, events))
+
+	// a DDL ends its transaction, not the statements after BEGIN
+	ddl := []*BinlogEvent{
+		{Header: &EventHeader{EventType: GTID_EVENT, LogPos: 100}, Event: &GTIDEvent{}},
+		{Header: &EventHeader{EventType: QUERY_EVENT, LogPos: 110}, Event: &QueryEvent{Query: []byte("CREATE TABLE t (id int)")}},
+		{Header: &EventHeader{EventType: QUERY_EVENT, LogPos: 120}, Event: &QueryEvent{Query: []byte("BEGIN")}},
+		{Header: &EventHeader{EventType: QUERY_EVENT, LogPos: 130}, Event: &QueryEvent{Query: []byte("INSERT INTO t VALUES (1)")}},
+		{Header: &EventHeader{EventType: QUERY_EVENT, LogPos: 140}, Event: &QueryEvent{Query: []byte("COMMIT")}},
+	}
+	st = &syncStop{cond: StopCondition{Position: mysql.Position{Name: "mysql-bin.000001", Pos: 100}}}
+	require.Equal(t, []int{1, 4}, run(st, nil, ddl))
+
+	gset, err := mysql.ParseMysqlGTIDSet("de278ad0-2106-11e4-9f8e-6edd0ca20947:1-5")
+	require.NoError(t, err)
+	stopGset, err := mysql.ParseMysqlGTIDSet("de278ad0-2106-11e4-9f8e-6edd0ca20947:5")
+	require.NoError(t, err)
+	st = &syncStop{cond: StopCondition{GTIDSet: stopGset}}
+	require.Equal(t, []int{3, 7}, run(st, gset, events))
+
+	st = &syncStop{cond: StopCondition{Datetime: time.Unix(150, 0)}}
+	require.Equal(t, []int{-4}, run(st, nil, events))
+}
+
+// TestBinlogStreamerStop verifies GetEvent returns the events sent before the
+// stop condition was reached, then ErrStopConditionReached.
+func TestBinlogStreamerStop(t *testing.T) {
+	s := NewBinlogStreamerWithChanSize(8)
+	events := stopTestEvents(100, 100)
+	for _, e := range events {
+		require.NoError(t, s.AddEventToStreamer(e))
+	}
+	s.closeWithError(ErrStopConditionReached)
+
+	for _, want := range events {
+		e, err := s.GetEvent(context.Background())
+		require.NoError(t, err)
+		require.Same(t, want, e)
+	}
+	_, err := s.GetEvent(context.Background())
+	require.Equal(t, ErrStopConditionReached, err)
+	_, err = s.GetEvent(context.Background())
+	require.Equal(t, ErrNeedSyncAgain, err)
+}
+
+func TestSearchBinlogFile(t *testing.T) {
+	files := []string{"mysql-bin.000001", "mysql-bin.000002", "mysql-bin.000003", "mysql-bin.000004"}
+	created := map[string]time.Time{
+		"mysql-bin.000001": time.Unix(100, 0),
+		"mysql-bin.000002": time.Unix(200, 0),
+		"mysql-bin.000003": time.Unix(300, 0),
+		"mysql-bin.000004": time.Unix(400, 0),
+	}
+	search := func(ts int64) string {
+		var probes int
+		file, err := searchBinlogFile(files, time.Unix(ts, 0), func(file string) (time.Time, error) {
+			probes++
+			return created[file], nil
+		})
+		require.NoError(t, err)
+		require.LessOrEqual(t, probes, 3)
+		return file
+	}
+
+	require.Equal(t, "mysql-bin.000001", search(50))
+	require.Equal(t, "mysql-bin.000001", search(150))
+	// the transactions of mysql-bin.000002 may be committed in the second
+	// of the creation of mysql-bin.000003
+	require.Equal(t, "mysql-bin.000002", search(300))
+	require.Equal(t, "mysql-bin.000003", search(301))
+	require.Equal(t, "mysql-bin.000004", search(1000))
+}
+
+func TestTimeScan(t *testing.T) {
+	const sid = "de278ad0-2106-11e4-9f8e-6edd0ca20947"
+	u, err := uuid.Parse(sid)
+	require.NoError(t, err)
+	gtid := func(gno int64, commit int64, pos uint32) *BinlogEvent {
+		return &BinlogEvent{
+			Header: &EventHeader{EventType: GTID_EVENT, Timestamp: 1, LogPos: pos},
+			Event:  &GTIDEvent{SID: u[:], GNO: gno, ImmediateCommitTimestamp: uint64(commit) * 1000000},
+		}
+	}
+	events := []*BinlogEvent{
+		{Header: &EventHeader{EventType: ROTATE_EVENT}, Event: &RotateEvent{NextLogName: []byte("mysql-bin.000002"), Position: 4}},
+		{Header: &EventHeader{EventType: FORMAT_DESCRIPTION_EVENT, Timestamp: 90}, Event: &FormatDescriptionEvent{}},
+		{Header: &EventHeader{EventType: PREVIOUS_GTIDS_EVENT, Timestamp: 90, LogPos: 200}, Event: &PreviousGTIDsEvent{GTIDSets: sid + ":1-5"}},
+		gtid(6, 100, 300),
+		{Header: &EventHeader{EventType: QUERY_EVENT, LogPos: 400}, Event: &QueryEvent{Query: []byte("BEGIN")}},
+		{Header: &EventHeader{EventType: XID_EVENT, LogPos: 500}, Event: &XIDEvent{}},
+		gtid(7, 110, 600),
+		{Header: &EventHeader{EventType: QUERY_EVENT, LogPos: 700}, Event: &QueryEvent{Query: []byte("CREATE TABLE t (id int)")}},
+		{Header: &EventHeader{EventType: ROTATE_EVENT, LogPos: 800}, Event: &RotateEvent{NextLogName: []byte("mysql-bin.000003"), Position: 4}},
+		gtid(8, 120, 300),
+		{Header: &EventHeader{EventType: QUERY_EVENT, LogPos: 400}, Event: &QueryEvent{Query: []byte("BEGIN")}},
+		{Header: &EventHeader{EventType: XID_EVENT, LogPos: 500}, Event: &XIDEvent{}},
+	}
+	scan := func(ts int64) (mysql.Position, string, bool) {
+		s := newTimeScan("mysql-bin.000002", time.Unix(ts, 0))
+		for _, e := range events {
+			found, err := s.handleEvent(e)
+			require.NoError(t, err)
+			if found {
+				return s.start, s.gset.String(), true
+			}
+		}
+		return s.start, s.gset.String(), false
+	}
+
+	pos, gset, found := scan(100)
+	require.True(t, found)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000002", Pos: 200}, pos)
+	require.Equal(t, sid+":1-5", gset)
+
+	pos, gset, found = scan(105)
+	require.True(t, found)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000002", Pos: 500}, pos)
+	require.Equal(t, sid+":1-6", gset)
+
+	pos, gset, found = scan(115)
+	require.True(t, found)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000003", Pos: 4}, pos)
+	require.Equal(t, sid+":1-7", gset)
+
+	pos, gset, found = scan(200)
+	require.False(t, found)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000003", Pos: 500}, pos)
+	require.Equal(t, sid+":1-8", gset)
+}
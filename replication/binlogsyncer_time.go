@@ -0,0 +1,241 @@
+package replication
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// FindStartByTime returns the position and the GTID set of the first
+// transaction committed at or after t, to pass to StartSync or StartSyncGTID.
+// The GTID set is the one executed before the transaction, nil if the binlog
+// has no GTIDs. If no transaction is committed after t yet, they are the ones
+// of the end of the binlog.
+//
+// The files of SHOW BINARY LOGS are searched by their creation time, which is
+// read from their first event, then the transactions of the file created
+// before t are read up to the one committed after t. The commit time is the
+// immediate commit timestamp of the GTID events since MySQL 8.0.1, else the
+// timestamp of the last event of the transaction.
+//
+// The binlog is read with the configuration of the syncer, which must not be
+// running: the server allows one binlog dump for its ServerID.
+func (b *BinlogSyncer) FindStartByTime(ctx context.Context, t time.Time) (mysql.Position, mysql.GTIDSet, error) {
+	b.m.RLock()
+	running := b.running
+	b.m.RUnlock()
+	if running {
+		return mysql.Position{}, nil, errors.Trace(errSyncRunning)
+	}
+
+	files, err := b.binaryLogs(ctx)
+	if err != nil {
+		return mysql.Position{}, nil, errors.Trace(err)
+	}
+	file, err := searchBinlogFile(files, t, func(file string) (time.Time, error) {
+		return b.binlogCreateTime(ctx, file)
+	})
+	if err != nil {
+		return mysql.Position{}, nil, errors.Trace(err)
+	}
+	return b.scanByTime(ctx, file, t)
+}
+
+// binaryLogs returns the names of the binlog files of the server.
+func (b *BinlogSyncer) binaryLogs(ctx context.Context) ([]string, error) {
+	conn, err := b.newConnection(ctx)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer conn.Close()
+
+	r, err := conn.Execute("SHOW BINARY LOGS")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	files := make([]string, r.RowNumber())
+	for i := range files {
+		if files[i], err = r.GetString(i, 0); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no binary logs, the binlog may be disabled")
+	}
+	return files, nil
+}
+
+// searchBinlogFile returns the last of the files created at least a second
+// before t, whose transactions may be committed up to the creation of the
+// next file, or the first file.
+func searchBinlogFile(files []string, t time.Time, created func(string) (time.Time, error)) (string, error) {
+	// files[:lo] are created before t, files[hi:] after
+	lo, hi := 0, len(files)
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		c, err := created(files[mid])
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		// the creation time is truncated to the second
+		if !c.Add(time.Second).After(t) {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return files[max(lo-1, 0)], nil
+}
+
+// probeSyncer returns a syncer reading the binlog with the configuration of
+// b.
+func (b *BinlogSyncer) probeSyncer() *BinlogSyncer {
+	cfg := b.cfg
+	cfg.SemiSyncEnabled = false
+	cfg.RawModeEnabled = false
+	cfg.DisableRetrySync = true
+	cfg.SynchronousEventHandler = nil
+	cfg.Metrics = nil
+	return NewBinlogSyncer(cfg)
+}
+
+// binlogCreateTime returns the timestamp of the format description event of
+// the file.
+func (b *BinlogSyncer) binlogCreateTime(ctx context.Context, file string) (time.Time, error) {
+	p := b.probeSyncer()
+	defer p.Close()
+
+	s, err := p.StartSyncWithStop(mysql.Position{Name: file, Pos: 4}, StopCondition{NonBlock: true})
+	if err != nil {
+		return time.Time{}, errors.Trace(err)
+	}
+	for {
+		e, err := s.GetEvent(ctx)
+		if err != nil {
+			return time.Time{}, errors.Annotatef(err, "read the format description event of %s", file)
+		}
+		if _, ok := e.Event.(*FormatDescriptionEvent); ok {
+			return time.Unix(int64(e.Header.Timestamp), 0), nil
+		}
+	}
+}
+
+// scanByTime reads the transactions from the file up to the first one
+// committed at or after t.
+func (b *BinlogSyncer) scanByTime(ctx context.Context, file string, t time.Time) (mysql.Position, mysql.GTIDSet, error) {
+	p := b.probeSyncer()
+	defer p.Close()
+
+	scan := newTimeScan(file, t)
+	s, err := p.StartSyncWithStop(scan.start, StopCondition{NonBlock: true})
+	if err != nil {
+		return mysql.Position{}, nil, errors.Trace(err)
+	}
+	for {
+		e, err := s.GetEvent(ctx)
+		if err == ErrStopConditionReached {
+			// no transaction committed after t
+			return scan.start, scan.gset, nil
+		} else if err != nil {
+			return mysql.Position{}, nil, errors.Trace(err)
+		}
+
+		found, err := scan.handleEvent(e)
+		if err != nil {
+			return mysql.Position{}, nil, errors.Trace(err)
+		}
+		if found {
+			return scan.start, scan.gset, nil
+		}
+	}
+}
+
+// timeScan follows the transactions of the binlog to find the first one
+// committed at or after t.
+type timeScan struct {
+	t  time.Time
+	st syncStop
+
+	// pos is the position after the last event, start the one of the
+	// transaction and gset the GTID set executed before it.
+	pos   mysql.Position
+	start mysql.Position
+	gset  mysql.GTIDSet
+
+	// gtid and commit are the GTID and the commit time of the transaction.
+	gtid   mysql.GTIDSet
+	commit time.Time
+}
+
+func newTimeScan(file string, t time.Time) *timeScan {
+	pos := mysql.Position{Name: file, Pos: 4}
+	return &timeScan{t: t, pos: pos, start: pos}
+}
+
+// handleEvent reports whether e ends the first transaction committed at or
+// after t.
+func (s *timeScan) handleEvent(e *BinlogEvent) (bool, error) {
+	var err error
+	switch ev := e.Event.(type) {
+	case *RotateEvent:
+		s.pos = mysql.Position{Name: string(ev.NextLogName), Pos: uint32(ev.Position)}
+	case *PreviousGTIDsEvent:
+		s.gset, err = mysql.ParseMysqlGTIDSet(ev.GTIDSets)
+	case *MariadbGTIDListEvent:
+		s.gset, err = mysql.ParseMariadbGTIDSet("")
+		for i := range ev.GTIDs {
+			if err == nil {
+				err = s.gset.(*mysql.MariadbGTIDSet).AddSet(&ev.GTIDs[i])
+			}
+		}
+	case *GTIDEvent:
+		err = s.setGTID(ev)
+	case *GtidTaggedLogEvent:
+		err = s.setGTID(&ev.GTIDEvent)
+	case *MariadbGTIDEvent:
+		s.gtid, err = ev.GTIDNext()
+	}
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	if _, ok := e.Event.(*RotateEvent); !ok && e.Header.LogPos > 0 {
+		s.pos.Pos = e.Header.LogPos
+	}
+
+	inTrx := s.st.trx.InTransaction()
+	s.st.trx.Update(e)
+	if s.st.trx.InTransaction() {
+		return false, nil
+	}
+	if inTrx || transactionEvent(e) {
+		if s.commit.IsZero() {
+			s.commit = time.Unix(int64(e.Header.Timestamp), 0)
+		}
+		if !s.commit.Before(s.t) {
+			return true, nil
+		}
+		if s.gtid != nil && s.gset != nil {
+			if err = s.gset.Update(s.gtid.String()); err != nil {
+				return false, errors.Trace(err)
+			}
+		}
+	}
+	s.start = s.pos
+	s.gtid = nil
+	s.commit = time.Time{}
+	return false, nil
+}
+
+func (s *timeScan) setGTID(ev *GTIDEvent) error {
+	s.commit = ev.ImmediateCommitTime()
+	if ev.GNO == 0 {
+		// anonymous transaction
+		return nil
+	}
+	var err error
+	s.gtid, err = ev.GTIDNext()
+	return errors.Trace(err)
+}
@@ -0,0 +1,465 @@
+package replication
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/pingcap/errors"
+)
+
+// BinlogWriterConfig is the configuration for a BinlogWriter.
+type BinlogWriterConfig struct {
+	// Dir is the directory of the binlog files and the index file.
+	Dir string
+
+	// BaseName is the binlog file base name, files are named BaseName.000001 and so on.
+	// The default is "mysql-bin".
+	BaseName string
+
+	// ServerID is used for the events generated by the writer itself,
+	// like FormatDescriptionEvent and RotateEvent.
+	ServerID uint32
+
+	// ServerVersion is written into the FormatDescriptionEvent, the default is "8.0.36".
+	ServerVersion string
+
+	// ChecksumAlgorithm of the written files, BINLOG_CHECKSUM_ALG_OFF or BINLOG_CHECKSUM_ALG_CRC32.
+	ChecksumAlgorithm BinlogChecksum
+
+	// MaxFileSize rotates to a new file after a transaction that makes the
+	// file exceed this size. 0 disables size based rotation.
+	MaxFileSize int64
+
+	// GTIDSet is the set of transactions executed before the first written file.
+	// If set, a PreviousGTIDsEvent is written at the start of every file and
+	// a copy of the set is updated with the GTIDs of the transactions written.
+	// Only MySQL GTID sets are supported.
+	GTIDSet mysql.GTIDSet
+}
+
+// BinlogWriter writes events into binlog files which can be read by
+// mysqlbinlog and BinlogParser. It writes the magic header and its own
+// FormatDescriptionEvent at the start of every file, rotates files, maintains
+// the index file and rewrites the LogPos and checksum of every event.
+//
+// FORMAT_DESCRIPTION_EVENT, ROTATE_EVENT and PREVIOUS_GTIDS_EVENT passed in are
+// not written since the writer generates them itself.
+type BinlogWriter struct {
+	cfg BinlogWriterConfig
+
+	m sync.Mutex
+
+	f        *os.File
+	w        *bufio.Writer
+	fileName string
+	fileSeq  int
+	pos      uint32
+
+	trx TransactionTracker
+
+	// the executed GTID set, nil if GTIDs are not tracked
+	gset mysql.GTIDSet
+	// the GTID of the transaction being written, added to gset once it ends
+	pendingGTID string
+
+	// checksum algorithm of the source of raw events, learnt from their FormatDescriptionEvent
+	rawChecksumAlg BinlogChecksum
+}
+
+// NewBinlogWriter creates the directory if needed and opens the first binlog
+// file. If the index file already lists files, the writer continues with the
+// next file sequence number.
+func NewBinlogWriter(cfg BinlogWriterConfig) (*BinlogWriter, error) {
+	if len(cfg.BaseName) == 0 {
+		cfg.BaseName = "mysql-bin"
+	}
+	if len(cfg.ServerVersion) == 0 {
+		cfg.ServerVersion = "8.0.36"
+	}
+	if cfg.ChecksumAlgorithm != BINLOG_CHECKSUM_ALG_OFF && cfg.ChecksumAlgorithm != BINLOG_CHECKSUM_ALG_CRC32 {
+		return nil, errors.Errorf("unsupported checksum algorithm %s", cfg.ChecksumAlgorithm)
+	}
+	if cfg.GTIDSet != nil {
+		if _, ok := cfg.GTIDSet.(*mysql.MysqlGTIDSet); !ok {
+			return nil, errors.Errorf("unsupported GTID set %T, only MySQL GTID sets are supported", cfg.GTIDSet)
+		}
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	w := &BinlogWriter{
+		cfg:            cfg,
+		rawChecksumAlg: BINLOG_CHECKSUM_ALG_OFF,
+	}
+	if cfg.GTIDSet != nil {
+		w.gset = cfg.GTIDSet.Clone()
+	}
+
+	seq, err := w.lastIndexedSeq()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if err = w.openFile(seq + 1); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return w, nil
+}
+
+func (w *BinlogWriter) indexFileName() string {
+	return path.Join(w.cfg.Dir, w.cfg.BaseName+".index")
+}
+
+func (w *BinlogWriter) lastIndexedSeq() (int, error) {
+	data, err := os.ReadFile(w.indexFileName())
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, errors.Trace(err)
+	}
+
+	seq := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		ext := path.Ext(line)
+		n, err := strconv.Atoi(strings.TrimPrefix(ext, "."))
+		if err != nil {
+			return 0, errors.Errorf("invalid binlog file name %q in index file", line)
+		}
+		seq = max(seq, n)
+	}
+	return seq, nil
+}
+
+func (w *BinlogWriter) openFile(seq int) error {
+	name := fmt.Sprintf("%s.%06d", w.cfg.BaseName, seq)
+
+	f, err := os.OpenFile(path.Join(w.cfg.Dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	w.f = f
+	w.w = bufio.NewWriter(f)
+	w.fileName = name
+	w.fileSeq = seq
+	w.pos = 0
+	w.trx.Reset()
+
+	if err = w.write(BinLogFileHeader); err != nil {
+		return errors.Trace(err)
+	}
+
+	now := uint32(time.Now().Unix())
+	fde := NewFormatDescriptionEvent(w.cfg.ServerVersion, w.cfg.ChecksumAlgorithm)
+	fde.CreateTimestamp = now
+	if err = w.writeEvent(&EventHeader{Timestamp: now, EventType: FORMAT_DESCRIPTION_EVENT, ServerID: w.cfg.ServerID}, fde); err != nil {
+		return errors.Trace(err)
+	}
+
+	if w.gset != nil {
+		prev := &PreviousGTIDsEvent{GTIDSets: w.gset.String()}
+		if err = w.writeEvent(&EventHeader{Timestamp: now, EventType: PREVIOUS_GTIDS_EVENT, ServerID: w.cfg.ServerID}, prev); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	idx, err := os.OpenFile(w.indexFileName(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if _, err = fmt.Fprintf(idx, "./%s\n", name); err != nil {
+		idx.Close()
+		return errors.Trace(err)
+	}
+	return errors.Trace(idx.Close())
+}
+
+func (w *BinlogWriter) write(data []byte) error {
+	if _, err := w.w.Write(data); err != nil {
+		return errors.Trace(err)
+	}
+	w.pos += uint32(len(data))
+	return nil
+}
+
+// writeEvent encodes and writes an event, setting its LogPos.
+func (w *BinlogWriter) writeEvent(h *EventHeader, e Event) error {
+	ee, ok := e.(EncodableEvent)
+	if !ok {
+		return errors.Errorf("encoding %T is not supported", e)
+	}
+	body, err := ee.Encode()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if _, ok := e.(*FormatDescriptionEvent); ok {
+		return w.writeBody(h, e, body)
+	}
+	return w.writeBody(h, &GenericEvent{Data: body}, body)
+}
+
+func (w *BinlogWriter) writeBody(h *EventHeader, e Event, body []byte) error {
+	hdr := *h
+	size := EventHeaderSize + len(body)
+	if _, ok := e.(*FormatDescriptionEvent); ok {
+		if w.cfg.ChecksumAlgorithm != BINLOG_CHECKSUM_ALG_UNDEF {
+			size += BinlogChecksumLength
+		}
+	} else if w.cfg.ChecksumAlgorithm == BINLOG_CHECKSUM_ALG_CRC32 {
+		size += BinlogChecksumLength
+	}
+	hdr.LogPos = w.pos + uint32(size)
+
+	data, err := EncodeEvent(&hdr, e, w.cfg.ChecksumAlgorithm)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return w.write(data)
+}
+
+// WriteEvent encodes e.Event with e.Header and writes it into the current file.
+// The LogPos, EventSize and checksum are rewritten, e is not modified.
+func (w *BinlogWriter) WriteEvent(e *BinlogEvent) error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	ee, ok := e.Event.(EncodableEvent)
+	if !ok {
+		return errors.Errorf("encoding %T is not supported", e.Event)
+	}
+
+	switch e.Header.EventType {
+	case FORMAT_DESCRIPTION_EVENT, ROTATE_EVENT, PREVIOUS_GTIDS_EVENT:
+		return nil
+	}
+
+	body, err := ee.Encode()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	return w.handleEvent(e.Header, body)
+}
+
+// WriteRawEvent writes an event as read from a binlog file or a replication
+// stream, including the event header and the checksum if any. The checksum
+// algorithm of raw events is learnt from the FORMAT_DESCRIPTION_EVENT passed
+// in before them, it is OFF otherwise.
+func (w *BinlogWriter) WriteRawEvent(data []byte) error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	h := new(EventHeader)
+	if err := h.Decode(data); err != nil {
+		return errors.Trace(err)
+	}
+	if int(h.EventSize) != len(data) {
+		return errors.Errorf("invalid raw event size %d, event size in header is %d", len(data), h.EventSize)
+	}
+
+	switch h.EventType {
+	case FORMAT_DESCRIPTION_EVENT:
+		fde := new(FormatDescriptionEvent)
+		if err := fde.Decode(data[EventHeaderSize:]); err != nil {
+			return errors.Trace(err)
+		}
+		w.rawChecksumAlg = fde.ChecksumAlgorithm
+		return nil
+	case ROTATE_EVENT, PREVIOUS_GTIDS_EVENT:
+		return nil
+	}
+
+	body := data[EventHeaderSize:]
+	if w.rawChecksumAlg == BINLOG_CHECKSUM_ALG_CRC32 {
+		if len(body) < BinlogChecksumLength {
+			return errors.Errorf("raw event too short for checksum, size %d", len(data))
+		}
+		body = body[:len(body)-BinlogChecksumLength]
+	}
+
+	return w.handleEvent(h, body)
+}
+
+func (w *BinlogWriter) handleEvent(h *EventHeader, body []byte) error {
+	if w.f == nil {
+		return errors.New("binlog writer is closed")
+	}
+
+	var gtid string
+	if w.gset != nil {
+		var err error
+		if gtid, err = eventGTID(h.EventType, body); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	if err := w.writeBody(h, &GenericEvent{Data: body}, body); err != nil {
+		return errors.Trace(err)
+	}
+	if len(gtid) > 0 {
+		w.pendingGTID = gtid
+	}
+
+	if !w.updateTransactionState(h, body) {
+		return nil
+	}
+	if len(w.pendingGTID) > 0 {
+		// the transaction is written, it is in the PREVIOUS_GTIDS of the next files
+		if err := w.gset.Update(w.pendingGTID); err != nil {
+			return errors.Trace(err)
+		}
+		w.pendingGTID = ""
+	}
+	if w.cfg.MaxFileSize > 0 && int64(w.pos) >= w.cfg.MaxFileSize {
+		return errors.Trace(w.rotate())
+	}
+	return nil
+}
+
+// eventGTID returns the GTID of a GTID event, empty for the other events.
+func eventGTID(eventType EventType, body []byte) (string, error) {
+	var ge *GTIDEvent
+	switch eventType {
+	case GTID_EVENT:
+		ge = new(GTIDEvent)
+		if err := ge.Decode(body); err != nil {
+			return "", errors.Trace(err)
+		}
+	case GTID_TAGGED_LOG_EVENT:
+		te := new(GtidTaggedLogEvent)
+		if err := te.Decode(body); err != nil {
+			return "", errors.Trace(err)
+		}
+		ge = &te.GTIDEvent
+	default:
+		return "", nil
+	}
+	next, err := ge.GTIDNext()
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return next.String(), nil
+}
+
+// updateTransactionState tracks the transaction boundaries and reports
+// whether the event ended a transaction, files are only rotated there.
+func (w *BinlogWriter) updateTransactionState(h *EventHeader, body []byte) bool {
+	e := &BinlogEvent{Header: h}
+	switch h.EventType {
+	case GTID_EVENT, GTID_TAGGED_LOG_EVENT, ANONYMOUS_GTID_EVENT:
+		e.Event = &GTIDEvent{}
+	case MARIADB_GTID_EVENT:
+		ge := new(MariadbGTIDEvent)
+		if err := ge.Decode(body); err != nil {
+			return false
+		}
+		e.Event = ge
+	case QUERY_EVENT:
+		qe := new(QueryEvent)
+		if err := qe.Decode(body); err != nil {
+			return false
+		}
+		e.Event = qe
+	case XID_EVENT:
+		e.Event = &XIDEvent{}
+	case TRANSACTION_PAYLOAD_EVENT:
+		e.Event = &TransactionPayloadEvent{}
+	default:
+		e.Event = &GenericEvent{Data: body}
+	}
+	_, end := w.trx.Update(e)
+	return end
+}
+
+// Rotate ends the current file with a RotateEvent and continues with the next one.
+func (w *BinlogWriter) Rotate() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if w.f == nil {
+		return errors.New("binlog writer is closed")
+	}
+	return w.rotate()
+}
+
+func (w *BinlogWriter) rotate() error {
+	nextSeq := w.fileSeq + 1
+	rotate := &RotateEvent{
+		Position:    4,
+		NextLogName: fmt.Appendf(nil, "%s.%06d", w.cfg.BaseName, nextSeq),
+	}
+	h := &EventHeader{Timestamp: uint32(time.Now().Unix()), EventType: ROTATE_EVENT, ServerID: w.cfg.ServerID}
+	if err := w.writeEvent(h, rotate); err != nil {
+		return errors.Trace(err)
+	}
+
+	if err := w.closeFile(); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(w.openFile(nextSeq))
+}
+
+func (w *BinlogWriter) closeFile() error {
+	err := w.w.Flush()
+	if closeErr := w.f.Close(); err == nil {
+		err = closeErr
+	}
+	w.f = nil
+	w.w = nil
+	return errors.Trace(err)
+}
+
+// Position returns the current file name and the position the next event is written at.
+func (w *BinlogWriter) Position() mysql.Position {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	return mysql.Position{Name: w.fileName, Pos: w.pos}
+}
+
+// GTIDSet returns a copy of the executed GTID set, or nil if GTIDs are not tracked.
+func (w *BinlogWriter) GTIDSet() mysql.GTIDSet {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if w.gset == nil {
+		return nil
+	}
+	return w.gset.Clone()
+}
+
+// Flush writes the buffered events to the current file.
+func (w *BinlogWriter) Flush() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if w.f == nil {
+		return nil
+	}
+	return errors.Trace(w.w.Flush())
+}
+
+// Close flushes and closes the current file.
+func (w *BinlogWriter) Close() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if w.f == nil {
+		return nil
+	}
+	return w.closeFile()
+}
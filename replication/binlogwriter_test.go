@@ -0,0 +1,167 @@
+package replication
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestTransaction(t *testing.T, w *BinlogWriter, gno int64) {
+	t.Helper()
+
+	sid := []byte{0x3e, 0x11, 0xfa, 0x47, 0x71, 0xca, 0x11, 0xe1, 0x9e, 0x33, 0xc8, 0x0a, 0xa9, 0x42, 0x95, 0x62}
+	events := []*BinlogEvent{
+		{Header: &EventHeader{EventType: GTID_EVENT, ServerID: 10}, Event: &GTIDEvent{CommitFlag: 1, SID: sid, GNO: gno}},
+		{Header: &EventHeader{EventType: QUERY_EVENT, ServerID: 10}, Event: &QueryEvent{Schema: []byte("test"), Query: []byte("BEGIN")}},
+		{Header: &EventHeader{EventType: ROWS_QUERY_EVENT, ServerID: 10}, Event: &RowsQueryEvent{Query: []byte("insert into t values (1)")}},
+		{Header: &EventHeader{EventType: XID_EVENT, ServerID: 10}, Event: &XIDEvent{XID: uint64(gno)}},
+	}
+	for _, e := range events {
+		require.NoError(t, w.WriteEvent(e))
+	}
+}
+
+func TestBinlogWriter(t *testing.T) {
+	dir := t.TempDir()
+
+	gset, err := mysql.ParseMysqlGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-10")
+	require.NoError(t, err)
+
+	w, err := NewBinlogWriter(BinlogWriterConfig{
+		Dir:               dir,
+		ServerID:          1,
+		ChecksumAlgorithm: BINLOG_CHECKSUM_ALG_CRC32,
+		MaxFileSize:       500,
+		GTIDSet:           gset,
+	})
+	require.NoError(t, err)
+
+	for gno := int64(11); gno <= 15; gno++ {
+		writeTestTransaction(t, w, gno)
+	}
+	require.NoError(t, w.Close())
+	require.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-15", w.GTIDSet().String())
+
+	index, err := os.ReadFile(path.Join(dir, "mysql-bin.index"))
+	require.NoError(t, err)
+	require.Equal(t, "./mysql-bin.000001\n./mysql-bin.000002\n./mysql-bin.000003\n", string(index))
+
+	p := NewBinlogParser()
+	p.SetVerifyChecksum(true)
+
+	var xids []uint64
+	var prevGTIDs []string
+	for i, name := range []string{"mysql-bin.000001", "mysql-bin.000002", "mysql-bin.000003"} {
+		var pos uint32 = 4
+		var rotate *RotateEvent
+		err = p.ParseFile(path.Join(dir, name), 0, func(e *BinlogEvent) error {
+			pos += e.Header.EventSize
+			require.Equal(t, pos, e.Header.LogPos)
+
+			switch ev := e.Event.(type) {
+			case *XIDEvent:
+				xids = append(xids, ev.XID)
+			case *PreviousGTIDsEvent:
+				prevGTIDs = append(prevGTIDs, ev.GTIDSets)
+			case *RotateEvent:
+				rotate = ev
+			}
+			return nil
+		})
+		require.NoError(t, err)
+
+		if i < 2 {
+			require.NotNil(t, rotate)
+			require.Equal(t, uint64(4), rotate.Position)
+		} else {
+			require.Nil(t, rotate)
+		}
+	}
+
+	require.Equal(t, []uint64{11, 12, 13, 14, 15}, xids)
+	require.Equal(t, []string{
+		"3e11fa47-71ca-11e1-9e33-c80aa9429562:1-10",
+		"3e11fa47-71ca-11e1-9e33-c80aa9429562:1-12",
+		"3e11fa47-71ca-11e1-9e33-c80aa9429562:1-14",
+	}, prevGTIDs)
+
+	// a new writer continues after the files in the index
+	w, err = NewBinlogWriter(BinlogWriterConfig{Dir: dir})
+	require.NoError(t, err)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000004", Pos: 4 + 122}, w.Position())
+	require.NoError(t, w.Close())
+}
+
+func TestBinlogWriterRawEvents(t *testing.T) {
+	dir := t.TempDir()
+
+	// raw events with checksums are rewritten without them
+	w, err := NewBinlogWriter(BinlogWriterConfig{Dir: dir, ChecksumAlgorithm: BINLOG_CHECKSUM_ALG_OFF})
+	require.NoError(t, err)
+
+	fde, err := EncodeEvent(&EventHeader{EventType: FORMAT_DESCRIPTION_EVENT}, NewFormatDescriptionEvent("8.0.36", BINLOG_CHECKSUM_ALG_CRC32), BINLOG_CHECKSUM_ALG_CRC32)
+	require.NoError(t, err)
+	require.NoError(t, w.WriteRawEvent(fde))
+
+	query, err := EncodeEvent(&EventHeader{EventType: QUERY_EVENT, LogPos: 999}, &QueryEvent{Schema: []byte("test"), Query: []byte("CREATE TABLE t (id int)")}, BINLOG_CHECKSUM_ALG_CRC32)
+	require.NoError(t, err)
+	require.NoError(t, w.WriteRawEvent(query))
+	require.NoError(t, w.Close())
+
+	p := NewBinlogParser()
+	var queries []string
+	err = p.ParseFile(path.Join(dir, "mysql-bin.000001"), 0, func(e *BinlogEvent) error {
+		if qe, ok := e.Event.(*QueryEvent); ok {
+			queries = append(queries, string(qe.Query))
+			require.Equal(t, uint32(len(query)-BinlogChecksumLength), e.Header.EventSize)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"CREATE TABLE t (id int)"}, queries)
+}
+
+func TestBinlogWriterGTIDSet(t *testing.T) {
+	sid := []byte{0x3e, 0x11, 0xfa, 0x47, 0x71, 0xca, 0x11, 0xe1, 0x9e, 0x33, 0xc8, 0x0a, 0xa9, 0x42, 0x95, 0x62}
+	gset, err := mysql.ParseMysqlGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-10")
+	require.NoError(t, err)
+	w, err := NewBinlogWriter(BinlogWriterConfig{Dir: t.TempDir(), GTIDSet: gset})
+	require.NoError(t, err)
+
+	// the GTID is added once its transaction is written
+	require.NoError(t, w.WriteEvent(&BinlogEvent{Header: &EventHeader{EventType: GTID_EVENT}, Event: &GTIDEvent{CommitFlag: 1, SID: sid, GNO: 11}}))
+	require.NoError(t, w.WriteEvent(&BinlogEvent{Header: &EventHeader{EventType: QUERY_EVENT}, Event: &QueryEvent{Query: []byte("BEGIN")}}))
+	require.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-10", w.GTIDSet().String())
+	require.NoError(t, w.WriteEvent(&BinlogEvent{Header: &EventHeader{EventType: XID_EVENT}, Event: &XIDEvent{XID: 11}}))
+	require.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-11", w.GTIDSet().String())
+
+	// a tagged GTID event written by MySQL 8.4, of a DDL
+	tagged := []byte{
+		0x2, 0x76, 0x0, 0x0, 0x2, 0x2, 0x25, 0x2, 0xdc, 0xf0, 0x9, 0x2, 0x30, 0xf9, 0x3, 0x22, 0xbd, 0x3,
+		0xad, 0x2, 0x21, 0x2, 0x44, 0x44, 0x5a, 0x68, 0x51, 0x3, 0x22, 0x4, 0x4, 0x6, 0xc, 0x66, 0x6f, 0x6f, 0x62,
+		0x61, 0x7a, 0x8, 0x0, 0xa, 0x4, 0xc, 0x7f, 0x15, 0x83, 0x22, 0x2d, 0x5c, 0x2e, 0x6, 0x10, 0x49, 0x3, 0x12,
+		0xc3, 0x2, 0xb,
+	}
+	te := new(GtidTaggedLogEvent)
+	require.NoError(t, te.Decode(tagged))
+	next, err := te.GTIDNext()
+	require.NoError(t, err)
+	require.Contains(t, next.String(), ":foobaz:")
+	raw, err := EncodeEvent(&EventHeader{EventType: GTID_TAGGED_LOG_EVENT}, &GenericEvent{Data: tagged}, BINLOG_CHECKSUM_ALG_OFF)
+	require.NoError(t, err)
+	require.NoError(t, w.WriteRawEvent(raw))
+	require.NoError(t, w.WriteEvent(&BinlogEvent{Header: &EventHeader{EventType: QUERY_EVENT}, Event: &QueryEvent{Query: []byte("CREATE TABLE t (id INT)")}}))
+	require.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-11,"+next.String(), w.GTIDSet().String())
+
+	// the GTID of a transaction not written up to its end is not added
+	require.NoError(t, w.WriteEvent(&BinlogEvent{Header: &EventHeader{EventType: GTID_EVENT}, Event: &GTIDEvent{CommitFlag: 1, SID: sid, GNO: 12}}))
+	require.NoError(t, w.WriteEvent(&BinlogEvent{Header: &EventHeader{EventType: QUERY_EVENT}, Event: &QueryEvent{Query: []byte("BEGIN")}}))
+	require.NoError(t, w.Close())
+	require.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-11,"+next.String(), w.GTIDSet().String())
+
+	// the set of the config is not changed
+	require.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-10", gset.String())
+}
@@ -0,0 +1,308 @@
+package replication
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"math"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/pingcap/errors"
+)
+
+// EncodableEvent is an Event which can be serialized back to binlog bytes.
+type EncodableEvent interface {
+	Event
+
+	// Encode returns the event body, excluding the event header and the checksum.
+	Encode() ([]byte, error)
+}
+
+// mysqlEventTypeHeaderLengths are the post-header lengths of every event type
+// as written by MySQL 8.0 in its FORMAT_DESCRIPTION_EVENT.
+var mysqlEventTypeHeaderLengths = []byte{
+	0x00, 0x0d, 0x00, 0x08, 0x00, 0x00, 0x00, 0x00, 0x04, 0x00, 0x04, 0x00, 0x00, 0x00, 0x62, 0x00,
+	0x04, 0x1a, 0x08, 0x00, 0x00, 0x00, 0x08, 0x08, 0x08, 0x02, 0x00, 0x00, 0x00, 0x0a, 0x0a, 0x0a,
+	0x2a, 0x2a, 0x00, 0x12, 0x34, 0x00, 0x0a, 0x28, 0x00,
+}
+
+// NewFormatDescriptionEvent returns a binlog version 4 FormatDescriptionEvent
+// with the post-header lengths of MySQL 8.0, suitable for starting a binlog
+// stream or file with events produced by EncodeEvent.
+func NewFormatDescriptionEvent(serverVersion string, checksumAlg BinlogChecksum) *FormatDescriptionEvent {
+	return &FormatDescriptionEvent{
+		Version:                4,
+		ServerVersion:          serverVersion,
+		EventHeaderLength:      EventHeaderSize,
+		EventTypeHeaderLengths: append([]byte(nil), mysqlEventTypeHeaderLengths...),
+		ChecksumAlgorithm:      checksumAlg,
+	}
+}
+
+// EncodeEvent serializes the header and the event body, setting the EventSize
+// of the header. LogPos is written as is. A CRC32 checksum is appended when
+// checksumAlg is BINLOG_CHECKSUM_ALG_CRC32.
+//
+// A FormatDescriptionEvent uses its own ChecksumAlgorithm instead, and like in
+// MySQL it always carries a checksum unless the algorithm is undefined.
+func EncodeEvent(h *EventHeader, e Event, checksumAlg BinlogChecksum) ([]byte, error) {
+	ee, ok := e.(EncodableEvent)
+	if !ok {
+		return nil, errors.Errorf("encoding %T is not supported", e)
+	}
+
+	body, err := ee.Encode()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	withChecksum := checksumAlg == BINLOG_CHECKSUM_ALG_CRC32
+	if fde, ok := e.(*FormatDescriptionEvent); ok {
+		withChecksum = fde.ChecksumAlgorithm != BINLOG_CHECKSUM_ALG_UNDEF
+	}
+
+	size := EventHeaderSize + len(body)
+	if withChecksum {
+		size += BinlogChecksumLength
+	}
+	if size > math.MaxUint32 {
+		return nil, errors.Errorf("event size %d is too large", size)
+	}
+	h.EventSize = uint32(size)
+
+	data := make([]byte, 0, size)
+	data = append(data, h.Encode()...)
+	data = append(data, body...)
+	if withChecksum {
+		data = binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+	}
+
+	return data, nil
+}
+
+// Encode serializes the event into RawData, see EncodeEvent.
+func (e *BinlogEvent) Encode(checksumAlg BinlogChecksum) error {
+	data, err := EncodeEvent(e.Header, e.Event, checksumAlg)
+	if err != nil {
+		return err
+	}
+	e.RawData = data
+	return nil
+}
+
+// Encode is the inverse of Decode.
+func (h *EventHeader) Encode() []byte {
+	data := make([]byte, EventHeaderSize)
+
+	pos := 0
+
+	binary.LittleEndian.PutUint32(data[pos:], h.Timestamp)
+	pos += 4
+
+	data[pos] = byte(h.EventType)
+	pos++
+
+	binary.LittleEndian.PutUint32(data[pos:], h.ServerID)
+	pos += 4
+
+	binary.LittleEndian.PutUint32(data[pos:], h.EventSize)
+	pos += 4
+
+	binary.LittleEndian.PutUint32(data[pos:], h.LogPos)
+	pos += 4
+
+	binary.LittleEndian.PutUint16(data[pos:], h.Flags)
+
+	return data
+}
+
+// Encode writes the checksum algorithm when it is defined, the checksum
+// itself is added by EncodeEvent.
+func (e *FormatDescriptionEvent) Encode() ([]byte, error) {
+	if len(e.ServerVersion) > 50 {
+		return nil, errors.Errorf("server version %q is longer than 50 bytes", e.ServerVersion)
+	}
+
+	headerLength := e.EventHeaderLength
+	if headerLength == 0 {
+		headerLength = EventHeaderSize
+	}
+
+	data := binary.LittleEndian.AppendUint16(nil, e.Version)
+
+	serverVersion := make([]byte, 50)
+	copy(serverVersion, e.ServerVersion)
+	data = append(data, serverVersion...)
+
+	data = binary.LittleEndian.AppendUint32(data, e.CreateTimestamp)
+	data = append(data, headerLength)
+	data = append(data, e.EventTypeHeaderLengths...)
+
+	if e.ChecksumAlgorithm != BINLOG_CHECKSUM_ALG_UNDEF {
+		data = append(data, byte(e.ChecksumAlgorithm))
+	}
+
+	return data, nil
+}
+
+func (e *RotateEvent) Encode() ([]byte, error) {
+	data := binary.LittleEndian.AppendUint64(nil, e.Position)
+	return append(data, e.NextLogName...), nil
+}
+
+func (e *PreviousGTIDsEvent) Encode() ([]byte, error) {
+	gset, err := mysql.ParseMysqlGTIDSet(e.GTIDSets)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return gset.Encode(), nil
+}
+
+func (e *XIDEvent) Encode() ([]byte, error) {
+	return binary.LittleEndian.AppendUint64(nil, e.XID), nil
+}
+
+func (e *QueryEvent) Encode() ([]byte, error) {
+	if e.compressed {
+		return nil, errors.New("encoding MARIADB_QUERY_COMPRESSED_EVENT is not supported")
+	}
+	if len(e.Schema) > math.MaxUint8 {
+		return nil, errors.Errorf("schema %q is too long", e.Schema)
+	}
+	if len(e.StatusVars) > math.MaxUint16 {
+		return nil, errors.Errorf("status vars length %d is too long", len(e.StatusVars))
+	}
+
+	data := binary.LittleEndian.AppendUint32(nil, e.SlaveProxyID)
+	data = binary.LittleEndian.AppendUint32(data, e.ExecutionTime)
+	data = append(data, byte(len(e.Schema)))
+	data = binary.LittleEndian.AppendUint16(data, e.ErrorCode)
+	data = binary.LittleEndian.AppendUint16(data, uint16(len(e.StatusVars)))
+	data = append(data, e.StatusVars...)
+	data = append(data, e.Schema...)
+	data = append(data, 0x00)
+	return append(data, e.Query...), nil
+}
+
+// Encode writes the logical timestamps, and the MySQL 8.0 commit timestamps,
+// transaction length and server versions when any of them is set.
+func (e *GTIDEvent) Encode() ([]byte, error) {
+	if len(e.SID) != 0 && len(e.SID) != SidLength {
+		return nil, errors.Errorf("invalid SID length %d", len(e.SID))
+	}
+
+	data := []byte{e.CommitFlag}
+	sid := make([]byte, SidLength)
+	copy(sid, e.SID)
+	data = append(data, sid...)
+	data = binary.LittleEndian.AppendUint64(data, uint64(e.GNO))
+
+	data = append(data, LogicalTimestampTypeCode)
+	data = binary.LittleEndian.AppendUint64(data, uint64(e.LastCommitted))
+	data = binary.LittleEndian.AppendUint64(data, uint64(e.SequenceNumber))
+
+	if e.ImmediateCommitTimestamp == 0 && e.OriginalCommitTimestamp == 0 && e.TransactionLength == 0 &&
+		e.ImmediateServerVersion == 0 && e.OriginalServerVersion == 0 {
+		return data, nil
+	}
+
+	if e.OriginalCommitTimestamp != e.ImmediateCommitTimestamp {
+		data = appendFixedLengthInt(data, e.ImmediateCommitTimestamp|uint64(1)<<55, 7)
+		data = appendFixedLengthInt(data, e.OriginalCommitTimestamp, 7)
+	} else {
+		data = appendFixedLengthInt(data, e.ImmediateCommitTimestamp, 7)
+	}
+
+	data = mysql.AppendLengthEncodedInteger(data, e.TransactionLength)
+
+	if e.OriginalServerVersion != e.ImmediateServerVersion {
+		data = binary.LittleEndian.AppendUint32(data, e.ImmediateServerVersion|uint32(1)<<31)
+		data = binary.LittleEndian.AppendUint32(data, e.OriginalServerVersion)
+	} else {
+		data = binary.LittleEndian.AppendUint32(data, e.ImmediateServerVersion)
+	}
+
+	return data, nil
+}
+
+// Encode is not supported for tagged GTID events yet, it only shadows the
+// promoted GTIDEvent.Encode which would produce the wrong format.
+func (e *GtidTaggedLogEvent) Encode() ([]byte, error) {
+	return nil, errors.New("encoding GTID_TAGGED_LOG_EVENT is not supported")
+}
+
+func (e *BeginLoadQueryEvent) Encode() ([]byte, error) {
+	data := binary.LittleEndian.AppendUint32(nil, e.FileID)
+	return append(data, e.BlockData...), nil
+}
+
+func (e *MariadbAnnotateRowsEvent) Encode() ([]byte, error) {
+	return append([]byte(nil), e.Query...), nil
+}
+
+func (e *MariadbBinlogCheckPointEvent) Encode() ([]byte, error) {
+	return append([]byte(nil), e.Info...), nil
+}
+
+// Encode does not write the server id, it belongs to the event header.
+func (e *MariadbGTIDEvent) Encode() ([]byte, error) {
+	data := binary.LittleEndian.AppendUint64(nil, e.GTID.SequenceNumber)
+	data = binary.LittleEndian.AppendUint32(data, e.GTID.DomainID)
+	data = append(data, e.Flags)
+
+	if (e.Flags & BINLOG_MARIADB_FL_GROUP_COMMIT_ID) > 0 {
+		return binary.LittleEndian.AppendUint64(data, e.CommitID), nil
+	}
+
+	// the event is padded to a fixed size of 19 bytes
+	return append(data, make([]byte, 6)...), nil
+}
+
+func (e *MariadbGTIDListEvent) Encode() ([]byte, error) {
+	if len(e.GTIDs) >= 1<<28 {
+		return nil, errors.Errorf("too many GTIDs %d", len(e.GTIDs))
+	}
+
+	data := binary.LittleEndian.AppendUint32(nil, uint32(len(e.GTIDs)))
+	for _, gtid := range e.GTIDs {
+		data = binary.LittleEndian.AppendUint32(data, gtid.DomainID)
+		data = binary.LittleEndian.AppendUint32(data, gtid.ServerID)
+		data = binary.LittleEndian.AppendUint64(data, gtid.SequenceNumber)
+	}
+	return data, nil
+}
+
+func (i *IntVarEvent) Encode() ([]byte, error) {
+	data := []byte{byte(i.Type)}
+	return binary.LittleEndian.AppendUint64(data, i.Value), nil
+}
+
+func (h *HeartbeatEvent) Encode() ([]byte, error) {
+	switch h.Version {
+	case 1:
+		return []byte(h.Filename), nil
+	case 2:
+		if len(h.Filename) > math.MaxUint8 {
+			return nil, errors.Errorf("binary log filename %q is too long", h.Filename)
+		}
+		data := []byte{OTW_HB_LOG_FILENAME_FIELD, byte(len(h.Filename))}
+		data = append(data, h.Filename...)
+
+		offset := mysql.PutLengthEncodedInt(h.Offset)
+		data = append(data, OTW_HB_LOG_POSITION_FIELD, byte(len(offset)))
+		data = append(data, offset...)
+
+		return append(data, OTW_HB_HEADER_END_MARK), nil
+	default:
+		return nil, errors.New("unknown heartbeat version")
+	}
+}
+
+func (e *RowsQueryEvent) Encode() ([]byte, error) {
+	// the length byte is ignored by readers and truncated for long queries
+	data := []byte{byte(min(len(e.Query), math.MaxUint8))}
+	return append(data, e.Query...), nil
+}
+
+func (e *GenericEvent) Encode() ([]byte, error) {
+	return append([]byte(nil), e.Data...), nil
+}
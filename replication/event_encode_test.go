@@ -0,0 +1,220 @@
+package replication
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/require"
+)
+
+func encodeAndParse(t *testing.T, p *BinlogParser, eventType EventType, e Event) *BinlogEvent {
+	t.Helper()
+
+	h := &EventHeader{Timestamp: 1700000000, EventType: eventType, ServerID: 1, LogPos: 1234}
+	data, err := EncodeEvent(h, e, BINLOG_CHECKSUM_ALG_CRC32)
+	require.NoError(t, err)
+	require.Equal(t, uint32(len(data)), h.EventSize)
+
+	be, err := p.Parse(data)
+	require.NoError(t, err)
+	require.Equal(t, *h, *be.Header)
+	return be
+}
+
+func newEncodeTestParser(t *testing.T) *BinlogParser {
+	t.Helper()
+
+	p := NewBinlogParser()
+	p.SetVerifyChecksum(true)
+
+	fde := NewFormatDescriptionEvent("8.0.36", BINLOG_CHECKSUM_ALG_CRC32)
+	be := encodeAndParse(t, p, FORMAT_DESCRIPTION_EVENT, fde)
+	require.Equal(t, fde, be.Event)
+	return p
+}
+
+func TestEncodeEvents(t *testing.T) {
+	p := newEncodeTestParser(t)
+
+	sid := []byte{0x3e, 0x11, 0xfa, 0x47, 0x71, 0xca, 0x11, 0xe1, 0x9e, 0x33, 0xc8, 0x0a, 0xa9, 0x42, 0x95, 0x62}
+
+	testCases := []struct {
+		eventType EventType
+		event     Event
+	}{
+		{ROTATE_EVENT, &RotateEvent{Position: 4, NextLogName: []byte("mysql-bin.000002")}},
+		{PREVIOUS_GTIDS_EVENT, &PreviousGTIDsEvent{GTIDSets: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-23:25"}},
+		{XID_EVENT, &XIDEvent{XID: 42}},
+		{QUERY_EVENT, &QueryEvent{
+			SlaveProxyID: 7, ExecutionTime: 1, StatusVars: []byte{0x00, 0x00, 0x00, 0x00, 0x00},
+			Schema: []byte("test"), Query: []byte("BEGIN"),
+		}},
+		{GTID_EVENT, &GTIDEvent{CommitFlag: 1, SID: sid, GNO: 24, LastCommitted: 3, SequenceNumber: 4}},
+		{GTID_EVENT, &GTIDEvent{
+			CommitFlag: 1, SID: sid, GNO: 25, LastCommitted: 4, SequenceNumber: 5,
+			ImmediateCommitTimestamp: 1700000000123456, OriginalCommitTimestamp: 1700000000000001,
+			TransactionLength: 300, ImmediateServerVersion: 80036, OriginalServerVersion: 80036,
+		}},
+		{ROWS_QUERY_EVENT, &RowsQueryEvent{Query: []byte("insert into t values (1)")}},
+		{INTVAR_EVENT, &IntVarEvent{Type: INSERT_ID, Value: 10}},
+		{BEGIN_LOAD_QUERY_EVENT, &BeginLoadQueryEvent{FileID: 3, BlockData: []byte("1,2\n")}},
+		{MARIADB_ANNOTATE_ROWS_EVENT, &MariadbAnnotateRowsEvent{Query: []byte("delete from t")}},
+		{MARIADB_BINLOG_CHECKPOINT_EVENT, &MariadbBinlogCheckPointEvent{Info: []byte("mysql-bin.000001")}},
+		{MARIADB_GTID_EVENT, &MariadbGTIDEvent{GTID: mysql.MariadbGTID{DomainID: 1, ServerID: 1, SequenceNumber: 100}}},
+		{MARIADB_GTID_EVENT, &MariadbGTIDEvent{
+			GTID: mysql.MariadbGTID{DomainID: 1, ServerID: 1, SequenceNumber: 101}, Flags: BINLOG_MARIADB_FL_GROUP_COMMIT_ID, CommitID: 9,
+		}},
+		{MARIADB_GTID_LIST_EVENT, &MariadbGTIDListEvent{GTIDs: []mysql.MariadbGTID{{DomainID: 1, ServerID: 2, SequenceNumber: 3}}}},
+		{HEARTBEAT_EVENT, &HeartbeatEvent{Version: 1, Filename: "mysql-bin.000001"}},
+		{HEARTBEAT_LOG_EVENT_V2, &HeartbeatEvent{Version: 2, Filename: "mysql-bin.000001", Offset: 123456}},
+		{STOP_EVENT, &GenericEvent{Data: []byte{}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.eventType.String(), func(t *testing.T) {
+			be := encodeAndParse(t, p, tc.eventType, tc.event)
+			require.Equal(t, tc.event, be.Event)
+		})
+	}
+}
+
+func TestEncodeFormatDescriptionEventWithoutChecksum(t *testing.T) {
+	p := NewBinlogParser()
+	p.SetVerifyChecksum(true)
+
+	fde := NewFormatDescriptionEvent("8.0.36", BINLOG_CHECKSUM_ALG_OFF)
+	be := encodeAndParse(t, p, FORMAT_DESCRIPTION_EVENT, fde)
+	require.Equal(t, fde, be.Event)
+
+	// the FDE always has a checksum, following events don't
+	data, err := EncodeEvent(&EventHeader{EventType: XID_EVENT}, &XIDEvent{XID: 1}, BINLOG_CHECKSUM_ALG_OFF)
+	require.NoError(t, err)
+	require.Len(t, data, EventHeaderSize+8)
+	be, err = p.Parse(data)
+	require.NoError(t, err)
+	require.Equal(t, &XIDEvent{XID: 1}, be.Event)
+}
+
+func TestEncodeRowsEvent(t *testing.T) {
+	p := newEncodeTestParser(t)
+	p.SetTimestampStringLocation(time.UTC)
+
+	table := &TableMapEvent{
+		TableID:     100,
+		Flags:       1,
+		Schema:      []byte("test"),
+		Table:       []byte("t"),
+		ColumnCount: 17,
+		ColumnType: []byte{
+			mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_TINY, mysql.MYSQL_TYPE_LONGLONG, mysql.MYSQL_TYPE_NEWDECIMAL,
+			mysql.MYSQL_TYPE_DOUBLE, mysql.MYSQL_TYPE_FLOAT, mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_STRING,
+			mysql.MYSQL_TYPE_STRING, mysql.MYSQL_TYPE_BLOB, mysql.MYSQL_TYPE_DATETIME2, mysql.MYSQL_TYPE_TIMESTAMP2,
+			mysql.MYSQL_TYPE_DATE, mysql.MYSQL_TYPE_TIME2, mysql.MYSQL_TYPE_YEAR, mysql.MYSQL_TYPE_BIT,
+			mysql.MYSQL_TYPE_JSON,
+		},
+		ColumnMeta: []uint16{
+			0, 0, 0, 10<<8 | 3,
+			8, 4, 1024, 0xfe<<8 | 40,
+			uint16(mysql.MYSQL_TYPE_ENUM)<<8 | 1, 2, 6, 3,
+			0, 4, 0, 1<<8 | 2,
+			4,
+		},
+		NullBitmap:       []byte{0xfe, 0xff, 0x01},
+		SignednessBitmap: []byte{0x20},
+		ColumnName: [][]byte{
+			[]byte("id"), []byte("tiny"), []byte("big"), []byte("dec"), []byte("dbl"), []byte("flt"), []byte("vc"),
+			[]byte("ch"), []byte("en"), []byte("bl"), []byte("dt"), []byte("ts"), []byte("d"), []byte("tm"),
+			[]byte("y"), []byte("bit"), []byte("js"),
+		},
+		PrimaryKey:       []uint64{0},
+		PrimaryKeyPrefix: []uint64{0},
+	}
+
+	be := encodeAndParse(t, p, TABLE_MAP_EVENT, table)
+	decodedTable := be.Event.(*TableMapEvent)
+	require.Equal(t, table.ColumnType, decodedTable.ColumnType)
+	require.Equal(t, table.ColumnMeta, decodedTable.ColumnMeta)
+	require.Equal(t, table.ColumnName, decodedTable.ColumnName)
+	require.Equal(t, table.PrimaryKey, decodedTable.PrimaryKey)
+	require.Equal(t, table.SignednessBitmap, decodedTable.SignednessBitmap)
+
+	rows := [][]any{
+		{
+			int32(1), int8(-5), uint64(18446744073709551615), "-1234567.123",
+			3.25, float32(1.5), "hello", "world",
+			int64(2), []byte{0x00, 0x01, 0x02}, "2024-02-29 13:14:15.123456", "2024-03-01 01:02:03.500",
+			"2024-02-29", "-12:34:56.7800", 2024, int64(0x1ff),
+			`{"a":[1,2.5,"x",true,null],"bb":{"c":-70000}}`,
+		},
+		{
+			int32(2), nil, nil, nil,
+			nil, nil, nil, nil,
+			nil, nil, "0000-00-00 00:00:00.000000", "0000-00-00 00:00:00.000",
+			"0000-00-00", "00:00:00", 0, nil,
+			nil,
+		},
+	}
+
+	for _, eventType := range []EventType{WRITE_ROWS_EVENTv2, DELETE_ROWS_EVENTv1, UPDATE_ROWS_EVENTv2, PARTIAL_UPDATE_ROWS_EVENT} {
+		t.Run(eventType.String(), func(t *testing.T) {
+			re := NewRowsEvent(eventType, table, rows)
+			re.Flags = RowsEventStmtEndFlag
+			p.tables[table.TableID] = decodedTable
+
+			be := encodeAndParse(t, p, eventType, re)
+			decoded := be.Event.(*RowsEvent)
+			require.Equal(t, eventType, decoded.EventType())
+			require.Len(t, decoded.Rows, len(rows))
+			for i, row := range rows {
+				for j, v := range row {
+					if j == len(row)-1 && v != nil {
+						require.JSONEq(t, v.(string), decoded.Rows[i][j].(string))
+						continue
+					}
+					require.Equal(t, v, decoded.Rows[i][j], "row %d column %d", i, j)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeRowsEventMissingTable(t *testing.T) {
+	re := &RowsEvent{Version: 2}
+	_, err := re.Encode()
+	require.Error(t, err)
+}
+
+func TestEncodeJSONBinary(t *testing.T) {
+	large := make([]any, 0, 10000)
+	for i := range 10000 {
+		large = append(large, i*1000)
+	}
+	largeJSON, err := json.Marshal(map[string]any{"large": large, "s": "small"})
+	require.NoError(t, err)
+
+	testCases := []string{
+		`null`,
+		`true`,
+		`-1`,
+		`3000000000`,
+		`18446744073709551615`,
+		`1.5e300`,
+		`"string"`,
+		`[]`,
+		`{}`,
+		`{"k1":"v1","key2":[1,{"x":false}],"k":65536}`,
+		string(largeJSON),
+	}
+
+	e := &RowsEvent{}
+	for _, tc := range testCases {
+		data, err := encodeJSONBinary([]byte(tc))
+		require.NoError(t, err)
+
+		decoded, err := e.decodeJSONBinary(data)
+		require.NoError(t, err)
+		require.JSONEq(t, tc, string(decoded))
+	}
+}
@@ -0,0 +1,222 @@
+package replication
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/goccy/go-json"
+	"github.com/pingcap/errors"
+)
+
+// encodeJSONBinary converts a JSON text document into the MySQL binary JSON
+// format used in row events. It is the inverse of decodeJSONBinary.
+// see mysql-server/sql-common/json_binary.cc serialize_json_value
+func encodeJSONBinary(text []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(text))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	tp, data, err := encodeJSONBinaryValue(v)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return append([]byte{tp}, data...), nil
+}
+
+func encodeJSONBinaryValue(v any) (byte, []byte, error) {
+	switch t := v.(type) {
+	case nil:
+		return JSONB_LITERAL, []byte{JSONB_NULL_LITERAL}, nil
+	case bool:
+		if t {
+			return JSONB_LITERAL, []byte{JSONB_TRUE_LITERAL}, nil
+		}
+		return JSONB_LITERAL, []byte{JSONB_FALSE_LITERAL}, nil
+	case json.Number:
+		return encodeJSONBinaryNumber(t)
+	case string:
+		buf := encodeJSONBinaryVariableLength(nil, len(t))
+		return JSONB_STRING, append(buf, t...), nil
+	case []any:
+		data, err := encodeJSONBinaryArray(t, true)
+		if err == nil {
+			return JSONB_SMALL_ARRAY, data, nil
+		}
+		if errors.Cause(err) != errJSONBinaryTooLarge {
+			return 0, nil, err
+		}
+		data, err = encodeJSONBinaryArray(t, false)
+		return JSONB_LARGE_ARRAY, data, err
+	case map[string]any:
+		data, err := encodeJSONBinaryObject(t, true)
+		if err == nil {
+			return JSONB_SMALL_OBJECT, data, nil
+		}
+		if errors.Cause(err) != errJSONBinaryTooLarge {
+			return 0, nil, err
+		}
+		data, err = encodeJSONBinaryObject(t, false)
+		return JSONB_LARGE_OBJECT, data, err
+	default:
+		return 0, nil, errors.Errorf("unsupported JSON value type %T", v)
+	}
+}
+
+func encodeJSONBinaryNumber(n json.Number) (byte, []byte, error) {
+	if i, err := strconv.ParseInt(n.String(), 10, 64); err == nil {
+		switch {
+		case i >= math.MinInt16 && i <= math.MaxInt16:
+			return JSONB_INT16, binary.LittleEndian.AppendUint16(nil, uint16(i)), nil
+		case i >= math.MinInt32 && i <= math.MaxInt32:
+			return JSONB_INT32, binary.LittleEndian.AppendUint32(nil, uint32(i)), nil
+		default:
+			return JSONB_INT64, binary.LittleEndian.AppendUint64(nil, uint64(i)), nil
+		}
+	}
+
+	if u, err := strconv.ParseUint(n.String(), 10, 64); err == nil {
+		return JSONB_UINT64, binary.LittleEndian.AppendUint64(nil, u), nil
+	}
+
+	f, err := strconv.ParseFloat(n.String(), 64)
+	if err != nil {
+		return 0, nil, errors.Trace(err)
+	}
+	return JSONB_DOUBLE, binary.LittleEndian.AppendUint64(nil, math.Float64bits(f)), nil
+}
+
+var errJSONBinaryTooLarge = errors.New("JSON value too large for small storage format")
+
+func encodeJSONBinaryArray(values []any, isSmall bool) ([]byte, error) {
+	offsetSize := jsonbGetOffsetSize(isSmall)
+	valueEntrySize := jsonbGetValueEntrySize(isSmall)
+
+	headerSize := 2*offsetSize + len(values)*valueEntrySize
+	buf := make([]byte, headerSize)
+
+	for i, v := range values {
+		var err error
+		entry := buf[2*offsetSize+i*valueEntrySize:]
+		buf, err = encodeJSONBinaryEntry(buf, entry, v, isSmall)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return encodeJSONBinaryFinish(buf, len(values), isSmall)
+}
+
+func encodeJSONBinaryObject(m map[string]any, isSmall bool) ([]byte, error) {
+	offsetSize := jsonbGetOffsetSize(isSmall)
+	keyEntrySize := jsonbGetKeyEntrySize(isSmall)
+	valueEntrySize := jsonbGetValueEntrySize(isSmall)
+
+	// MySQL stores keys ordered by length first, then by their bytes.
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) < len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+
+	headerSize := 2*offsetSize + len(keys)*(keyEntrySize+valueEntrySize)
+	buf := make([]byte, headerSize)
+
+	for i, k := range keys {
+		if len(k) > math.MaxUint16 {
+			return nil, errors.Errorf("JSON key length %d is too long", len(k))
+		}
+		entry := buf[2*offsetSize+i*keyEntrySize:]
+		if err := putJSONBinaryOffset(entry, len(buf), isSmall); err != nil {
+			return nil, err
+		}
+		binary.LittleEndian.PutUint16(entry[offsetSize:], uint16(len(k)))
+		buf = append(buf, k...)
+	}
+
+	valueEntriesStart := 2*offsetSize + len(keys)*keyEntrySize
+	for i, k := range keys {
+		var err error
+		entry := buf[valueEntriesStart+i*valueEntrySize:]
+		buf, err = encodeJSONBinaryEntry(buf, entry, m[k], isSmall)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return encodeJSONBinaryFinish(buf, len(keys), isSmall)
+}
+
+// encodeJSONBinaryEntry fills a value entry, either inlining the value or
+// appending it to buf and storing its offset.
+func encodeJSONBinaryEntry(buf []byte, entry []byte, v any, isSmall bool) ([]byte, error) {
+	tp, data, err := encodeJSONBinaryValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	entry[0] = tp
+	if isInlineValue(tp, isSmall) {
+		if tp == JSONB_LITERAL {
+			entry[1] = data[0]
+		} else {
+			copy(entry[1:], data)
+		}
+		return buf, nil
+	}
+
+	if err = putJSONBinaryOffset(entry[1:], len(buf), isSmall); err != nil {
+		return nil, err
+	}
+	return append(buf, data...), nil
+}
+
+func encodeJSONBinaryFinish(buf []byte, count int, isSmall bool) ([]byte, error) {
+	if err := putJSONBinaryOffset(buf, count, isSmall); err != nil {
+		return nil, err
+	}
+	if err := putJSONBinaryOffset(buf[jsonbGetOffsetSize(isSmall):], len(buf), isSmall); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func putJSONBinaryOffset(data []byte, v int, isSmall bool) error {
+	if isSmall {
+		if v > math.MaxUint16 {
+			return errJSONBinaryTooLarge
+		}
+		binary.LittleEndian.PutUint16(data, uint16(v))
+		return nil
+	}
+
+	if v > math.MaxUint32 {
+		return errors.Errorf("JSON value size %d is too large", v)
+	}
+	binary.LittleEndian.PutUint32(data, uint32(v))
+	return nil
+}
+
+// encodeJSONBinaryVariableLength is the inverse of decodeVariableLength.
+func encodeJSONBinaryVariableLength(buf []byte, length int) []byte {
+	for {
+		b := byte(length & 0x7F)
+		length >>= 7
+		if length == 0 {
+			return append(buf, b)
+		}
+		buf = append(buf, b|0x80)
+	}
+}
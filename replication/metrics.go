@@ -0,0 +1,55 @@
+package replication
+
+import (
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/utils"
+)
+
+// Metrics receives the metrics of a BinlogSyncer. The methods are called on
+// the goroutine reading the binlog, so they must not block.
+type Metrics interface {
+	// ObserveEvent is called for each event received with its size in bytes,
+	// and the `schema.table` of the table map and rows events.
+	ObserveEvent(eventType EventType, table string, size uint32)
+
+	// ObserveLag is called with the time between the timestamp of the events
+	// and their reception, and with zero for the heartbeats, which the
+	// server sends only once all the events are sent, so that the lag is
+	// right while the source is idle.
+	ObserveLag(lag time.Duration)
+
+	// ObserveQueue is called with the number of events in the channel of the
+	// streamer and its capacity, EventCacheCount, after an event is added.
+	ObserveQueue(length int, capacity int)
+
+	// ObserveReconnect is called after each attempt to reconnect to the
+	// server with the error of the attempt.
+	ObserveReconnect(err error)
+}
+
+// observeEvent passes the metrics of an event to m.
+func observeEvent(m Metrics, e *BinlogEvent) {
+	var table string
+	switch ev := e.Event.(type) {
+	case *TableMapEvent:
+		table = string(ev.Schema) + "." + string(ev.Table)
+	case *RowsEvent:
+		if ev.Table != nil {
+			table = string(ev.Table.Schema) + "." + string(ev.Table.Table)
+		}
+	}
+	m.ObserveEvent(e.Header.EventType, table, e.Header.EventSize)
+
+	switch e.Event.(type) {
+	case *HeartbeatEvent:
+		m.ObserveLag(0)
+	case *FormatDescriptionEvent:
+		// sent again with its old timestamp on each connection
+	default:
+		if e.Header.Timestamp > 0 {
+			lag := utils.Now().Sub(time.Unix(int64(e.Header.Timestamp), 0))
+			m.ObserveLag(max(lag, 0))
+		}
+	}
+}
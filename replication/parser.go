@@ -42,6 +42,7 @@ type BinlogParser struct {
 	verifyChecksum           bool
 
 	payloadDecoderConcurrency int
+	lazyPayloadDecode         bool
 
 	rowsEventDecodeFunc func(*RowsEvent, []byte) error
 
@@ -228,6 +229,12 @@ func (p *BinlogParser) SetPayloadDecoderConcurrency(concurrency int) {
 	p.payloadDecoderConcurrency = concurrency
 }
 
+// SetLazyPayloadDecode defers the decompression and the decoding of the
+// events of a TransactionPayloadEvent to its DecodeEvents method.
+func (p *BinlogParser) SetLazyPayloadDecode(lazy bool) {
+	p.lazyPayloadDecode = lazy
+}
+
 func (p *BinlogParser) SetRowsEventDecodeFunc(rowsEventDecodeFunc func(*RowsEvent, []byte) error) {
 	p.rowsEventDecodeFunc = rowsEventDecodeFunc
 }
@@ -255,6 +262,7 @@ func (p *BinlogParser) cloneForPayloadDecode() *BinlogParser {
 	// verifyChecksum is intentionally left at the zero value: nested
 	// events do not carry their own checksum trailers.
 	inner.payloadDecoderConcurrency = p.payloadDecoderConcurrency
+	inner.lazyPayloadDecode = p.lazyPayloadDecode
 	inner.rowsEventDecodeFunc = p.rowsEventDecodeFunc
 	inner.tableMapOptionalMetaDecodeFunc = p.tableMapOptionalMetaDecodeFunc
 	return inner
@@ -388,6 +396,7 @@ func (p *BinlogParser) parseEvent(h *EventHeader, data []byte, rawData []byte) (
 	}
 
 	if tpe, ok := e.(*TransactionPayloadEvent); ok {
+		tpe.header = h
 		tpe.stampInnerEventPositions(h)
 	}
 
@@ -460,51 +469,14 @@ func (p *BinlogParser) newRowsEvent(h *EventHeader) *RowsEvent {
 		e.tableIDSize = 6
 	}
 
-	e.needBitmap2 = false
 	e.tables = p.tables
-	e.eventType = h.EventType
 	e.parseTime = p.parseTime
 	e.timestampStringLocation = p.timestampStringLocation
 	e.useDecimal = p.useDecimal
 	e.useFloatWithTrailingZero = p.useFloatWithTrailingZero
 	e.renderJSONAsMySQLText = p.renderJSONAsMySQLText
 	e.ignoreJSONDecodeErr = p.ignoreJSONDecodeErr
-
-	switch h.EventType {
-	case WRITE_ROWS_EVENTv0:
-		e.Version = 0
-	case UPDATE_ROWS_EVENTv0:
-		e.Version = 0
-	case DELETE_ROWS_EVENTv0:
-		e.Version = 0
-	case WRITE_ROWS_EVENTv1:
-		e.Version = 1
-	case DELETE_ROWS_EVENTv1:
-		e.Version = 1
-	case UPDATE_ROWS_EVENTv1:
-		e.Version = 1
-		e.needBitmap2 = true
-	case MARIADB_WRITE_ROWS_COMPRESSED_EVENT_V1:
-		e.Version = 1
-		e.compressed = true
-	case MARIADB_DELETE_ROWS_COMPRESSED_EVENT_V1:
-		e.Version = 1
-		e.compressed = true
-	case MARIADB_UPDATE_ROWS_COMPRESSED_EVENT_V1:
-		e.Version = 1
-		e.compressed = true
-		e.needBitmap2 = true
-	case WRITE_ROWS_EVENTv2:
-		e.Version = 2
-	case UPDATE_ROWS_EVENTv2:
-		e.Version = 2
-		e.needBitmap2 = true
-	case DELETE_ROWS_EVENTv2:
-		e.Version = 2
-	case PARTIAL_UPDATE_ROWS_EVENT:
-		e.Version = 2
-		e.needBitmap2 = true
-	}
+	e.setEventType(h.EventType)
 
 	return e
 }
@@ -514,6 +486,7 @@ func (p *BinlogParser) newTransactionPayloadEvent() *TransactionPayloadEvent {
 	e.format = *p.format
 	e.concurrency = p.payloadDecoderConcurrency
 	e.parent = p
+	e.lazy = p.lazyPayloadDecode
 
 	return e
 }
@@ -949,6 +949,12 @@ type RowsEvent struct {
 	Rows           [][]any
 	SkippedColumns [][]int
 
+	// lazy is set by DecodeLazily, which decodes the row images instead of
+	// Rows and SkippedColumns.
+	lazy        bool
+	images      []RowImage
+	unsignedMap map[int]bool
+
 	parseTime                bool
 	timestampStringLocation  *time.Location
 	useDecimal               bool
@@ -1268,20 +1274,7 @@ func (e *RowsEvent) decodeValue(data []byte, tp byte, meta uint16, isPartial boo
 	length := 0
 
 	if tp == mysql.MYSQL_TYPE_STRING {
-		if meta >= 256 {
-			b0 := uint8(meta >> 8)
-			b1 := uint8(meta & 0xFF)
-
-			if b0&0x30 != 0x30 {
-				length = int(uint16(b1) | (uint16((b0&0x30)^0x30) << 4))
-				tp = b0 | 0x30
-			} else {
-				length = int(meta & 0xFF)
-				tp = b0
-			}
-		} else {
-			length = int(meta)
-		}
+		tp, length = StringColumnType(meta)
 	}
 
 	switch tp {
@@ -1494,6 +1487,21 @@ func (e *RowsEvent) decodeValue(data []byte, tp byte, meta uint16, isPartial boo
 	return v, n, err
 }
 
+// StringColumnType returns the real type of a MYSQL_TYPE_STRING column, which
+// may be an ENUM or a SET, and its maximum length.
+func StringColumnType(meta uint16) (tp byte, length int) {
+	if meta < 256 {
+		return mysql.MYSQL_TYPE_STRING, int(meta)
+	}
+
+	b0 := uint8(meta >> 8)
+	b1 := uint8(meta & 0xFF)
+	if b0&0x30 != 0x30 {
+		return b0 | 0x30, int(uint16(b1) | (uint16((b0&0x30)^0x30) << 4))
+	}
+	return b0, int(meta & 0xFF)
+}
+
 func decodeString(data []byte, length int) (v string, n int) {
 	if length < 256 {
 		length = int(data[0])
@@ -1897,6 +1905,9 @@ func (e *RowsEvent) Dump(w io.Writer) {
 	fmt.Fprintf(w, "Event type: %s (%s)", e.Type(), e.eventType)
 
 	fmt.Fprintf(w, "Values:\n")
+	if err := e.DecodeRows(); err != nil {
+		fmt.Fprintf(w, "Rows decode error: %v\n", err)
+	}
 	for _, rows := range e.Rows {
 		fmt.Fprintf(w, "--\n")
 		for j, d := range rows {
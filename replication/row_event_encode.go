@@ -0,0 +1,910 @@
+package replication
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/pingcap/errors"
+	"github.com/shopspring/decimal"
+)
+
+// NewRowsEvent creates a RowsEvent of the given type for the table, ready to
+// be encoded. Rows must use the same Go types that the decoder produces,
+// see RowsEvent. For update events, Rows holds before and after images in
+// alternating order.
+func NewRowsEvent(eventType EventType, table *TableMapEvent, rows [][]any) *RowsEvent {
+	e := &RowsEvent{
+		tableIDSize: table.tableIDSize,
+		Table:       table,
+		TableID:     table.TableID,
+		ColumnCount: table.ColumnCount,
+		Rows:        rows,
+	}
+	e.setEventType(eventType)
+	return e
+}
+
+// setEventType sets the version and image layout implied by the event type.
+func (e *RowsEvent) setEventType(eventType EventType) {
+	e.eventType = eventType
+	e.needBitmap2 = false
+	e.compressed = false
+
+	switch eventType {
+	case WRITE_ROWS_EVENTv0:
+		e.Version = 0
+	case UPDATE_ROWS_EVENTv0:
+		e.Version = 0
+	case DELETE_ROWS_EVENTv0:
+		e.Version = 0
+	case WRITE_ROWS_EVENTv1:
+		e.Version = 1
+	case DELETE_ROWS_EVENTv1:
+		e.Version = 1
+	case UPDATE_ROWS_EVENTv1:
+		e.Version = 1
+		e.needBitmap2 = true
+	case MARIADB_WRITE_ROWS_COMPRESSED_EVENT_V1:
+		e.Version = 1
+		e.compressed = true
+	case MARIADB_DELETE_ROWS_COMPRESSED_EVENT_V1:
+		e.Version = 1
+		e.compressed = true
+	case MARIADB_UPDATE_ROWS_COMPRESSED_EVENT_V1:
+		e.Version = 1
+		e.compressed = true
+		e.needBitmap2 = true
+	case WRITE_ROWS_EVENTv2:
+		e.Version = 2
+	case UPDATE_ROWS_EVENTv2:
+		e.Version = 2
+		e.needBitmap2 = true
+	case DELETE_ROWS_EVENTv2:
+		e.Version = 2
+	case PARTIAL_UPDATE_ROWS_EVENT:
+		e.Version = 2
+		e.needBitmap2 = true
+	}
+}
+
+// EventType returns the binlog event type of the rows event.
+func (e *RowsEvent) EventType() EventType {
+	return e.eventType
+}
+
+func fullBitmap(columnCount int) []byte {
+	bitmap := make([]byte, bitmapByteSize(columnCount))
+	for i := range columnCount {
+		bitmap[i>>3] |= 1 << (uint(i) & 7)
+	}
+	return bitmap
+}
+
+func appendFixedLengthInt(buf []byte, v uint64, n int) []byte {
+	for i := range n {
+		buf = append(buf, byte(v>>(8*uint(i))))
+	}
+	return buf
+}
+
+func appendBFixedLengthInt(buf []byte, v uint64, n int) []byte {
+	for i := n - 1; i >= 0; i-- {
+		buf = append(buf, byte(v>>(8*uint(i))))
+	}
+	return buf
+}
+
+// Encode encodes the table map event body, the inverse of Decode.
+func (e *TableMapEvent) Encode() ([]byte, error) {
+	if len(e.Schema) > math.MaxUint8 || len(e.Table) > math.MaxUint8 {
+		return nil, errors.Errorf("schema or table name too long: %s.%s", e.Schema, e.Table)
+	}
+	if len(e.ColumnType) != int(e.ColumnCount) {
+		return nil, errors.Errorf("expect %d column types but got %d", e.ColumnCount, len(e.ColumnType))
+	}
+
+	tableIDSize := e.tableIDSize
+	if tableIDSize == 0 {
+		tableIDSize = 6
+	}
+
+	buf := appendFixedLengthInt(nil, e.TableID, tableIDSize)
+	buf = binary.LittleEndian.AppendUint16(buf, e.Flags)
+	buf = append(buf, byte(len(e.Schema)))
+	buf = append(buf, e.Schema...)
+	buf = append(buf, 0x00)
+	buf = append(buf, byte(len(e.Table)))
+	buf = append(buf, e.Table...)
+	buf = append(buf, 0x00)
+	buf = mysql.AppendLengthEncodedInteger(buf, e.ColumnCount)
+	buf = append(buf, e.ColumnType...)
+
+	meta, err := e.encodeMeta()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	buf = append(buf, mysql.PutLengthEncodedString(meta)...)
+
+	nullBitmap := e.NullBitmap
+	if nullBitmap == nil {
+		nullBitmap = make([]byte, bitmapByteSize(int(e.ColumnCount)))
+	}
+	buf = append(buf, nullBitmap...)
+
+	return append(buf, e.encodeOptionalMeta()...), nil
+}
+
+// encodeMeta is the inverse of decodeMeta.
+func (e *TableMapEvent) encodeMeta() ([]byte, error) {
+	var buf []byte
+	for i, t := range e.ColumnType {
+		var meta uint16
+		if i < len(e.ColumnMeta) {
+			meta = e.ColumnMeta[i]
+		}
+
+		switch t {
+		case mysql.MYSQL_TYPE_STRING,
+			mysql.MYSQL_TYPE_NEWDECIMAL:
+			buf = binary.BigEndian.AppendUint16(buf, meta)
+		case mysql.MYSQL_TYPE_VAR_STRING,
+			mysql.MYSQL_TYPE_VARCHAR,
+			mysql.MYSQL_TYPE_BIT:
+			buf = binary.LittleEndian.AppendUint16(buf, meta)
+		case mysql.MYSQL_TYPE_BLOB,
+			mysql.MYSQL_TYPE_DOUBLE,
+			mysql.MYSQL_TYPE_FLOAT,
+			mysql.MYSQL_TYPE_GEOMETRY,
+			mysql.MYSQL_TYPE_VECTOR,
+			mysql.MYSQL_TYPE_JSON,
+			mysql.MYSQL_TYPE_TIME2,
+			mysql.MYSQL_TYPE_DATETIME2,
+			mysql.MYSQL_TYPE_TIMESTAMP2:
+			buf = append(buf, byte(meta))
+		case mysql.MYSQL_TYPE_NEWDATE,
+			mysql.MYSQL_TYPE_ENUM,
+			mysql.MYSQL_TYPE_SET,
+			mysql.MYSQL_TYPE_TINY_BLOB,
+			mysql.MYSQL_TYPE_MEDIUM_BLOB,
+			mysql.MYSQL_TYPE_LONG_BLOB:
+			return nil, errors.Errorf("unsupport type in binlog %d", t)
+		}
+	}
+	return buf, nil
+}
+
+// encodeOptionalMeta is the inverse of decodeOptionalMeta. Only the fields
+// that are set are written.
+func (e *TableMapEvent) encodeOptionalMeta() []byte {
+	var buf []byte
+	appendField := func(t byte, v []byte) {
+		if v == nil {
+			return
+		}
+		buf = append(buf, t)
+		buf = append(buf, mysql.PutLengthEncodedString(v)...)
+	}
+	intSeq := func(seq []uint64) []byte {
+		if len(seq) == 0 {
+			return nil
+		}
+		var v []byte
+		for _, i := range seq {
+			v = mysql.AppendLengthEncodedInteger(v, i)
+		}
+		return v
+	}
+	strValue := func(values [][][]byte) []byte {
+		if len(values) == 0 {
+			return nil
+		}
+		var v []byte
+		for _, vals := range values {
+			v = mysql.AppendLengthEncodedInteger(v, uint64(len(vals)))
+			for _, val := range vals {
+				v = append(v, mysql.PutLengthEncodedString(val)...)
+			}
+		}
+		return v
+	}
+
+	appendField(TABLE_MAP_OPT_META_SIGNEDNESS, e.SignednessBitmap)
+	appendField(TABLE_MAP_OPT_META_DEFAULT_CHARSET, intSeq(e.DefaultCharset))
+	appendField(TABLE_MAP_OPT_META_COLUMN_CHARSET, intSeq(e.ColumnCharset))
+
+	if len(e.ColumnName) > 0 {
+		var v []byte
+		for _, name := range e.ColumnName {
+			v = append(v, byte(len(name)))
+			v = append(v, name...)
+		}
+		appendField(TABLE_MAP_OPT_META_COLUMN_NAME, v)
+	}
+
+	appendField(TABLE_MAP_OPT_META_SET_STR_VALUE, strValue(e.SetStrValue))
+	appendField(TABLE_MAP_OPT_META_ENUM_STR_VALUE, strValue(e.EnumStrValue))
+	appendField(TABLE_MAP_OPT_META_GEOMETRY_TYPE, intSeq(e.GeometryType))
+
+	if len(e.PrimaryKey) > 0 {
+		withPrefix := false
+		for _, prefix := range e.PrimaryKeyPrefix {
+			if prefix != 0 {
+				withPrefix = true
+				break
+			}
+		}
+
+		var v []byte
+		for i, col := range e.PrimaryKey {
+			v = mysql.AppendLengthEncodedInteger(v, col)
+			if withPrefix {
+				var prefix uint64
+				if i < len(e.PrimaryKeyPrefix) {
+					prefix = e.PrimaryKeyPrefix[i]
+				}
+				v = mysql.AppendLengthEncodedInteger(v, prefix)
+			}
+		}
+		if withPrefix {
+			appendField(TABLE_MAP_OPT_META_PRIMARY_KEY_WITH_PREFIX, v)
+		} else {
+			appendField(TABLE_MAP_OPT_META_SIMPLE_PRIMARY_KEY, v)
+		}
+	}
+
+	appendField(TABLE_MAP_OPT_META_ENUM_AND_SET_DEFAULT_CHARSET, intSeq(e.EnumSetDefaultCharset))
+	appendField(TABLE_MAP_OPT_META_ENUM_AND_SET_COLUMN_CHARSET, intSeq(e.EnumSetColumnCharset))
+	appendField(TABLE_MAP_OPT_META_COLUMN_VISIBILITY, e.VisibilityBitmap)
+
+	return buf
+}
+
+// Encode encodes the rows event body, the inverse of Decode. The Table field
+// must be set since the column types are needed to encode the values.
+// ColumnBitmap1 and ColumnBitmap2 default to the full row image. The rows
+// of an event decoded by DecodeLazily are decoded first.
+func (e *RowsEvent) Encode() ([]byte, error) {
+	if e.Table == nil {
+		return nil, errors.Trace(errMissingTableMapEvent)
+	}
+	if err := e.DecodeRows(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if e.compressed {
+		return nil, errors.Errorf("encoding %s is not supported", e.eventType)
+	}
+
+	columnCount := e.ColumnCount
+	if columnCount == 0 {
+		columnCount = e.Table.ColumnCount
+	}
+	if int(columnCount) > len(e.Table.ColumnType) {
+		return nil, errors.Errorf("rows event has %d columns but table map has %d", columnCount, len(e.Table.ColumnType))
+	}
+
+	tableIDSize := e.tableIDSize
+	if tableIDSize == 0 {
+		tableIDSize = 6
+	}
+
+	buf := appendFixedLengthInt(nil, e.TableID, tableIDSize)
+	buf = binary.LittleEndian.AppendUint16(buf, e.Flags)
+
+	if e.Version == 2 {
+		extra := e.encodeExtraData()
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(len(extra)+2))
+		buf = append(buf, extra...)
+	}
+
+	buf = mysql.AppendLengthEncodedInteger(buf, columnCount)
+
+	bitmap1 := e.ColumnBitmap1
+	if bitmap1 == nil {
+		bitmap1 = fullBitmap(int(columnCount))
+	}
+	buf = append(buf, bitmap1...)
+
+	bitmap2 := e.ColumnBitmap2
+	if e.needBitmap2 {
+		if bitmap2 == nil {
+			bitmap2 = fullBitmap(int(columnCount))
+		}
+		buf = append(buf, bitmap2...)
+	}
+
+	rowImageType := EnumRowImageTypeUpdateBI
+	switch e.Type() {
+	case EnumRowsEventTypeInsert:
+		rowImageType = EnumRowImageTypeWriteAI
+	case EnumRowsEventTypeDelete:
+		rowImageType = EnumRowImageTypeDeleteBI
+	}
+
+	if e.needBitmap2 && len(e.Rows)%2 != 0 {
+		return nil, errors.Errorf("update rows event needs before and after images, got %d rows", len(e.Rows))
+	}
+
+	var err error
+	for i := 0; i < len(e.Rows); i++ {
+		if buf, err = e.encodeImage(buf, e.Rows[i], bitmap1, int(columnCount), rowImageType); err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		if e.needBitmap2 {
+			i++
+			if buf, err = e.encodeImage(buf, e.Rows[i], bitmap2, int(columnCount), EnumRowImageTypeUpdateAI); err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+	}
+
+	return buf, nil
+}
+
+// encodeExtraData is the inverse of decodeExtraData. A partition id of 0 can
+// not be distinguished from an unset one, so it is not written.
+func (e *RowsEvent) encodeExtraData() []byte {
+	switch {
+	case len(e.NdbData) > 0:
+		buf := []byte{ENUM_EXTRA_ROW_INFO_TYPECODE_NDB, byte(len(e.NdbData) + 2), e.NdbFormat}
+		return append(buf, e.NdbData...)
+	case e.PartitionId != 0 || e.SourcePartitionId != 0:
+		buf := []byte{ENUM_EXTRA_ROW_INFO_TYPECODE_PARTITION}
+		buf = binary.LittleEndian.AppendUint16(buf, e.PartitionId)
+		if e.Type() == EnumRowsEventTypeUpdate {
+			buf = binary.LittleEndian.AppendUint16(buf, e.SourcePartitionId)
+		}
+		return buf
+	}
+	return nil
+}
+
+func (e *RowsEvent) encodeImage(buf []byte, row []any, bitmap []byte, columnCount int, rowImageType EnumRowImageType) ([]byte, error) {
+	if len(row) < columnCount {
+		return nil, errors.Errorf("expect %d columns in row but got %d", columnCount, len(row))
+	}
+
+	if e.eventType == PARTIAL_UPDATE_ROWS_EVENT && rowImageType == EnumRowImageTypeUpdateAI {
+		// binlog_row_value_options, partial JSON updates are never written
+		buf = mysql.AppendLengthEncodedInteger(buf, 0)
+	}
+
+	count := 0
+	for i := range columnCount {
+		if isBitSet(bitmap, i) {
+			count++
+		}
+	}
+
+	nullBitmapPos := len(buf)
+	buf = append(buf, make([]byte, bitmapByteSize(count))...)
+
+	unsignedMap := e.Table.UnsignedMap()
+	nullBitmapIndex := 0
+	for i := range columnCount {
+		if !isBitSet(bitmap, i) {
+			continue
+		}
+
+		if row[i] == nil {
+			buf[nullBitmapPos+nullBitmapIndex>>3] |= 1 << (uint(nullBitmapIndex) & 7)
+			nullBitmapIndex++
+			continue
+		}
+		nullBitmapIndex++
+
+		var meta uint16
+		if i < len(e.Table.ColumnMeta) {
+			meta = e.Table.ColumnMeta[i]
+		}
+
+		var err error
+		buf, err = e.encodeValue(buf, row[i], e.Table.ColumnType[i], meta, unsignedMap[i])
+		if err != nil {
+			return nil, errors.Annotatef(err, "column %d", i)
+		}
+	}
+
+	return buf, nil
+}
+
+// encodeValue is the inverse of decodeValue.
+// see mysql sql/field.cc Field::pack
+func (e *RowsEvent) encodeValue(buf []byte, v any, tp byte, meta uint16, isUnsigned bool) ([]byte, error) {
+	length := 0
+
+	if tp == mysql.MYSQL_TYPE_STRING {
+		tp, length = StringColumnType(meta)
+	}
+
+	switch tp {
+	case mysql.MYSQL_TYPE_NULL:
+		return buf, nil
+	case mysql.MYSQL_TYPE_TINY:
+		return appendIntValue(buf, v, 1)
+	case mysql.MYSQL_TYPE_SHORT:
+		return appendIntValue(buf, v, 2)
+	case mysql.MYSQL_TYPE_INT24:
+		return appendIntValue(buf, v, 3)
+	case mysql.MYSQL_TYPE_LONG:
+		return appendIntValue(buf, v, 4)
+	case mysql.MYSQL_TYPE_LONGLONG:
+		return appendIntValue(buf, v, 8)
+	case mysql.MYSQL_TYPE_NEWDECIMAL:
+		return appendDecimal(buf, v, int(meta>>8), int(meta&0xFF))
+	case mysql.MYSQL_TYPE_FLOAT:
+		f, err := toFloat64(v)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(f))), nil
+	case mysql.MYSQL_TYPE_DOUBLE:
+		f, err := toFloat64(v)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(f)), nil
+	case mysql.MYSQL_TYPE_BIT:
+		nbits := ((meta >> 8) * 8) + (meta & 0xFF)
+		u, err := toUint64(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendBFixedLengthInt(buf, u, int(nbits+7)/8), nil
+	case mysql.MYSQL_TYPE_TIMESTAMP:
+		sec, _, err := e.timestampValue(v)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint32(buf, uint32(sec)), nil
+	case mysql.MYSQL_TYPE_TIMESTAMP2:
+		sec, usec, err := e.timestampValue(v)
+		if err != nil {
+			return nil, err
+		}
+		buf = binary.BigEndian.AppendUint32(buf, uint32(sec))
+		return appendFrac(buf, usec, meta), nil
+	case mysql.MYSQL_TYPE_DATETIME:
+		dt, err := datetimeValue(v)
+		if err != nil {
+			return nil, err
+		}
+		d := uint64(dt.year*10000 + dt.month*100 + dt.day)
+		t := uint64(dt.hour*10000 + dt.minute*100 + dt.second)
+		return binary.LittleEndian.AppendUint64(buf, d*1000000+t), nil
+	case mysql.MYSQL_TYPE_DATETIME2:
+		dt, err := datetimeValue(v)
+		if err != nil {
+			return nil, err
+		}
+		ymd := int64((dt.year*13+dt.month)<<5 | dt.day)
+		hms := int64(dt.hour<<12 | dt.minute<<6 | dt.second)
+		intPart := ymd<<17 | hms
+		buf = appendBFixedLengthInt(buf, uint64(intPart+DATETIMEF_INT_OFS), 5)
+		return appendFrac(buf, dt.usec, meta), nil
+	case mysql.MYSQL_TYPE_TIME:
+		s, err := toString(v)
+		if err != nil {
+			return nil, err
+		}
+		neg, hour, minute, second, _, err := parseTimeString(s)
+		if err != nil {
+			return nil, err
+		}
+		i32 := int64(hour*10000 + minute*100 + second)
+		if neg {
+			i32 = -i32
+		}
+		return appendFixedLengthInt(buf, uint64(i32), 3), nil
+	case mysql.MYSQL_TYPE_TIME2:
+		s, err := toString(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendTime2(buf, s, meta)
+	case mysql.MYSQL_TYPE_DATE:
+		s, err := toString(v)
+		if err != nil {
+			return nil, err
+		}
+		var year, month, day int
+		if _, err = fmt.Sscanf(s, "%d-%d-%d", &year, &month, &day); err != nil {
+			return nil, errors.Annotatef(err, "invalid date %q", s)
+		}
+		return appendFixedLengthInt(buf, uint64(year*16*32+month*32+day), 3), nil
+	case mysql.MYSQL_TYPE_YEAR:
+		year, err := toInt64(v)
+		if err != nil {
+			return nil, err
+		}
+		if year != 0 {
+			year -= 1900
+		}
+		return append(buf, byte(year)), nil
+	case mysql.MYSQL_TYPE_ENUM:
+		l := meta & 0xFF
+		if l != 1 && l != 2 {
+			return nil, errors.Errorf("unknown ENUM packlen=%d", l)
+		}
+		return appendIntValue(buf, v, int(l))
+	case mysql.MYSQL_TYPE_SET:
+		return appendIntValue(buf, v, int(meta&0xFF))
+	case mysql.MYSQL_TYPE_BLOB,
+		mysql.MYSQL_TYPE_GEOMETRY,
+		mysql.MYSQL_TYPE_VECTOR:
+		b, err := toBytes(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendBlob(buf, b, int(meta))
+	case mysql.MYSQL_TYPE_VARCHAR,
+		mysql.MYSQL_TYPE_VAR_STRING:
+		b, err := toBytes(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendString(buf, b, int(meta)), nil
+	case mysql.MYSQL_TYPE_STRING:
+		b, err := toBytes(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendString(buf, b, length), nil
+	case mysql.MYSQL_TYPE_JSON:
+		if _, ok := v.(*JsonDiff); ok {
+			return nil, errors.New("encoding partial JSON updates is not supported")
+		}
+		b, err := toBytes(v)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) > 0 {
+			if b, err = encodeJSONBinary(b); err != nil {
+				return nil, err
+			}
+		}
+		return appendBlob(buf, b, int(meta))
+	default:
+		return nil, errors.Errorf("unsupport type %d in binlog and don't know how to handle", tp)
+	}
+}
+
+func appendIntValue(buf []byte, v any, n int) ([]byte, error) {
+	u, err := toUint64(v)
+	if err != nil {
+		return nil, err
+	}
+	return appendFixedLengthInt(buf, u, n), nil
+}
+
+func appendBlob(buf []byte, b []byte, meta int) ([]byte, error) {
+	if meta < 1 || meta > 4 {
+		return nil, errors.Errorf("invalid blob packlen = %d", meta)
+	}
+	if uint64(len(b)) >= uint64(1)<<(8*uint(meta)) {
+		return nil, errors.Errorf("blob length %d exceeds packlen %d", len(b), meta)
+	}
+	buf = appendFixedLengthInt(buf, uint64(len(b)), meta)
+	return append(buf, b...), nil
+}
+
+func appendString(buf []byte, b []byte, length int) []byte {
+	if length < 256 {
+		buf = append(buf, byte(len(b)))
+	} else {
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(len(b)))
+	}
+	return append(buf, b...)
+}
+
+// appendFrac appends the fractional seconds part of TIMESTAMP2/DATETIME2.
+func appendFrac(buf []byte, usec int, dec uint16) []byte {
+	switch dec {
+	case 1, 2:
+		return append(buf, byte(usec/10000))
+	case 3, 4:
+		return binary.BigEndian.AppendUint16(buf, uint16(usec/100))
+	case 5, 6:
+		return appendBFixedLengthInt(buf, uint64(usec), 3)
+	}
+	return buf
+}
+
+// appendTime2 is the inverse of decodeTime2.
+// see mysql-server/mysys/my_time.cc my_time_packed_to_binary
+func appendTime2(buf []byte, s string, dec uint16) ([]byte, error) {
+	neg, hour, minute, second, usec, err := parseTimeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	hms := int64(hour<<12 | minute<<6 | second)
+	packed := hms<<24 + int64(usec)
+	if neg {
+		packed = -packed
+	}
+
+	intPart := packed >> 24
+	frac := packed % (1 << 24)
+
+	switch dec {
+	case 1, 2:
+		buf = appendBFixedLengthInt(buf, uint64(intPart+TIMEF_INT_OFS), 3)
+		return append(buf, byte(int8(frac/10000))), nil
+	case 3, 4:
+		buf = appendBFixedLengthInt(buf, uint64(intPart+TIMEF_INT_OFS), 3)
+		return binary.BigEndian.AppendUint16(buf, uint16(int16(frac/100))), nil
+	case 5, 6:
+		return appendBFixedLengthInt(buf, uint64(packed+TIMEF_OFS), 6), nil
+	default:
+		return appendBFixedLengthInt(buf, uint64(intPart+TIMEF_INT_OFS), 3), nil
+	}
+}
+
+// parseTimeString parses a TIME value like "-838:59:59.000000".
+func parseTimeString(s string) (neg bool, hour, minute, second, usec int, err error) {
+	if strings.HasPrefix(s, "-") {
+		neg = true
+		s = s[1:]
+	}
+
+	hms, frac, _ := strings.Cut(s, ".")
+	if _, err = fmt.Sscanf(hms, "%d:%d:%d", &hour, &minute, &second); err != nil {
+		return false, 0, 0, 0, 0, errors.Annotatef(err, "invalid time %q", s)
+	}
+	if usec, err = parseMicroseconds(frac); err != nil {
+		return false, 0, 0, 0, 0, err
+	}
+	return neg, hour, minute, second, usec, nil
+}
+
+func parseMicroseconds(frac string) (int, error) {
+	if frac == "" {
+		return 0, nil
+	}
+	if len(frac) > 6 {
+		frac = frac[:6]
+	}
+	usec, err := strconv.Atoi(frac + strings.Repeat("0", 6-len(frac)))
+	if err != nil {
+		return 0, errors.Annotatef(err, "invalid fractional seconds %q", frac)
+	}
+	return usec, nil
+}
+
+type datetimeParts struct {
+	year, month, day, hour, minute, second, usec int
+}
+
+// datetimeValue accepts the values decodeValue produces for DATETIME columns.
+// Strings are parsed by hand since zero dates are not valid time.Time values.
+func datetimeValue(v any) (datetimeParts, error) {
+	var dt datetimeParts
+	if t, ok := v.(time.Time); ok {
+		return datetimeParts{
+			year: t.Year(), month: int(t.Month()), day: t.Day(),
+			hour: t.Hour(), minute: t.Minute(), second: t.Second(),
+			usec: t.Nanosecond() / 1000,
+		}, nil
+	}
+
+	s, err := toString(v)
+	if err != nil {
+		return dt, err
+	}
+
+	datetime, frac, _ := strings.Cut(s, ".")
+	if _, err = fmt.Sscanf(datetime, "%d-%d-%d %d:%d:%d",
+		&dt.year, &dt.month, &dt.day, &dt.hour, &dt.minute, &dt.second); err != nil {
+		return dt, errors.Annotatef(err, "invalid datetime %q", s)
+	}
+	dt.usec, err = parseMicroseconds(frac)
+	return dt, err
+}
+
+// timestampValue returns the unix seconds and microseconds of a TIMESTAMP
+// value. Strings are interpreted in the timestamp string location, like
+// decodeValue formats them.
+func (e *RowsEvent) timestampValue(v any) (int64, int, error) {
+	if t, ok := v.(time.Time); ok {
+		return t.Unix(), t.Nanosecond() / 1000, nil
+	}
+
+	s, err := toString(v)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if strings.HasPrefix(s, "0000-00-00") {
+		_, frac, _ := strings.Cut(s, ".")
+		usec, err := parseMicroseconds(frac)
+		return 0, usec, err
+	}
+
+	loc := e.timestampStringLocation
+	if loc == nil {
+		loc = time.Local
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04:05.999999", s, loc)
+	if err != nil {
+		return 0, 0, errors.Trace(err)
+	}
+	return t.Unix(), t.Nanosecond() / 1000, nil
+}
+
+// appendDecimal is the inverse of decodeDecimal.
+// see mysql-server/strings/decimal.cc decimal2bin
+func appendDecimal(buf []byte, v any, precision int, decimals int) ([]byte, error) {
+	var s string
+	switch t := v.(type) {
+	case decimal.Decimal:
+		s = t.StringFixed(int32(decimals))
+	case float32:
+		s = strconv.FormatFloat(float64(t), 'f', decimals, 32)
+	case float64:
+		s = strconv.FormatFloat(t, 'f', decimals, 64)
+	default:
+		var err error
+		if s, err = toString(v); err != nil {
+			return nil, err
+		}
+	}
+
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimLeft(s, "+-")
+	intDigits, fracDigits, _ := strings.Cut(s, ".")
+	intDigits = strings.TrimLeft(intDigits, "0")
+
+	integral := precision - decimals
+	if len(intDigits) > integral {
+		return nil, errors.Errorf("decimal %v overflows DECIMAL(%d,%d)", v, precision, decimals)
+	}
+	if len(fracDigits) > decimals {
+		fracDigits = fracDigits[:decimals]
+	}
+	intDigits = strings.Repeat("0", integral-len(intDigits)) + intDigits
+	fracDigits += strings.Repeat("0", decimals-len(fracDigits))
+
+	uncompIntegral := integral / digitsPerInteger
+	uncompFractional := decimals / digitsPerInteger
+	compIntegral := integral - (uncompIntegral * digitsPerInteger)
+	compFractional := decimals - (uncompFractional * digitsPerInteger)
+
+	var data []byte
+	appendDigits := func(digits string, size int) error {
+		if size == 0 {
+			return nil
+		}
+		value, err := strconv.ParseUint(digits, 10, 32)
+		if err != nil {
+			return errors.Annotatef(err, "invalid decimal %v", v)
+		}
+		data = appendBFixedLengthInt(data, value, size)
+		return nil
+	}
+
+	if err := appendDigits(intDigits[:compIntegral], compressedBytes[compIntegral]); err != nil {
+		return nil, err
+	}
+	for i := range uncompIntegral {
+		start := compIntegral + i*digitsPerInteger
+		if err := appendDigits(intDigits[start:start+digitsPerInteger], 4); err != nil {
+			return nil, err
+		}
+	}
+	for i := range uncompFractional {
+		start := i * digitsPerInteger
+		if err := appendDigits(fracDigits[start:start+digitsPerInteger], 4); err != nil {
+			return nil, err
+		}
+	}
+	if err := appendDigits(fracDigits[uncompFractional*digitsPerInteger:], compressedBytes[compFractional]); err != nil {
+		return nil, err
+	}
+
+	if neg {
+		for i := range data {
+			data[i] = ^data[i]
+		}
+	}
+	if len(data) > 0 {
+		data[0] ^= 0x80
+	}
+
+	return append(buf, data...), nil
+}
+
+func toUint64(v any) (uint64, error) {
+	switch t := v.(type) {
+	case int:
+		return uint64(t), nil
+	case int8:
+		return uint64(t), nil
+	case int16:
+		return uint64(t), nil
+	case int32:
+		return uint64(t), nil
+	case int64:
+		return uint64(t), nil
+	case uint:
+		return uint64(t), nil
+	case uint8:
+		return uint64(t), nil
+	case uint16:
+		return uint64(t), nil
+	case uint32:
+		return uint64(t), nil
+	case uint64:
+		return t, nil
+	case bool:
+		if t {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		if u, err := strconv.ParseUint(t, 10, 64); err == nil {
+			return u, nil
+		}
+		i, err := strconv.ParseInt(t, 10, 64)
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		return uint64(i), nil
+	default:
+		return 0, errors.Errorf("unsupported integer value type %T", v)
+	}
+}
+
+func toInt64(v any) (int64, error) {
+	u, err := toUint64(v)
+	return int64(u), err
+}
+
+func toFloat64(v any) (float64, error) {
+	switch t := v.(type) {
+	case float32:
+		return float64(t), nil
+	case float64:
+		return t, nil
+	case FloatWithTrailingZero:
+		return float64(t), nil
+	case string:
+		f, err := strconv.ParseFloat(t, 64)
+		return f, errors.Trace(err)
+	default:
+		i, err := toInt64(v)
+		if err != nil {
+			return 0, errors.Errorf("unsupported float value type %T", v)
+		}
+		return float64(i), nil
+	}
+}
+
+func toString(v any) (string, error) {
+	switch t := v.(type) {
+	case string:
+		return t, nil
+	case []byte:
+		return string(t), nil
+	case fmt.Stringer:
+		return t.String(), nil
+	default:
+		return "", errors.Errorf("unsupported string value type %T", v)
+	}
+}
+
+func toBytes(v any) ([]byte, error) {
+	switch t := v.(type) {
+	case []byte:
+		return t, nil
+	case string:
+		return []byte(t), nil
+	default:
+		return nil, errors.Errorf("unsupported bytes value type %T", v)
+	}
+}
@@ -0,0 +1,530 @@
+package replication
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// The offsets of the columns of a RowImage which have no value.
+const (
+	skippedColumnOffset = -1
+	nullColumnOffset    = -2
+)
+
+// RowImage is a row image of a RowsEvent decoded by DecodeLazily. Its column
+// values are decoded on access from the event data, which the byte slices it
+// returns refer to.
+type RowImage struct {
+	e         *RowsEvent
+	data      []byte
+	imageType EnumRowImageType
+	// offsets are the offsets of the values of the columns in data, or
+	// skippedColumnOffset and nullColumnOffset.
+	offsets []int
+	// partial are the JSON columns of a partial update.
+	partial []int
+}
+
+// RowIterator iterates over the row images of a RowsEvent decoded by
+// DecodeLazily, which alternate between the before and the after images for
+// an update like Rows.
+type RowIterator struct {
+	images []RowImage
+	i      int
+}
+
+// DecodeLazily decodes the header of the event and the boundaries of its row
+// images, to access them with RowIterator, instead of decoding every column
+// into Rows and SkippedColumns. It can be used as RowsEventDecodeFunc, see
+// BinlogSyncerConfig.
+func (e *RowsEvent) DecodeLazily(data []byte) error {
+	pos, err := e.DecodeHeader(data)
+	if err != nil {
+		return err
+	}
+	return e.decodeRowImages(pos, data)
+}
+
+func (e *RowsEvent) decodeRowImages(pos int, data []byte) (err2 error) {
+	if e.compressed {
+		data, err2 = mysql.DecompressMariadbData(data[pos:])
+		if err2 != nil {
+			return err2
+		}
+		pos = 0
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err2 = errors.Errorf("parse rows event panic %v, data %q, table map %#v", r, data, e.Table)
+		}
+	}()
+
+	e.Rows, e.SkippedColumns = nil, nil
+	e.lazy = true
+	e.images = e.images[:0]
+	e.unsignedMap = e.Table.UnsignedMap()
+
+	var rowImageType EnumRowImageType
+	switch e.Type() {
+	case EnumRowsEventTypeInsert:
+		rowImageType = EnumRowImageTypeWriteAI
+	case EnumRowsEventTypeDelete:
+		rowImageType = EnumRowImageTypeDeleteBI
+	default:
+		rowImageType = EnumRowImageTypeUpdateBI
+	}
+
+	// the offsets of all the images share one allocation
+	var offsets []int
+	for pos < len(data) {
+		n, err := e.decodeRowImage(data, pos, e.ColumnBitmap1, rowImageType, &offsets)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		pos += n
+
+		if e.needBitmap2 {
+			if n, err = e.decodeRowImage(data, pos, e.ColumnBitmap2, EnumRowImageTypeUpdateAI, &offsets); err != nil {
+				return errors.Trace(err)
+			}
+			pos += n
+		}
+	}
+	for i := range e.images {
+		start := i * int(e.ColumnCount)
+		e.images[i].offsets = offsets[start : start+int(e.ColumnCount) : start+int(e.ColumnCount)]
+	}
+	return nil
+}
+
+// decodeRowImage appends the offsets of the columns of the image at pos, like
+// decodeImage decodes them.
+func (e *RowsEvent) decodeRowImage(data []byte, pos int, bitmap []byte, rowImageType EnumRowImageType, offsets *[]int) (int, error) {
+	start := pos
+	image := RowImage{e: e, data: data, imageType: rowImageType}
+
+	var isPartialJSONUpdate bool
+	var partialBitmap []byte
+	if e.eventType == PARTIAL_UPDATE_ROWS_EVENT && rowImageType == EnumRowImageTypeUpdateAI {
+		binlogRowValueOptions, _, n := mysql.LengthEncodedInt(data[pos:])
+		pos += n
+		isPartialJSONUpdate = EnumBinlogRowValueOptions(binlogRowValueOptions)&EnumBinlogRowValueOptionsPartialJsonUpdates != 0
+		if isPartialJSONUpdate {
+			byteCount := bitmapByteSize(int(e.Table.JsonColumnCount()))
+			partialBitmap = data[pos : pos+byteCount]
+			pos += byteCount
+		}
+	}
+
+	count := 0
+	for i := 0; i < int(e.ColumnCount); i++ {
+		if isBitSet(bitmap, i) {
+			count++
+		}
+	}
+	nullBitmap := data[pos : pos+bitmapByteSize(count)]
+	pos += len(nullBitmap)
+
+	partialBitmapIndex := 0
+	nullBitmapIndex := 0
+	for i := 0; i < int(e.ColumnCount); i++ {
+		isPartial := isPartialJSONUpdate &&
+			e.Table.ColumnType[i] == mysql.MYSQL_TYPE_JSON &&
+			isBitSetIncr(partialBitmap, &partialBitmapIndex)
+
+		if !isBitSet(bitmap, i) {
+			*offsets = append(*offsets, skippedColumnOffset)
+			continue
+		}
+		if isBitSetIncr(nullBitmap, &nullBitmapIndex) {
+			*offsets = append(*offsets, nullColumnOffset)
+			continue
+		}
+
+		n, err := valueLength(data[pos:], e.Table.ColumnType[i], e.Table.ColumnMeta[i])
+		if err != nil {
+			return 0, errors.Annotatef(err, "column %d", i)
+		}
+		if isPartial {
+			image.partial = append(image.partial, i)
+		}
+		*offsets = append(*offsets, pos)
+		pos += n
+	}
+
+	e.images = append(e.images, image)
+	return pos - start, nil
+}
+
+// valueLength returns the length of the value of a column, like decodeValue
+// decodes it.
+func valueLength(data []byte, tp byte, meta uint16) (int, error) {
+	length := 0
+	if tp == mysql.MYSQL_TYPE_STRING {
+		tp, length = StringColumnType(meta)
+	}
+
+	switch tp {
+	case mysql.MYSQL_TYPE_NULL:
+		return 0, nil
+	case mysql.MYSQL_TYPE_TINY, mysql.MYSQL_TYPE_YEAR:
+		return 1, nil
+	case mysql.MYSQL_TYPE_SHORT:
+		return 2, nil
+	case mysql.MYSQL_TYPE_INT24, mysql.MYSQL_TYPE_TIME, mysql.MYSQL_TYPE_DATE:
+		return 3, nil
+	case mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_FLOAT, mysql.MYSQL_TYPE_TIMESTAMP:
+		return 4, nil
+	case mysql.MYSQL_TYPE_LONGLONG, mysql.MYSQL_TYPE_DOUBLE, mysql.MYSQL_TYPE_DATETIME:
+		return 8, nil
+	case mysql.MYSQL_TYPE_NEWDECIMAL:
+		return decimalBinarySize(int(meta>>8), int(meta&0xFF)), nil
+	case mysql.MYSQL_TYPE_BIT:
+		nbits := ((meta >> 8) * 8) + (meta & 0xFF)
+		return int(nbits+7) / 8, nil
+	case mysql.MYSQL_TYPE_TIMESTAMP2:
+		return int(4 + (meta+1)/2), nil
+	case mysql.MYSQL_TYPE_DATETIME2:
+		return int(5 + (meta+1)/2), nil
+	case mysql.MYSQL_TYPE_TIME2:
+		return int(3 + (meta+1)/2), nil
+	case mysql.MYSQL_TYPE_ENUM:
+		if l := meta & 0xFF; l == 1 || l == 2 {
+			return int(l), nil
+		}
+		return 0, errors.Errorf("unknown ENUM packlen=%d", meta&0xFF)
+	case mysql.MYSQL_TYPE_SET:
+		return int(meta & 0xFF), nil
+	case mysql.MYSQL_TYPE_BLOB, mysql.MYSQL_TYPE_GEOMETRY, mysql.MYSQL_TYPE_VECTOR, mysql.MYSQL_TYPE_JSON:
+		if meta < 1 || meta > 4 {
+			return 0, errors.Errorf("invalid blob packlen = %d", meta)
+		}
+		return int(meta) + int(mysql.FixedLengthInt(data[:meta])), nil
+	case mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_VAR_STRING:
+		return len(stringValue(data, int(meta))) + lengthSize(int(meta)), nil
+	case mysql.MYSQL_TYPE_STRING:
+		return len(stringValue(data, length)) + lengthSize(length), nil
+	default:
+		return 0, errors.Errorf("unsupport type %d in binlog and don't know how to handle", tp)
+	}
+}
+
+// decimalBinarySize returns the length of a NEWDECIMAL value, see
+// decodeDecimal.
+func decimalBinarySize(precision int, decimals int) int {
+	integral := precision - decimals
+	uncompIntegral := integral / digitsPerInteger
+	uncompFractional := decimals / digitsPerInteger
+	compIntegral := integral - (uncompIntegral * digitsPerInteger)
+	compFractional := decimals - (uncompFractional * digitsPerInteger)
+
+	return uncompIntegral*4 + compressedBytes[compIntegral] +
+		uncompFractional*4 + compressedBytes[compFractional]
+}
+
+// stringValue returns the bytes of a string value of a column of the maximum
+// length, see decodeString.
+func stringValue(data []byte, length int) []byte {
+	if length < 256 {
+		return data[1 : 1+int(data[0])]
+	}
+	return data[2 : 2+int(binary.LittleEndian.Uint16(data))]
+}
+
+func lengthSize(length int) int {
+	if length < 256 {
+		return 1
+	}
+	return 2
+}
+
+// Iterator returns an iterator over the row images of the event decoded by
+// DecodeLazily.
+func (e *RowsEvent) Iterator() *RowIterator {
+	return &RowIterator{images: e.images}
+}
+
+// Lazy reports whether the rows of the event are decoded by DecodeLazily.
+func (e *RowsEvent) Lazy() bool {
+	return e.lazy
+}
+
+// DecodeRows decodes the row images of the event decoded by DecodeLazily into
+// Rows and SkippedColumns, for the consumers of the decoded event.
+func (e *RowsEvent) DecodeRows() error {
+	if !e.Lazy() || e.Rows != nil {
+		return nil
+	}
+
+	rows := make([][]any, 0, len(e.images))
+	skippedColumns := make([][]int, 0, len(e.images))
+	for i := range e.images {
+		r := &e.images[i]
+		row := make([]any, len(r.offsets))
+		skips := make([]int, 0)
+		for j := range r.offsets {
+			if r.IsSkipped(j) {
+				skips = append(skips, j)
+				continue
+			}
+			v, err := r.Value(j)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			row[j] = v
+		}
+		rows = append(rows, row)
+		skippedColumns = append(skippedColumns, skips)
+	}
+	e.Rows, e.SkippedColumns = rows, skippedColumns
+	return nil
+}
+
+// Next advances the iterator to the next row image, and reports whether
+// there is one.
+func (it *RowIterator) Next() bool {
+	if it.i >= len(it.images) {
+		return false
+	}
+	it.i++
+	return true
+}
+
+// Row returns the current row image.
+func (it *RowIterator) Row() *RowImage {
+	return &it.images[it.i-1]
+}
+
+// Len returns the number of row images.
+func (it *RowIterator) Len() int {
+	return len(it.images)
+}
+
+// Type returns the type of the row image.
+func (r *RowImage) Type() EnumRowImageType {
+	return r.imageType
+}
+
+// ColumnCount returns the number of columns of the row image.
+func (r *RowImage) ColumnCount() int {
+	return len(r.offsets)
+}
+
+// IsSkipped reports whether the column is not in the image, like in
+// SkippedColumns.
+func (r *RowImage) IsSkipped(i int) bool {
+	return r.offsets[i] == skippedColumnOffset
+}
+
+// IsNull reports whether the value of the column is NULL.
+func (r *RowImage) IsNull(i int) bool {
+	return r.offsets[i] == nullColumnOffset
+}
+
+// column returns the data of the column from its value, its type and its
+// meta.
+func (r *RowImage) column(i int) ([]byte, byte, uint16, error) {
+	if i < 0 || i >= len(r.offsets) {
+		return nil, 0, 0, errors.Errorf("column %d out of range, the table has %d columns", i, len(r.offsets))
+	}
+	switch r.offsets[i] {
+	case skippedColumnOffset:
+		return nil, 0, 0, errors.Errorf("column %d is not in the row image", i)
+	case nullColumnOffset:
+		return nil, 0, 0, errors.Errorf("column %d is NULL", i)
+	}
+
+	tp, meta := r.e.Table.ColumnType[i], r.e.Table.ColumnMeta[i]
+	if tp == mysql.MYSQL_TYPE_STRING {
+		tp, _ = StringColumnType(meta)
+	}
+	return r.data[r.offsets[i]:], tp, meta, nil
+}
+
+// Value returns the value of the column like in Rows, nil if it is skipped.
+func (r *RowImage) Value(i int) (v any, err error) {
+	if i >= 0 && i < len(r.offsets) && (r.IsSkipped(i) || r.IsNull(i)) {
+		return nil, nil
+	}
+	data, _, _, err := r.column(i)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = errors.Errorf("decode column %d panic %v", i, rec)
+		}
+	}()
+	isPartial := false
+	for _, c := range r.partial {
+		isPartial = isPartial || c == i
+	}
+	v, _, err = r.e.decodeValue(data, r.e.Table.ColumnType[i], r.e.Table.ColumnMeta[i], isPartial, r.e.unsignedMap[i])
+	return v, err
+}
+
+// integer returns the value of an integer column, as the bits of an int64
+// when the column is signed.
+func (r *RowImage) integer(i int) (uint64, bool, error) {
+	data, tp, meta, err := r.column(i)
+	if err != nil {
+		return 0, false, err
+	}
+
+	unsigned := r.e.unsignedMap[i]
+	switch tp {
+	case mysql.MYSQL_TYPE_TINY:
+		if unsigned {
+			return uint64(mysql.ParseBinaryUint8(data)), true, nil
+		}
+		return uint64(int64(mysql.ParseBinaryInt8(data))), false, nil
+	case mysql.MYSQL_TYPE_SHORT:
+		if unsigned {
+			return uint64(mysql.ParseBinaryUint16(data)), true, nil
+		}
+		return uint64(int64(mysql.ParseBinaryInt16(data))), false, nil
+	case mysql.MYSQL_TYPE_INT24:
+		if unsigned {
+			return uint64(mysql.ParseBinaryUint24(data)), true, nil
+		}
+		return uint64(int64(mysql.ParseBinaryInt24(data))), false, nil
+	case mysql.MYSQL_TYPE_LONG:
+		if unsigned {
+			return uint64(mysql.ParseBinaryUint32(data)), true, nil
+		}
+		return uint64(int64(mysql.ParseBinaryInt32(data))), false, nil
+	case mysql.MYSQL_TYPE_LONGLONG:
+		return mysql.ParseBinaryUint64(data), unsigned, nil
+	case mysql.MYSQL_TYPE_YEAR:
+		if data[0] == 0 {
+			return 0, true, nil
+		}
+		return uint64(data[0]) + 1900, true, nil
+	case mysql.MYSQL_TYPE_ENUM, mysql.MYSQL_TYPE_SET, mysql.MYSQL_TYPE_BIT:
+		v, _, err := r.e.decodeValue(data, tp, meta, false, false)
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(v.(int64)), true, nil
+	default:
+		return 0, false, errors.Errorf("column %d of type %d is not an integer", i, tp)
+	}
+}
+
+// Int64 returns the value of an integer, YEAR, ENUM, SET or BIT column.
+func (r *RowImage) Int64(i int) (int64, error) {
+	v, unsigned, err := r.integer(i)
+	if err != nil {
+		return 0, err
+	}
+	if unsigned && v > math.MaxInt64 {
+		return 0, errors.Errorf("column %d value %d overflows int64", i, v)
+	}
+	return int64(v), nil
+}
+
+// Uint64 returns the value of an integer, YEAR, ENUM, SET or BIT column.
+func (r *RowImage) Uint64(i int) (uint64, error) {
+	v, unsigned, err := r.integer(i)
+	if err != nil {
+		return 0, err
+	}
+	if !unsigned && int64(v) < 0 {
+		return 0, errors.Errorf("column %d value %d is negative", i, int64(v))
+	}
+	return v, nil
+}
+
+// Bytes returns the value of a string, BLOB, GEOMETRY or VECTOR column, or the
+// MySQL binary value of a JSON column. It refers to the event data.
+func (r *RowImage) Bytes(i int) ([]byte, error) {
+	data, tp, meta, err := r.column(i)
+	if err != nil {
+		return nil, err
+	}
+
+	switch tp {
+	case mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_VAR_STRING:
+		return stringValue(data, int(meta)), nil
+	case mysql.MYSQL_TYPE_STRING:
+		_, length := StringColumnType(meta)
+		return stringValue(data, length), nil
+	case mysql.MYSQL_TYPE_BLOB, mysql.MYSQL_TYPE_GEOMETRY, mysql.MYSQL_TYPE_VECTOR, mysql.MYSQL_TYPE_JSON:
+		n, err := valueLength(data, tp, meta)
+		if err != nil {
+			return nil, err
+		}
+		return data[meta:n], nil
+	default:
+		return nil, errors.Errorf("column %d of type %d is not a string", i, tp)
+	}
+}
+
+// Time returns the value of a TIMESTAMP, DATETIME or DATE column. Like in
+// Rows, a TIMESTAMP is in the local time zone and a DATETIME or a DATE in
+// UTC. Zero dates are an error.
+func (r *RowImage) Time(i int) (time.Time, error) {
+	data, tp, meta, err := r.column(i)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var v any
+	switch tp {
+	case mysql.MYSQL_TYPE_TIMESTAMP:
+		if sec := binary.LittleEndian.Uint32(data); sec != 0 {
+			return time.Unix(int64(sec), 0), nil
+		}
+	case mysql.MYSQL_TYPE_TIMESTAMP2:
+		v, _, err = decodeTimestamp2(data, meta, nil)
+	case mysql.MYSQL_TYPE_DATETIME2:
+		v, _, err = decodeDatetime2(data, meta, true)
+	case mysql.MYSQL_TYPE_DATETIME:
+		i64 := binary.LittleEndian.Uint64(data)
+		d, t := i64/1000000, i64%1000000
+		month, day := int(d%10000)/100, int(d%100)
+		if month != 0 && day != 0 {
+			return time.Date(int(d/10000), time.Month(month), day, int(t/10000), int(t%10000)/100, int(t%100), 0, time.UTC), nil
+		}
+	case mysql.MYSQL_TYPE_DATE:
+		i32 := uint32(mysql.FixedLengthInt(data[0:3]))
+		month, day := int(i32/32%16), int(i32%32)
+		if month != 0 && day != 0 {
+			return time.Date(int(i32/(16*32)), time.Month(month), day, 0, 0, 0, 0, time.UTC), nil
+		}
+	default:
+		return time.Time{}, errors.Errorf("column %d of type %d is not a date or a time", i, tp)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	if t, ok := v.(fracTime); ok {
+		return t.Time, nil
+	}
+	return time.Time{}, errors.Errorf("column %d has the zero or invalid date %v", i, v)
+}
+
+// Decimal returns the value of a DECIMAL column.
+func (r *RowImage) Decimal(i int) (decimal.Decimal, error) {
+	data, tp, meta, err := r.column(i)
+	if err != nil {
+		return decimal.Decimal{}, err
+	}
+	if tp != mysql.MYSQL_TYPE_NEWDECIMAL {
+		return decimal.Decimal{}, errors.Errorf("column %d of type %d is not a decimal", i, tp)
+	}
+
+	v, _, err := decodeDecimal(data, int(meta>>8), int(meta&0xFF), true)
+	if err != nil {
+		return decimal.Decimal{}, err
+	}
+	return v.(decimal.Decimal), nil
+}
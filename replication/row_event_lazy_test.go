@@ -0,0 +1,177 @@
+package replication
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+func lazyTestTable() *TableMapEvent {
+	return &TableMapEvent{
+		TableID:     100,
+		Flags:       1,
+		Schema:      []byte("test"),
+		Table:       []byte("t"),
+		ColumnCount: 10,
+		ColumnType: []byte{
+			mysql.MYSQL_TYPE_LONGLONG, mysql.MYSQL_TYPE_SHORT, mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_BLOB,
+			mysql.MYSQL_TYPE_NEWDECIMAL, mysql.MYSQL_TYPE_DATETIME2, mysql.MYSQL_TYPE_TIMESTAMP2, mysql.MYSQL_TYPE_DATE,
+			mysql.MYSQL_TYPE_STRING, mysql.MYSQL_TYPE_JSON,
+		},
+		ColumnMeta: []uint16{
+			0, 0, 1024, 2,
+			10<<8 | 2, 6, 3, 0,
+			uint16(mysql.MYSQL_TYPE_ENUM)<<8 | 1, 4,
+		},
+		NullBitmap:       []byte{0xfe, 0x03},
+		SignednessBitmap: []byte{0x80},
+	}
+}
+
+func TestRowsEventDecodeLazily(t *testing.T) {
+	table := lazyTestTable()
+	rows := [][]any{
+		{
+			uint64(18446744073709551615), int16(-3), "hello", []byte{0x00, 0x01}, "-12.50",
+			"2024-02-29 13:14:15.123456", "2024-03-01 01:02:03.500", "2024-02-29", int64(2), `{"a":1}`,
+		},
+		{uint64(1), nil, nil, nil, nil, nil, nil, nil, nil, nil},
+	}
+
+	eager := newEncodeTestParser(t)
+	lazy := newEncodeTestParser(t)
+	lazy.SetRowsEventDecodeFunc((*RowsEvent).DecodeLazily)
+	for _, p := range []*BinlogParser{eager, lazy} {
+		encodeAndParse(t, p, TABLE_MAP_EVENT, table)
+	}
+
+	for _, eventType := range []EventType{WRITE_ROWS_EVENTv2, UPDATE_ROWS_EVENTv2} {
+		re := NewRowsEvent(eventType, table, rows)
+		expected := encodeAndParse(t, eager, eventType, re).Event.(*RowsEvent)
+		e := encodeAndParse(t, lazy, eventType, re).Event.(*RowsEvent)
+		require.True(t, e.Lazy())
+		require.Nil(t, e.Rows)
+
+		it := e.Iterator()
+		require.Equal(t, 2, it.Len())
+		require.True(t, it.Next())
+		r := it.Row()
+		if eventType == UPDATE_ROWS_EVENTv2 {
+			require.Equal(t, EnumRowImageTypeUpdateBI, r.Type())
+		}
+		require.Equal(t, 10, r.ColumnCount())
+
+		_, err := r.Int64(0)
+		require.Error(t, err)
+		u, err := r.Uint64(0)
+		require.NoError(t, err)
+		require.Equal(t, uint64(18446744073709551615), u)
+		i, err := r.Int64(1)
+		require.NoError(t, err)
+		require.Equal(t, int64(-3), i)
+		_, err = r.Uint64(1)
+		require.Error(t, err)
+		b, err := r.Bytes(2)
+		require.NoError(t, err)
+		require.Equal(t, []byte("hello"), b)
+		b, err = r.Bytes(3)
+		require.NoError(t, err)
+		require.Equal(t, []byte{0x00, 0x01}, b)
+		d, err := r.Decimal(4)
+		require.NoError(t, err)
+		require.Equal(t, "-12.5", d.String())
+		tm, err := r.Time(5)
+		require.NoError(t, err)
+		require.Equal(t, time.Date(2024, 2, 29, 13, 14, 15, 123456000, time.UTC), tm)
+		tm, err = r.Time(7)
+		require.NoError(t, err)
+		require.Equal(t, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), tm)
+		i, err = r.Int64(8)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), i)
+		_, err = r.Time(2)
+		require.Error(t, err)
+		_, err = r.Bytes(10)
+		require.Error(t, err)
+
+		require.True(t, it.Next())
+		r = it.Row()
+		require.True(t, r.IsNull(1))
+		_, err = r.Int64(1)
+		require.Error(t, err)
+		v, err := r.Value(1)
+		require.NoError(t, err)
+		require.Nil(t, v)
+		require.False(t, it.Next())
+
+		// the rows decoded from the row images are the eager ones
+		require.NoError(t, e.DecodeRows())
+		require.Equal(t, expected.Rows, e.Rows)
+		require.Equal(t, expected.SkippedColumns, e.SkippedColumns)
+	}
+}
+
+func TestRowsEventDecodeLazilyMinimalImage(t *testing.T) {
+	table := lazyTestTable()
+	p := newEncodeTestParser(t)
+	p.SetRowsEventDecodeFunc((*RowsEvent).DecodeLazily)
+	encodeAndParse(t, p, TABLE_MAP_EVENT, table)
+
+	re := NewRowsEvent(DELETE_ROWS_EVENTv2, table, [][]any{{uint64(7), nil, nil, nil, nil, nil, nil, nil, nil, nil}})
+	re.ColumnBitmap1 = []byte{0x01, 0x00}
+	re.SkippedColumns = [][]int{{1, 2, 3, 4, 5, 6, 7, 8, 9}}
+	e := encodeAndParse(t, p, DELETE_ROWS_EVENTv2, re).Event.(*RowsEvent)
+
+	it := e.Iterator()
+	require.True(t, it.Next())
+	r := it.Row()
+	require.Equal(t, EnumRowImageTypeDeleteBI, r.Type())
+	require.True(t, r.IsSkipped(4))
+	require.False(t, r.IsNull(4))
+	_, err := r.Decimal(4)
+	require.Error(t, err)
+	u, err := r.Uint64(0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(7), u)
+
+	require.NoError(t, e.DecodeRows())
+	require.Equal(t, [][]int{{1, 2, 3, 4, 5, 6, 7, 8, 9}}, e.SkippedColumns)
+}
+
+func TestRowsEventDecodeLazilyConsumers(t *testing.T) {
+	table := lazyTestTable()
+	rows := [][]any{{uint64(1), int16(2), "a", nil, nil, nil, nil, nil, nil, nil}}
+
+	eager := newEncodeTestParser(t)
+	lazy := newEncodeTestParser(t)
+	lazy.SetRowsEventDecodeFunc((*RowsEvent).DecodeLazily)
+	for _, p := range []*BinlogParser{eager, lazy} {
+		encodeAndParse(t, p, TABLE_MAP_EVENT, table)
+	}
+	re := NewRowsEvent(WRITE_ROWS_EVENTv2, table, rows)
+	expected := encodeAndParse(t, eager, WRITE_ROWS_EVENTv2, re).Event.(*RowsEvent)
+
+	// the lazily decoded rows are encoded when the event is relayed
+	e := encodeAndParse(t, lazy, WRITE_ROWS_EVENTv2, re).Event.(*RowsEvent)
+	require.True(t, e.Lazy())
+	expectedBody, err := expected.Encode()
+	require.NoError(t, err)
+	body, err := e.Encode()
+	require.NoError(t, err)
+	require.Equal(t, expectedBody, body)
+
+	// and rendered as SQL
+	r := &SQLRenderer{TableColumns: func(string, string) ([]string, error) {
+		return []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}, nil
+	}}
+	expectedStmts, err := r.Render(expected)
+	require.NoError(t, err)
+	e = encodeAndParse(t, lazy, WRITE_ROWS_EVENTv2, re).Event.(*RowsEvent)
+	stmts, err := r.Render(e)
+	require.NoError(t, err)
+	require.Len(t, stmts, 1)
+	require.Equal(t, expectedStmts, stmts)
+}
@@ -0,0 +1,402 @@
+package replication
+
+import (
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pingcap/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// SQLRenderer renders the rows of a RowsEvent as SQL statements, one per row,
+// like binlog2sql. The redo statements replay the rows: INSERT for the write
+// rows, UPDATE for the update rows and DELETE for the delete rows. The
+// flashback statements undo them: DELETE for the write rows, UPDATE back to
+// the before image for the update rows and INSERT for the delete rows, in the
+// reverse order of the rows. To undo several events, their flashback
+// statements must be run in the reverse order of the events too.
+//
+// The column names come from the table map event, which has them with
+// binlog_row_metadata=FULL, or else from TableColumns. The UPDATE and DELETE
+// statements find the row by its primary key when the table map event has
+// it, else by all the columns of the row image. Flashback needs the full row
+// images, binlog_row_image=FULL.
+//
+// The string values are escaped for the sql_mode without NO_BACKSLASH_ESCAPES,
+// and the binary ones are rendered as hexadecimal literals. The TIMESTAMP
+// values decoded as time.Time are rendered in TimestampLocation, UTC by
+// default, and the ones decoded as strings in the TimestampStringLocation of
+// the parser: the statements must be run with the session time_zone of this
+// location.
+type SQLRenderer struct {
+	// Flashback renders the statements which undo the rows instead of the
+	// ones which replay them.
+	Flashback bool
+
+	// TimestampLocation is the location of the TIMESTAMP values decoded as
+	// time.Time, UTC if nil.
+	TimestampLocation *time.Location
+
+	// TableColumns returns the column names of a table when its table map
+	// event does not have them.
+	TableColumns func(schema string, table string) ([]string, error)
+}
+
+// Render returns the statements of the rows of e, the rows of an event
+// decoded by DecodeLazily are decoded first.
+func (r *SQLRenderer) Render(e *RowsEvent) ([]string, error) {
+	if e.Table == nil {
+		return nil, errors.Trace(errMissingTableMapEvent)
+	}
+	if err := e.DecodeRows(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	columns, err := r.columns(e.Table)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(columns) != int(e.Table.ColumnCount) {
+		return nil, errors.Errorf("table %s has %d column names for %d columns",
+			quoteTable(e.Table), len(columns), e.Table.ColumnCount)
+	}
+
+	s := &rowsEventSQL{
+		r:         r,
+		e:         e,
+		columns:   columns,
+		collation: e.Table.CollationMap(),
+		unsigned:  e.Table.UnsignedMap(),
+		enums:     e.Table.EnumStrValueMap(),
+		sets:      e.Table.SetStrValueMap(),
+	}
+	if r.Flashback {
+		for _, skips := range e.SkippedColumns {
+			if len(skips) > 0 {
+				return nil, errors.Errorf("flashback of table %s needs the full row image", quoteTable(e.Table))
+			}
+		}
+	}
+
+	var stmts []string
+	switch e.Type() {
+	case EnumRowsEventTypeInsert, EnumRowsEventTypeDelete:
+		insert := (e.Type() == EnumRowsEventTypeInsert) != r.Flashback
+		for i := range e.Rows {
+			var stmt string
+			if insert {
+				stmt, err = s.insert(i)
+			} else {
+				stmt, err = s.delete(i)
+			}
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			stmts = append(stmts, stmt)
+		}
+	case EnumRowsEventTypeUpdate:
+		if len(e.Rows)%2 != 0 {
+			return nil, errors.Errorf("update rows event of table %s has %d row images", quoteTable(e.Table), len(e.Rows))
+		}
+		for i := 0; i < len(e.Rows); i += 2 {
+			before, after := i, i+1
+			if r.Flashback {
+				before, after = after, before
+			}
+			stmt, err := s.update(before, after)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			stmts = append(stmts, stmt)
+		}
+	default:
+		return nil, errors.Errorf("unsupported rows event type %s", e.eventType)
+	}
+
+	if r.Flashback {
+		slices.Reverse(stmts)
+	}
+	return stmts, nil
+}
+
+func (r *SQLRenderer) columns(table *TableMapEvent) ([]string, error) {
+	if columns := table.ColumnNameString(); len(columns) > 0 {
+		return columns, nil
+	}
+	if r.TableColumns == nil {
+		return nil, errors.Errorf("no column names for table %s, they need binlog_row_metadata=FULL", quoteTable(table))
+	}
+	columns, err := r.TableColumns(string(table.Schema), string(table.Table))
+	return columns, errors.Trace(err)
+}
+
+// rowsEventSQL renders the rows of an event.
+type rowsEventSQL struct {
+	r       *SQLRenderer
+	e       *RowsEvent
+	columns []string
+
+	collation map[int]uint64
+	unsigned  map[int]bool
+	enums     map[int][]string
+	sets      map[int][]string
+}
+
+func (s *rowsEventSQL) insert(row int) (string, error) {
+	var names, values []string
+	for i, v := range s.e.Rows[row] {
+		if s.skipped(row, i) {
+			continue
+		}
+		value, err := s.value(i, v)
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		names = append(names, quoteIdentifier(s.columns[i]))
+		values = append(values, value)
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s);", quoteTable(s.e.Table),
+		strings.Join(names, ", "), strings.Join(values, ", ")), nil
+}
+
+func (s *rowsEventSQL) delete(row int) (string, error) {
+	where, err := s.where(row)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return fmt.Sprintf("DELETE FROM %s WHERE %s LIMIT 1;", quoteTable(s.e.Table), where), nil
+}
+
+func (s *rowsEventSQL) update(before int, after int) (string, error) {
+	var set []string
+	for i, v := range s.e.Rows[after] {
+		if s.skipped(after, i) {
+			continue
+		}
+		name := quoteIdentifier(s.columns[i])
+		if diff, ok := v.(*JsonDiff); ok && !s.r.Flashback {
+			set = append(set, name+"="+jsonDiffSQL(name, diff))
+			continue
+		}
+		value, err := s.value(i, v)
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		set = append(set, name+"="+value)
+	}
+	where, err := s.where(before)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return fmt.Sprintf("UPDATE %s SET %s WHERE %s LIMIT 1;", quoteTable(s.e.Table),
+		strings.Join(set, ", "), where), nil
+}
+
+// where returns the condition matching the row by its primary key, or by all
+// its columns if the row image does not have the primary key.
+func (s *rowsEventSQL) where(row int) (string, error) {
+	keys := make([]int, 0, len(s.e.Table.PrimaryKey))
+	for _, key := range s.e.Table.PrimaryKey {
+		if int(key) >= len(s.columns) || s.skipped(row, int(key)) {
+			keys = nil
+			break
+		}
+		keys = append(keys, int(key))
+	}
+	if len(keys) == 0 {
+		for i := range s.e.Rows[row] {
+			if !s.skipped(row, i) {
+				keys = append(keys, i)
+			}
+		}
+	}
+
+	conds := make([]string, 0, len(keys))
+	for _, i := range keys {
+		v := s.e.Rows[row][i]
+		name := quoteIdentifier(s.columns[i])
+		if v == nil {
+			conds = append(conds, name+" IS NULL")
+			continue
+		}
+		value, err := s.value(i, v)
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		conds = append(conds, name+"="+value)
+	}
+	return strings.Join(conds, " AND "), nil
+}
+
+func (s *rowsEventSQL) skipped(row int, column int) bool {
+	return row < len(s.e.SkippedColumns) && slices.Contains(s.e.SkippedColumns[row], column)
+}
+
+// value returns the SQL literal of the value v of the column i.
+func (s *rowsEventSQL) value(i int, v any) (string, error) {
+	if v == nil {
+		return "NULL", nil
+	}
+	table := s.e.Table
+	tp := table.realType(i)
+	switch tp {
+	case mysql.MYSQL_TYPE_ENUM:
+		if idx, ok := v.(int64); ok && idx > 0 && int(idx) <= len(s.enums[i]) {
+			return quoteString(s.enums[i][idx-1]), nil
+		}
+	case mysql.MYSQL_TYPE_SET:
+		if bits, ok := v.(int64); ok && s.sets[i] != nil {
+			if value, ok := setValue(bits, s.sets[i]); ok {
+				return quoteString(value), nil
+			}
+		}
+	case mysql.MYSQL_TYPE_JSON:
+		switch v := v.(type) {
+		case string:
+			return jsonSQL(v), nil
+		case []byte:
+			return jsonSQL(string(v)), nil
+		}
+	}
+
+	if s.unsigned[i] {
+		// the rows of the events built by NewRowsEvent keep the signed Go
+		// types of the integers
+		switch u := v.(type) {
+		case int8:
+			v = uint8(u)
+		case int16:
+			v = uint16(u)
+		case int32:
+			if tp == mysql.MYSQL_TYPE_INT24 {
+				v = uint32(u) & 0xffffff
+			} else {
+				v = uint32(u)
+			}
+		case int64:
+			v = uint64(u)
+		}
+	}
+
+	switch v := v.(type) {
+	case int8:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int16:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case FloatWithTrailingZero:
+		return strconv.FormatFloat(float64(v), 'g', -1, 64), nil
+	case decimal.Decimal:
+		return v.String(), nil
+	case time.Time:
+		return quoteString(s.time(i, tp, v)), nil
+	case string:
+		if tp == mysql.MYSQL_TYPE_NEWDECIMAL || tp == mysql.MYSQL_TYPE_DECIMAL {
+			return v, nil
+		}
+		if s.collation[i] == binaryCollationID || !utf8.ValidString(v) {
+			return hexLiteral([]byte(v)), nil
+		}
+		return quoteString(v), nil
+	case *JsonDiff:
+		return "", errors.Errorf("flashback of table %s needs the full JSON values, not partial updates", quoteTable(table))
+	case []byte:
+		if table.IsCharacterColumn(i) && s.collation[i] != 0 && s.collation[i] != binaryCollationID && utf8.Valid(v) {
+			return quoteString(string(v)), nil
+		}
+		return hexLiteral(v), nil
+	default:
+		return "", errors.Errorf("unsupported value %T of column %s.%s", v, quoteTable(table), quoteIdentifier(s.columns[i]))
+	}
+}
+
+func (s *rowsEventSQL) time(i int, tp byte, t time.Time) string {
+	dec := 0
+	switch tp {
+	case mysql.MYSQL_TYPE_TIMESTAMP2, mysql.MYSQL_TYPE_DATETIME2:
+		dec = min(int(s.e.Table.ColumnMeta[i]), len(fracTimeFormat)-1)
+	}
+	if tp == mysql.MYSQL_TYPE_TIMESTAMP || tp == mysql.MYSQL_TYPE_TIMESTAMP2 {
+		loc := s.r.TimestampLocation
+		if loc == nil {
+			loc = time.UTC
+		}
+		t = t.In(loc)
+	}
+	return t.Format(fracTimeFormat[dec])
+}
+
+// binaryCollationID is the collation of the binary strings.
+const binaryCollationID = 63
+
+func setValue(bits int64, values []string) (string, bool) {
+	var members []string
+	for i, value := range values {
+		if bits&(1<<i) != 0 {
+			members = append(members, value)
+			bits &^= 1 << i
+		}
+	}
+	return strings.Join(members, ","), bits == 0
+}
+
+func jsonSQL(v string) string {
+	if v == "" {
+		// an empty document is read as the JSON null literal
+		v = "null"
+	}
+	return "CAST(" + quoteString(v) + " AS JSON)"
+}
+
+func jsonDiffSQL(column string, diff *JsonDiff) string {
+	switch diff.Op {
+	case JsonDiffOperationInsert:
+		return fmt.Sprintf("JSON_INSERT(%s, %s, %s)", column, quoteString(diff.Path), jsonSQL(diff.Value))
+	case JsonDiffOperationRemove:
+		return fmt.Sprintf("JSON_REMOVE(%s, %s)", column, quoteString(diff.Path))
+	default:
+		return fmt.Sprintf("JSON_REPLACE(%s, %s, %s)", column, quoteString(diff.Path), jsonSQL(diff.Value))
+	}
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func quoteTable(table *TableMapEvent) string {
+	return quoteIdentifier(string(table.Schema)) + "." + quoteIdentifier(string(table.Table))
+}
+
+func quoteString(s string) string {
+	return "'" + mysql.Escape(s) + "'"
+}
+
+func hexLiteral(b []byte) string {
+	if len(b) == 0 {
+		return "''"
+	}
+	return "X'" + hex.EncodeToString(b) + "'"
+}
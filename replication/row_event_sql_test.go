@@ -0,0 +1,180 @@
+package replication
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+func sqlTestTable() *TableMapEvent {
+	return &TableMapEvent{
+		Schema:      []byte("test"),
+		Table:       []byte("t`1"),
+		ColumnCount: 10,
+		ColumnType: []byte{
+			mysql.MYSQL_TYPE_LONGLONG,
+			mysql.MYSQL_TYPE_VARCHAR,
+			mysql.MYSQL_TYPE_BLOB,
+			mysql.MYSQL_TYPE_JSON,
+			mysql.MYSQL_TYPE_STRING,
+			mysql.MYSQL_TYPE_STRING,
+			mysql.MYSQL_TYPE_NEWDECIMAL,
+			mysql.MYSQL_TYPE_DATETIME2,
+			mysql.MYSQL_TYPE_TIMESTAMP2,
+			mysql.MYSQL_TYPE_BIT,
+		},
+		ColumnMeta: []uint16{0, 40, 2, 4, uint16(mysql.MYSQL_TYPE_SET)<<8 | 1, uint16(mysql.MYSQL_TYPE_ENUM)<<8 | 1, 10<<8 | 2, 3, 0, 1},
+		ColumnName: [][]byte{
+			[]byte("id"), []byte("name"), []byte("data"), []byte("doc"), []byte("flags"),
+			[]byte("color"), []byte("price"), []byte("created"), []byte("ts"), []byte("b"),
+		},
+		// utf8mb4 for name, binary for data
+		DefaultCharset: []uint64{255, 1, 63},
+		SetStrValue:    [][][]byte{{[]byte("a"), []byte("b"), []byte("c")}},
+		EnumStrValue:   [][][]byte{{[]byte("red"), []byte("green")}},
+		PrimaryKey:     []uint64{0},
+	}
+}
+
+func sqlTestRow(id int64, name string) []any {
+	return []any{
+		id, name, []byte{0, 0xff}, `{"k": "it's"}`, int64(5), int64(2),
+		decimal.RequireFromString("12.50"),
+		time.Date(2024, 5, 6, 7, 8, 9, 120000000, time.UTC),
+		time.Date(2024, 5, 6, 9, 8, 9, 0, time.FixedZone("CEST", 2*3600)),
+		int64(3),
+	}
+}
+
+func TestSQLRendererRedo(t *testing.T) {
+	table := sqlTestTable()
+	r := &SQLRenderer{}
+
+	stmts, err := r.Render(&RowsEvent{eventType: WRITE_ROWS_EVENTv2, Table: table, Rows: [][]any{sqlTestRow(1, "o'neil\n")}})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"INSERT INTO `test`.`t``1` (`id`, `name`, `data`, `doc`, `flags`, `color`, `price`, `created`, `ts`, `b`) " +
+			`VALUES (1, 'o\'neil\n', X'00ff', CAST('{\"k\": \"it\'s\"}' AS JSON), 'a,c', 'green', 12.5, ` +
+			"'2024-05-06 07:08:09.120', '2024-05-06 07:08:09', 3);",
+	}, stmts)
+
+	before := sqlTestRow(1, "a")
+	after := sqlTestRow(1, "b")
+	after[3] = &JsonDiff{Op: JsonDiffOperationReplace, Path: "$.k", Value: `"v"`}
+	stmts, err = r.Render(&RowsEvent{
+		eventType:      UPDATE_ROWS_EVENTv2,
+		Table:          table,
+		Rows:           [][]any{before, after},
+		SkippedColumns: [][]int{nil, {2, 4, 5, 6, 7, 8, 9}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"UPDATE `test`.`t``1` SET `id`=1, `name`='b', `doc`=JSON_REPLACE(`doc`, '$.k', CAST('\\\"v\\\"' AS JSON)) WHERE `id`=1 LIMIT 1;",
+	}, stmts)
+
+	// without a primary key the row is found by all its columns
+	table.PrimaryKey = nil
+	row := sqlTestRow(2, "c")
+	row[1], row[3] = nil, []byte{}
+	stmts, err = r.Render(&RowsEvent{eventType: DELETE_ROWS_EVENTv2, Table: table, Rows: [][]any{row}})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"DELETE FROM `test`.`t``1` WHERE `id`=2 AND `name` IS NULL AND `data`=X'00ff' AND `doc`=CAST('null' AS JSON) AND " +
+			"`flags`='a,c' AND `color`='green' AND `price`=12.5 AND `created`='2024-05-06 07:08:09.120' AND " +
+			"`ts`='2024-05-06 07:08:09' AND `b`=3 LIMIT 1;",
+	}, stmts)
+}
+
+func TestSQLRendererFlashback(t *testing.T) {
+	table := sqlTestTable()
+	table.ColumnName = nil
+	r := &SQLRenderer{Flashback: true, TimestampLocation: time.FixedZone("CEST", 2*3600)}
+
+	_, err := r.Render(&RowsEvent{eventType: DELETE_ROWS_EVENTv2, Table: table, Rows: [][]any{sqlTestRow(1, "a")}})
+	require.Error(t, err)
+
+	r.TableColumns = func(schema string, table string) ([]string, error) {
+		require.Equal(t, "test", schema)
+		require.Equal(t, "t`1", table)
+		return []string{"id", "name", "data", "doc", "flags", "color", "price", "created", "ts", "b"}, nil
+	}
+	stmts, err := r.Render(&RowsEvent{eventType: DELETE_ROWS_EVENTv2, Table: table, Rows: [][]any{sqlTestRow(1, "a"), sqlTestRow(2, "b")}})
+	require.NoError(t, err)
+	require.Len(t, stmts, 2)
+	require.Contains(t, stmts[0], "VALUES (2, 'b',")
+	require.Contains(t, stmts[0], "'2024-05-06 09:08:09', 3);")
+	require.Contains(t, stmts[1], "INSERT INTO `test`.`t``1` (`id`,")
+
+	stmts, err = r.Render(&RowsEvent{eventType: WRITE_ROWS_EVENTv2, Table: table, Rows: [][]any{sqlTestRow(1, "a")}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"DELETE FROM `test`.`t``1` WHERE `id`=1 LIMIT 1;"}, stmts)
+
+	table.ColumnCount, table.ColumnType, table.ColumnMeta, table.DefaultCharset = 2, table.ColumnType[:2], table.ColumnMeta[:2], nil
+	r.TableColumns = func(string, string) ([]string, error) {
+		return []string{"id", "name"}, nil
+	}
+	stmts, err = r.Render(&RowsEvent{
+		eventType: UPDATE_ROWS_EVENTv2,
+		Table:     table,
+		Rows:      [][]any{{int64(1), "a"}, {int64(2), "b"}, {int64(3), "c"}, {int64(3), "d"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"UPDATE `test`.`t``1` SET `id`=3, `name`='c' WHERE `id`=3 LIMIT 1;",
+		"UPDATE `test`.`t``1` SET `id`=1, `name`='a' WHERE `id`=2 LIMIT 1;",
+	}, stmts)
+
+	// the minimal row images can not be undone
+	_, err = r.Render(&RowsEvent{
+		eventType:      UPDATE_ROWS_EVENTv2,
+		Table:          table,
+		Rows:           [][]any{{int64(1), nil}, {nil, "b"}},
+		SkippedColumns: [][]int{{1}, {0}},
+	})
+	require.Error(t, err)
+}
+
+func TestSQLRendererUnsigned(t *testing.T) {
+	table := &TableMapEvent{
+		Schema:      []byte("test"),
+		Table:       []byte("u"),
+		ColumnCount: 5,
+		ColumnType: []byte{
+			mysql.MYSQL_TYPE_TINY,
+			mysql.MYSQL_TYPE_SHORT,
+			mysql.MYSQL_TYPE_INT24,
+			mysql.MYSQL_TYPE_LONG,
+			mysql.MYSQL_TYPE_LONGLONG,
+		},
+		ColumnMeta: make([]uint16, 5),
+		ColumnName: [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d"), []byte("e")},
+		// all unsigned but d
+		SignednessBitmap: []byte{0b11101000},
+	}
+	r := &SQLRenderer{}
+
+	stmts, err := r.Render(&RowsEvent{
+		eventType: WRITE_ROWS_EVENTv2,
+		Table:     table,
+		Rows:      [][]any{{int8(-1), int16(-1), int32(-1), int32(-1), int64(-1)}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"INSERT INTO `test`.`u` (`a`, `b`, `c`, `d`, `e`) VALUES (255, 65535, 16777215, -1, 18446744073709551615);",
+	}, stmts)
+
+	// the decoded rows already have the unsigned Go types
+	stmts, err = r.Render(&RowsEvent{
+		eventType: WRITE_ROWS_EVENTv2,
+		Table:     table,
+		Rows:      [][]any{{uint8(255), uint16(65535), uint32(16777215), int32(-1), uint64(18446744073709551615)}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"INSERT INTO `test`.`u` (`a`, `b`, `c`, `d`, `e`) VALUES (255, 65535, 16777215, -1, 18446744073709551615);",
+	}, stmts)
+}
@@ -0,0 +1,91 @@
+package replication
+
+import (
+	"bytes"
+)
+
+// IsBeginQuery reports whether the query of a query event begins a
+// multi-statement transaction.
+func IsBeginQuery(query []byte) bool {
+	return bytes.EqualFold(bytes.TrimSpace(query), []byte("BEGIN"))
+}
+
+// IsEndQuery reports whether the query of a query event ends a
+// multi-statement transaction.
+func IsEndQuery(query []byte) bool {
+	query = bytes.TrimSpace(query)
+	return bytes.EqualFold(query, []byte("COMMIT")) || bytes.EqualFold(query, []byte("ROLLBACK"))
+}
+
+// TransactionTracker follows the transaction boundaries of the events of a
+// binlog: a transaction begins with its GTID event, a BEGIN query or its first
+// event, and ends with its XID event, a COMMIT or ROLLBACK query, its XA
+// PREPARE event, or the query of a statement outside of a BEGIN like a DDL.
+type TransactionTracker struct {
+	inTrx bool
+	// multiStatement is set when the transaction ends with a COMMIT or
+	// ROLLBACK query.
+	multiStatement bool
+}
+
+// Update follows the transactions with e, and reports whether e begins or
+// ends a transaction. A standalone statement both begins and ends one.
+func (t *TransactionTracker) Update(e *BinlogEvent) (begin bool, end bool) {
+	begin = !t.inTrx && transactionEvent(e)
+	switch ev := e.Event.(type) {
+	case *GTIDEvent, *GtidTaggedLogEvent:
+		t.inTrx, t.multiStatement = true, false
+		return true, false
+	case *MariadbGTIDEvent:
+		t.inTrx, t.multiStatement = true, !ev.IsStandalone()
+		return true, false
+	case *QueryEvent:
+		switch {
+		case IsBeginQuery(ev.Query):
+			t.inTrx, t.multiStatement = true, true
+			return begin, false
+		case IsEndQuery(ev.Query):
+			t.Reset()
+			return begin, true
+		case t.inTrx && t.multiStatement:
+			return false, false
+		}
+		// a statement which commits on its own, like a DDL
+		t.Reset()
+		return begin, true
+	case *XIDEvent, *TransactionPayloadEvent:
+		t.Reset()
+		return begin, true
+	}
+	if e.Header.EventType == XA_PREPARE_LOG_EVENT {
+		t.Reset()
+		return begin, true
+	}
+	if begin {
+		t.inTrx = true
+	}
+	return begin, false
+}
+
+// InTransaction reports whether the events followed are within a
+// transaction.
+func (t *TransactionTracker) InTransaction() bool {
+	return t.inTrx
+}
+
+// Reset forgets the transaction followed, when the events restart at a
+// transaction boundary.
+func (t *TransactionTracker) Reset() {
+	t.inTrx, t.multiStatement = false, false
+}
+
+// transactionEvent reports whether e is an event of a transaction, unlike
+// the rotate, format description or heartbeat events between them.
+func transactionEvent(e *BinlogEvent) bool {
+	switch e.Event.(type) {
+	case *GTIDEvent, *GtidTaggedLogEvent, *MariadbGTIDEvent, *QueryEvent, *XIDEvent, *TransactionPayloadEvent,
+		*TableMapEvent, *RowsEvent, *RowsQueryEvent, *IntVarEvent, *MariadbAnnotateRowsEvent:
+		return true
+	}
+	return e.Header.EventType == XA_PREPARE_LOG_EVENT
+}
@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"io"
 
-	"github.com/go-mysql-org/go-mysql/mysql"
 	"github.com/klauspost/compress/zstd"
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
 )
 
 // On The Wire: Field Types
@@ -37,12 +39,62 @@ type TransactionPayloadEvent struct {
 	// that compressed and uncompressed rows decode identically. nil when
 	// the event is constructed outside of BinlogParser, in which case
 	// decodePayload falls back to default parser options.
-	parent           *BinlogParser
+	parent *BinlogParser
+	// lazy defers the decoding of the payload to DecodeEvents, see
+	// BinlogParser.SetLazyPayloadDecode, undecoded is set until then.
+	lazy      bool
+	undecoded bool
+	header    *EventHeader
+	gset      mysql.GTIDSet
+
 	Size             uint64
 	UncompressedSize uint64
 	CompressionType  uint64
 	Payload          []byte
-	Events           []*BinlogEvent
+	// Events are the events of the transaction in the payload. They are nil
+	// until DecodeEvents is called when the payload is decoded lazily.
+	Events []*BinlogEvent
+}
+
+// NewTransactionPayloadEvent returns the TransactionPayloadEvent holding the
+// events of a transaction, from its first event to its XID or COMMIT event,
+// compressed with compressionType, ZSTD or NONE. Like MySQL does, the events
+// are encoded without checksum and with a zero LogPos, so their Event must
+// be an EncodableEvent.
+func NewTransactionPayloadEvent(events []*BinlogEvent, compressionType uint64) (*TransactionPayloadEvent, error) {
+	var data []byte
+	for _, ev := range events {
+		h := *ev.Header
+		h.LogPos = 0
+		raw, err := EncodeEvent(&h, ev.Event, BINLOG_CHECKSUM_ALG_OFF)
+		if err != nil {
+			return nil, errors.Annotatef(err, "encode %s of the payload", h.EventType)
+		}
+		data = append(data, raw...)
+	}
+
+	e := &TransactionPayloadEvent{
+		UncompressedSize: uint64(len(data)),
+		CompressionType:  compressionType,
+		Events:           events,
+	}
+	switch compressionType {
+	case ZSTD:
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		e.Payload = encoder.EncodeAll(data, nil)
+		if err = encoder.Close(); err != nil {
+			return nil, errors.Trace(err)
+		}
+	case NONE:
+		e.Payload = data
+	default:
+		return nil, errors.Errorf("unsupported payload compression type %d", compressionType)
+	}
+	e.Size = uint64(len(e.Payload))
+	return e, nil
 }
 
 func (e *TransactionPayloadEvent) compressionType() string {
@@ -62,7 +114,11 @@ func (e *TransactionPayloadEvent) Dump(w io.Writer) {
 	fmt.Fprintf(w, "Payload CompressionType: %s\n", e.compressionType())
 	fmt.Fprintf(w, "Payload Body: \n%s", hex.Dump(e.Payload))
 	fmt.Fprintln(w, "=== Start of events decoded from compressed payload ===")
-	for _, event := range e.Events {
+	events, err := e.DecodeEvents()
+	if err != nil {
+		fmt.Fprintf(w, "Payload decode error: %v\n", err)
+	}
+	for _, event := range events {
 		event.Dump(w)
 	}
 	fmt.Fprintln(w, "=== End of events decoded from compressed payload ===")
@@ -74,33 +130,134 @@ func (e *TransactionPayloadEvent) Decode(data []byte) error {
 	if err != nil {
 		return err
 	}
+	if e.lazy {
+		e.undecoded = true
+		return nil
+	}
 	return e.decodePayload()
 }
 
+// Encode implements EncodableEvent, with the fields in the order MySQL
+// writes them.
+func (e *TransactionPayloadEvent) Encode() ([]byte, error) {
+	var data []byte
+	appendField := func(fieldType, value uint64) {
+		data = mysql.AppendLengthEncodedInteger(data, fieldType)
+		data = mysql.AppendLengthEncodedInteger(data, uint64(len(mysql.PutLengthEncodedInt(value))))
+		data = mysql.AppendLengthEncodedInteger(data, value)
+	}
+	appendField(OTW_PAYLOAD_SIZE_FIELD, uint64(len(e.Payload)))
+	appendField(OTW_PAYLOAD_COMPRESSION_TYPE_FIELD, e.CompressionType)
+	if e.CompressionType != NONE {
+		appendField(OTW_PAYLOAD_UNCOMPRESSED_SIZE_FIELD, e.UncompressedSize)
+	}
+	data = append(data, OTW_PAYLOAD_HEADER_END_MARK)
+	return append(data, e.Payload...), nil
+}
+
+// DecodeEvents returns the events of the payload, decoding them on the first
+// call when the payload is decoded lazily.
+func (e *TransactionPayloadEvent) DecodeEvents() ([]*BinlogEvent, error) {
+	if !e.undecoded {
+		return e.Events, nil
+	}
+	if err := e.decodePayload(); err != nil {
+		return nil, err
+	}
+	if e.header != nil {
+		e.stampInnerEventPositions(e.header)
+	}
+	e.stampGSet()
+	return e.Events, nil
+}
+
+// UncompressedPayload returns the payload, decompressed for ZSTD.
+func (e *TransactionPayloadEvent) UncompressedPayload() ([]byte, error) {
+	switch e.CompressionType {
+	case ZSTD:
+		decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(e.concurrency))
+		if err != nil {
+			return nil, err
+		}
+		defer decoder.Close()
+		return decoder.DecodeAll(e.Payload, nil)
+	case NONE:
+		return e.Payload, nil
+	default:
+		return nil, fmt.Errorf("TransactionPayloadEvent has compression type %d (%s)",
+			e.CompressionType, e.compressionType())
+	}
+}
+
+// setGSet attaches gset to the XID and Query events of the payload, like to
+// the ones of an uncompressed transaction, when they are decoded.
+func (e *TransactionPayloadEvent) setGSet(gset mysql.GTIDSet) {
+	e.gset = gset
+	if !e.undecoded {
+		e.stampGSet()
+	}
+}
+
+func (e *TransactionPayloadEvent) stampGSet() {
+	if e.gset == nil {
+		return
+	}
+	for _, inner := range e.Events {
+		switch innerEvent := inner.Event.(type) {
+		case *XIDEvent:
+			innerEvent.GSet = e.gset.Clone()
+		case *QueryEvent:
+			innerEvent.GSet = e.gset.Clone()
+		}
+	}
+}
+
 func (e *TransactionPayloadEvent) decodeFields(data []byte) error {
-	offset := uint64(0)
+	// the field types, lengths and values are length encoded integers
+	offset := 0
+	next := func() (uint64, error) {
+		if offset >= len(data) {
+			return 0, io.ErrUnexpectedEOF
+		}
+		v, _, n := mysql.LengthEncodedInt(data[offset:])
+		if offset+n > len(data) {
+			return 0, io.ErrUnexpectedEOF
+		}
+		offset += n
+		return v, nil
+	}
 
 	for {
-		fieldType := mysql.FixedLengthInt(data[offset : offset+1])
-		offset++
-
+		fieldType, err := next()
+		if err != nil {
+			return errors.Annotate(err, "decode the payload header")
+		}
 		if fieldType == OTW_PAYLOAD_HEADER_END_MARK {
 			e.Payload = data[offset:]
 			break
 		}
-		fieldLength := mysql.FixedLengthInt(data[offset : offset+1])
-		offset++
+		fieldLength, err := next()
+		if err != nil {
+			return errors.Annotate(err, "decode the payload header")
+		}
+		if uint64(len(data)-offset) < fieldLength {
+			return errors.Annotate(io.ErrUnexpectedEOF, "decode the payload header")
+		}
+		end := offset + int(fieldLength)
 
 		switch fieldType {
 		case OTW_PAYLOAD_SIZE_FIELD:
-			e.Size = mysql.FixedLengthInt(data[offset : offset+fieldLength])
+			e.Size, err = next()
 		case OTW_PAYLOAD_COMPRESSION_TYPE_FIELD:
-			e.CompressionType = mysql.FixedLengthInt(data[offset : offset+fieldLength])
+			e.CompressionType, err = next()
 		case OTW_PAYLOAD_UNCOMPRESSED_SIZE_FIELD:
-			e.UncompressedSize = mysql.FixedLengthInt(data[offset : offset+fieldLength])
+			e.UncompressedSize, err = next()
+		}
+		if err != nil {
+			return errors.Annotate(err, "decode the payload header")
 		}
 
-		offset += fieldLength
+		offset = end
 	}
 
 	return nil
@@ -124,21 +281,11 @@ func (e *TransactionPayloadEvent) stampInnerEventPositions(h *EventHeader) {
 }
 
 func (e *TransactionPayloadEvent) decodePayload() error {
-	if e.CompressionType != ZSTD {
-		return fmt.Errorf("TransactionPayloadEvent has compression type %d (%s)",
-			e.CompressionType, e.compressionType())
-	}
-
-	decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(e.concurrency))
-	if err != nil {
-		return err
-	}
-	defer decoder.Close()
-
-	payloadUncompressed, err := decoder.DecodeAll(e.Payload, nil)
+	payloadUncompressed, err := e.UncompressedPayload()
 	if err != nil {
 		return err
 	}
+	e.Events = nil
 
 	// The uncompressed data needs to be split up into individual events for Parse()
 	// to work on them. We can't use the parent parser directly as we need to disable
@@ -183,6 +330,7 @@ func (e *TransactionPayloadEvent) decodePayload() error {
 
 		offset += eventLength
 	}
+	e.undecoded = false
 
 	return nil
 }
@@ -5,6 +5,8 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
 )
 
 // TestBinlogParserCloneForPayloadDecode verifies that the inner parser
@@ -28,6 +30,7 @@ func TestBinlogParserCloneForPayloadDecode(t *testing.T) {
 	outer.SetIgnoreJSONDecodeError(true)
 	outer.SetVerifyChecksum(true) // intentionally not propagated
 	outer.SetPayloadDecoderConcurrency(7)
+	outer.SetLazyPayloadDecode(true)
 
 	inner := outer.cloneForPayloadDecode()
 
@@ -40,6 +43,7 @@ func TestBinlogParserCloneForPayloadDecode(t *testing.T) {
 	require.True(t, inner.renderJSONAsMySQLText)
 	require.True(t, inner.ignoreJSONDecodeErr)
 	require.Equal(t, 7, inner.payloadDecoderConcurrency)
+	require.True(t, inner.lazyPayloadDecode)
 	// Checksum verification must be off: nested events do not carry
 	// their own checksum trailers.
 	require.False(t, inner.verifyChecksum)
@@ -185,3 +189,83 @@ func TestTransactionPayloadEventStampInnerEventPositions(t *testing.T) {
 	// no events, must not panic
 	mk().stampInnerEventPositions(&EventHeader{LogPos: 5000, EventSize: 1200})
 }
+
+func payloadTestEvents() []*BinlogEvent {
+	return []*BinlogEvent{
+		{Header: &EventHeader{Timestamp: 1700000000, EventType: QUERY_EVENT, ServerID: 1}, Event: &QueryEvent{
+			StatusVars: []byte{}, Schema: []byte("test"), Query: []byte("BEGIN"),
+		}},
+		{Header: &EventHeader{Timestamp: 1700000000, EventType: ROWS_QUERY_EVENT, ServerID: 1}, Event: &RowsQueryEvent{
+			Query: []byte("insert into t values (1)"),
+		}},
+		{Header: &EventHeader{Timestamp: 1700000000, EventType: XID_EVENT, ServerID: 1}, Event: &XIDEvent{XID: 42}},
+	}
+}
+
+func TestTransactionPayloadEventEncode(t *testing.T) {
+	for _, compressionType := range []uint64{ZSTD, NONE} {
+		p := newEncodeTestParser(t)
+
+		tpe, err := NewTransactionPayloadEvent(payloadTestEvents(), compressionType)
+		require.NoError(t, err)
+		require.Equal(t, uint64(len(tpe.Payload)), tpe.Size)
+		be := encodeAndParse(t, p, TRANSACTION_PAYLOAD_EVENT, tpe)
+
+		e := be.Event.(*TransactionPayloadEvent)
+		require.Equal(t, compressionType, e.CompressionType)
+		require.Equal(t, tpe.Size, e.Size)
+		require.Equal(t, tpe.Payload, e.Payload)
+		if compressionType == ZSTD {
+			require.Equal(t, tpe.UncompressedSize, e.UncompressedSize)
+		}
+		require.Len(t, e.Events, 3)
+		for i, inner := range payloadTestEvents() {
+			require.Equal(t, inner.Event, e.Events[i].Event)
+			require.Equal(t, inner.Header.EventType, e.Events[i].Header.EventType)
+		}
+		// the positions are stamped from the outer event
+		require.Equal(t, uint32(1234)-be.Header.EventSize, e.Events[0].Header.LogPos)
+		require.Equal(t, uint32(1234), e.Events[2].Header.LogPos)
+	}
+
+	_, err := NewTransactionPayloadEvent(payloadTestEvents(), 1)
+	require.Error(t, err)
+	_, err = NewTransactionPayloadEvent([]*BinlogEvent{{Header: &EventHeader{EventType: EXECUTE_LOAD_QUERY_EVENT}, Event: &ExecuteLoadQueryEvent{}}}, ZSTD)
+	require.Error(t, err)
+}
+
+func TestTransactionPayloadEventLazyDecode(t *testing.T) {
+	p := newEncodeTestParser(t)
+	p.SetLazyPayloadDecode(true)
+
+	tpe, err := NewTransactionPayloadEvent(payloadTestEvents(), ZSTD)
+	require.NoError(t, err)
+	// sizes over 250 are length encoded on more than a byte
+	tpe.UncompressedSize = 100000
+	be := encodeAndParse(t, p, TRANSACTION_PAYLOAD_EVENT, tpe)
+
+	e := be.Event.(*TransactionPayloadEvent)
+	require.Equal(t, uint64(100000), e.UncompressedSize)
+	require.Nil(t, e.Events)
+
+	gset, err := mysql.ParseMysqlGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5")
+	require.NoError(t, err)
+	e.setGSet(gset)
+	require.Nil(t, e.Events)
+
+	events, err := e.DecodeEvents()
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	require.Equal(t, gset.String(), events[0].Event.(*QueryEvent).GSet.String())
+	require.Equal(t, gset.String(), events[2].Event.(*XIDEvent).GSet.String())
+	require.Equal(t, uint32(1234), events[2].Header.LogPos)
+
+	again, err := e.DecodeEvents()
+	require.NoError(t, err)
+	require.Equal(t, events, again)
+
+	// an unknown compression type fails on the decode of the events only
+	e.CompressionType, e.undecoded = 1, true
+	_, err = e.DecodeEvents()
+	require.Error(t, err)
+}
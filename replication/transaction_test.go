@@ -0,0 +1,46 @@
+package replication
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestTransactionTracker verifies the events which begin and end the
+// transactions.
+func TestTransactionTracker(t *testing.T) {
+	query := func(q string) *BinlogEvent {
+		return &BinlogEvent{Header: &EventHeader{EventType: QUERY_EVENT}, Event: &QueryEvent{Query: []byte(q)}}
+	}
+	events := []*BinlogEvent{
+		{Header: &EventHeader{EventType: GTID_EVENT}, Event: &GTIDEvent{}},
+		query("BEGIN"),
+		{Header: &EventHeader{EventType: WRITE_ROWS_EVENTv2}, Event: &RowsEvent{}},
+		{Header: &EventHeader{EventType: XID_EVENT}, Event: &XIDEvent{}},
+		{Header: &EventHeader{EventType: GTID_EVENT}, Event: &GTIDEvent{}},
+		query("CREATE TABLE t (id int)"),
+		query("BEGIN"),
+		query("INSERT INTO t VALUES (1)"),
+		query(" rollback "),
+		{Header: &EventHeader{EventType: ROTATE_EVENT}, Event: &RotateEvent{}},
+		query("DROP TABLE t"),
+		{Header: &EventHeader{EventType: MARIADB_GTID_EVENT}, Event: &MariadbGTIDEvent{}},
+		query("INSERT INTO t VALUES (2)"),
+		{Header: &EventHeader{EventType: XID_EVENT}, Event: &XIDEvent{}},
+	}
+	want := [][2]bool{
+		{true, false}, {false, false}, {false, false}, {false, true},
+		{true, false}, {false, true},
+		{true, false}, {false, false}, {false, true},
+		{false, false},
+		{true, true},
+		{true, false}, {false, false}, {false, true},
+	}
+
+	var trx TransactionTracker
+	for i, e := range events {
+		begin, end := trx.Update(e)
+		require.Equal(t, want[i], [2]bool{begin, end}, "event %d", i)
+	}
+	require.False(t, trx.InTransaction())
+}
@@ -54,6 +54,7 @@ type TableColumn struct {
 	IsStored       bool
 	IsDefaultExpr  bool
 	IsAutoUpdating bool
+	IsInvisible    bool
 	EnumValues     []string
 	SetValues      []string
 	FixedSize      uint
@@ -164,6 +165,9 @@ func (ta *Table) AddColumn(name string, columnType string, collation string, ext
 	if strings.Contains(extra, "DEFAULT_GENERATED") {
 		ta.Columns[index].IsDefaultExpr = true
 	}
+	if strings.Contains(extra, "INVISIBLE") {
+		ta.Columns[index].IsInvisible = true
+	}
 	if ta.Columns[index].Type == TYPE_DATETIME ||
 		ta.Columns[index].Type == TYPE_TIMESTAMP {
 		if strings.Contains(extra, "on update CURRENT_TIMESTAMP") {
@@ -0,0 +1,671 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/google/uuid"
+	"github.com/pingcap/errors"
+)
+
+// binlogFileNameRegexp matches binlog file names like mysql-bin.000001,
+// which excludes the index file.
+var binlogFileNameRegexp = regexp.MustCompile(`^.+\.[0-9]+$`)
+
+var _ SemiSyncReplicationHandler = &BinlogFileHandler{}
+
+// BinlogFileHandlerConfig configures a BinlogFileHandler.
+type BinlogFileHandlerConfig struct {
+	// Dir is the directory holding the binlog files, for example the one
+	// written by BinlogSyncer.StartBackup or a replication.BinlogWriter.
+	Dir string
+
+	// ServerID is used for the artificial rotate and heartbeat events, it
+	// should differ from the server ids of the replicas.
+	ServerID uint32
+
+	// HeartbeatPeriod is used when the replica does not set
+	// @master_heartbeat_period itself, no heartbeats are sent if both are zero.
+	HeartbeatPeriod time.Duration
+
+	// PollInterval is how often the last file is checked for appended
+	// events, 100ms by default.
+	PollInterval time.Duration
+
+	// SemiSync makes the handler report rpl_semi_sync_master_enabled as ON,
+	// so replicas can enable semi-sync replication.
+	SemiSync bool
+
+	// OnSemiSyncACK is called with the positions acknowledged by semi-sync replicas.
+	OnSemiSyncACK func(pos mysql.Position) error
+
+	// Handler handles everything unrelated to replication, EmptyHandler by default.
+	Handler Handler
+}
+
+// BinlogFileHandler is a ReplicationHandler serving the binlog files of a
+// directory, so it can act as a binlog relay for replicas and canal instances.
+//
+// It answers the queries BinlogSyncer sends before requesting a binlog dump,
+// and streams the files starting at the requested position or GTID set,
+// following the rotate events to the next file and waiting for new events at
+// the end of the last one.
+//
+// The handler keeps per-connection state, use one handler per Conn.
+type BinlogFileHandler struct {
+	Handler
+
+	cfg BinlogFileHandlerConfig
+
+	mu              sync.Mutex
+	heartbeatPeriod time.Duration
+	semiSync        bool
+
+	// inTransaction is only used by SemiSyncNeedACK, which is called in order
+	inTransaction bool
+}
+
+// NewBinlogFileHandler creates a handler for a single connection.
+func NewBinlogFileHandler(cfg BinlogFileHandlerConfig) *BinlogFileHandler {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 100 * time.Millisecond
+	}
+
+	h := cfg.Handler
+	if h == nil {
+		h = EmptyHandler{}
+	}
+
+	return &BinlogFileHandler{
+		Handler:         h,
+		cfg:             cfg,
+		heartbeatPeriod: cfg.HeartbeatPeriod,
+	}
+}
+
+// HandleQuery answers the queries of the replication handshake and passes
+// everything else to the wrapped Handler.
+func (h *BinlogFileHandler) HandleQuery(query string) (*mysql.Result, error) {
+	q := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(query), ";"))
+
+	switch {
+	case strings.EqualFold(q, "SHOW GLOBAL VARIABLES LIKE 'BINLOG_CHECKSUM'"):
+		checksum, err := h.binlogChecksum()
+		if err != nil {
+			return nil, err
+		}
+		r, err := mysql.BuildSimpleResultset([]string{"Variable_name", "Value"}, [][]any{
+			{"binlog_checksum", checksum},
+		}, false)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return mysql.NewResult(r), nil
+	case isSemiSyncEnabledQuery(q):
+		enabled := "OFF"
+		if h.cfg.SemiSync {
+			enabled = "ON"
+		}
+		r, err := mysql.BuildSimpleResultset([]string{"Variable_name", "Value"}, [][]any{
+			{"rpl_semi_sync_master_enabled", enabled},
+			{"rpl_semi_sync_source_enabled", enabled},
+		}, false)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return mysql.NewResult(r), nil
+	case len(q) > 4 && strings.EqualFold(q[:4], "SET ") && strings.HasPrefix(strings.TrimSpace(q[4:]), "@"):
+		return nil, h.setUserVariables(q[4:])
+	}
+
+	return h.Handler.HandleQuery(query)
+}
+
+// isSemiSyncEnabledQuery reports whether a replica checks if the source
+// supports semi-sync replication.
+func isSemiSyncEnabledQuery(q string) bool {
+	q = strings.ToLower(q)
+	return strings.HasPrefix(q, "show ") &&
+		(strings.Contains(q, "rpl_semi_sync_master_enabled") || strings.Contains(q, "rpl_semi_sync_source_enabled"))
+}
+
+// setUserVariables accepts the user variables set by replicas and keeps the
+// requested heartbeat period and semi-sync setting.
+func (h *BinlogFileHandler) setUserVariables(assignments string) error {
+	for _, assignment := range strings.Split(assignments, ",") {
+		name, value, ok := strings.Cut(assignment, "=")
+		if !ok {
+			return mysql.NewError(mysql.ER_PARSE_ERROR, fmt.Sprintf("invalid assignment %q", assignment))
+		}
+
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "@master_heartbeat_period", "@source_heartbeat_period":
+			period, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				return mysql.NewError(mysql.ER_WRONG_VALUE_FOR_VAR, fmt.Sprintf("invalid heartbeat period %q", value))
+			}
+			h.mu.Lock()
+			h.heartbeatPeriod = time.Duration(period)
+			h.mu.Unlock()
+		case "@rpl_semi_sync_slave", "@rpl_semi_sync_replica":
+			h.mu.Lock()
+			h.semiSync = h.cfg.SemiSync && strings.TrimSpace(value) != "0"
+			h.mu.Unlock()
+		}
+	}
+	return nil
+}
+
+// binlogChecksum returns the checksum algorithm of the last binlog file.
+func (h *BinlogFileHandler) binlogChecksum() (string, error) {
+	files, err := h.binlogFiles()
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "NONE", nil
+	}
+
+	f, err := os.Open(path.Join(h.cfg.Dir, files[len(files)-1]))
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	defer f.Close()
+
+	_, fde, err := readFormatDescriptionEvent(f)
+	if err != nil {
+		return "", err
+	}
+	if fde.ChecksumAlgorithm == replication.BINLOG_CHECKSUM_ALG_CRC32 {
+		return "CRC32", nil
+	}
+	return "NONE", nil
+}
+
+// SemiSyncEnabled reports whether the replica enabled semi-sync replication,
+// which requires the SemiSync option.
+func (h *BinlogFileHandler) SemiSyncEnabled() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.semiSync
+}
+
+// SemiSyncNeedACK requests an ACK for the last event of every transaction.
+func (h *BinlogFileHandler) SemiSyncNeedACK(e *replication.BinlogEvent) bool {
+	switch e.Header.EventType {
+	case replication.XID_EVENT, replication.TRANSACTION_PAYLOAD_EVENT:
+		h.inTransaction = false
+		return true
+	case replication.QUERY_EVENT:
+		qe, ok := e.Event.(*replication.QueryEvent)
+		if !ok {
+			return false
+		}
+		switch {
+		case bytes.EqualFold(qe.Query, []byte("BEGIN")):
+			h.inTransaction = true
+			return false
+		case bytes.EqualFold(qe.Query, []byte("COMMIT")), bytes.EqualFold(qe.Query, []byte("ROLLBACK")):
+			h.inTransaction = false
+			return true
+		default:
+			// a DDL or a statement outside of a transaction
+			return !h.inTransaction
+		}
+	}
+	return false
+}
+
+// HandleSemiSyncACK passes the acknowledged position to OnSemiSyncACK.
+func (h *BinlogFileHandler) HandleSemiSyncACK(pos mysql.Position) error {
+	if h.cfg.OnSemiSyncACK == nil {
+		return nil
+	}
+	return h.cfg.OnSemiSyncACK(pos)
+}
+
+// HandleRegisterSlave accepts every replica.
+func (h *BinlogFileHandler) HandleRegisterSlave(data []byte) error {
+	return nil
+}
+
+// HandleBinlogDump streams the files starting at pos, or at the first file
+// when pos has no name.
+func (h *BinlogFileHandler) HandleBinlogDump(pos mysql.Position) (*replication.BinlogStreamer, error) {
+	files, err := h.binlogFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	name := pos.Name
+	if name == "" && len(files) > 0 {
+		name = files[0]
+	}
+	if !slices.Contains(files, name) {
+		return nil, mysql.NewError(mysql.ER_MASTER_FATAL_ERROR_READING_BINLOG,
+			"Could not find first log file name in binary log index file")
+	}
+
+	return h.startSender(nil, name, max(pos.Pos, uint32(len(replication.BinLogFileHeader)))), nil
+}
+
+// HandleBinlogDumpGTID streams the files starting at the last one whose
+// PREVIOUS_GTIDS_EVENT is contained in gtidSet, skipping the transactions
+// the replica already has.
+func (h *BinlogFileHandler) HandleBinlogDumpGTID(gtidSet *mysql.MysqlGTIDSet) (*replication.BinlogStreamer, error) {
+	files, err := h.binlogFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(files) - 1; i >= 0; i-- {
+		prev, err := h.previousGTIDs(files[i])
+		if err != nil {
+			return nil, err
+		}
+		if gtidSet.Contain(prev) {
+			return h.startSender(gtidSet, files[i], uint32(len(replication.BinLogFileHeader))), nil
+		}
+	}
+
+	return nil, mysql.NewError(mysql.ER_MASTER_FATAL_ERROR_READING_BINLOG,
+		"Cannot replicate because the binary logs containing GTIDs the replica requires have been purged")
+}
+
+func (h *BinlogFileHandler) startSender(gtidSet *mysql.MysqlGTIDSet, name string, pos uint32) *replication.BinlogStreamer {
+	h.mu.Lock()
+	heartbeatPeriod := h.heartbeatPeriod
+	h.mu.Unlock()
+
+	b := &binlogFileSender{
+		h:               h,
+		s:               replication.NewBinlogStreamer(),
+		gtidSet:         gtidSet,
+		heartbeatPeriod: heartbeatPeriod,
+		checksumAlg:     replication.BINLOG_CHECKSUM_ALG_UNDEF,
+		lastSent:        time.Now(),
+	}
+	go b.run(name, pos)
+
+	return b.s
+}
+
+// binlogFiles returns the binlog file names of the directory in order.
+func (h *BinlogFileHandler) binlogFiles() ([]string, error) {
+	entries, err := os.ReadDir(h.cfg.Dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && binlogFileNameRegexp.MatchString(entry.Name()) {
+			files = append(files, entry.Name())
+		}
+	}
+	// the sequence numbers are zero padded, so the names sort in order
+	slices.Sort(files)
+	return files, nil
+}
+
+// previousGTIDs reads the PREVIOUS_GTIDS_EVENT of a file, files without one
+// are treated as having an empty set.
+func (h *BinlogFileHandler) previousGTIDs(name string) (*mysql.MysqlGTIDSet, error) {
+	f, err := os.Open(path.Join(h.cfg.Dir, name))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer f.Close()
+
+	off, fde, err := readFormatDescriptionEvent(f)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		data, err := readBinlogEvent(f, off)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			break
+		}
+		off += int64(len(data))
+
+		eventType := replication.EventType(data[4])
+		if eventType == replication.PREVIOUS_GTIDS_EVENT {
+			return mysql.DecodeMysqlGTIDSet(eventBody(data, fde.ChecksumAlgorithm))
+		}
+		if eventType == replication.GTID_EVENT || eventType == replication.GTID_TAGGED_LOG_EVENT ||
+			eventType == replication.ANONYMOUS_GTID_EVENT {
+			// the PREVIOUS_GTIDS_EVENT comes before the first transaction
+			break
+		}
+	}
+
+	s := mysql.NewMysqlGTIDSet()
+	return &s, nil
+}
+
+// readFormatDescriptionEvent checks the binlog magic and reads the first
+// event of a file, returning the offset of the following event.
+func readFormatDescriptionEvent(f *os.File) (int64, *replication.FormatDescriptionEvent, error) {
+	magic := make([]byte, len(replication.BinLogFileHeader))
+	if _, err := f.ReadAt(magic, 0); err != nil {
+		return 0, nil, errors.Annotatef(err, "read binlog magic of %s", f.Name())
+	}
+	if !bytes.Equal(magic, replication.BinLogFileHeader) {
+		return 0, nil, errors.Errorf("%s is not a binlog file", f.Name())
+	}
+
+	off := int64(len(magic))
+	data, err := readBinlogEvent(f, off)
+	if err != nil {
+		return 0, nil, err
+	}
+	if data == nil || replication.EventType(data[4]) != replication.FORMAT_DESCRIPTION_EVENT {
+		return 0, nil, errors.Errorf("%s does not start with a FORMAT_DESCRIPTION_EVENT", f.Name())
+	}
+
+	fde := &replication.FormatDescriptionEvent{}
+	if err = fde.Decode(data[replication.EventHeaderSize:]); err != nil {
+		return 0, nil, errors.Trace(err)
+	}
+
+	return off + int64(len(data)), fde, nil
+}
+
+// readBinlogEvent reads the event at off, it returns nil when the file does
+// not hold a complete event there yet.
+func readBinlogEvent(f *os.File, off int64) ([]byte, error) {
+	header := make([]byte, replication.EventHeaderSize)
+	if n, err := f.ReadAt(header, off); err != nil {
+		if err == io.EOF && n < len(header) {
+			return nil, nil
+		}
+		return nil, errors.Trace(err)
+	}
+
+	size := binary.LittleEndian.Uint32(header[9:])
+	if size < replication.EventHeaderSize {
+		return nil, errors.Errorf("invalid event size %d at %s:%d", size, f.Name(), off)
+	}
+
+	data := make([]byte, size)
+	if n, err := f.ReadAt(data, off); err != nil {
+		if err == io.EOF && n < len(data) {
+			return nil, nil
+		}
+		return nil, errors.Trace(err)
+	}
+	return data, nil
+}
+
+// eventBody returns the event without its header and checksum.
+func eventBody(data []byte, checksumAlg replication.BinlogChecksum) []byte {
+	body := data[replication.EventHeaderSize:]
+	if checksumAlg == replication.BINLOG_CHECKSUM_ALG_CRC32 {
+		body = body[:len(body)-replication.BinlogChecksumLength]
+	}
+	return body
+}
+
+// binlogFileSender streams the files of a BinlogFileHandler for one binlog dump.
+type binlogFileSender struct {
+	h *BinlogFileHandler
+	s *replication.BinlogStreamer
+
+	// gtidSet holds the transactions to skip, nil for position based dumps
+	gtidSet *mysql.MysqlGTIDSet
+	skip    bool
+
+	heartbeatPeriod time.Duration
+	// checksumAlg is the algorithm of the last FORMAT_DESCRIPTION_EVENT sent,
+	// which the replica uses for the following events
+	checksumAlg replication.BinlogChecksum
+	lastSent    time.Time
+}
+
+func (b *binlogFileSender) run(name string, pos uint32) {
+	for {
+		next, err := b.sendFile(name, pos)
+		if err != nil {
+			b.s.AddErrorToStreamer(err)
+			return
+		}
+		name, pos = next, uint32(len(replication.BinLogFileHeader))
+	}
+}
+
+// sendFile sends the events of a file starting at pos and returns the name of
+// the next file.
+func (b *binlogFileSender) sendFile(name string, pos uint32) (string, error) {
+	f, err := b.openFile(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// like MySQL, every file starts with an artificial rotate event to tell
+	// the replica the name of the file
+	if err = b.sendArtificialEvent(replication.ROTATE_EVENT, 0, &replication.RotateEvent{
+		Position:    uint64(pos),
+		NextLogName: []byte(name),
+	}); err != nil {
+		return "", err
+	}
+
+	if _, err = b.waitEvent(f, name, int64(len(replication.BinLogFileHeader))); err != nil {
+		return "", err
+	}
+	off, fde, err := readFormatDescriptionEvent(f)
+	if err != nil {
+		return "", err
+	}
+	if err = b.sendFormatDescriptionEvent(f, fde, pos > uint32(len(replication.BinLogFileHeader))); err != nil {
+		return "", err
+	}
+	off = max(off, int64(pos))
+
+	for {
+		data, err := b.waitEvent(f, name, off)
+		if err != nil {
+			return "", err
+		}
+		off += int64(len(data))
+
+		eventType := replication.EventType(data[4])
+		body := eventBody(data, fde.ChecksumAlgorithm)
+		switch eventType {
+		case replication.ROTATE_EVENT:
+			if err = b.send(data, nil); err != nil {
+				return "", err
+			}
+			rotate := &replication.RotateEvent{}
+			if err = rotate.Decode(body); err != nil {
+				return "", errors.Trace(err)
+			}
+			return string(rotate.NextLogName), nil
+		case replication.STOP_EVENT:
+			// the server was shut down, it continues with a new file after restarting
+			if err = b.send(data, nil); err != nil {
+				return "", err
+			}
+			return b.waitNextFile(name)
+		case replication.GTID_EVENT, replication.GTID_TAGGED_LOG_EVENT:
+			if b.gtidSet != nil {
+				if b.skip, err = b.containsGTID(eventType, body); err != nil {
+					return "", err
+				}
+			}
+		case replication.ANONYMOUS_GTID_EVENT:
+			b.skip = false
+		}
+
+		// every event of a transaction the replica already has is skipped
+		if b.skip {
+			continue
+		}
+
+		// the query is needed to find the end of transactions for semi-sync
+		var e replication.Event
+		if eventType == replication.QUERY_EVENT {
+			qe := &replication.QueryEvent{}
+			if err = qe.Decode(body); err != nil {
+				return "", errors.Trace(err)
+			}
+			e = qe
+		}
+		if err = b.send(data, e); err != nil {
+			return "", err
+		}
+	}
+}
+
+func (b *binlogFileSender) containsGTID(eventType replication.EventType, body []byte) (bool, error) {
+	var e *replication.GTIDEvent
+	if eventType == replication.GTID_TAGGED_LOG_EVENT {
+		tagged := &replication.GtidTaggedLogEvent{}
+		if err := tagged.Decode(body); err != nil {
+			return false, errors.Trace(err)
+		}
+		e = &tagged.GTIDEvent
+	} else {
+		e = &replication.GTIDEvent{}
+		if err := e.Decode(body); err != nil {
+			return false, errors.Trace(err)
+		}
+	}
+
+	u, err := uuid.FromBytes(e.SID)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	intervals, ok := (*b.gtidSet)[u][e.Tag]
+	return ok && intervals.Contain(mysql.IntervalSlice{{Start: e.GNO, Stop: e.GNO + 1}}), nil
+}
+
+// openFile waits until the file exists, the file of a rotate event may not
+// be created yet.
+func (b *binlogFileSender) openFile(name string) (*os.File, error) {
+	for {
+		f, err := os.Open(path.Join(b.h.cfg.Dir, name))
+		if err == nil {
+			return f, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, errors.Trace(err)
+		}
+		if err = b.idle(name, 0); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (b *binlogFileSender) waitNextFile(name string) (string, error) {
+	for {
+		files, err := b.h.binlogFiles()
+		if err != nil {
+			return "", err
+		}
+		for _, file := range files {
+			if file > name {
+				return file, nil
+			}
+		}
+		if err = b.idle(name, 0); err != nil {
+			return "", err
+		}
+	}
+}
+
+func (b *binlogFileSender) sendFormatDescriptionEvent(f *os.File, fde *replication.FormatDescriptionEvent, resume bool) error {
+	data, err := readBinlogEvent(f, int64(len(replication.BinLogFileHeader)))
+	if err != nil {
+		return err
+	}
+
+	// like MySQL, a zero log position tells a resuming replica to not
+	// update its position with the FORMAT_DESCRIPTION_EVENT
+	if resume {
+		binary.LittleEndian.PutUint32(data[13:], 0)
+		if fde.ChecksumAlgorithm != replication.BINLOG_CHECKSUM_ALG_UNDEF {
+			checksum := crc32.ChecksumIEEE(data[:len(data)-replication.BinlogChecksumLength])
+			binary.LittleEndian.PutUint32(data[len(data)-replication.BinlogChecksumLength:], checksum)
+		}
+	}
+
+	b.checksumAlg = fde.ChecksumAlgorithm
+	return b.send(data, nil)
+}
+
+// waitEvent returns the next event of the file, waiting for it to be written
+// and sending heartbeats in the meantime.
+func (b *binlogFileSender) waitEvent(f *os.File, name string, off int64) ([]byte, error) {
+	for {
+		data, err := readBinlogEvent(f, off)
+		if err != nil || data != nil {
+			return data, err
+		}
+		if err = b.idle(name, off); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// idle waits for the poll interval and sends a heartbeat when the replica
+// has not received anything for the heartbeat period. It fails once the
+// replica is gone.
+func (b *binlogFileSender) idle(name string, off int64) error {
+	select {
+	case <-b.s.Done():
+		return errors.Trace(replication.ErrSyncClosed)
+	case <-time.After(b.h.cfg.PollInterval):
+	}
+
+	if b.heartbeatPeriod <= 0 || time.Since(b.lastSent) < b.heartbeatPeriod {
+		return nil
+	}
+
+	return b.sendArtificialEvent(replication.HEARTBEAT_EVENT, uint32(off), &replication.HeartbeatEvent{
+		Version:  1,
+		Filename: name,
+	})
+}
+
+func (b *binlogFileSender) sendArtificialEvent(eventType replication.EventType, logPos uint32, e replication.Event) error {
+	h := &replication.EventHeader{
+		EventType: eventType,
+		ServerID:  b.h.cfg.ServerID,
+		LogPos:    logPos,
+		Flags:     replication.LOG_EVENT_ARTIFICIAL_F,
+	}
+	data, err := replication.EncodeEvent(h, e, b.checksumAlg)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return b.send(data, nil)
+}
+
+func (b *binlogFileSender) send(data []byte, e replication.Event) error {
+	h := &replication.EventHeader{}
+	if err := h.Decode(data); err != nil {
+		return errors.Trace(err)
+	}
+
+	b.lastSent = time.Now()
+	return b.s.AddEventToStreamer(&replication.BinlogEvent{RawData: data, Header: h, Event: e})
+}
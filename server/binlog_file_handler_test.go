@@ -0,0 +1,247 @@
+package server
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/stretchr/testify/require"
+)
+
+var testBinlogSID = []byte{0x3e, 0x11, 0xfa, 0x47, 0x71, 0xca, 0x11, 0xe1, 0x9e, 0x33, 0xc8, 0x0a, 0xa9, 0x42, 0x95, 0x62}
+
+func writeTestBinlogTransaction(t *testing.T, w *replication.BinlogWriter, gno int64) {
+	t.Helper()
+
+	events := []*replication.BinlogEvent{
+		{Header: &replication.EventHeader{EventType: replication.GTID_EVENT, ServerID: 1}, Event: &replication.GTIDEvent{CommitFlag: 1, SID: testBinlogSID, GNO: gno}},
+		{Header: &replication.EventHeader{EventType: replication.QUERY_EVENT, ServerID: 1}, Event: &replication.QueryEvent{Schema: []byte("test"), Query: []byte("BEGIN")}},
+		{Header: &replication.EventHeader{EventType: replication.XID_EVENT, ServerID: 1}, Event: &replication.XIDEvent{XID: uint64(gno)}},
+	}
+	for _, e := range events {
+		require.NoError(t, w.WriteEvent(e))
+	}
+	require.NoError(t, w.Flush())
+}
+
+func newTestBinlogFiles(t *testing.T) (string, *replication.BinlogWriter) {
+	t.Helper()
+
+	gset, err := mysql.ParseMysqlGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-10")
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	w, err := replication.NewBinlogWriter(replication.BinlogWriterConfig{
+		Dir:               dir,
+		ServerID:          1,
+		ChecksumAlgorithm: replication.BINLOG_CHECKSUM_ALG_CRC32,
+		MaxFileSize:       400,
+		GTIDSet:           gset,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = w.Close() })
+
+	for gno := int64(11); gno <= 15; gno++ {
+		writeTestBinlogTransaction(t, w, gno)
+	}
+	return dir, w
+}
+
+func newTestBinlogSyncer(t *testing.T, cfg BinlogFileHandlerConfig, semiSync bool) *replication.BinlogSyncer {
+	t.Helper()
+
+	host, port := newTestBinlogServer(t, cfg)
+	b := replication.NewBinlogSyncer(replication.BinlogSyncerConfig{
+		ServerID:        100,
+		Flavor:          mysql.MySQLFlavor,
+		Host:            host,
+		Port:            port,
+		User:            "root",
+		HeartbeatPeriod: 100 * time.Millisecond,
+		SemiSyncEnabled: semiSync,
+	})
+	t.Cleanup(b.Close)
+	return b
+}
+
+// newTestBinlogServer serves the binlog files with a BinlogFileHandler per
+// connection and returns its address.
+func newTestBinlogServer(t *testing.T, cfg BinlogFileHandlerConfig) (string, uint16) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				h := NewBinlogFileHandler(cfg)
+				co, err := NewDefaultServer().NewConn(conn, "root", "", h)
+				if err != nil {
+					return
+				}
+				//nolint:revive // loop drains commands; work is in the condition
+				for co.HandleCommand() == nil {
+				}
+			}()
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(l.Addr().String())
+	require.NoError(t, err)
+	portNum, err := strconv.Atoi(port)
+	require.NoError(t, err)
+	return host, uint16(portNum)
+}
+
+// nextXID returns the XID of the next transaction in the stream, and
+// whether a heartbeat was received before it.
+func nextXID(t *testing.T, s *replication.BinlogStreamer) (uint64, bool) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	heartbeat := false
+	for {
+		e, err := s.GetEvent(ctx)
+		require.NoError(t, err)
+		switch ev := e.Event.(type) {
+		case *replication.XIDEvent:
+			return ev.XID, heartbeat
+		case *replication.HeartbeatEvent:
+			heartbeat = true
+		}
+	}
+}
+
+func TestBinlogFileHandlerDump(t *testing.T) {
+	dir, w := newTestBinlogFiles(t)
+	b := newTestBinlogSyncer(t, BinlogFileHandlerConfig{Dir: dir, ServerID: 1, PollInterval: 10 * time.Millisecond}, false)
+
+	s, err := b.StartSync(mysql.Position{Name: "mysql-bin.000001", Pos: 4})
+	require.NoError(t, err)
+
+	for gno := uint64(11); gno <= 15; gno++ {
+		xid, _ := nextXID(t, s)
+		require.Equal(t, gno, xid)
+	}
+
+	// events appended later are streamed too, heartbeats are sent meanwhile
+	time.Sleep(300 * time.Millisecond)
+	writeTestBinlogTransaction(t, w, 16)
+	xid, heartbeat := nextXID(t, s)
+	require.Equal(t, uint64(16), xid)
+	require.True(t, heartbeat)
+}
+
+func TestBinlogFileHandlerReplicaGone(t *testing.T) {
+	dir, _ := newTestBinlogFiles(t)
+	host, port := newTestBinlogServer(t, BinlogFileHandlerConfig{Dir: dir, ServerID: 1, PollInterval: 10 * time.Millisecond})
+
+	senderRunning := func() bool {
+		buf := make([]byte, 1<<20)
+		return strings.Contains(string(buf[:runtime.Stack(buf, true)]), "(*binlogFileSender).run")
+	}
+
+	// without heartbeats, nothing is written to the replica while the file
+	// is idle
+	b := replication.NewBinlogSyncer(replication.BinlogSyncerConfig{
+		ServerID: 100,
+		Flavor:   mysql.MySQLFlavor,
+		Host:     host,
+		Port:     port,
+		User:     "root",
+	})
+	s, err := b.StartSync(mysql.Position{Name: "mysql-bin.000001", Pos: 4})
+	require.NoError(t, err)
+	for gno := uint64(11); gno <= 15; gno++ {
+		xid, _ := nextXID(t, s)
+		require.Equal(t, gno, xid)
+	}
+	require.True(t, senderRunning())
+
+	b.Close()
+	require.Eventually(t, func() bool { return !senderRunning() }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestBinlogFileHandlerDumpGTID(t *testing.T) {
+	dir, _ := newTestBinlogFiles(t)
+	b := newTestBinlogSyncer(t, BinlogFileHandlerConfig{Dir: dir, ServerID: 1, PollInterval: 10 * time.Millisecond}, false)
+
+	gset, err := mysql.ParseMysqlGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-13")
+	require.NoError(t, err)
+	s, err := b.StartSyncGTID(gset)
+	require.NoError(t, err)
+
+	for gno := uint64(14); gno <= 15; gno++ {
+		xid, _ := nextXID(t, s)
+		require.Equal(t, gno, xid)
+	}
+}
+
+func TestBinlogFileHandlerPurged(t *testing.T) {
+	dir, _ := newTestBinlogFiles(t)
+	h := NewBinlogFileHandler(BinlogFileHandlerConfig{Dir: dir})
+
+	gset, err := mysql.ParseMysqlGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5")
+	require.NoError(t, err)
+	_, err = h.HandleBinlogDumpGTID(gset.(*mysql.MysqlGTIDSet))
+	require.ErrorContains(t, err, "purged")
+
+	_, err = h.HandleBinlogDump(mysql.Position{Name: "mysql-bin.000099", Pos: 4})
+	require.Error(t, err)
+}
+
+func TestBinlogFileHandlerSemiSync(t *testing.T) {
+	dir, _ := newTestBinlogFiles(t)
+
+	acks := make(chan mysql.Position, 10)
+	b := newTestBinlogSyncer(t, BinlogFileHandlerConfig{
+		Dir:          dir,
+		ServerID:     1,
+		PollInterval: 10 * time.Millisecond,
+		SemiSync:     true,
+		OnSemiSyncACK: func(pos mysql.Position) error {
+			acks <- pos
+			return nil
+		},
+	}, true)
+
+	s, err := b.StartSync(mysql.Position{Name: "mysql-bin.000001", Pos: 4})
+	require.NoError(t, err)
+
+	// every transaction is acknowledged with the position after its XID_EVENT
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	name := "mysql-bin.000001"
+	for gno := uint64(11); gno <= 15; {
+		e, err := s.GetEvent(ctx)
+		require.NoError(t, err)
+		switch ev := e.Event.(type) {
+		case *replication.RotateEvent:
+			name = string(ev.NextLogName)
+		case *replication.XIDEvent:
+			require.Equal(t, gno, ev.XID)
+			select {
+			case ack := <-acks:
+				require.Equal(t, mysql.Position{Name: name, Pos: e.Header.LogPos}, ack)
+			case <-ctx.Done():
+				require.FailNow(t, "no ACK received")
+			}
+			gno++
+		}
+	}
+	require.Empty(t, acks)
+}
@@ -42,6 +42,23 @@ type ReplicationHandler interface {
 	HandleBinlogDumpGTID(gtidSet *mysql.MysqlGTIDSet) (*replication.BinlogStreamer, error)
 }
 
+// SemiSyncReplicationHandler is for replication handlers that want to act as a semi-sync source.
+// When SemiSyncEnabled returns true at the start of a binlog dump, every event is sent with the
+// semi-sync header and the ACKs of the replica are passed to HandleSemiSyncACK.
+// Semi-sync is not used on connections with protocol compression.
+type SemiSyncReplicationHandler interface {
+	ReplicationHandler
+	// SemiSyncEnabled reports whether the replica enabled semi-sync, usually
+	// with SET @rpl_semi_sync_slave = 1 or SET @rpl_semi_sync_replica = 1
+	SemiSyncEnabled() bool
+	// SemiSyncNeedACK reports whether the replica has to acknowledge the event,
+	// it is called for every event in order
+	SemiSyncNeedACK(e *replication.BinlogEvent) bool
+	// HandleSemiSyncACK is called with the position of every ACK received,
+	// an error stops the binlog dump
+	HandleSemiSyncACK(pos mysql.Position) error
+}
+
 // HandleCommand is handling commands received by the server
 // https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_command_phase.html
 func (c *Conn) HandleCommand() error {
@@ -158,6 +175,9 @@ func (c *Conn) dispatch(data []byte) any {
 		return c.h.HandleOtherCommand(cmd, data)
 	case mysql.COM_BINLOG_DUMP:
 		if h, ok := c.h.(ReplicationHandler); ok {
+			if err := c.checkBinlogDumpCompression(); err != nil {
+				return err
+			}
 			pos, err := parseBinlogDump(data)
 			if err != nil {
 				return err
@@ -171,6 +191,9 @@ func (c *Conn) dispatch(data []byte) any {
 		return c.h.HandleOtherCommand(cmd, data)
 	case mysql.COM_BINLOG_DUMP_GTID:
 		if h, ok := c.h.(ReplicationHandler); ok {
+			if err := c.checkBinlogDumpCompression(); err != nil {
+				return err
+			}
 			gtidSet, err := parseBinlogDumpGTID(data)
 			if err != nil {
 				return err
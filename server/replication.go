@@ -2,8 +2,10 @@ package server
 
 import (
 	"encoding/binary"
+	"io"
 
 	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
 )
 
 func parseBinlogDump(data []byte) (mysql.Position, error) {
@@ -48,3 +50,70 @@ func parseBinlogDumpGTID(data []byte) (*mysql.MysqlGTIDSet, error) {
 	// parse GTID set
 	return mysql.DecodeMysqlGTIDSet(data[pos : pos+dataSize])
 }
+
+// checkBinlogDumpCompression rejects the binlog dumps of compressed
+// connections: the replies of the replica are read without the packet layer,
+// see readSemiSyncACKs.
+func (c *Conn) checkBinlogDumpCompression() error {
+	if c.Compression != mysql.MYSQL_COMPRESS_NONE {
+		return mysql.NewError(mysql.ER_MASTER_FATAL_ERROR_READING_BINLOG, "binlog dump is not supported with the compressed protocol")
+	}
+	return nil
+}
+
+// readSemiSyncACKs passes the ACKs of a semi-sync replica to the handler until
+// the connection is closed. The replica sends nothing else once the binlog dump
+// started, so the packets are read from the reader of the connection without
+// ReadPacket and the sequence numbers used by the events being written
+// concurrently.
+func (c *Conn) readSemiSyncACKs(h SemiSyncReplicationHandler, s *replication.BinlogStreamer) {
+	r := c.Conn.Reader()
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			s.AddErrorToStreamer(err)
+			return
+		}
+
+		data := make([]byte, int(uint32(header[0])|uint32(header[1])<<8|uint32(header[2])<<16))
+		if _, err := io.ReadFull(r, data); err != nil {
+			s.AddErrorToStreamer(err)
+			return
+		}
+
+		pos, err := parseSemiSyncACK(data)
+		if err == nil {
+			err = h.HandleSemiSyncACK(pos)
+		}
+		if err != nil {
+			s.AddErrorToStreamer(err)
+			return
+		}
+	}
+}
+
+// waitReplicaClose ends the binlog dump when the connection is closed, even
+// while no event is written. The replica sends nothing once the binlog dump
+// started.
+func (c *Conn) waitReplicaClose(s *replication.BinlogStreamer) {
+	r := c.Conn.Reader()
+	buf := make([]byte, 1024)
+	for {
+		if _, err := r.Read(buf); err != nil {
+			s.AddErrorToStreamer(err)
+			return
+		}
+	}
+}
+
+func parseSemiSyncACK(data []byte) (mysql.Position, error) {
+	if len(data) < 9 || data[0] != replication.SemiSyncIndicator {
+		return mysql.Position{}, mysql.ErrMalformPacket
+	}
+
+	var p mysql.Position
+	p.Pos = uint32(binary.LittleEndian.Uint64(data[1:9]))
+	p.Name = string(data[9:])
+
+	return p, nil
+}
@@ -5,6 +5,8 @@ import (
 	"testing"
 
 	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/packet"
+	"github.com/go-mysql-org/go-mysql/replication"
 	"github.com/stretchr/testify/require"
 )
 
@@ -152,3 +154,59 @@ func TestParseBinlogDump(t *testing.T) {
 		})
 	}
 }
+
+func TestParseSemiSyncACK(t *testing.T) {
+	data := []byte{0xef}
+	data = binary.LittleEndian.AppendUint64(data, 1234)
+	data = append(data, "mysql-bin.000002"...)
+
+	pos, err := parseSemiSyncACK(data)
+	require.NoError(t, err)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000002", Pos: 1234}, pos)
+
+	_, err = parseSemiSyncACK(data[:5])
+	require.ErrorIs(t, err, mysql.ErrMalformPacket)
+
+	data[0] = 0x00
+	_, err = parseSemiSyncACK(data)
+	require.ErrorIs(t, err, mysql.ErrMalformPacket)
+}
+
+type dumpTestHandler struct {
+	EmptyHandler
+	dumps int
+}
+
+func (h *dumpTestHandler) HandleRegisterSlave([]byte) error {
+	return nil
+}
+
+func (h *dumpTestHandler) HandleBinlogDump(mysql.Position) (*replication.BinlogStreamer, error) {
+	h.dumps++
+	return replication.NewBinlogStreamer(), nil
+}
+
+func (h *dumpTestHandler) HandleBinlogDumpGTID(*mysql.MysqlGTIDSet) (*replication.BinlogStreamer, error) {
+	h.dumps++
+	return replication.NewBinlogStreamer(), nil
+}
+
+func TestBinlogDumpCompressed(t *testing.T) {
+	h := &dumpTestHandler{}
+	c := &Conn{Conn: &packet.Conn{Compression: mysql.MYSQL_COMPRESS_ZLIB}, h: h}
+
+	dump := binary.LittleEndian.AppendUint32([]byte{mysql.COM_BINLOG_DUMP}, 4)
+	dump = append(dump, make([]byte, 6)...)
+	dump = append(dump, "mysql-bin.000001"...)
+	for _, data := range [][]byte{dump, {mysql.COM_BINLOG_DUMP_GTID}} {
+		err, ok := c.dispatch(data).(*mysql.MyError)
+		require.True(t, ok)
+		require.Equal(t, uint16(mysql.ER_MASTER_FATAL_ERROR_READING_BINLOG), err.Code)
+	}
+	require.Zero(t, h.dumps)
+
+	c.Compression = mysql.MYSQL_COMPRESS_NONE
+	_, ok := c.dispatch(dump).(*replication.BinlogStreamer)
+	require.True(t, ok)
+	require.Equal(t, 1, h.dumps)
+}
@@ -351,24 +351,57 @@ func (c *Conn) writeFieldValues(fv []mysql.FieldValue) error {
 }
 
 // see: https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_replication.html
-func (c *Conn) writeBinlogEvents(s *replication.BinlogStreamer) error {
+func (c *Conn) writeBinlogEvents(s *replication.BinlogStreamer) (err error) {
+	// Stop the producer of the events and the ACK reader once the dump ends,
+	// the replica is gone.
+	defer func() {
+		s.AddErrorToStreamer(err)
+		s.Close()
+	}()
+
+	semiSync, ok := c.h.(SemiSyncReplicationHandler)
+	if !ok || !semiSync.SemiSyncEnabled() {
+		semiSync = nil
+	}
+	if semiSync != nil {
+		go c.readSemiSyncACKs(semiSync, s)
+	} else {
+		go c.waitReplicaClose(s)
+	}
+
 	for {
 		ev, err := s.GetEvent(context.Background())
 		if err != nil {
 			return err
 		}
-		data := make([]byte, 4, 4+len(ev.RawData))
+		data := make([]byte, 4, 4+3+len(ev.RawData))
 		data = append(data, mysql.OK_HEADER)
 
+		needACK := false
+		if semiSync != nil {
+			needACK = semiSync.SemiSyncNeedACK(ev)
+			flag := byte(0x00)
+			if needACK {
+				flag = 0x01
+			}
+			data = append(data, replication.SemiSyncIndicator, flag)
+		}
+
 		data = append(data, ev.RawData...)
-		if err := c.WritePacket(data); err != nil {
-			return err
+		err = c.WritePacket(data)
+		if err == nil {
+			// Deliver each event immediately (heartbeat/semi-sync timing); GetEvent
+			// may block indefinitely.
+			err = c.Flush()
 		}
-		// Deliver each event immediately (heartbeat/semi-sync timing); GetEvent
-		// may block indefinitely.
-		if err := c.Flush(); err != nil {
+		if err != nil {
 			return err
 		}
+		if needACK {
+			// Like MySQL, continue after the ACK packet of the replica, which
+			// restarts the sequence at 0.
+			c.Sequence = 1
+		}
 	}
 }
 